@@ -0,0 +1,59 @@
+// Command chirpy-admin promotes an existing user to admin, it's how the first
+// admin is created since only admins can change roles through the API.
+//
+//	go run ./cmd/chirpy-admin -email admin@example.com
+//
+// It refuses to run when there is already an admin unless -force is set.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"os"
+
+	_ "github.com/joho/godotenv/autoload"
+	_ "github.com/lib/pq"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/auth"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/database"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/logging"
+)
+
+func main() {
+	email := flag.String("email", "", "email of the user to promote to admin")
+	force := flag.Bool("force", false, "promote the user even if there is already an admin")
+	flag.Parse()
+
+	if *email == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	dbURL := os.Getenv("DB_URL")
+	if dbURL == "" {
+		logging.Fatalf("DB_URL must be set")
+	}
+	db, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		logging.Fatalf("db connection failed with err: %v", err)
+	}
+	defer db.Close()
+	dbQueries := database.New(db)
+	ctx := context.Background()
+
+	admins, err := dbQueries.CountUsersWithRole(ctx, string(auth.RoleAdmin))
+	if err != nil {
+		logging.Fatalf("failed to count admins with err: %v", err)
+	}
+	if admins > 0 && !*force {
+		logging.Fatalf("there are already %d admins, use the API or -force", admins)
+	}
+
+	user, err := dbQueries.SetUserRoleByEmail(ctx, database.SetUserRoleByEmailParams{
+		Email: *email,
+		Role:  string(auth.RoleAdmin),
+	})
+	if err != nil {
+		logging.Fatalf("failed to promote %s with err: %v", *email, err)
+	}
+	logging.LogInfo("user promoted to admin", "user_id", user.ID)
+}
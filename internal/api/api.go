@@ -0,0 +1,178 @@
+// Package api has the JSON payloads returned by the Chirpy endpoints and the
+// mappers from the database models to them.
+//
+// Handlers should never return the database models directly, every field
+// returned is listed here so a new column (like hashed_password) is never
+// exposed by accident.
+package api
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/database"
+)
+
+// Format "t" as RFC 3339 in UTC, the format of every timestamp we return.
+func Timestamp(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// Same as [Timestamp] but NULL times are a JSON null.
+func NullTimestamp(t sql.NullTime) *string {
+	if !t.Valid {
+		return nil
+	}
+	timestamp := Timestamp(t.Time)
+	return &timestamp
+}
+
+func nullString(s sql.NullString) *string {
+	if !s.Valid {
+		return nil
+	}
+	return &s.String
+}
+
+// User is the private view of an user, only returned to the user itself.
+type User struct {
+	ID               string  `json:"id"`
+	CreatedAt        string  `json:"created_at"`
+	UpdatedAt        string  `json:"updated_at"`
+	Email            string  `json:"email"`
+	EmailVerified    bool    `json:"email_verified"`
+	IsChirpyRed      bool    `json:"is_chirpy_red"`
+	Role             string  `json:"role"`
+	TwoFactorEnabled bool    `json:"two_factor_enabled"`
+	Username         *string `json:"username"`
+	DisplayName      string  `json:"display_name"`
+	Bio              string  `json:"bio"`
+	Avatar           string  `json:"avatar"`
+}
+
+func NewUser(user database.User) User {
+	return User{
+		ID:               user.ID.String(),
+		CreatedAt:        Timestamp(user.CreatedAt),
+		UpdatedAt:        Timestamp(user.UpdatedAt),
+		Email:            user.Email,
+		EmailVerified:    user.EmailVerifiedAt.Valid,
+		IsChirpyRed:      user.IsChirpyRed,
+		Role:             user.Role,
+		TwoFactorEnabled: user.TotpEnabledAt.Valid,
+		Username:         nullString(user.Username),
+		DisplayName:      user.DisplayName,
+		Bio:              user.Bio,
+		Avatar:           user.Avatar,
+	}
+}
+
+// Session is the response of every way of logging in.
+type Session struct {
+	User
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+func NewSession(user database.User, token, refreshToken string) Session {
+	return Session{
+		User:         NewUser(user),
+		Token:        token,
+		RefreshToken: refreshToken,
+	}
+}
+
+// Profile is the public view of an user.
+type Profile struct {
+	ID             string `json:"id"`
+	CreatedAt      string `json:"created_at"`
+	Username       string `json:"username"`
+	DisplayName    string `json:"display_name"`
+	Bio            string `json:"bio"`
+	Avatar         string `json:"avatar"`
+	IsChirpyRed    bool   `json:"is_chirpy_red"`
+	ChirpCount     int64  `json:"chirp_count"`
+	FollowerCount  int64  `json:"follower_count"`
+	FollowingCount int64  `json:"following_count"`
+}
+
+func NewProfile(profile database.GetUserProfileByUsernameRow) Profile {
+	return Profile{
+		ID:             profile.ID.String(),
+		CreatedAt:      Timestamp(profile.CreatedAt),
+		Username:       profile.Username.String,
+		DisplayName:    profile.DisplayName,
+		Bio:            profile.Bio,
+		Avatar:         profile.Avatar,
+		IsChirpyRed:    profile.IsChirpyRed,
+		ChirpCount:     profile.ChirpCount,
+		FollowerCount:  profile.FollowerCount,
+		FollowingCount: profile.FollowingCount,
+	}
+}
+
+// ChirpAuthor is the compact public profile embedded on every chirp.
+type ChirpAuthor struct {
+	ID          string  `json:"id"`
+	Username    *string `json:"username"`
+	DisplayName string  `json:"display_name"`
+	Avatar      string  `json:"avatar"`
+}
+
+type Chirp struct {
+	ID        string      `json:"id"`
+	CreatedAt string      `json:"created_at"`
+	UpdatedAt string      `json:"updated_at"`
+	Body      string      `json:"body"`
+	UserID    string      `json:"user_id"`
+	Author    ChirpAuthor `json:"author"`
+}
+
+func NewChirp(chirp database.ChirpsWithAuthor) Chirp {
+	return Chirp{
+		ID:        chirp.ID.String(),
+		CreatedAt: Timestamp(chirp.CreatedAt),
+		UpdatedAt: Timestamp(chirp.UpdatedAt),
+		Body:      chirp.Body,
+		UserID:    chirp.UserID.String(),
+		Author: ChirpAuthor{
+			ID:          chirp.UserID.String(),
+			Username:    nullString(chirp.AuthorUsername),
+			DisplayName: chirp.AuthorDisplayName,
+			Avatar:      chirp.AuthorAvatar,
+		},
+	}
+}
+
+// Always a JSON list, even without chirps.
+func NewChirps(chirps []database.ChirpsWithAuthor) []Chirp {
+	responses := make([]Chirp, len(chirps))
+	for i, chirp := range chirps {
+		responses[i] = NewChirp(chirp)
+	}
+	return responses
+}
+
+// Map a chirp that was just created, and so doesn't come from the
+// chirps_with_authors view, with its "author".
+func NewCreatedChirp(chirp database.Chirp, author database.User) Chirp {
+	return NewChirp(database.ChirpsWithAuthor{
+		ID:                chirp.ID,
+		CreatedAt:         chirp.CreatedAt,
+		UpdatedAt:         chirp.UpdatedAt,
+		Body:              chirp.Body,
+		UserID:            chirp.UserID,
+		AuthorUsername:    author.Username,
+		AuthorDisplayName: author.DisplayName,
+		AuthorAvatar:      author.Avatar,
+	})
+}
+
+// AccountDeletion is returned when an account is scheduled to be purged.
+type AccountDeletion struct {
+	PurgeAfter string `json:"purge_after"`
+}
+
+func NewAccountDeletion(purgeAfter time.Time) AccountDeletion {
+	return AccountDeletion{PurgeAfter: Timestamp(purgeAfter)}
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/database"
+)
+
+func jsonKeys(t *testing.T, v any) []string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("failed to marshal: %s", err)
+	}
+	fields := map[string]any{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatalf("failed to unmarshal: %s", err)
+	}
+	keys := []string{}
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestUserOnlyHasExplicitFields(t *testing.T) {
+	user := database.User{
+		ID:             uuid.New(),
+		CreatedAt:      time.Now(),
+		UpdatedAt:      time.Now(),
+		Email:          "bob@example.com",
+		HashedPassword: "$argon2id$secret",
+		TotpSecret:     []byte("secret"),
+	}
+	expected := []string{
+		"avatar",
+		"bio",
+		"created_at",
+		"display_name",
+		"email",
+		"email_verified",
+		"id",
+		"is_chirpy_red",
+		"role",
+		"two_factor_enabled",
+		"updated_at",
+		"username",
+	}
+	if keys := jsonKeys(t, NewUser(user)); !reflect.DeepEqual(keys, expected) {
+		t.Errorf("NewUser JSON has keys %v expected %v", keys, expected)
+	}
+}
+
+func TestTimestampsAreRFC3339InUTC(t *testing.T) {
+	location := time.FixedZone("BRT", -3*60*60)
+	createdAt := time.Date(2025, 8, 21, 9, 30, 15, 123456789, location)
+	if timestamp := Timestamp(createdAt); timestamp != "2025-08-21T12:30:15Z" {
+		t.Errorf("Timestamp returned %s", timestamp)
+	}
+	if timestamp := NullTimestamp(sql.NullTime{}); timestamp != nil {
+		t.Errorf("NullTimestamp returned %s for a NULL time", *timestamp)
+	}
+}
+
+func TestNewChirpsIsNeverNull(t *testing.T) {
+	data, err := json.Marshal(NewChirps(nil))
+	if err != nil || string(data) != "[]" {
+		t.Errorf("NewChirps(nil) marshaled to %s err: %v", data, err)
+	}
+}
@@ -0,0 +1,18 @@
+package api
+
+import "github.com/luigiMinardi/bootdotdev-chirpy/internal/entitlements"
+
+// Entitlements are the limits of the plan of the user by feature, -1 is no
+// limit and 0 is not allowed.
+type Entitlements struct {
+	Plan   string         `json:"plan"`
+	Limits map[string]int `json:"limits"`
+}
+
+func NewEntitlements(plan string, limits entitlements.Limits) Entitlements {
+	response := Entitlements{Plan: plan, Limits: map[string]int{}}
+	for feature, limit := range limits {
+		response.Limits[string(feature)] = limit
+	}
+	return response
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"time"
+
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/database"
+)
+
+// Export is every piece of data we keep from an user, returned by
+// GET /api/users/export. Secrets like the password hash, tokens and the TOTP
+// secret are left out.
+type Export struct {
+	ExportedAt string          `json:"exported_at"`
+	Profile    ExportProfile   `json:"profile"`
+	Chirps     []Chirp         `json:"chirps"`
+	Sessions   []ExportSession `json:"sessions"`
+	Billing    ExportBilling   `json:"billing"`
+}
+
+// ExportProfile is the private view of the user with the dates of when the
+// email was verified and 2FA was turned on.
+type ExportProfile struct {
+	User
+	EmailVerifiedAt    *string `json:"email_verified_at"`
+	TwoFactorEnabledAt *string `json:"two_factor_enabled_at"`
+}
+
+// ExportSession is a refresh token without the token itself.
+type ExportSession struct {
+	CreatedAt string  `json:"created_at"`
+	ExpiresAt string  `json:"expires_at"`
+	RevokedAt *string `json:"revoked_at"`
+}
+
+// ExportBilling has every Chirpy Red subscription of the user, live or not.
+type ExportBilling struct {
+	IsChirpyRed   bool           `json:"is_chirpy_red"`
+	Subscriptions []Subscription `json:"subscriptions"`
+}
+
+func NewExport(user database.User, chirps []database.ChirpsWithAuthor, refreshTokens []database.RefreshToken, subscriptions []database.Subscription, exportedAt time.Time) Export {
+	sessions := make([]ExportSession, len(refreshTokens))
+	for i, refreshToken := range refreshTokens {
+		sessions[i] = ExportSession{
+			CreatedAt: Timestamp(refreshToken.CreatedAt),
+			ExpiresAt: Timestamp(refreshToken.ExpiresAt),
+			RevokedAt: NullTimestamp(refreshToken.RevokedAt),
+		}
+	}
+	return Export{
+		ExportedAt: Timestamp(exportedAt),
+		Profile: ExportProfile{
+			User:               NewUser(user),
+			EmailVerifiedAt:    NullTimestamp(user.EmailVerifiedAt),
+			TwoFactorEnabledAt: NullTimestamp(user.TotpEnabledAt),
+		},
+		Chirps:   NewChirps(chirps),
+		Sessions: sessions,
+		Billing: ExportBilling{
+			IsChirpyRed:   user.IsChirpyRed,
+			Subscriptions: NewSubscriptions(subscriptions),
+		},
+	}
+}
@@ -0,0 +1,49 @@
+package api
+
+import "github.com/luigiMinardi/bootdotdev-chirpy/internal/database"
+
+// OAuthClient is a third-party app registered by the user, without its
+// secret.
+type OAuthClient struct {
+	ID           string   `json:"client_id"`
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Scopes       []string `json:"scopes"`
+	Public       bool     `json:"public"`
+	CreatedAt    string   `json:"created_at"`
+}
+
+func NewOAuthClient(client database.OauthClient) OAuthClient {
+	return OAuthClient{
+		ID:           client.ID,
+		Name:         client.Name,
+		RedirectURIs: client.RedirectUris,
+		Scopes:       client.Scopes,
+		Public:       !client.SecretHash.Valid,
+		CreatedAt:    Timestamp(client.CreatedAt),
+	}
+}
+
+// Always a JSON list, even without clients.
+func NewOAuthClients(clients []database.OauthClient) []OAuthClient {
+	responses := make([]OAuthClient, len(clients))
+	for i, client := range clients {
+		responses[i] = NewOAuthClient(client)
+	}
+	return responses
+}
+
+// CreatedOAuthClient is the response of registering a client, the only time
+// the secret is shown. Public clients have no secret.
+type CreatedOAuthClient struct {
+	OAuthClient
+	Secret *string `json:"client_secret"`
+}
+
+func NewCreatedOAuthClient(client database.OauthClient, secret string) CreatedOAuthClient {
+	created := CreatedOAuthClient{OAuthClient: NewOAuthClient(client)}
+	if secret != "" {
+		created.Secret = &secret
+	}
+	return created
+}
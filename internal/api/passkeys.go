@@ -0,0 +1,54 @@
+package api
+
+import (
+	"encoding/base64"
+
+	"github.com/google/uuid"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/database"
+)
+
+// Passkey is a registered passkey without its public key, the id is the
+// base64url credential id also used on DELETE /api/passkeys/{passkeyID}.
+type Passkey struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	Transports []string `json:"transports"`
+	Synced     bool     `json:"synced"`
+	CreatedAt  string   `json:"created_at"`
+	LastUsedAt *string  `json:"last_used_at"`
+}
+
+func NewPasskey(passkey database.Passkey) Passkey {
+	return Passkey{
+		ID:         base64.RawURLEncoding.EncodeToString(passkey.ID),
+		Name:       passkey.Name,
+		Transports: passkey.Transports,
+		Synced:     passkey.BackupState,
+		CreatedAt:  Timestamp(passkey.CreatedAt),
+		LastUsedAt: NullTimestamp(passkey.LastUsedAt),
+	}
+}
+
+// Always a JSON list, even without passkeys.
+func NewPasskeys(passkeys []database.Passkey) []Passkey {
+	responses := make([]Passkey, len(passkeys))
+	for i, passkey := range passkeys {
+		responses[i] = NewPasskey(passkey)
+	}
+	return responses
+}
+
+// PasskeyChallenge starts a registration or a login, "options" are given to
+// navigator.credentials.create() or get() and the answer is sent back with
+// the session id.
+type PasskeyChallenge struct {
+	SessionID string `json:"session_id"`
+	Options   any    `json:"options"`
+}
+
+func NewPasskeyChallenge(sessionID uuid.UUID, options any) PasskeyChallenge {
+	return PasskeyChallenge{
+		SessionID: sessionID.String(),
+		Options:   options,
+	}
+}
@@ -0,0 +1,36 @@
+package api
+
+import "github.com/luigiMinardi/bootdotdev-chirpy/internal/database"
+
+// Subscription is a Chirpy Red subscription, "grace_until" is only set while
+// it's past due.
+type Subscription struct {
+	ID               string  `json:"id"`
+	Plan             string  `json:"plan"`
+	Status           string  `json:"status"`
+	StartedAt        string  `json:"started_at"`
+	CurrentPeriodEnd string  `json:"current_period_end"`
+	GraceUntil       *string `json:"grace_until"`
+	EndedAt          *string `json:"ended_at"`
+}
+
+func NewSubscription(subscription database.Subscription) Subscription {
+	return Subscription{
+		ID:               subscription.ID.String(),
+		Plan:             subscription.Plan,
+		Status:           subscription.Status,
+		StartedAt:        Timestamp(subscription.StartedAt),
+		CurrentPeriodEnd: Timestamp(subscription.CurrentPeriodEnd),
+		GraceUntil:       NullTimestamp(subscription.GraceUntil),
+		EndedAt:          NullTimestamp(subscription.EndedAt),
+	}
+}
+
+// Always a JSON list, even without subscriptions.
+func NewSubscriptions(subscriptions []database.Subscription) []Subscription {
+	responses := make([]Subscription, len(subscriptions))
+	for i, subscription := range subscriptions {
+		responses[i] = NewSubscription(subscription)
+	}
+	return responses
+}
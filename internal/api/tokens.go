@@ -0,0 +1,48 @@
+package api
+
+import "github.com/luigiMinardi/bootdotdev-chirpy/internal/database"
+
+// APIToken is a personal API token without the token itself, that is only
+// returned once by [CreatedAPIToken].
+type APIToken struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	Scopes     []string `json:"scopes"`
+	CreatedAt  string   `json:"created_at"`
+	ExpiresAt  string   `json:"expires_at"`
+	LastUsedAt *string  `json:"last_used_at"`
+}
+
+func NewAPIToken(apiToken database.ApiToken) APIToken {
+	return APIToken{
+		ID:         apiToken.ID.String(),
+		Name:       apiToken.Name,
+		Scopes:     apiToken.Scopes,
+		CreatedAt:  Timestamp(apiToken.CreatedAt),
+		ExpiresAt:  Timestamp(apiToken.ExpiresAt),
+		LastUsedAt: NullTimestamp(apiToken.LastUsedAt),
+	}
+}
+
+// Always a JSON list, even without tokens.
+func NewAPITokens(apiTokens []database.ApiToken) []APIToken {
+	responses := make([]APIToken, len(apiTokens))
+	for i, apiToken := range apiTokens {
+		responses[i] = NewAPIToken(apiToken)
+	}
+	return responses
+}
+
+// CreatedAPIToken is the response of creating a token, the only time the
+// token is shown.
+type CreatedAPIToken struct {
+	APIToken
+	Token string `json:"token"`
+}
+
+func NewCreatedAPIToken(apiToken database.ApiToken, token string) CreatedAPIToken {
+	return CreatedAPIToken{
+		APIToken: NewAPIToken(apiToken),
+		Token:    token,
+	}
+}
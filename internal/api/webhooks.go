@@ -0,0 +1,165 @@
+package api
+
+import (
+	"encoding/json"
+
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/database"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/webhook"
+)
+
+// WebhookEvent is an incoming webhook delivery and how processing it went.
+type WebhookEvent struct {
+	ID          string          `json:"id"`
+	Source      string          `json:"source"`
+	EventID     string          `json:"event_id"`
+	EventType   string          `json:"event_type"`
+	Status      string          `json:"status"`
+	Error       *string         `json:"error"`
+	Attempts    int32           `json:"attempts"`
+	Payload     json.RawMessage `json:"payload"`
+	ReceivedAt  string          `json:"received_at"`
+	ProcessedAt *string         `json:"processed_at"`
+}
+
+func NewWebhookEvent(event database.WebhookEvent) WebhookEvent {
+	return WebhookEvent{
+		ID:          event.ID.String(),
+		Source:      event.Source,
+		EventID:     event.EventID,
+		EventType:   event.EventType,
+		Status:      event.Status,
+		Error:       nullString(event.Error),
+		Attempts:    event.Attempts,
+		Payload:     event.Payload,
+		ReceivedAt:  Timestamp(event.ReceivedAt),
+		ProcessedAt: NullTimestamp(event.ProcessedAt),
+	}
+}
+
+// Always a JSON list, even without events.
+func NewWebhookEvents(events []database.WebhookEvent) []WebhookEvent {
+	responses := make([]WebhookEvent, len(events))
+	for i, event := range events {
+		responses[i] = NewWebhookEvent(event)
+	}
+	return responses
+}
+
+// WebhookEndpoint is a URL registered to receive events, without its secret
+// that is only returned once by [CreatedWebhookEndpoint].
+type WebhookEndpoint struct {
+	ID        string   `json:"id"`
+	URL       string   `json:"url"`
+	Events    []string `json:"events"`
+	AllUsers  bool     `json:"all_users"`
+	CreatedAt string   `json:"created_at"`
+}
+
+func NewWebhookEndpoint(endpoint database.WebhookEndpoint) WebhookEndpoint {
+	return WebhookEndpoint{
+		ID:        endpoint.ID.String(),
+		URL:       endpoint.Url,
+		Events:    endpoint.Events,
+		AllUsers:  endpoint.AllUsers,
+		CreatedAt: Timestamp(endpoint.CreatedAt),
+	}
+}
+
+// Always a JSON list, even without endpoints.
+func NewWebhookEndpoints(endpoints []database.WebhookEndpoint) []WebhookEndpoint {
+	responses := make([]WebhookEndpoint, len(endpoints))
+	for i, endpoint := range endpoints {
+		responses[i] = NewWebhookEndpoint(endpoint)
+	}
+	return responses
+}
+
+// CreatedWebhookEndpoint is the response of registering an endpoint, the
+// only time the signing secret is shown.
+type CreatedWebhookEndpoint struct {
+	WebhookEndpoint
+	Secret string `json:"secret"`
+}
+
+func NewCreatedWebhookEndpoint(endpoint database.WebhookEndpoint, secret string) CreatedWebhookEndpoint {
+	return CreatedWebhookEndpoint{
+		WebhookEndpoint: NewWebhookEndpoint(endpoint),
+		Secret:          secret,
+	}
+}
+
+// WebhookDelivery is an event queued to be sent to an endpoint.
+type WebhookDelivery struct {
+	ID             string          `json:"id"`
+	EventID        string          `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Status         string          `json:"status"`
+	Attempts       int32           `json:"attempts"`
+	NextAttemptAt  *string         `json:"next_attempt_at"`
+	LastStatusCode *int32          `json:"last_status_code"`
+	LastError      *string         `json:"last_error"`
+	Payload        json.RawMessage `json:"payload"`
+	CreatedAt      string          `json:"created_at"`
+	DeliveredAt    *string         `json:"delivered_at"`
+}
+
+func NewWebhookDelivery(delivery database.WebhookDelivery) WebhookDelivery {
+	response := WebhookDelivery{
+		ID:          delivery.ID.String(),
+		EventID:     delivery.EventID.String(),
+		EventType:   delivery.EventType,
+		Status:      delivery.Status,
+		Attempts:    delivery.Attempts,
+		LastError:   nullString(delivery.LastError),
+		Payload:     delivery.Payload,
+		CreatedAt:   Timestamp(delivery.CreatedAt),
+		DeliveredAt: NullTimestamp(delivery.DeliveredAt),
+	}
+	// only pending deliveries are attempted again
+	if delivery.Status == webhook.StatusPending {
+		nextAttemptAt := Timestamp(delivery.NextAttemptAt)
+		response.NextAttemptAt = &nextAttemptAt
+	}
+	if delivery.LastStatusCode.Valid {
+		response.LastStatusCode = &delivery.LastStatusCode.Int32
+	}
+	return response
+}
+
+// Always a JSON list, even without deliveries.
+func NewWebhookDeliveries(deliveries []database.WebhookDelivery) []WebhookDelivery {
+	responses := make([]WebhookDelivery, len(deliveries))
+	for i, delivery := range deliveries {
+		responses[i] = NewWebhookDelivery(delivery)
+	}
+	return responses
+}
+
+// WebhookDeliveryAttempt is the log of sending a delivery once.
+type WebhookDeliveryAttempt struct {
+	AttemptedAt string  `json:"attempted_at"`
+	StatusCode  *int32  `json:"status_code"`
+	Error       *string `json:"error"`
+	DurationMs  int32   `json:"duration_ms"`
+}
+
+func NewWebhookDeliveryAttempt(attempt database.WebhookDeliveryAttempt) WebhookDeliveryAttempt {
+	response := WebhookDeliveryAttempt{
+		AttemptedAt: Timestamp(attempt.AttemptedAt),
+		Error:       nullString(attempt.Error),
+		DurationMs:  attempt.DurationMs,
+	}
+	if attempt.StatusCode.Valid {
+		response.StatusCode = &attempt.StatusCode.Int32
+	}
+	return response
+}
+
+// Always a JSON list, even without attempts.
+func NewWebhookDeliveryAttempts(attempts []database.WebhookDeliveryAttempt) []WebhookDeliveryAttempt {
+	responses := make([]WebhookDeliveryAttempt, len(attempts))
+	for i, attempt := range attempts {
+		responses[i] = NewWebhookDeliveryAttempt(attempt)
+	}
+	return responses
+}
@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Every personal API token starts with it, so they can be told apart from
+// JWTs and found by secret scanners.
+const APITokenPrefix = "chirpy_pat_"
+
+// Scope of what a personal API token is allowed to do, JWTs can do
+// everything.
+type Scope string
+
+const (
+	ScopeChirpsWrite  Scope = "chirps:write"
+	ScopeChirpsRead   Scope = "chirps:read"
+	ScopeProfileWrite Scope = "profile:write"
+)
+
+// Every scope a token can be given.
+var Scopes = []Scope{ScopeChirpsWrite, ScopeChirpsRead, ScopeProfileWrite}
+
+// Make a new personal API token. Only its [HashToken] should be stored.
+func MakeAPIToken() (string, error) {
+	tokenArr := make([]byte, 32)
+	if _, err := rand.Read(tokenArr); err != nil {
+		return "", err
+	}
+	return APITokenPrefix + hex.EncodeToString(tokenArr), nil
+}
+
+// Whether "token" looks like a personal API token instead of a JWT.
+func IsAPIToken(token string) bool {
+	return strings.HasPrefix(token, APITokenPrefix)
+}
+
+// Parse the "scopes" asked for a token, repeated ones are dropped. It errors
+// if there is none or one of them is unknown.
+func ParseScopes(scopes []string) ([]Scope, error) {
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("at least one scope is needed")
+	}
+	parsed := []Scope{}
+	for _, scope := range scopes {
+		if !slices.Contains(Scopes, Scope(scope)) {
+			return nil, fmt.Errorf("unknown scope %q", scope)
+		}
+		if !slices.Contains(parsed, Scope(scope)) {
+			parsed = append(parsed, Scope(scope))
+		}
+	}
+	return parsed, nil
+}
+
+// Join "scopes" with spaces, like the OAuth "scope" parameter.
+func JoinScopes(scopes []Scope) string {
+	scopeStrings := make([]string, len(scopes))
+	for i, scope := range scopes {
+		scopeStrings[i] = string(scope)
+	}
+	return strings.Join(scopeStrings, " ")
+}
+
+// Split a space separated "scope", it returns nil when it's empty. The scopes
+// aren't checked, see [ParseScopes] for that.
+func SplitScopes(scope string) []Scope {
+	fields := strings.Fields(scope)
+	if len(fields) == 0 {
+		return nil
+	}
+	scopes := make([]Scope, len(fields))
+	for i, field := range fields {
+		scopes[i] = Scope(field)
+	}
+	return scopes
+}
+
+// Whether "scopes" has the "required" one.
+func HasScope(scopes []Scope, required Scope) bool {
+	return slices.Contains(scopes, required)
+}
@@ -0,0 +1,44 @@
+package auth
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMakeAPIToken(t *testing.T) {
+	token, err := MakeAPIToken()
+	if err != nil {
+		t.Fatalf("failed to MakeAPIToken: %s", err)
+	}
+	if !IsAPIToken(token) {
+		t.Errorf("MakeAPIToken returned %s without the prefix", token)
+	}
+	other, _ := MakeAPIToken()
+	if token == other {
+		t.Errorf("MakeAPIToken returned the same token twice")
+	}
+	jwt, _ := MakeJWT([16]byte{}, tokenSecret, 0)
+	if IsAPIToken(jwt) {
+		t.Errorf("IsAPIToken accepted a JWT")
+	}
+}
+
+func TestParseScopes(t *testing.T) {
+	scopes, err := ParseScopes([]string{"chirps:write", "chirps:read", "chirps:write"})
+	if err != nil {
+		t.Fatalf("failed to ParseScopes: %s", err)
+	}
+	expected := []Scope{ScopeChirpsWrite, ScopeChirpsRead}
+	if !reflect.DeepEqual(scopes, expected) {
+		t.Errorf("ParseScopes returned %v expected %v", scopes, expected)
+	}
+	if !HasScope(scopes, ScopeChirpsRead) || HasScope(scopes, ScopeProfileWrite) {
+		t.Errorf("HasScope doesn't match the parsed scopes %v", scopes)
+	}
+	if _, err := ParseScopes([]string{"chirps:delete"}); err == nil {
+		t.Errorf("ParseScopes accepted an unknown scope")
+	}
+	if _, err := ParseScopes(nil); err == nil {
+		t.Errorf("ParseScopes accepted no scopes")
+	}
+}
@@ -2,6 +2,7 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"net/http"
@@ -11,98 +12,216 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/luigiMinardi/bootdotdev-chirpy/internal/logging"
-	"golang.org/x/crypto/bcrypt"
 )
 
 const (
 	TokenIssuerAPI string = "chirpy"
+	// issuer of the MFA challenge tokens, so they can't be used as access tokens
+	TokenIssuerMFA string = "chirpy-mfa"
 )
 
+// Hash the password with the [DefaultPasswordHasher].
 func HashPassword(password string) (string, error) {
 	if len(password) < 1 {
-		logging.LogError("password is empty: %s", password)
+		logging.LogError("password is empty")
 		return "", fmt.Errorf("password is empty")
 	}
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	hashedPassword, err := DefaultPasswordHasher.Hash(password)
 	if err != nil {
-		logging.LogError("failed to hash password: %s", err)
+		logging.LogError("failed to hash password", "err", err)
 		return "", err
 	}
-	return string(hashedPassword), nil
+	return hashedPassword, nil
 }
 
+// Check the password against a hash of any scheme the [DefaultPasswordHasher]
+// supports.
 func CheckPasswordHash(password, hash string) error {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	err := DefaultPasswordHasher.Verify(password, hash)
 	if err != nil {
-		logging.LogError("hash and password comparison errored with: %s", err)
+		logging.LogError("hash and password comparison failed", "err", err)
 		return err
 	}
 	return nil
 }
 
+// Reports if the hash was made with an outdated scheme or parameters of the
+// [DefaultPasswordHasher] and should be replaced after the password is checked.
+func PasswordNeedsRehash(hash string) bool {
+	return DefaultPasswordHasher.NeedsRehash(hash)
+}
+
+// AccessToken is a signed JWT together with the claims needed to keep track
+// of it, e.g. to revoke it before it expires.
+type AccessToken struct {
+	// the signed JsonWebToken
+	Token string
+	// jti (JWT ID) claim of the token
+	ID string
+	// exp (ExpiresAt) claim of the token
+	ExpiresAt time.Time
+}
+
 // MakeJWT should have an User UUID as "userID", the ApiConfig.jwtToken
 // ([github.com/luigiMinardi/bootdotdev-chirpy/internal/server.ApiConfig].jwtToken)
 // as the "tokenSecret" and a time.Duration that isnt more than a day as "expiresIn"
 // to make sure the JWT is propperly done and is secure.
 //
-// Returns a new signed JsonWebToken with an Issuer, IssuedAt, ExpiresAt and Subject.
+// Returns a new signed JsonWebToken with an Issuer, IssuedAt, ExpiresAt, Subject and ID.
 //   - token signature secret: "tokenSecret"
 //   - iss (Issuer): [TokenIssuerAPI]
 //   - iat (IssuedAt): time.Now()
 //   - exp (ExpiresAt): "expiresIn"
 //   - sub (Subject): "userID"
+//   - jti (ID): a random UUID, see [IssueJWT] if you need to know it
 func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
-		Issuer:    TokenIssuerAPI,
-		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
-		Subject:   userID.String(),
-	})
+	accessToken, err := IssueJWT(userID, tokenSecret, expiresIn)
+	if err != nil {
+		return "", err
+	}
+	return accessToken.Token, nil
+}
 
-	signedToken, err := token.SignedString([]byte(tokenSecret))
+// IssueJWT works like [MakeJWT] but also returns the jti and expiration of the
+// token so it can be stored and later put in the [Denylist].
+func IssueJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (AccessToken, error) {
+	return issueJWT(TokenIssuerAPI, userID, tokenSecret, expiresIn, nil)
+}
+
+// IssueScopedJWT works like [IssueJWT] but the token is limited to the
+// "scopes", sent as a space separated "scope" claim. They are the access
+// tokens given to third-party apps.
+func IssueScopedJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration, scopes []Scope) (AccessToken, error) {
+	if len(scopes) == 0 {
+		return AccessToken{}, fmt.Errorf("a scoped token needs at least one scope")
+	}
+	return issueJWT(TokenIssuerAPI, userID, tokenSecret, expiresIn, scopes)
+}
+
+// MakeMFAChallengeJWT returns a short lived token that proves the user
+// "userID" already gave the right password and only has to give the second
+// factor. It's issued by [TokenIssuerMFA] so [ValidateJWT] rejects it.
+func MakeMFAChallengeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
+	accessToken, err := issueJWT(TokenIssuerMFA, userID, tokenSecret, expiresIn, nil)
 	if err != nil {
-		logging.LogError("MakeJWT signedToken errored with: %s", err)
 		return "", err
 	}
-	return signedToken, nil
+	return accessToken.Token, nil
+}
+
+// registered claims plus the scope of third-party tokens
+type scopedClaims struct {
+	jwt.RegisteredClaims
+	Scope string `json:"scope,omitempty"`
+}
+
+func issueJWT(issuer string, userID uuid.UUID, tokenSecret string, expiresIn time.Duration, scopes []Scope) (AccessToken, error) {
+	now := time.Now().UTC()
+	claims := scopedClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
+			Subject:   userID.String(),
+			ID:        uuid.NewString(),
+		},
+		Scope: JoinScopes(scopes),
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+
+	signedToken, err := token.SignedString([]byte(tokenSecret))
+	if err != nil {
+		logging.LogError("MakeJWT failed to sign token", "err", err)
+		return AccessToken{}, err
+	}
+	return AccessToken{
+		Token:     signedToken,
+		ID:        claims.ID,
+		ExpiresAt: claims.ExpiresAt.Time,
+	}, nil
+}
+
+// Claims of a validated access token.
+type Claims struct {
+	// sub (Subject) parsed as the user UUID
+	UserID uuid.UUID
+	// jti (JWT ID), empty for tokens issued before it was added
+	ID string
+	// exp (ExpiresAt)
+	ExpiresAt time.Time
+	// scope of tokens made by [IssueScopedJWT], nil for first-party tokens
+	// which can do everything
+	Scopes []Scope
 }
 
 // Given a token and it's signed secret
 // ([github.com/luigiMinardi/bootdotdev-chirpy/internal/server.ApiConfig].jwtToken)
 // return the token Subject (user UUID) if the secret, subject and issuer are valid.
 func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	claims := jwt.RegisteredClaims{}
+	claims, err := ParseJWT(tokenString, tokenSecret)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return claims.UserID, nil
+}
+
+// ParseJWT validates the token the same way [ValidateJWT] does and returns
+// all the [Claims] Chirpy cares about.
+func ParseJWT(tokenString, tokenSecret string) (Claims, error) {
+	return parseJWT(TokenIssuerAPI, tokenString, tokenSecret)
+}
+
+// Validate a token made by [MakeMFAChallengeJWT] and return its user UUID.
+func ValidateMFAChallengeJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
+	claims, err := parseJWT(TokenIssuerMFA, tokenString, tokenSecret)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return claims.UserID, nil
+}
+
+func parseJWT(expectedIssuer, tokenString, tokenSecret string) (Claims, error) {
+	claims := scopedClaims{}
 	token, err := jwt.ParseWithClaims(tokenString, &claims, func(t *jwt.Token) (any, error) {
 		return []byte(tokenSecret), nil
 	})
 	if err != nil {
-		logging.LogError("ValidateJWT parseWithClaims errored with: %s", err)
-		return uuid.Nil, err
+		logging.LogError("ValidateJWT failed to parse claims", "err", err)
+		return Claims{}, err
 	}
 
 	issuer, err := token.Claims.GetIssuer()
 	if err != nil {
-		logging.LogError("ValidateJWT Claims GetIssuer errored with: %s", err)
-		return uuid.Nil, err
+		logging.LogError("ValidateJWT failed to get issuer", "err", err)
+		return Claims{}, err
 	}
 
-	if issuer != TokenIssuerAPI {
-		logging.LogError("ValidateJWT returned wrong issuer: %s", issuer)
-		return uuid.Nil, fmt.Errorf("Issuer '%s' is not the API issuer '%s'.", issuer, TokenIssuerAPI)
+	if issuer != expectedIssuer {
+		logging.LogError("ValidateJWT returned wrong issuer", "issuer", issuer)
+		return Claims{}, fmt.Errorf("Issuer '%s' is not the expected issuer '%s'.", issuer, expectedIssuer)
 	}
 
 	subject, err := token.Claims.GetSubject()
 	if err != nil {
-		logging.LogError("ValidateJWT Claims GetSubject errored with: %s", err)
-		return uuid.Nil, err
+		logging.LogError("ValidateJWT failed to get subject", "err", err)
+		return Claims{}, err
 	}
 
 	uid, err := uuid.Parse(subject)
 	if err != nil {
-		logging.LogError("ValidateJWT UUID Parse errored with: %s", err)
-		return uuid.Nil, err
+		logging.LogError("ValidateJWT failed to parse subject as UUID", "err", err)
+		return Claims{}, err
+	}
+
+	parsed := Claims{
+		UserID: uid,
+		ID:     claims.ID,
+		Scopes: SplitScopes(claims.Scope),
+	}
+	if claims.ExpiresAt != nil {
+		parsed.ExpiresAt = claims.ExpiresAt.Time
 	}
-	return uid, nil
+	return parsed, nil
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
@@ -130,6 +249,23 @@ func MakeRefreshToken() (string, error) {
 	return token, nil
 }
 
+// Make a random token for single use links, like email verification and
+// password reset ones. Only its [HashToken] should be stored.
+func MakeOneTimeToken() (string, error) {
+	tokenArr := make([]byte, 32)
+	if _, err := rand.Read(tokenArr); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(tokenArr), nil
+}
+
+// Hash a random token to be stored, they have enough entropy for SHA-256 to
+// be enough.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 // Get Header Authorization ApiKey
 func GetAPIKey(headers http.Header) (string, error) {
 	authorization := headers.Get("Authorization")
@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"reflect"
 	"testing"
 	"time"
 
@@ -15,16 +16,16 @@ func TestMakeAndValidateJWT(t *testing.T) {
 	uid := uuid.New()
 	token, err := MakeJWT(uid, tokenSecret, time.Duration(time.Second*30))
 	if err != nil {
-		logging.LogInfo("testing MakeJWT with UUID: %s", uid)
+		logging.LogInfo("testing MakeJWT", "user_id", uid)
 		t.Errorf("failed to MakeJWT: %s", err)
 	}
 	tokenUUID, err := ValidateJWT(token, tokenSecret)
 	if err != nil {
-		logging.LogInfo("testing MakeJWT generated token: %s", token)
+		logging.LogInfo("MakeJWT generated token", "token", token)
 		t.Errorf("failed to ValidateJWT: %s", err)
 	}
 	if uid != tokenUUID {
-		logging.LogInfo("testing MakeJWT with UUID: %s", uid)
+		logging.LogInfo("testing MakeJWT", "user_id", uid)
 		t.Errorf("testing ValidateJWT returned UUID: %s", tokenUUID)
 	}
 }
@@ -33,13 +34,13 @@ func TestMakeAndValidateAnExpiredJWT(t *testing.T) {
 	uid := uuid.New()
 	token, err := MakeJWT(uid, tokenSecret, time.Duration(time.Nanosecond))
 	if err != nil {
-		logging.LogInfo("testing MakeJWT with UUID: %s", uid)
+		logging.LogInfo("testing MakeJWT", "user_id", uid)
 		t.Errorf("failed to MakeJWT: %s", err)
 	}
 	tokenUUID, err := ValidateJWT(token, tokenSecret)
 	if err == nil {
-		logging.LogInfo("testing MakeJWT with UUID: %s", uid)
-		logging.LogInfo("testing MakeJWT generated token: %s", token)
+		logging.LogInfo("testing MakeJWT", "user_id", uid)
+		logging.LogInfo("MakeJWT generated token", "token", token)
 		t.Errorf("ValidateJWT worked with expired token returning UUID: %s", tokenUUID)
 	}
 	if uid == tokenUUID {
@@ -57,7 +58,7 @@ func TestValidateAJWTWithNoUUID(t *testing.T) {
 
 	signedToken, err := token.SignedString([]byte(tokenSecret))
 	if err != nil {
-		logging.LogError("invalid token data: %s", token)
+		logging.LogError("invalid token data", "token", token)
 		t.Errorf("invalid token signing failed with: %s", err)
 	}
 
@@ -78,7 +79,7 @@ func TestValidateAJWTWithWrongIssuer(t *testing.T) {
 
 	signedToken, err := token.SignedString([]byte(tokenSecret))
 	if err != nil {
-		logging.LogError("invalid token data: %s", token)
+		logging.LogError("invalid token data", "token", token)
 		t.Errorf("invalid token signing failed with: %s", err)
 	}
 
@@ -100,7 +101,7 @@ func TestValidateAJWTWithWrongTokenSecret(t *testing.T) {
 
 	signedToken, err := token.SignedString([]byte(secret))
 	if err != nil {
-		logging.LogError("invalid token data: %s", token)
+		logging.LogError("invalid token data", "token", token)
 		t.Errorf("invalid token signing failed with: %s", err)
 	}
 
@@ -109,3 +110,45 @@ func TestValidateAJWTWithWrongTokenSecret(t *testing.T) {
 		t.Errorf("ValidateJWT successfuly validated a token signed with '%s' signature by passing '%s' as a signature", secret, signedToken)
 	}
 }
+
+func TestIssueJWTHasAnID(t *testing.T) {
+	accessToken, err := IssueJWT(fake_userUUID, tokenSecret, time.Minute)
+	if err != nil {
+		t.Fatalf("failed to IssueJWT: %s", err)
+	}
+	claims, err := ParseJWT(accessToken.Token, tokenSecret)
+	if err != nil {
+		t.Fatalf("failed to ParseJWT: %s", err)
+	}
+	if claims.ID == "" || claims.ID != accessToken.ID {
+		t.Errorf("ParseJWT returned jti '%s' expected '%s'", claims.ID, accessToken.ID)
+	}
+	if claims.UserID != fake_userUUID {
+		t.Errorf("ParseJWT returned UUID %s expected %s", claims.UserID, fake_userUUID)
+	}
+}
+
+func TestIssueScopedJWT(t *testing.T) {
+	uid := uuid.New()
+	scopes := []Scope{ScopeChirpsRead, ScopeProfileWrite}
+	accessToken, err := IssueScopedJWT(uid, tokenSecret, time.Minute, scopes)
+	if err != nil {
+		t.Fatalf("failed to IssueScopedJWT: %s", err)
+	}
+	claims, err := ParseJWT(accessToken.Token, tokenSecret)
+	if err != nil {
+		t.Fatalf("failed to ParseJWT: %s", err)
+	}
+	if claims.UserID != uid || !reflect.DeepEqual(claims.Scopes, scopes) {
+		t.Errorf("ParseJWT returned %v expected user %s with scopes %v", claims, uid, scopes)
+	}
+
+	unscoped, _ := MakeJWT(uid, tokenSecret, time.Minute)
+	claims, err = ParseJWT(unscoped, tokenSecret)
+	if err != nil || claims.Scopes != nil {
+		t.Errorf("ParseJWT of a first-party token returned scopes %v err: %v", claims.Scopes, err)
+	}
+	if _, err := IssueScopedJWT(uid, tokenSecret, time.Minute, nil); err == nil {
+		t.Errorf("IssueScopedJWT issued a token without scopes")
+	}
+}
@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DenylistStore is where revoked access tokens are persisted so every Chirpy
+// instance can see them, it's satisfied by
+// [github.com/luigiMinardi/bootdotdev-chirpy/internal/database.Queries].
+type DenylistStore interface {
+	IsAccessTokenDenied(ctx context.Context, jti string) (bool, error)
+}
+
+// Denylist keeps track of access tokens (by their jti) that were revoked
+// before expiring. Lookups hit the [DenylistStore] and are cached in memory:
+// denied tokens are cached until they expire and allowed ones for the
+// Denylist ttl, so a token revoked by another instance stops working at most
+// ttl later.
+type Denylist struct {
+	store DenylistStore
+	ttl   time.Duration
+	// used to override time.Now on tests
+	now func() time.Time
+
+	mu        sync.Mutex
+	entries   map[string]denylistEntry
+	lastSweep time.Time
+}
+
+type denylistEntry struct {
+	denied    bool
+	expiresAt time.Time
+}
+
+// NewDenylist returns a [Denylist] backed by "store" that caches allowed
+// tokens for "ttl".
+func NewDenylist(store DenylistStore, ttl time.Duration) *Denylist {
+	return &Denylist{
+		store:   store,
+		ttl:     ttl,
+		now:     time.Now,
+		entries: map[string]denylistEntry{},
+	}
+}
+
+// IsDenied reports if the token with the "jti" was revoked. If the store
+// fails the error is returned and the caller should treat the token as denied.
+func (d *Denylist) IsDenied(ctx context.Context, jti string) (bool, error) {
+	now := d.now()
+
+	d.mu.Lock()
+	entry, ok := d.entries[jti]
+	d.mu.Unlock()
+	if ok && now.Before(entry.expiresAt) {
+		return entry.denied, nil
+	}
+
+	denied, err := d.store.IsAccessTokenDenied(ctx, jti)
+	if err != nil {
+		return false, err
+	}
+	// we don't know when a denied token expires here so it's also only cached
+	// for the ttl, Deny is the one that caches it for the whole token lifetime
+	d.remember(jti, denylistEntry{denied: denied, expiresAt: now.Add(d.ttl)})
+	return denied, nil
+}
+
+// Deny caches the "jti" as denied until "expiresAt", after that the token is
+// expired and will be rejected anyway. It should be called after the token
+// was persisted on the [DenylistStore].
+func (d *Denylist) Deny(jti string, expiresAt time.Time) {
+	d.remember(jti, denylistEntry{denied: true, expiresAt: expiresAt})
+}
+
+// save the entry and every ttl drop the ones that already expired so the
+// cache don't grow forever
+func (d *Denylist) remember(jti string, entry denylistEntry) {
+	now := d.now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.entries[jti] = entry
+	if now.Sub(d.lastSweep) < d.ttl {
+		return
+	}
+	for k, v := range d.entries {
+		if !now.Before(v.expiresAt) {
+			delete(d.entries, k)
+		}
+	}
+	d.lastSweep = now
+}
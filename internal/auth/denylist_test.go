@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+type fakeDenylistStore struct {
+	denied map[string]bool
+	calls  int
+	err    error
+}
+
+func (s *fakeDenylistStore) IsAccessTokenDenied(ctx context.Context, jti string) (bool, error) {
+	s.calls++
+	return s.denied[jti], s.err
+}
+
+func TestDenylistCachesAllowedTokensForTTL(t *testing.T) {
+	store := &fakeDenylistStore{denied: map[string]bool{}}
+	denylist := NewDenylist(store, time.Minute)
+	now := time.Now()
+	denylist.now = func() time.Time { return now }
+
+	for range 3 {
+		denied, err := denylist.IsDenied(context.Background(), "jti")
+		if err != nil || denied {
+			t.Errorf("IsDenied returned denied: %v err: %v for an allowed token", denied, err)
+		}
+	}
+	if store.calls != 1 {
+		t.Errorf("IsDenied hit the store %d times instead of once", store.calls)
+	}
+
+	// revoked by another instance, shows up after the ttl
+	store.denied["jti"] = true
+	now = now.Add(time.Minute)
+	denied, err := denylist.IsDenied(context.Background(), "jti")
+	if err != nil || !denied {
+		t.Errorf("IsDenied returned denied: %v err: %v after the ttl of a revoked token", denied, err)
+	}
+}
+
+func TestDenylistDenyWithoutHittingTheStore(t *testing.T) {
+	store := &fakeDenylistStore{denied: map[string]bool{}}
+	denylist := NewDenylist(store, time.Minute)
+
+	denylist.Deny("jti", time.Now().Add(time.Hour))
+	denied, err := denylist.IsDenied(context.Background(), "jti")
+	if err != nil || !denied {
+		t.Errorf("IsDenied returned denied: %v err: %v for a denied token", denied, err)
+	}
+	if store.calls != 0 {
+		t.Errorf("IsDenied hit the store %d times for a cached token", store.calls)
+	}
+}
+
+func TestDenylistReturnsStoreErrors(t *testing.T) {
+	store := &fakeDenylistStore{err: fmt.Errorf("db is down")}
+	denylist := NewDenylist(store, time.Minute)
+
+	_, err := denylist.IsDenied(context.Background(), "jti")
+	if err == nil {
+		t.Errorf("IsDenied didn't return the store error")
+	}
+	store.err = nil
+	_, _ = denylist.IsDenied(context.Background(), "jti")
+	if store.calls != 2 {
+		t.Errorf("IsDenied cached a failed lookup")
+	}
+}
@@ -0,0 +1,205 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// returned when the password don't match the hash
+	ErrPasswordMismatch = errors.New("password does not match the hash")
+	// returned when the hash isn't in a format any PasswordHasher knows
+	ErrUnknownHashFormat = errors.New("unknown password hash format")
+	// returned when the hash is in a known format but can't be a real hash,
+	// e.g. an empty key would match every password
+	ErrMalformedHash = errors.New("malformed password hash")
+)
+
+// Shortest salt and key we accept on a stored argon2id hash, anything
+// shorter is a broken hash, a 1 byte key would match 1 in 256 passwords.
+const (
+	minArgon2idSaltLength = 8
+	minArgon2idKeyLength  = 16
+)
+
+// PasswordHasher hashes and verifies passwords. The hashes it makes are self
+// describing (scheme and parameters are encoded on them) so the hasher can
+// tell when a stored hash was made with outdated parameters.
+type PasswordHasher interface {
+	// hash the password with the hasher current parameters
+	Hash(password string) (string, error)
+	// returns nil if the password matches the hash
+	Verify(password, hash string) error
+	// reports if the hash wasn't made with the hasher current scheme and
+	// parameters and should be replaced by a new Hash of the password
+	NeedsRehash(hash string) bool
+}
+
+// Argon2idParams are the argon2id tunables, see RFC 9106 section 4.
+type Argon2idParams struct {
+	// memory in KiB
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// Second recommended option of RFC 9106 (64 MiB, 3 passes, 4 lanes).
+var DefaultArgon2idParams = Argon2idParams{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 4,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// Argon2idHasher hashes passwords to the PHC string format:
+//
+//	$argon2id$v=19$m=65536,t=3,p=4$<base64 salt>$<base64 key>
+type Argon2idHasher struct {
+	Params Argon2idParams
+}
+
+func (h Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.Params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Params.Iterations, h.Params.Memory, h.Params.Parallelism, h.Params.KeyLength)
+	return fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		h.Params.Memory,
+		h.Params.Iterations,
+		h.Params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// Verify uses the parameters encoded on the hash, not the hasher ones, so
+// hashes made with older parameters still work.
+func (h Argon2idHasher) Verify(password, hash string) error {
+	params, salt, key, err := decodeArgon2idHash(hash)
+	if err != nil {
+		return err
+	}
+	otherKey := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	if subtle.ConstantTimeCompare(key, otherKey) != 1 {
+		return ErrPasswordMismatch
+	}
+	return nil
+}
+
+func (h Argon2idHasher) NeedsRehash(hash string) bool {
+	params, _, _, err := decodeArgon2idHash(hash)
+	if err != nil {
+		return true
+	}
+	return params != h.Params
+}
+
+func decodeArgon2idHash(hash string) (Argon2idParams, []byte, []byte, error) {
+	// "", "argon2id", "v=19", "m=65536,t=3,p=4", salt, key
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return Argon2idParams{}, nil, nil, ErrUnknownHashFormat
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return Argon2idParams{}, nil, nil, err
+	}
+	if version != argon2.Version {
+		return Argon2idParams{}, nil, nil, fmt.Errorf("unsupported argon2 version: %d", version)
+	}
+	params := Argon2idParams{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return Argon2idParams{}, nil, nil, err
+	}
+	// argon2.IDKey panics with no passes or lanes
+	if params.Iterations == 0 || params.Parallelism == 0 {
+		return Argon2idParams{}, nil, nil, ErrMalformedHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Argon2idParams{}, nil, nil, err
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return Argon2idParams{}, nil, nil, err
+	}
+	if len(salt) < minArgon2idSaltLength || len(key) < minArgon2idKeyLength {
+		return Argon2idParams{}, nil, nil, ErrMalformedHash
+	}
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	return params, salt, key, nil
+}
+
+// BcryptHasher hashes passwords with bcrypt at Cost, keep in mind bcrypt only
+// uses the first 72 bytes of the password.
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h BcryptHasher) Hash(password string) (string, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashedPassword), nil
+}
+
+func (h BcryptHasher) Verify(password, hash string) error {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrPasswordMismatch
+	}
+	return err
+}
+
+func (h BcryptHasher) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return true
+	}
+	return cost != h.Cost
+}
+
+// VersionedHasher hashes new passwords with Current but verifies hashes of
+// every supported scheme, so users with hashes from older schemes or
+// parameters can still login and get their hash upgraded.
+type VersionedHasher struct {
+	Current PasswordHasher
+}
+
+func (h VersionedHasher) Hash(password string) (string, error) {
+	return h.Current.Hash(password)
+}
+
+func (h VersionedHasher) Verify(password, hash string) error {
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		return Argon2idHasher{}.Verify(password, hash)
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		return BcryptHasher{}.Verify(password, hash)
+	}
+	return ErrUnknownHashFormat
+}
+
+func (h VersionedHasher) NeedsRehash(hash string) bool {
+	return h.Current.NeedsRehash(hash)
+}
+
+// PasswordHasher used by [HashPassword] and [CheckPasswordHash].
+var DefaultPasswordHasher PasswordHasher = VersionedHasher{
+	Current: Argon2idHasher{Params: DefaultArgon2idParams},
+}
@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// cheap parameters so the tests don't take forever
+var testArgon2idParams = Argon2idParams{
+	Memory:      1024,
+	Iterations:  1,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+func TestArgon2idHashAndVerify(t *testing.T) {
+	hasher := Argon2idHasher{Params: testArgon2idParams}
+	hash, err := hasher.Hash("hunter2")
+	if err != nil {
+		t.Fatalf("failed to Hash: %s", err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Errorf("Hash returned an unexpected format: %s", hash)
+	}
+	if err := hasher.Verify("hunter2", hash); err != nil {
+		t.Errorf("Verify failed with the right password: %s", err)
+	}
+	if err := hasher.Verify("hunter3", hash); !errors.Is(err, ErrPasswordMismatch) {
+		t.Errorf("Verify returned '%v' with the wrong password", err)
+	}
+	if hasher.NeedsRehash(hash) {
+		t.Errorf("NeedsRehash is true for a hash with the current parameters")
+	}
+	stronger := Argon2idHasher{Params: testArgon2idParams}
+	stronger.Params.Iterations = 2
+	if !stronger.NeedsRehash(hash) {
+		t.Errorf("NeedsRehash is false for a hash with outdated parameters")
+	}
+}
+
+func TestBcryptNeedsRehashOnCostChange(t *testing.T) {
+	hash, err := BcryptHasher{Cost: bcrypt.MinCost}.Hash("hunter2")
+	if err != nil {
+		t.Fatalf("failed to Hash: %s", err)
+	}
+	if (BcryptHasher{Cost: bcrypt.MinCost}).NeedsRehash(hash) {
+		t.Errorf("NeedsRehash is true for a hash with the current cost")
+	}
+	if !(BcryptHasher{Cost: bcrypt.MinCost + 1}).NeedsRehash(hash) {
+		t.Errorf("NeedsRehash is false for a hash with an outdated cost")
+	}
+}
+
+func TestVersionedHasherUpgradesBcryptToArgon2id(t *testing.T) {
+	hasher := VersionedHasher{Current: Argon2idHasher{Params: testArgon2idParams}}
+	oldHash, err := BcryptHasher{Cost: bcrypt.MinCost}.Hash("hunter2")
+	if err != nil {
+		t.Fatalf("failed to Hash: %s", err)
+	}
+	if err := hasher.Verify("hunter2", oldHash); err != nil {
+		t.Errorf("Verify failed with a bcrypt hash: %s", err)
+	}
+	if err := hasher.Verify("hunter3", oldHash); !errors.Is(err, ErrPasswordMismatch) {
+		t.Errorf("Verify returned '%v' with the wrong password", err)
+	}
+	if !hasher.NeedsRehash(oldHash) {
+		t.Errorf("NeedsRehash is false for a bcrypt hash")
+	}
+	if err := hasher.Verify("hunter2", "plaintext"); !errors.Is(err, ErrUnknownHashFormat) {
+		t.Errorf("Verify returned '%v' with an unknown hash format", err)
+	}
+}
+
+func TestArgon2idRejectsMalformedHash(t *testing.T) {
+	hasher := Argon2idHasher{Params: testArgon2idParams}
+	hashes := []string{
+		"$argon2id$v=19$m=1024,t=1,p=1$$",
+		"$argon2id$v=19$m=1024,t=1,p=1$c2FsdHNhbHRzYWx0$",
+		"$argon2id$v=19$m=1024,t=1,p=1$$a2V5a2V5a2V5a2V5a2V5a2V5",
+		"$argon2id$v=19$m=1024,t=1,p=1$c2FsdHNhbHRzYWx0$aw",
+		"$argon2id$v=19$m=1024,t=0,p=1$c2FsdHNhbHRzYWx0$a2V5a2V5a2V5a2V5a2V5a2V5",
+		"$argon2id$v=19$m=1024,t=1,p=0$c2FsdHNhbHRzYWx0$a2V5a2V5a2V5a2V5a2V5a2V5",
+	}
+	for _, hash := range hashes {
+		if err := hasher.Verify("", hash); !errors.Is(err, ErrMalformedHash) {
+			t.Errorf("Verify returned '%v' for the malformed hash %s", err, hash)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/logging"
+)
+
+// bcrypt ignores everything after the 72th byte of a password
+const BcryptMaxPasswordBytes = 72
+
+// Names of the [PasswordPolicy] rules, returned on [PolicyViolation].Rule
+const (
+	RuleMinLength = "min_length"
+	RuleMaxLength = "max_length"
+	RuleNotEmail  = "not_email"
+	RuleBreached  = "not_breached"
+)
+
+// PolicyViolation is a rule of the [PasswordPolicy] the password broke.
+type PolicyViolation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// PasswordPolicy are the rules a new password has to follow.
+type PasswordPolicy struct {
+	// minimum amount of characters
+	MinLength int
+	// maximum amount of bytes, should be at most [BcryptMaxPasswordBytes] if
+	// the passwords are hashed with bcrypt
+	MaxLength int
+	// reject passwords that are the user email or its local part
+	DisallowEmail bool
+	// reject passwords found on a breach, nil to skip the check
+	Breached *BreachedPasswords
+}
+
+// Default rules, without the breached passwords check since it needs a corpus.
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength:     8,
+	MaxLength:     BcryptMaxPasswordBytes,
+	DisallowEmail: true,
+}
+
+// Check the password of the user with "email" against every rule and return
+// all the ones it violates, an empty slice means the password is accepted.
+func (p PasswordPolicy) Check(password, email string) []PolicyViolation {
+	violations := []PolicyViolation{}
+	if utf8.RuneCountInString(password) < p.MinLength {
+		violations = append(violations, PolicyViolation{
+			Rule:    RuleMinLength,
+			Message: fmt.Sprintf("Password must have at least %d characters", p.MinLength),
+		})
+	}
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		violations = append(violations, PolicyViolation{
+			Rule:    RuleMaxLength,
+			Message: fmt.Sprintf("Password must have at most %d bytes", p.MaxLength),
+		})
+	}
+	if p.DisallowEmail && email != "" {
+		localPart, _, _ := strings.Cut(email, "@")
+		if strings.EqualFold(password, email) || strings.EqualFold(password, localPart) {
+			violations = append(violations, PolicyViolation{
+				Rule:    RuleNotEmail,
+				Message: "Password can't be your email",
+			})
+		}
+	}
+	if p.Breached != nil {
+		breached, err := p.Breached.Contains(password)
+		if err != nil {
+			// a broken corpus shouldn't lock everyone out of signing up
+			logging.LogError("failed to check breached passwords", "err", err)
+		}
+		if breached {
+			violations = append(violations, PolicyViolation{
+				Rule:    RuleBreached,
+				Message: "Password was found in a data breach, choose another one",
+			})
+		}
+	}
+	return violations
+}
+
+// BreachedPasswords is a local k-anonymity corpus of breached passwords, in
+// the same layout as the "Pwned Passwords" range API: Dir has one file per
+// SHA-1 prefix (the first 5 hex characters, e.g. "21BD1" or "21BD1.txt")
+// with one "SUFFIX:COUNT" line for every breached hash with that prefix.
+//
+// Only the prefix of the password hash is used to pick the file, so the
+// corpus can be served by anything that speaks the range format.
+type BreachedPasswords struct {
+	Dir string
+}
+
+// Reports if the password SHA-1 is on the corpus.
+func (b *BreachedPasswords) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	file, err := os.Open(filepath.Join(b.Dir, prefix))
+	if errors.Is(err, fs.ErrNotExist) {
+		file, err = os.Open(filepath.Join(b.Dir, prefix+".txt"))
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lineSuffix, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if strings.EqualFold(lineSuffix, suffix) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
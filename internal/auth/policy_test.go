@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func violatedRules(violations []PolicyViolation) []string {
+	rules := []string{}
+	for _, violation := range violations {
+		rules = append(rules, violation.Rule)
+	}
+	return rules
+}
+
+func TestPasswordPolicyListsEveryViolation(t *testing.T) {
+	policy := DefaultPasswordPolicy
+
+	rules := violatedRules(policy.Check("bob", "bob@example.com"))
+	if strings.Join(rules, ",") != RuleMinLength+","+RuleNotEmail {
+		t.Errorf("Check returned rules %v for a short password equal to the email local part", rules)
+	}
+
+	rules = violatedRules(policy.Check(strings.Repeat("a", BcryptMaxPasswordBytes+1), "bob@example.com"))
+	if strings.Join(rules, ",") != RuleMaxLength {
+		t.Errorf("Check returned rules %v for a password over the bcrypt limit", rules)
+	}
+
+	rules = violatedRules(policy.Check("correct horse battery staple", "bob@example.com"))
+	if len(rules) != 0 {
+		t.Errorf("Check returned rules %v for a valid password", rules)
+	}
+}
+
+func TestBreachedPasswordsCorpus(t *testing.T) {
+	dir := t.TempDir()
+	// SHA-1 of "password" is 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8
+	corpus := "0018A45C4D1DEF81644B54AB7F969B88D65:1\r\n1E4C9B93F3F0682250B6CF8331B7EE68FD8:9545824\r\n"
+	if err := os.WriteFile(filepath.Join(dir, "5BAA6"), []byte(corpus), 0o600); err != nil {
+		t.Fatalf("failed to write corpus: %s", err)
+	}
+	breached := &BreachedPasswords{Dir: dir}
+
+	found, err := breached.Contains("password")
+	if err != nil || !found {
+		t.Errorf("Contains returned found: %v err: %v for a breached password", found, err)
+	}
+	found, err = breached.Contains("correct horse battery staple")
+	if err != nil || found {
+		t.Errorf("Contains returned found: %v err: %v for a password without a range file", found, err)
+	}
+
+	policy := DefaultPasswordPolicy
+	policy.Breached = breached
+	rules := violatedRules(policy.Check("password", "bob@example.com"))
+	if strings.Join(rules, ",") != RuleBreached {
+		t.Errorf("Check returned rules %v for a breached password", rules)
+	}
+}
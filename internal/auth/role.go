@@ -0,0 +1,53 @@
+package auth
+
+import "fmt"
+
+// Role of an user, every role can do everything the roles below it can.
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+var roleRanks = map[Role]int{
+	RoleUser:      0,
+	RoleModerator: 1,
+	RoleAdmin:     2,
+}
+
+// Parse "role" and return an error if it's not one of the known roles.
+func ParseRole(role string) (Role, error) {
+	if _, ok := roleRanks[Role(role)]; !ok {
+		return "", fmt.Errorf("unknown role %q", role)
+	}
+	return Role(role), nil
+}
+
+// Whether the role is "required" or above it, unknown roles have no access.
+func (r Role) Includes(required Role) bool {
+	rank, ok := roleRanks[r]
+	if !ok {
+		return false
+	}
+	requiredRank, ok := roleRanks[required]
+	if !ok {
+		return false
+	}
+	return rank >= requiredRank
+}
+
+// Whether the role is strictly above "other", so it can act on users with it.
+// Unknown roles outrank nothing and are outranked by everything.
+func (r Role) Outranks(other Role) bool {
+	rank, ok := roleRanks[r]
+	if !ok {
+		return false
+	}
+	otherRank, ok := roleRanks[other]
+	if !ok {
+		return true
+	}
+	return rank > otherRank
+}
@@ -0,0 +1,58 @@
+package auth
+
+import "testing"
+
+func TestRoleIncludes(t *testing.T) {
+	cases := []struct {
+		role     Role
+		required Role
+		expected bool
+	}{
+		{RoleAdmin, RoleAdmin, true},
+		{RoleAdmin, RoleModerator, true},
+		{RoleAdmin, RoleUser, true},
+		{RoleModerator, RoleAdmin, false},
+		{RoleModerator, RoleModerator, true},
+		{RoleUser, RoleModerator, false},
+		{RoleUser, RoleUser, true},
+		{Role("root"), RoleUser, false},
+		{RoleAdmin, Role("root"), false},
+	}
+	for _, c := range cases {
+		if got := c.role.Includes(c.required); got != c.expected {
+			t.Errorf("%q.Includes(%q) returned %v expected %v", c.role, c.required, got, c.expected)
+		}
+	}
+}
+
+func TestRoleOutranks(t *testing.T) {
+	cases := []struct {
+		role     Role
+		other    Role
+		expected bool
+	}{
+		{RoleAdmin, RoleModerator, true},
+		{RoleAdmin, RoleAdmin, false},
+		{RoleModerator, RoleUser, true},
+		{RoleModerator, RoleModerator, false},
+		{RoleModerator, RoleAdmin, false},
+		{RoleUser, RoleUser, false},
+		{Role("root"), RoleUser, false},
+		{RoleUser, Role("root"), true},
+	}
+	for _, c := range cases {
+		if got := c.role.Outranks(c.other); got != c.expected {
+			t.Errorf("%q.Outranks(%q) returned %v expected %v", c.role, c.other, got, c.expected)
+		}
+	}
+}
+
+func TestParseRole(t *testing.T) {
+	role, err := ParseRole("moderator")
+	if err != nil || role != RoleModerator {
+		t.Errorf("ParseRole(moderator) returned %q err: %v", role, err)
+	}
+	if _, err := ParseRole("Admin"); err == nil {
+		t.Errorf("ParseRole accepted an unknown role")
+	}
+}
@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RFC 6238 appendix B test secret for SHA-1
+var rfcTOTPSecret = []byte("12345678901234567890")
+
+func TestTOTPCodeMatchesRFC6238(t *testing.T) {
+	// the RFC uses 8 digits, the last 6 are the same as a 6 digits code
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, expected := range vectors {
+		code := TOTPCode(rfcTOTPSecret, TOTPStep(time.Unix(unix, 0)))
+		if code != expected {
+			t.Errorf("TOTPCode at %d returned %s expected %s", unix, code, expected)
+		}
+	}
+}
+
+func TestValidateTOTPAcceptsClockSkew(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	previousCode := TOTPCode(rfcTOTPSecret, TOTPStep(now)-1)
+	step, ok := ValidateTOTP(rfcTOTPSecret, previousCode, now)
+	if !ok || step != TOTPStep(now)-1 {
+		t.Errorf("ValidateTOTP returned step: %d ok: %v for the previous period code", step, ok)
+	}
+	oldCode := TOTPCode(rfcTOTPSecret, TOTPStep(now)-2)
+	if _, ok := ValidateTOTP(rfcTOTPSecret, oldCode, now); ok {
+		t.Errorf("ValidateTOTP accepted a code from two periods ago")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := TOTPURI("Chirpy", "bob@example.com", rfcTOTPSecret)
+	expected := "otpauth://totp/Chirpy:bob@example.com?algorithm=SHA1&digits=6&issuer=Chirpy&period=30&secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	if uri != expected {
+		t.Errorf("TOTPURI returned %s expected %s", uri, expected)
+	}
+}
+
+func TestRecoveryCodesHashIgnoresFormatting(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatalf("failed to GenerateRecoveryCodes: %s", err)
+	}
+	if len(codes) != 10 {
+		t.Errorf("GenerateRecoveryCodes returned %d codes expected 10", len(codes))
+	}
+	typed := strings.ToUpper(strings.ReplaceAll(codes[0], "-", " "))
+	if HashRecoveryCode(typed) != HashRecoveryCode(codes[0]) {
+		t.Errorf("HashRecoveryCode of %s and %s are different", typed, codes[0])
+	}
+}
+
+func TestSecretBoxRoundTrip(t *testing.T) {
+	box, err := NewSecretBox(bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatalf("failed to NewSecretBox: %s", err)
+	}
+	sealed, err := box.Seal(rfcTOTPSecret)
+	if err != nil {
+		t.Fatalf("failed to Seal: %s", err)
+	}
+	opened, err := box.Open(sealed)
+	if err != nil || !bytes.Equal(opened, rfcTOTPSecret) {
+		t.Errorf("Open returned %s err: %v expected %s", opened, err, rfcTOTPSecret)
+	}
+	sealed[len(sealed)-1] ^= 1
+	if _, err := box.Open(sealed); err == nil {
+		t.Errorf("Open accepted a tampered ciphertext")
+	}
+}
+
+func TestMFAChallengeJWTIsNotAnAccessToken(t *testing.T) {
+	uid := uuid.New()
+	token, err := MakeMFAChallengeJWT(uid, tokenSecret, time.Minute)
+	if err != nil {
+		t.Fatalf("failed to MakeMFAChallengeJWT: %s", err)
+	}
+	if _, err := ValidateJWT(token, tokenSecret); err == nil {
+		t.Errorf("ValidateJWT accepted an MFA challenge token")
+	}
+	challengeUID, err := ValidateMFAChallengeJWT(token, tokenSecret)
+	if err != nil || challengeUID != uid {
+		t.Errorf("ValidateMFAChallengeJWT returned %s err: %v expected %s", challengeUID, err, uid)
+	}
+}
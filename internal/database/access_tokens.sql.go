@@ -0,0 +1,174 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: access_tokens.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const createAccessToken = `-- name: CreateAccessToken :one
+INSERT INTO access_tokens(
+    jti,
+    created_at,
+    user_id,
+    refresh_token,
+    expires_at
+) VALUES (
+    $1,
+    NOW(),
+    $2,
+    $3,
+    $4
+)
+RETURNING jti, created_at, user_id, refresh_token, expires_at
+`
+
+type CreateAccessTokenParams struct {
+	Jti          string         `json:"jti"`
+	UserID       uuid.UUID      `json:"user_id"`
+	RefreshToken sql.NullString `json:"refresh_token"`
+	ExpiresAt    time.Time      `json:"expires_at"`
+}
+
+func (q *Queries) CreateAccessToken(ctx context.Context, arg CreateAccessTokenParams) (AccessToken, error) {
+	row := q.db.QueryRowContext(ctx, createAccessToken,
+		arg.Jti,
+		arg.UserID,
+		arg.RefreshToken,
+		arg.ExpiresAt,
+	)
+	var i AccessToken
+	err := row.Scan(
+		&i.Jti,
+		&i.CreatedAt,
+		&i.UserID,
+		&i.RefreshToken,
+		&i.ExpiresAt,
+	)
+	return i, err
+}
+
+const deleteExpiredAccessTokens = `-- name: DeleteExpiredAccessTokens :execrows
+DELETE FROM access_tokens
+WHERE expires_at < NOW()
+`
+
+func (q *Queries) DeleteExpiredAccessTokens(ctx context.Context) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteExpiredAccessTokens)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteExpiredDeniedAccessTokens = `-- name: DeleteExpiredDeniedAccessTokens :execrows
+DELETE FROM access_token_denylist
+WHERE expires_at < NOW()
+`
+
+// An expired token is rejected on its own, it doesn't need the denylist.
+func (q *Queries) DeleteExpiredDeniedAccessTokens(ctx context.Context) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteExpiredDeniedAccessTokens)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const denyAccessTokensFromRefreshToken = `-- name: DenyAccessTokensFromRefreshToken :many
+INSERT INTO access_token_denylist(jti, created_at, expires_at)
+SELECT jti, NOW(), expires_at FROM access_tokens
+WHERE refresh_token = $1 AND expires_at > NOW()
+ON CONFLICT (jti) DO NOTHING
+RETURNING jti, expires_at
+`
+
+type DenyAccessTokensFromRefreshTokenRow struct {
+	Jti       string    `json:"jti"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (q *Queries) DenyAccessTokensFromRefreshToken(ctx context.Context, refreshToken sql.NullString) ([]DenyAccessTokensFromRefreshTokenRow, error) {
+	rows, err := q.db.QueryContext(ctx, denyAccessTokensFromRefreshToken, refreshToken)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []DenyAccessTokensFromRefreshTokenRow
+	for rows.Next() {
+		var i DenyAccessTokensFromRefreshTokenRow
+		if err := rows.Scan(&i.Jti, &i.ExpiresAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const denyAccessTokensFromUser = `-- name: DenyAccessTokensFromUser :many
+INSERT INTO access_token_denylist(jti, created_at, expires_at)
+SELECT jti, NOW(), expires_at FROM access_tokens
+WHERE user_id = $1 AND jti <> $2::text AND expires_at > NOW()
+ON CONFLICT (jti) DO NOTHING
+RETURNING jti, expires_at
+`
+
+type DenyAccessTokensFromUserParams struct {
+	UserID  uuid.UUID `json:"user_id"`
+	KeepJti string    `json:"keep_jti"`
+}
+
+type DenyAccessTokensFromUserRow struct {
+	Jti       string    `json:"jti"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (q *Queries) DenyAccessTokensFromUser(ctx context.Context, arg DenyAccessTokensFromUserParams) ([]DenyAccessTokensFromUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, denyAccessTokensFromUser, arg.UserID, arg.KeepJti)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []DenyAccessTokensFromUserRow
+	for rows.Next() {
+		var i DenyAccessTokensFromUserRow
+		if err := rows.Scan(&i.Jti, &i.ExpiresAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const isAccessTokenDenied = `-- name: IsAccessTokenDenied :one
+SELECT EXISTS(
+    SELECT 1 FROM access_token_denylist
+    WHERE jti = $1
+)
+`
+
+func (q *Queries) IsAccessTokenDenied(ctx context.Context, jti string) (bool, error) {
+	row := q.db.QueryRowContext(ctx, isAccessTokenDenied, jti)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
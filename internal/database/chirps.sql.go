@@ -7,10 +7,28 @@ package database
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 )
 
+const countChirpsFromUserSince = `-- name: CountChirpsFromUserSince :one
+SELECT COUNT(*) FROM chirps
+WHERE user_id = $1 AND created_at > $2
+`
+
+type CountChirpsFromUserSinceParams struct {
+	UserID    uuid.UUID `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (q *Queries) CountChirpsFromUserSince(ctx context.Context, arg CountChirpsFromUserSinceParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countChirpsFromUserSince, arg.UserID, arg.CreatedAt)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createChirp = `-- name: CreateChirp :one
 INSERT INTO chirps(
     id,
@@ -81,27 +99,30 @@ func (q *Queries) DeleteChirp(ctx context.Context, arg DeleteChirpParams) (Chirp
 }
 
 const getAllChirps = `-- name: GetAllChirps :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps
+SELECT id, created_at, updated_at, body, user_id, author_username, author_display_name, author_avatar FROM chirps_with_authors
 ORDER BY 
 CASE WHEN UPPER($1::text) = 'ASC' THEN created_at END ASC,
 CASE WHEN UPPER($1::text) = 'DESC' THEN created_at END DESC
 `
 
-func (q *Queries) GetAllChirps(ctx context.Context, sortOrder string) ([]Chirp, error) {
+func (q *Queries) GetAllChirps(ctx context.Context, sortOrder string) ([]ChirpsWithAuthor, error) {
 	rows, err := q.db.QueryContext(ctx, getAllChirps, sortOrder)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []Chirp
+	var items []ChirpsWithAuthor
 	for rows.Next() {
-		var i Chirp
+		var i ChirpsWithAuthor
 		if err := rows.Scan(
 			&i.ID,
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.AuthorUsername,
+			&i.AuthorDisplayName,
+			&i.AuthorAvatar,
 		); err != nil {
 			return nil, err
 		}
@@ -117,7 +138,7 @@ func (q *Queries) GetAllChirps(ctx context.Context, sortOrder string) ([]Chirp,
 }
 
 const getAllChirpsFromUser = `-- name: GetAllChirpsFromUser :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps
+SELECT id, created_at, updated_at, body, user_id, author_username, author_display_name, author_avatar FROM chirps_with_authors
 WHERE user_id = $1
 ORDER BY 
 CASE WHEN UPPER($2::text) = 'ASC' THEN created_at END ASC,
@@ -129,21 +150,24 @@ type GetAllChirpsFromUserParams struct {
 	SortOrder string    `json:"sort_order"`
 }
 
-func (q *Queries) GetAllChirpsFromUser(ctx context.Context, arg GetAllChirpsFromUserParams) ([]Chirp, error) {
+func (q *Queries) GetAllChirpsFromUser(ctx context.Context, arg GetAllChirpsFromUserParams) ([]ChirpsWithAuthor, error) {
 	rows, err := q.db.QueryContext(ctx, getAllChirpsFromUser, arg.UserID, arg.SortOrder)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []Chirp
+	var items []ChirpsWithAuthor
 	for rows.Next() {
-		var i Chirp
+		var i ChirpsWithAuthor
 		if err := rows.Scan(
 			&i.ID,
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.AuthorUsername,
+			&i.AuthorDisplayName,
+			&i.AuthorAvatar,
 		); err != nil {
 			return nil, err
 		}
@@ -159,19 +183,22 @@ func (q *Queries) GetAllChirpsFromUser(ctx context.Context, arg GetAllChirpsFrom
 }
 
 const getChirp = `-- name: GetChirp :one
-SELECT id, created_at, updated_at, body, user_id FROM chirps
+SELECT id, created_at, updated_at, body, user_id, author_username, author_display_name, author_avatar FROM chirps_with_authors
 WHERE id = $1 LIMIT 1
 `
 
-func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
+func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (ChirpsWithAuthor, error) {
 	row := q.db.QueryRowContext(ctx, getChirp, id)
-	var i Chirp
+	var i ChirpsWithAuthor
 	err := row.Scan(
 		&i.ID,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.AuthorUsername,
+		&i.AuthorDisplayName,
+		&i.AuthorAvatar,
 	)
 	return i, err
 }
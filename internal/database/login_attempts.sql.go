@@ -0,0 +1,107 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: login_attempts.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+const deleteLoginAttempts = `-- name: DeleteLoginAttempts :exec
+DELETE FROM login_attempts
+WHERE key = $1
+`
+
+func (q *Queries) DeleteLoginAttempts(ctx context.Context, key string) error {
+	_, err := q.db.ExecContext(ctx, deleteLoginAttempts, key)
+	return err
+}
+
+const deleteStaleLoginAttempts = `-- name: DeleteStaleLoginAttempts :execrows
+DELETE FROM login_attempts
+WHERE last_failure_at < $1::timestamp
+    AND (locked_until IS NULL OR locked_until < $1::timestamp)
+`
+
+// Attempts whose failures are all out of the window and that aren't locked.
+func (q *Queries) DeleteStaleLoginAttempts(ctx context.Context, windowStart time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteStaleLoginAttempts, windowStart)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getLoginAttempts = `-- name: GetLoginAttempts :one
+SELECT key, failures, last_failure_at, locked_until FROM login_attempts
+WHERE key = $1 LIMIT 1
+`
+
+func (q *Queries) GetLoginAttempts(ctx context.Context, key string) (LoginAttempt, error) {
+	row := q.db.QueryRowContext(ctx, getLoginAttempts, key)
+	var i LoginAttempt
+	err := row.Scan(
+		&i.Key,
+		&i.Failures,
+		&i.LastFailureAt,
+		&i.LockedUntil,
+	)
+	return i, err
+}
+
+const lockLoginAttempts = `-- name: LockLoginAttempts :exec
+UPDATE login_attempts
+    SET locked_until = $2
+    WHERE key = $1
+`
+
+type LockLoginAttemptsParams struct {
+	Key         string       `json:"key"`
+	LockedUntil sql.NullTime `json:"locked_until"`
+}
+
+func (q *Queries) LockLoginAttempts(ctx context.Context, arg LockLoginAttemptsParams) error {
+	_, err := q.db.ExecContext(ctx, lockLoginAttempts, arg.Key, arg.LockedUntil)
+	return err
+}
+
+const recordLoginFailure = `-- name: RecordLoginFailure :one
+INSERT INTO login_attempts(
+    key,
+    failures,
+    last_failure_at
+) VALUES (
+    $1,
+    1,
+    $2::timestamp
+)
+ON CONFLICT (key) DO UPDATE
+    SET failures = CASE
+        WHEN login_attempts.last_failure_at < $3::timestamp THEN 1
+        ELSE login_attempts.failures + 1
+    END,
+    last_failure_at = $2::timestamp
+RETURNING key, failures, last_failure_at, locked_until
+`
+
+type RecordLoginFailureParams struct {
+	Key         string    `json:"key"`
+	Now         time.Time `json:"now"`
+	WindowStart time.Time `json:"window_start"`
+}
+
+func (q *Queries) RecordLoginFailure(ctx context.Context, arg RecordLoginFailureParams) (LoginAttempt, error) {
+	row := q.db.QueryRowContext(ctx, recordLoginFailure, arg.Key, arg.Now, arg.WindowStart)
+	var i LoginAttempt
+	err := row.Scan(
+		&i.Key,
+		&i.Failures,
+		&i.LastFailureAt,
+		&i.LockedUntil,
+	)
+	return i, err
+}
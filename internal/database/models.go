@@ -6,11 +6,38 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+type AccessToken struct {
+	Jti          string         `json:"jti"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UserID       uuid.UUID      `json:"user_id"`
+	RefreshToken sql.NullString `json:"refresh_token"`
+	ExpiresAt    time.Time      `json:"expires_at"`
+}
+
+type AccessTokenDenylist struct {
+	Jti       string    `json:"jti"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type ApiToken struct {
+	ID         uuid.UUID    `json:"id"`
+	CreatedAt  time.Time    `json:"created_at"`
+	UserID     uuid.UUID    `json:"user_id"`
+	Name       string       `json:"name"`
+	TokenHash  string       `json:"token_hash"`
+	Scopes     []string     `json:"scopes"`
+	ExpiresAt  time.Time    `json:"expires_at"`
+	LastUsedAt sql.NullTime `json:"last_used_at"`
+	RevokedAt  sql.NullTime `json:"revoked_at"`
+}
+
 type Chirp struct {
 	ID        uuid.UUID `json:"id"`
 	CreatedAt time.Time `json:"created_at"`
@@ -19,20 +46,202 @@ type Chirp struct {
 	UserID    uuid.UUID `json:"user_id"`
 }
 
+type ChirpsWithAuthor struct {
+	ID                uuid.UUID      `json:"id"`
+	CreatedAt         time.Time      `json:"created_at"`
+	UpdatedAt         time.Time      `json:"updated_at"`
+	Body              string         `json:"body"`
+	UserID            uuid.UUID      `json:"user_id"`
+	AuthorUsername    sql.NullString `json:"author_username"`
+	AuthorDisplayName string         `json:"author_display_name"`
+	AuthorAvatar      string         `json:"author_avatar"`
+}
+
+type Follow struct {
+	FollowerID uuid.UUID `json:"follower_id"`
+	FolloweeID uuid.UUID `json:"followee_id"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type LoginAttempt struct {
+	Key           string       `json:"key"`
+	Failures      int32        `json:"failures"`
+	LastFailureAt time.Time    `json:"last_failure_at"`
+	LockedUntil   sql.NullTime `json:"locked_until"`
+}
+
+type OauthClient struct {
+	ID           string         `json:"id"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UserID       uuid.UUID      `json:"user_id"`
+	Name         string         `json:"name"`
+	SecretHash   sql.NullString `json:"secret_hash"`
+	RedirectUris []string       `json:"redirect_uris"`
+	Scopes       []string       `json:"scopes"`
+}
+
+type OauthCode struct {
+	CodeHash      string       `json:"code_hash"`
+	CreatedAt     time.Time    `json:"created_at"`
+	ClientID      string       `json:"client_id"`
+	UserID        uuid.UUID    `json:"user_id"`
+	RedirectUri   string       `json:"redirect_uri"`
+	Scopes        []string     `json:"scopes"`
+	CodeChallenge string       `json:"code_challenge"`
+	ExpiresAt     time.Time    `json:"expires_at"`
+	UsedAt        sql.NullTime `json:"used_at"`
+}
+
+type Outbox struct {
+	ID            uuid.UUID       `json:"id"`
+	CreatedAt     time.Time       `json:"created_at"`
+	EventType     string          `json:"event_type"`
+	UserID        uuid.UUID       `json:"user_id"`
+	Payload       json.RawMessage `json:"payload"`
+	Attempts      int32           `json:"attempts"`
+	NextAttemptAt time.Time       `json:"next_attempt_at"`
+	LockedUntil   sql.NullTime    `json:"locked_until"`
+	LastError     sql.NullString  `json:"last_error"`
+	PublishedAt   sql.NullTime    `json:"published_at"`
+}
+
+type Passkey struct {
+	ID              []byte       `json:"id"`
+	CreatedAt       time.Time    `json:"created_at"`
+	UserID          uuid.UUID    `json:"user_id"`
+	Name            string       `json:"name"`
+	PublicKey       []byte       `json:"public_key"`
+	AttestationType string       `json:"attestation_type"`
+	Aaguid          []byte       `json:"aaguid"`
+	SignCount       int64        `json:"sign_count"`
+	Transports      []string     `json:"transports"`
+	BackupEligible  bool         `json:"backup_eligible"`
+	BackupState     bool         `json:"backup_state"`
+	LastUsedAt      sql.NullTime `json:"last_used_at"`
+}
+
+type RecoveryCode struct {
+	ID        uuid.UUID    `json:"id"`
+	CreatedAt time.Time    `json:"created_at"`
+	UserID    uuid.UUID    `json:"user_id"`
+	CodeHash  string       `json:"code_hash"`
+	UsedAt    sql.NullTime `json:"used_at"`
+}
+
 type RefreshToken struct {
-	Token     string       `json:"token"`
+	Token     string         `json:"token"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	UserID    uuid.UUID      `json:"user_id"`
+	ExpiresAt time.Time      `json:"expires_at"`
+	RevokedAt sql.NullTime   `json:"revoked_at"`
+	ClientID  sql.NullString `json:"client_id"`
+	Scopes    []string       `json:"scopes"`
+}
+
+type Subscription struct {
+	ID               uuid.UUID    `json:"id"`
+	CreatedAt        time.Time    `json:"created_at"`
+	UpdatedAt        time.Time    `json:"updated_at"`
+	UserID           uuid.UUID    `json:"user_id"`
+	Plan             string       `json:"plan"`
+	Status           string       `json:"status"`
+	StartedAt        time.Time    `json:"started_at"`
+	CurrentPeriodEnd time.Time    `json:"current_period_end"`
+	GraceUntil       sql.NullTime `json:"grace_until"`
+	EndedAt          sql.NullTime `json:"ended_at"`
+}
+
+type User struct {
+	ID              uuid.UUID      `json:"id"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	Email           string         `json:"email"`
+	HashedPassword  string         `json:"hashed_password"`
+	IsChirpyRed     bool           `json:"is_chirpy_red"`
+	SuspendedAt     sql.NullTime   `json:"suspended_at"`
+	TotpSecret      []byte         `json:"totp_secret"`
+	TotpEnabledAt   sql.NullTime   `json:"totp_enabled_at"`
+	TotpLastStep    sql.NullInt64  `json:"totp_last_step"`
+	EmailVerifiedAt sql.NullTime   `json:"email_verified_at"`
+	DeletedAt       sql.NullTime   `json:"deleted_at"`
+	PurgeAfter      sql.NullTime   `json:"purge_after"`
+	Username        sql.NullString `json:"username"`
+	DisplayName     string         `json:"display_name"`
+	Bio             string         `json:"bio"`
+	Avatar          string         `json:"avatar"`
+	Role            string         `json:"role"`
+}
+
+type UserIdentity struct {
+	Issuer    string    `json:"issuer"`
+	Subject   string    `json:"subject"`
+	CreatedAt time.Time `json:"created_at"`
+	UserID    uuid.UUID `json:"user_id"`
+	Email     string    `json:"email"`
+}
+
+type UserToken struct {
+	TokenHash string       `json:"token_hash"`
 	CreatedAt time.Time    `json:"created_at"`
-	UpdatedAt time.Time    `json:"updated_at"`
 	UserID    uuid.UUID    `json:"user_id"`
+	Purpose   string       `json:"purpose"`
 	ExpiresAt time.Time    `json:"expires_at"`
-	RevokedAt sql.NullTime `json:"revoked_at"`
+	UsedAt    sql.NullTime `json:"used_at"`
 }
 
-type User struct {
-	ID             uuid.UUID `json:"id"`
-	CreatedAt      time.Time `json:"created_at"`
-	UpdatedAt      time.Time `json:"updated_at"`
-	Email          string    `json:"email"`
-	HashedPassword string    `json:"hashed_password"`
-	IsChirpyRed    bool      `json:"is_chirpy_red"`
+type WebauthnSession struct {
+	ID        uuid.UUID     `json:"id"`
+	CreatedAt time.Time     `json:"created_at"`
+	UserID    uuid.NullUUID `json:"user_id"`
+	Data      []byte        `json:"data"`
+	ExpiresAt time.Time     `json:"expires_at"`
+}
+
+type WebhookDelivery struct {
+	ID             uuid.UUID       `json:"id"`
+	CreatedAt      time.Time       `json:"created_at"`
+	EndpointID     uuid.UUID       `json:"endpoint_id"`
+	EventID        uuid.UUID       `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int32           `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	LockedUntil    sql.NullTime    `json:"locked_until"`
+	LastStatusCode sql.NullInt32   `json:"last_status_code"`
+	LastError      sql.NullString  `json:"last_error"`
+	DeliveredAt    sql.NullTime    `json:"delivered_at"`
+}
+
+type WebhookDeliveryAttempt struct {
+	ID          uuid.UUID      `json:"id"`
+	DeliveryID  uuid.UUID      `json:"delivery_id"`
+	AttemptedAt time.Time      `json:"attempted_at"`
+	StatusCode  sql.NullInt32  `json:"status_code"`
+	Error       sql.NullString `json:"error"`
+	DurationMs  int32          `json:"duration_ms"`
+}
+
+type WebhookEndpoint struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UserID    uuid.UUID `json:"user_id"`
+	Url       string    `json:"url"`
+	Secret    []byte    `json:"secret"`
+	Events    []string  `json:"events"`
+	AllUsers  bool      `json:"all_users"`
+}
+
+type WebhookEvent struct {
+	ID          uuid.UUID       `json:"id"`
+	Source      string          `json:"source"`
+	EventID     string          `json:"event_id"`
+	EventType   string          `json:"event_type"`
+	Payload     json.RawMessage `json:"payload"`
+	ReceivedAt  time.Time       `json:"received_at"`
+	ProcessedAt sql.NullTime    `json:"processed_at"`
+	Status      string          `json:"status"`
+	Error       sql.NullString  `json:"error"`
+	Attempts    int32           `json:"attempts"`
 }
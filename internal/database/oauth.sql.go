@@ -0,0 +1,412 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: oauth.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const createOAuthClient = `-- name: CreateOAuthClient :one
+INSERT INTO oauth_clients(
+    id,
+    created_at,
+    user_id,
+    name,
+    secret_hash,
+    redirect_uris,
+    scopes
+) VALUES (
+    $1,
+    NOW(),
+    $2,
+    $3,
+    $4,
+    $5,
+    $6
+)
+RETURNING id, created_at, user_id, name, secret_hash, redirect_uris, scopes
+`
+
+type CreateOAuthClientParams struct {
+	ID           string         `json:"id"`
+	UserID       uuid.UUID      `json:"user_id"`
+	Name         string         `json:"name"`
+	SecretHash   sql.NullString `json:"secret_hash"`
+	RedirectUris []string       `json:"redirect_uris"`
+	Scopes       []string       `json:"scopes"`
+}
+
+func (q *Queries) CreateOAuthClient(ctx context.Context, arg CreateOAuthClientParams) (OauthClient, error) {
+	row := q.db.QueryRowContext(ctx, createOAuthClient,
+		arg.ID,
+		arg.UserID,
+		arg.Name,
+		arg.SecretHash,
+		pq.Array(arg.RedirectUris),
+		pq.Array(arg.Scopes),
+	)
+	var i OauthClient
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UserID,
+		&i.Name,
+		&i.SecretHash,
+		pq.Array(&i.RedirectUris),
+		pq.Array(&i.Scopes),
+	)
+	return i, err
+}
+
+const createOAuthCode = `-- name: CreateOAuthCode :exec
+INSERT INTO oauth_codes(
+    code_hash,
+    created_at,
+    client_id,
+    user_id,
+    redirect_uri,
+    scopes,
+    code_challenge,
+    expires_at
+) VALUES (
+    $1,
+    NOW(),
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7
+)
+`
+
+type CreateOAuthCodeParams struct {
+	CodeHash      string    `json:"code_hash"`
+	ClientID      string    `json:"client_id"`
+	UserID        uuid.UUID `json:"user_id"`
+	RedirectUri   string    `json:"redirect_uri"`
+	Scopes        []string  `json:"scopes"`
+	CodeChallenge string    `json:"code_challenge"`
+	ExpiresAt     time.Time `json:"expires_at"`
+}
+
+func (q *Queries) CreateOAuthCode(ctx context.Context, arg CreateOAuthCodeParams) error {
+	_, err := q.db.ExecContext(ctx, createOAuthCode,
+		arg.CodeHash,
+		arg.ClientID,
+		arg.UserID,
+		arg.RedirectUri,
+		pq.Array(arg.Scopes),
+		arg.CodeChallenge,
+		arg.ExpiresAt,
+	)
+	return err
+}
+
+const createOAuthRefreshToken = `-- name: CreateOAuthRefreshToken :one
+INSERT INTO refresh_tokens(
+    token,
+    created_at,
+    updated_at,
+    user_id,
+    expires_at,
+    client_id,
+    scopes
+) VALUES (
+    $1,
+    NOW(),
+    NOW(),
+    $2,
+    $3,
+    $4,
+    $5
+)
+RETURNING token, created_at, updated_at, user_id, expires_at, revoked_at, client_id, scopes
+`
+
+type CreateOAuthRefreshTokenParams struct {
+	Token     string         `json:"token"`
+	UserID    uuid.UUID      `json:"user_id"`
+	ExpiresAt time.Time      `json:"expires_at"`
+	ClientID  sql.NullString `json:"client_id"`
+	Scopes    []string       `json:"scopes"`
+}
+
+func (q *Queries) CreateOAuthRefreshToken(ctx context.Context, arg CreateOAuthRefreshTokenParams) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, createOAuthRefreshToken,
+		arg.Token,
+		arg.UserID,
+		arg.ExpiresAt,
+		arg.ClientID,
+		pq.Array(arg.Scopes),
+	)
+	var i RefreshToken
+	err := row.Scan(
+		&i.Token,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.ClientID,
+		pq.Array(&i.Scopes),
+	)
+	return i, err
+}
+
+const deleteExpiredOAuthCodes = `-- name: DeleteExpiredOAuthCodes :execrows
+DELETE FROM oauth_codes
+WHERE expires_at < NOW()
+`
+
+func (q *Queries) DeleteExpiredOAuthCodes(ctx context.Context) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteExpiredOAuthCodes)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteOAuthClient = `-- name: DeleteOAuthClient :execrows
+DELETE FROM oauth_clients
+WHERE id = $1 AND user_id = $2
+`
+
+type DeleteOAuthClientParams struct {
+	ID     string    `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+}
+
+func (q *Queries) DeleteOAuthClient(ctx context.Context, arg DeleteOAuthClientParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteOAuthClient, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const denyAccessToken = `-- name: DenyAccessToken :exec
+INSERT INTO access_token_denylist(jti, created_at, expires_at)
+VALUES ($1, NOW(), $2)
+ON CONFLICT (jti) DO NOTHING
+`
+
+type DenyAccessTokenParams struct {
+	Jti       string    `json:"jti"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (q *Queries) DenyAccessToken(ctx context.Context, arg DenyAccessTokenParams) error {
+	_, err := q.db.ExecContext(ctx, denyAccessToken, arg.Jti, arg.ExpiresAt)
+	return err
+}
+
+const denyAccessTokensFromClient = `-- name: DenyAccessTokensFromClient :many
+INSERT INTO access_token_denylist(jti, created_at, expires_at)
+SELECT access_tokens.jti, NOW(), access_tokens.expires_at FROM access_tokens
+JOIN refresh_tokens ON refresh_tokens.token = access_tokens.refresh_token
+WHERE refresh_tokens.client_id = $1 AND refresh_tokens.user_id = $2
+    AND access_tokens.expires_at > NOW()
+ON CONFLICT (jti) DO NOTHING
+RETURNING jti, expires_at
+`
+
+type DenyAccessTokensFromClientParams struct {
+	ClientID sql.NullString `json:"client_id"`
+	UserID   uuid.UUID      `json:"user_id"`
+}
+
+type DenyAccessTokensFromClientRow struct {
+	Jti       string    `json:"jti"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (q *Queries) DenyAccessTokensFromClient(ctx context.Context, arg DenyAccessTokensFromClientParams) ([]DenyAccessTokensFromClientRow, error) {
+	rows, err := q.db.QueryContext(ctx, denyAccessTokensFromClient, arg.ClientID, arg.UserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []DenyAccessTokensFromClientRow
+	for rows.Next() {
+		var i DenyAccessTokensFromClientRow
+		if err := rows.Scan(&i.Jti, &i.ExpiresAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const denyAllAccessTokensFromClient = `-- name: DenyAllAccessTokensFromClient :many
+INSERT INTO access_token_denylist(jti, created_at, expires_at)
+SELECT access_tokens.jti, NOW(), access_tokens.expires_at FROM access_tokens
+JOIN refresh_tokens ON refresh_tokens.token = access_tokens.refresh_token
+JOIN oauth_clients ON oauth_clients.id = refresh_tokens.client_id
+WHERE oauth_clients.id = $1 AND oauth_clients.user_id = $2
+    AND access_tokens.expires_at > NOW()
+ON CONFLICT (jti) DO NOTHING
+RETURNING jti, expires_at
+`
+
+type DenyAllAccessTokensFromClientParams struct {
+	ID     string    `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+}
+
+type DenyAllAccessTokensFromClientRow struct {
+	Jti       string    `json:"jti"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Every live access token of the client, for every user, if "user_id" owns it.
+func (q *Queries) DenyAllAccessTokensFromClient(ctx context.Context, arg DenyAllAccessTokensFromClientParams) ([]DenyAllAccessTokensFromClientRow, error) {
+	rows, err := q.db.QueryContext(ctx, denyAllAccessTokensFromClient, arg.ID, arg.UserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []DenyAllAccessTokensFromClientRow
+	for rows.Next() {
+		var i DenyAllAccessTokensFromClientRow
+		if err := rows.Scan(&i.Jti, &i.ExpiresAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getOAuthClient = `-- name: GetOAuthClient :one
+SELECT id, created_at, user_id, name, secret_hash, redirect_uris, scopes FROM oauth_clients
+WHERE id = $1 LIMIT 1
+`
+
+func (q *Queries) GetOAuthClient(ctx context.Context, id string) (OauthClient, error) {
+	row := q.db.QueryRowContext(ctx, getOAuthClient, id)
+	var i OauthClient
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UserID,
+		&i.Name,
+		&i.SecretHash,
+		pq.Array(&i.RedirectUris),
+		pq.Array(&i.Scopes),
+	)
+	return i, err
+}
+
+const getOAuthClientsFromUser = `-- name: GetOAuthClientsFromUser :many
+SELECT id, created_at, user_id, name, secret_hash, redirect_uris, scopes FROM oauth_clients
+WHERE user_id = $1
+ORDER BY created_at DESC
+`
+
+func (q *Queries) GetOAuthClientsFromUser(ctx context.Context, userID uuid.UUID) ([]OauthClient, error) {
+	rows, err := q.db.QueryContext(ctx, getOAuthClientsFromUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []OauthClient
+	for rows.Next() {
+		var i OauthClient
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UserID,
+			&i.Name,
+			&i.SecretHash,
+			pq.Array(&i.RedirectUris),
+			pq.Array(&i.Scopes),
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const revokeOAuthRefreshToken = `-- name: RevokeOAuthRefreshToken :execrows
+UPDATE refresh_tokens
+    SET revoked_at = NOW(),
+    updated_at = NOW()
+    WHERE token = $1 AND revoked_at IS NULL
+`
+
+// Only if it isn't revoked yet, so a refresh token is rotated at most once.
+func (q *Queries) RevokeOAuthRefreshToken(ctx context.Context, token string) (int64, error) {
+	result, err := q.db.ExecContext(ctx, revokeOAuthRefreshToken, token)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const revokeOAuthRefreshTokensFromClient = `-- name: RevokeOAuthRefreshTokensFromClient :exec
+UPDATE refresh_tokens
+    SET revoked_at = NOW(),
+    updated_at = NOW()
+    WHERE client_id = $1 AND user_id = $2 AND revoked_at IS NULL
+`
+
+type RevokeOAuthRefreshTokensFromClientParams struct {
+	ClientID sql.NullString `json:"client_id"`
+	UserID   uuid.UUID      `json:"user_id"`
+}
+
+func (q *Queries) RevokeOAuthRefreshTokensFromClient(ctx context.Context, arg RevokeOAuthRefreshTokensFromClientParams) error {
+	_, err := q.db.ExecContext(ctx, revokeOAuthRefreshTokensFromClient, arg.ClientID, arg.UserID)
+	return err
+}
+
+const useOAuthCode = `-- name: UseOAuthCode :one
+UPDATE oauth_codes
+    SET used_at = NOW()
+    WHERE code_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+RETURNING code_hash, created_at, client_id, user_id, redirect_uri, scopes, code_challenge, expires_at, used_at
+`
+
+func (q *Queries) UseOAuthCode(ctx context.Context, codeHash string) (OauthCode, error) {
+	row := q.db.QueryRowContext(ctx, useOAuthCode, codeHash)
+	var i OauthCode
+	err := row.Scan(
+		&i.CodeHash,
+		&i.CreatedAt,
+		&i.ClientID,
+		&i.UserID,
+		&i.RedirectUri,
+		pq.Array(&i.Scopes),
+		&i.CodeChallenge,
+		&i.ExpiresAt,
+		&i.UsedAt,
+	)
+	return i, err
+}
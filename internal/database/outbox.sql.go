@@ -0,0 +1,154 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: outbox.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const claimOutboxEvents = `-- name: ClaimOutboxEvents :many
+UPDATE outbox
+    SET locked_until = $1::timestamp
+    WHERE outbox.id IN (
+        SELECT due.id FROM outbox AS due
+        WHERE due.published_at IS NULL
+            AND due.next_attempt_at <= NOW()
+            AND (due.locked_until IS NULL OR due.locked_until <= NOW())
+        ORDER BY due.created_at
+        LIMIT $2
+        FOR UPDATE SKIP LOCKED
+    )
+RETURNING id, created_at, event_type, user_id, payload, attempts, next_attempt_at, locked_until, last_error, published_at
+`
+
+type ClaimOutboxEventsParams struct {
+	LockedUntil time.Time `json:"locked_until"`
+	BatchSize   int32     `json:"batch_size"`
+}
+
+// Lock the unpublished events that are due until "locked_until", oldest
+// first, SKIP LOCKED lets every instance claim a different batch.
+func (q *Queries) ClaimOutboxEvents(ctx context.Context, arg ClaimOutboxEventsParams) ([]Outbox, error) {
+	rows, err := q.db.QueryContext(ctx, claimOutboxEvents, arg.LockedUntil, arg.BatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Outbox
+	for rows.Next() {
+		var i Outbox
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.EventType,
+			&i.UserID,
+			&i.Payload,
+			&i.Attempts,
+			&i.NextAttemptAt,
+			&i.LockedUntil,
+			&i.LastError,
+			&i.PublishedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const createOutboxEvent = `-- name: CreateOutboxEvent :exec
+INSERT INTO outbox(
+    id,
+    created_at,
+    event_type,
+    user_id,
+    payload,
+    next_attempt_at
+) VALUES (
+    $1,
+    NOW(),
+    $2,
+    $3,
+    $4,
+    NOW()
+)
+`
+
+type CreateOutboxEventParams struct {
+	ID        uuid.UUID       `json:"id"`
+	EventType string          `json:"event_type"`
+	UserID    uuid.UUID       `json:"user_id"`
+	Payload   json.RawMessage `json:"payload"`
+}
+
+// Meant to be run in the transaction of the change the event is about.
+func (q *Queries) CreateOutboxEvent(ctx context.Context, arg CreateOutboxEventParams) error {
+	_, err := q.db.ExecContext(ctx, createOutboxEvent,
+		arg.ID,
+		arg.EventType,
+		arg.UserID,
+		arg.Payload,
+	)
+	return err
+}
+
+const deletePublishedOutboxEvents = `-- name: DeletePublishedOutboxEvents :execrows
+DELETE FROM outbox
+WHERE published_at < $1::timestamp
+`
+
+func (q *Queries) DeletePublishedOutboxEvents(ctx context.Context, publishedBefore time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deletePublishedOutboxEvents, publishedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const markOutboxEventPublished = `-- name: MarkOutboxEventPublished :exec
+UPDATE outbox
+    SET published_at = NOW(),
+    attempts = attempts + 1,
+    locked_until = NULL,
+    last_error = NULL
+    WHERE id = $1
+`
+
+func (q *Queries) MarkOutboxEventPublished(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, markOutboxEventPublished, id)
+	return err
+}
+
+const recordOutboxEventFailure = `-- name: RecordOutboxEventFailure :exec
+UPDATE outbox
+    SET attempts = attempts + 1,
+    next_attempt_at = $2,
+    locked_until = NULL,
+    last_error = $3
+    WHERE id = $1
+`
+
+type RecordOutboxEventFailureParams struct {
+	ID            uuid.UUID      `json:"id"`
+	NextAttemptAt time.Time      `json:"next_attempt_at"`
+	LastError     sql.NullString `json:"last_error"`
+}
+
+func (q *Queries) RecordOutboxEventFailure(ctx context.Context, arg RecordOutboxEventFailureParams) error {
+	_, err := q.db.ExecContext(ctx, recordOutboxEventFailure, arg.ID, arg.NextAttemptAt, arg.LastError)
+	return err
+}
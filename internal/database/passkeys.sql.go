@@ -0,0 +1,226 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: passkeys.sql
+
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const createPasskey = `-- name: CreatePasskey :one
+INSERT INTO passkeys(
+    id,
+    created_at,
+    user_id,
+    name,
+    public_key,
+    attestation_type,
+    aaguid,
+    sign_count,
+    transports,
+    backup_eligible,
+    backup_state
+) VALUES (
+    $1,
+    NOW(),
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    $8,
+    $9,
+    $10
+)
+RETURNING id, created_at, user_id, name, public_key, attestation_type, aaguid, sign_count, transports, backup_eligible, backup_state, last_used_at
+`
+
+type CreatePasskeyParams struct {
+	ID              []byte    `json:"id"`
+	UserID          uuid.UUID `json:"user_id"`
+	Name            string    `json:"name"`
+	PublicKey       []byte    `json:"public_key"`
+	AttestationType string    `json:"attestation_type"`
+	Aaguid          []byte    `json:"aaguid"`
+	SignCount       int64     `json:"sign_count"`
+	Transports      []string  `json:"transports"`
+	BackupEligible  bool      `json:"backup_eligible"`
+	BackupState     bool      `json:"backup_state"`
+}
+
+func (q *Queries) CreatePasskey(ctx context.Context, arg CreatePasskeyParams) (Passkey, error) {
+	row := q.db.QueryRowContext(ctx, createPasskey,
+		arg.ID,
+		arg.UserID,
+		arg.Name,
+		arg.PublicKey,
+		arg.AttestationType,
+		arg.Aaguid,
+		arg.SignCount,
+		pq.Array(arg.Transports),
+		arg.BackupEligible,
+		arg.BackupState,
+	)
+	var i Passkey
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UserID,
+		&i.Name,
+		&i.PublicKey,
+		&i.AttestationType,
+		&i.Aaguid,
+		&i.SignCount,
+		pq.Array(&i.Transports),
+		&i.BackupEligible,
+		&i.BackupState,
+		&i.LastUsedAt,
+	)
+	return i, err
+}
+
+const createWebAuthnSession = `-- name: CreateWebAuthnSession :one
+INSERT INTO webauthn_sessions(
+    id,
+    created_at,
+    user_id,
+    data,
+    expires_at
+) VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3
+)
+RETURNING id
+`
+
+type CreateWebAuthnSessionParams struct {
+	UserID    uuid.NullUUID `json:"user_id"`
+	Data      []byte        `json:"data"`
+	ExpiresAt time.Time     `json:"expires_at"`
+}
+
+func (q *Queries) CreateWebAuthnSession(ctx context.Context, arg CreateWebAuthnSessionParams) (uuid.UUID, error) {
+	row := q.db.QueryRowContext(ctx, createWebAuthnSession, arg.UserID, arg.Data, arg.ExpiresAt)
+	var id uuid.UUID
+	err := row.Scan(&id)
+	return id, err
+}
+
+const deleteExpiredWebAuthnSessions = `-- name: DeleteExpiredWebAuthnSessions :exec
+DELETE FROM webauthn_sessions
+WHERE expires_at < NOW()
+`
+
+func (q *Queries) DeleteExpiredWebAuthnSessions(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, deleteExpiredWebAuthnSessions)
+	return err
+}
+
+const deletePasskey = `-- name: DeletePasskey :execrows
+DELETE FROM passkeys
+WHERE id = $1 AND user_id = $2
+`
+
+type DeletePasskeyParams struct {
+	ID     []byte    `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+}
+
+func (q *Queries) DeletePasskey(ctx context.Context, arg DeletePasskeyParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deletePasskey, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getPasskeysFromUser = `-- name: GetPasskeysFromUser :many
+SELECT id, created_at, user_id, name, public_key, attestation_type, aaguid, sign_count, transports, backup_eligible, backup_state, last_used_at FROM passkeys
+WHERE user_id = $1
+ORDER BY created_at
+`
+
+func (q *Queries) GetPasskeysFromUser(ctx context.Context, userID uuid.UUID) ([]Passkey, error) {
+	rows, err := q.db.QueryContext(ctx, getPasskeysFromUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Passkey
+	for rows.Next() {
+		var i Passkey
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UserID,
+			&i.Name,
+			&i.PublicKey,
+			&i.AttestationType,
+			&i.Aaguid,
+			&i.SignCount,
+			pq.Array(&i.Transports),
+			&i.BackupEligible,
+			&i.BackupState,
+			&i.LastUsedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const usePasskey = `-- name: UsePasskey :exec
+UPDATE passkeys
+    SET sign_count = $2,
+    backup_state = $3,
+    last_used_at = NOW()
+    WHERE id = $1
+`
+
+type UsePasskeyParams struct {
+	ID          []byte `json:"id"`
+	SignCount   int64  `json:"sign_count"`
+	BackupState bool   `json:"backup_state"`
+}
+
+func (q *Queries) UsePasskey(ctx context.Context, arg UsePasskeyParams) error {
+	_, err := q.db.ExecContext(ctx, usePasskey, arg.ID, arg.SignCount, arg.BackupState)
+	return err
+}
+
+const useWebAuthnSession = `-- name: UseWebAuthnSession :one
+DELETE FROM webauthn_sessions
+WHERE id = $1
+RETURNING id, created_at, user_id, data, expires_at
+`
+
+// A session can only be used once, it's deleted even when it's expired.
+func (q *Queries) UseWebAuthnSession(ctx context.Context, id uuid.UUID) (WebauthnSession, error) {
+	row := q.db.QueryRowContext(ctx, useWebAuthnSession, id)
+	var i WebauthnSession
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UserID,
+		&i.Data,
+		&i.ExpiresAt,
+	)
+	return i, err
+}
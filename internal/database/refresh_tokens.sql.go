@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 const createRefreshToken = `-- name: CreateRefreshToken :one
@@ -26,7 +27,7 @@ INSERT INTO refresh_tokens(
     $2,
     $3
 )
-RETURNING token, created_at, updated_at, user_id, expires_at, revoked_at
+RETURNING token, created_at, updated_at, user_id, expires_at, revoked_at, client_id, scopes
 `
 
 type CreateRefreshTokenParams struct {
@@ -45,6 +46,8 @@ func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshToken
 		&i.UserID,
 		&i.ExpiresAt,
 		&i.RevokedAt,
+		&i.ClientID,
+		pq.Array(&i.Scopes),
 	)
 	return i, err
 }
@@ -59,7 +62,7 @@ func (q *Queries) DeleteAllRefreshTokens(ctx context.Context) error {
 }
 
 const getRefreshToken = `-- name: GetRefreshToken :one
-SELECT token, created_at, updated_at, user_id, expires_at, revoked_at FROM refresh_tokens
+SELECT token, created_at, updated_at, user_id, expires_at, revoked_at, client_id, scopes FROM refresh_tokens
 WHERE token = $1 LIMIT 1
 `
 
@@ -73,10 +76,83 @@ func (q *Queries) GetRefreshToken(ctx context.Context, token string) (RefreshTok
 		&i.UserID,
 		&i.ExpiresAt,
 		&i.RevokedAt,
+		&i.ClientID,
+		pq.Array(&i.Scopes),
 	)
 	return i, err
 }
 
+const getRefreshTokensFromUser = `-- name: GetRefreshTokensFromUser :many
+SELECT token, created_at, updated_at, user_id, expires_at, revoked_at, client_id, scopes FROM refresh_tokens
+WHERE user_id = $1
+ORDER BY created_at DESC
+`
+
+func (q *Queries) GetRefreshTokensFromUser(ctx context.Context, userID uuid.UUID) ([]RefreshToken, error) {
+	rows, err := q.db.QueryContext(ctx, getRefreshTokensFromUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []RefreshToken
+	for rows.Next() {
+		var i RefreshToken
+		if err := rows.Scan(
+			&i.Token,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.ExpiresAt,
+			&i.RevokedAt,
+			&i.ClientID,
+			pq.Array(&i.Scopes),
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const revokeAllRefreshTokensFromUser = `-- name: RevokeAllRefreshTokensFromUser :exec
+UPDATE refresh_tokens
+    SET revoked_at = NOW(),
+    updated_at = NOW()
+    WHERE user_id = $1 AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeAllRefreshTokensFromUser(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, revokeAllRefreshTokensFromUser, userID)
+	return err
+}
+
+const revokeOtherRefreshTokensFromUser = `-- name: RevokeOtherRefreshTokensFromUser :exec
+UPDATE refresh_tokens
+    SET revoked_at = NOW(),
+    updated_at = NOW()
+    WHERE refresh_tokens.user_id = $1 AND revoked_at IS NULL
+    AND token IS DISTINCT FROM (
+        SELECT refresh_token FROM access_tokens
+        WHERE jti = $2::text
+    )
+`
+
+type RevokeOtherRefreshTokensFromUserParams struct {
+	UserID  uuid.UUID `json:"user_id"`
+	KeepJti string    `json:"keep_jti"`
+}
+
+func (q *Queries) RevokeOtherRefreshTokensFromUser(ctx context.Context, arg RevokeOtherRefreshTokensFromUserParams) error {
+	_, err := q.db.ExecContext(ctx, revokeOtherRefreshTokensFromUser, arg.UserID, arg.KeepJti)
+	return err
+}
+
 const revokeRefreshToken = `-- name: RevokeRefreshToken :exec
 UPDATE refresh_tokens
     SET revoked_at = NOW(),
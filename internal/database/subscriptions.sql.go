@@ -0,0 +1,266 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: subscriptions.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const cancelSubscription = `-- name: CancelSubscription :one
+WITH canceled AS (
+    UPDATE subscriptions
+        SET status = 'canceled',
+        ended_at = NOW(),
+        updated_at = NOW()
+        WHERE subscriptions.id = $1
+    RETURNING subscriptions.user_id
+)
+UPDATE users
+    SET is_chirpy_red = FALSE,
+    updated_at = NOW()
+    WHERE users.id IN (SELECT user_id FROM canceled)
+RETURNING users.id
+`
+
+func (q *Queries) CancelSubscription(ctx context.Context, id uuid.UUID) (uuid.UUID, error) {
+	row := q.db.QueryRowContext(ctx, cancelSubscription, id)
+	err := row.Scan(&id)
+	return id, err
+}
+
+const expireLapsedSubscriptions = `-- name: ExpireLapsedSubscriptions :many
+WITH expired AS (
+    UPDATE subscriptions
+        SET status = 'expired',
+        ended_at = NOW(),
+        updated_at = NOW()
+        WHERE (subscriptions.status = 'active' AND subscriptions.current_period_end < $1)
+        OR (subscriptions.status = 'past_due' AND subscriptions.grace_until < NOW())
+    RETURNING subscriptions.user_id
+)
+UPDATE users
+    SET is_chirpy_red = FALSE,
+    updated_at = NOW()
+    WHERE users.id IN (SELECT user_id FROM expired)
+RETURNING users.id
+`
+
+// Active subscriptions whose period ended before "lapsed_before" (now minus
+// the grace period) without a renewal, and past due ones whose grace period
+// is over.
+func (q *Queries) ExpireLapsedSubscriptions(ctx context.Context, lapsedBefore time.Time) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, expireLapsedSubscriptions, lapsedBefore)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getLiveSubscription = `-- name: GetLiveSubscription :one
+SELECT id, created_at, updated_at, user_id, plan, status, started_at, current_period_end, grace_until, ended_at FROM subscriptions
+WHERE user_id = $1 AND status IN ('active', 'past_due')
+`
+
+func (q *Queries) GetLiveSubscription(ctx context.Context, userID uuid.UUID) (Subscription, error) {
+	row := q.db.QueryRowContext(ctx, getLiveSubscription, userID)
+	var i Subscription
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Plan,
+		&i.Status,
+		&i.StartedAt,
+		&i.CurrentPeriodEnd,
+		&i.GraceUntil,
+		&i.EndedAt,
+	)
+	return i, err
+}
+
+const getSubscriptionsFromUser = `-- name: GetSubscriptionsFromUser :many
+SELECT id, created_at, updated_at, user_id, plan, status, started_at, current_period_end, grace_until, ended_at FROM subscriptions
+WHERE user_id = $1
+ORDER BY started_at
+`
+
+func (q *Queries) GetSubscriptionsFromUser(ctx context.Context, userID uuid.UUID) ([]Subscription, error) {
+	rows, err := q.db.QueryContext(ctx, getSubscriptionsFromUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Subscription
+	for rows.Next() {
+		var i Subscription
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.Plan,
+			&i.Status,
+			&i.StartedAt,
+			&i.CurrentPeriodEnd,
+			&i.GraceUntil,
+			&i.EndedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markSubscriptionPastDue = `-- name: MarkSubscriptionPastDue :one
+UPDATE subscriptions
+    SET status = 'past_due',
+    grace_until = COALESCE(grace_until, $2),
+    updated_at = NOW()
+    WHERE id = $1
+RETURNING id, created_at, updated_at, user_id, plan, status, started_at, current_period_end, grace_until, ended_at
+`
+
+type MarkSubscriptionPastDueParams struct {
+	ID         uuid.UUID    `json:"id"`
+	GraceUntil sql.NullTime `json:"grace_until"`
+}
+
+// Failing again while past due doesn't extend the grace period.
+func (q *Queries) MarkSubscriptionPastDue(ctx context.Context, arg MarkSubscriptionPastDueParams) (Subscription, error) {
+	row := q.db.QueryRowContext(ctx, markSubscriptionPastDue, arg.ID, arg.GraceUntil)
+	var i Subscription
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Plan,
+		&i.Status,
+		&i.StartedAt,
+		&i.CurrentPeriodEnd,
+		&i.GraceUntil,
+		&i.EndedAt,
+	)
+	return i, err
+}
+
+const renewSubscription = `-- name: RenewSubscription :one
+UPDATE subscriptions
+    SET status = 'active',
+    plan = $2,
+    current_period_end = $3,
+    grace_until = NULL,
+    updated_at = NOW()
+    WHERE id = $1
+RETURNING id, created_at, updated_at, user_id, plan, status, started_at, current_period_end, grace_until, ended_at
+`
+
+type RenewSubscriptionParams struct {
+	ID               uuid.UUID `json:"id"`
+	Plan             string    `json:"plan"`
+	CurrentPeriodEnd time.Time `json:"current_period_end"`
+}
+
+func (q *Queries) RenewSubscription(ctx context.Context, arg RenewSubscriptionParams) (Subscription, error) {
+	row := q.db.QueryRowContext(ctx, renewSubscription, arg.ID, arg.Plan, arg.CurrentPeriodEnd)
+	var i Subscription
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Plan,
+		&i.Status,
+		&i.StartedAt,
+		&i.CurrentPeriodEnd,
+		&i.GraceUntil,
+		&i.EndedAt,
+	)
+	return i, err
+}
+
+const startSubscription = `-- name: StartSubscription :one
+WITH upgraded AS (
+    UPDATE users
+        SET is_chirpy_red = TRUE,
+        updated_at = NOW()
+        WHERE users.id = $3
+    RETURNING users.id
+)
+INSERT INTO subscriptions(
+    id,
+    created_at,
+    updated_at,
+    user_id,
+    plan,
+    status,
+    started_at,
+    current_period_end
+)
+SELECT
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    upgraded.id,
+    $1,
+    'active',
+    NOW(),
+    $2
+FROM upgraded
+RETURNING id, created_at, updated_at, user_id, plan, status, started_at, current_period_end, grace_until, ended_at
+`
+
+type StartSubscriptionParams struct {
+	Plan             string    `json:"plan"`
+	CurrentPeriodEnd time.Time `json:"current_period_end"`
+	UserID           uuid.UUID `json:"user_id"`
+}
+
+// Fails with no rows when the user doesn't exist.
+func (q *Queries) StartSubscription(ctx context.Context, arg StartSubscriptionParams) (Subscription, error) {
+	row := q.db.QueryRowContext(ctx, startSubscription, arg.Plan, arg.CurrentPeriodEnd, arg.UserID)
+	var i Subscription
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Plan,
+		&i.Status,
+		&i.StartedAt,
+		&i.CurrentPeriodEnd,
+		&i.GraceUntil,
+		&i.EndedAt,
+	)
+	return i, err
+}
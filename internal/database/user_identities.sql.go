@@ -0,0 +1,62 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: user_identities.sql
+
+package database
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+const createUserIdentity = `-- name: CreateUserIdentity :exec
+INSERT INTO user_identities(
+    issuer,
+    subject,
+    created_at,
+    user_id,
+    email
+) VALUES (
+    $1,
+    $2,
+    NOW(),
+    $3,
+    $4
+)
+`
+
+type CreateUserIdentityParams struct {
+	Issuer  string    `json:"issuer"`
+	Subject string    `json:"subject"`
+	UserID  uuid.UUID `json:"user_id"`
+	Email   string    `json:"email"`
+}
+
+func (q *Queries) CreateUserIdentity(ctx context.Context, arg CreateUserIdentityParams) error {
+	_, err := q.db.ExecContext(ctx, createUserIdentity,
+		arg.Issuer,
+		arg.Subject,
+		arg.UserID,
+		arg.Email,
+	)
+	return err
+}
+
+const getUserIDByIdentity = `-- name: GetUserIDByIdentity :one
+SELECT user_id FROM user_identities
+WHERE issuer = $1 AND subject = $2
+`
+
+type GetUserIDByIdentityParams struct {
+	Issuer  string `json:"issuer"`
+	Subject string `json:"subject"`
+}
+
+func (q *Queries) GetUserIDByIdentity(ctx context.Context, arg GetUserIDByIdentityParams) (uuid.UUID, error) {
+	row := q.db.QueryRowContext(ctx, getUserIDByIdentity, arg.Issuer, arg.Subject)
+	var user_id uuid.UUID
+	err := row.Scan(&user_id)
+	return user_id, err
+}
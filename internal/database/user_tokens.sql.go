@@ -0,0 +1,80 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: user_tokens.sql
+
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const createUserToken = `-- name: CreateUserToken :exec
+INSERT INTO user_tokens(
+    token_hash,
+    created_at,
+    user_id,
+    purpose,
+    expires_at
+) VALUES (
+    $1,
+    NOW(),
+    $2,
+    $3,
+    $4
+)
+`
+
+type CreateUserTokenParams struct {
+	TokenHash string    `json:"token_hash"`
+	UserID    uuid.UUID `json:"user_id"`
+	Purpose   string    `json:"purpose"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (q *Queries) CreateUserToken(ctx context.Context, arg CreateUserTokenParams) error {
+	_, err := q.db.ExecContext(ctx, createUserToken,
+		arg.TokenHash,
+		arg.UserID,
+		arg.Purpose,
+		arg.ExpiresAt,
+	)
+	return err
+}
+
+const deleteUserTokensFromUser = `-- name: DeleteUserTokensFromUser :exec
+DELETE FROM user_tokens
+WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL
+`
+
+type DeleteUserTokensFromUserParams struct {
+	UserID  uuid.UUID `json:"user_id"`
+	Purpose string    `json:"purpose"`
+}
+
+func (q *Queries) DeleteUserTokensFromUser(ctx context.Context, arg DeleteUserTokensFromUserParams) error {
+	_, err := q.db.ExecContext(ctx, deleteUserTokensFromUser, arg.UserID, arg.Purpose)
+	return err
+}
+
+const useUserToken = `-- name: UseUserToken :one
+UPDATE user_tokens
+    SET used_at = NOW()
+    WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW()
+RETURNING user_id
+`
+
+type UseUserTokenParams struct {
+	TokenHash string `json:"token_hash"`
+	Purpose   string `json:"purpose"`
+}
+
+func (q *Queries) UseUserToken(ctx context.Context, arg UseUserTokenParams) (uuid.UUID, error) {
+	row := q.db.QueryRowContext(ctx, useUserToken, arg.TokenHash, arg.Purpose)
+	var user_id uuid.UUID
+	err := row.Scan(&user_id)
+	return user_id, err
+}
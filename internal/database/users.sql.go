@@ -7,11 +7,24 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+const countUsersWithRole = `-- name: CountUsersWithRole :one
+SELECT COUNT(*) FROM users
+WHERE role = $1
+`
+
+func (q *Queries) CountUsersWithRole(ctx context.Context, role string) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countUsersWithRole, role)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createUser = `-- name: CreateUser :one
 INSERT INTO users(
     id,
@@ -26,7 +39,7 @@ INSERT INTO users(
     $1,
     $2
 )
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, suspended_at, totp_secret, totp_enabled_at, totp_last_step, email_verified_at, deleted_at, purge_after, username, display_name, bio, avatar, role
 `
 
 type CreateUserParams struct {
@@ -44,6 +57,18 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.SuspendedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.DeletedAt,
+		&i.PurgeAfter,
+		&i.Username,
+		&i.DisplayName,
+		&i.Bio,
+		&i.Avatar,
+		&i.Role,
 	)
 	return i, err
 }
@@ -57,8 +82,40 @@ func (q *Queries) DeleteAllUsers(ctx context.Context) error {
 	return err
 }
 
+const disableUserTOTP = `-- name: DisableUserTOTP :exec
+UPDATE users
+    SET totp_secret = NULL,
+    totp_enabled_at = NULL,
+    totp_last_step = NULL,
+    updated_at = NOW()
+    WHERE id = $1
+`
+
+func (q *Queries) DisableUserTOTP(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, disableUserTOTP, id)
+	return err
+}
+
+const enableUserTOTP = `-- name: EnableUserTOTP :exec
+UPDATE users
+    SET totp_enabled_at = NOW(),
+    totp_last_step = $2,
+    updated_at = NOW()
+    WHERE id = $1
+`
+
+type EnableUserTOTPParams struct {
+	ID           uuid.UUID     `json:"id"`
+	TotpLastStep sql.NullInt64 `json:"totp_last_step"`
+}
+
+func (q *Queries) EnableUserTOTP(ctx context.Context, arg EnableUserTOTPParams) error {
+	_, err := q.db.ExecContext(ctx, enableUserTOTP, arg.ID, arg.TotpLastStep)
+	return err
+}
+
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red FROM users
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, suspended_at, totp_secret, totp_enabled_at, totp_last_step, email_verified_at, deleted_at, purge_after, username, display_name, bio, avatar, role FROM users
 WHERE email = $1 LIMIT 1
 `
 
@@ -72,55 +129,251 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.SuspendedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.DeletedAt,
+		&i.PurgeAfter,
+		&i.Username,
+		&i.DisplayName,
+		&i.Bio,
+		&i.Avatar,
+		&i.Role,
 	)
 	return i, err
 }
 
-const updateUser = `-- name: UpdateUser :one
+const getUserByID = `-- name: GetUserByID :one
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, suspended_at, totp_secret, totp_enabled_at, totp_last_step, email_verified_at, deleted_at, purge_after, username, display_name, bio, avatar, role FROM users
+WHERE id = $1 LIMIT 1
+`
+
+func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByID, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.SuspendedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.DeletedAt,
+		&i.PurgeAfter,
+		&i.Username,
+		&i.DisplayName,
+		&i.Bio,
+		&i.Avatar,
+		&i.Role,
+	)
+	return i, err
+}
+
+const getUserProfileByUsername = `-- name: GetUserProfileByUsername :one
+SELECT
+    id,
+    created_at,
+    username,
+    display_name,
+    bio,
+    avatar,
+    is_chirpy_red,
+    (SELECT COUNT(*) FROM chirps WHERE chirps.user_id = users.id) AS chirp_count,
+    (SELECT COUNT(*) FROM follows WHERE follows.followee_id = users.id) AS follower_count,
+    (SELECT COUNT(*) FROM follows WHERE follows.follower_id = users.id) AS following_count
+FROM users
+WHERE LOWER(username) = LOWER($1::text) AND deleted_at IS NULL
+LIMIT 1
+`
+
+type GetUserProfileByUsernameRow struct {
+	ID             uuid.UUID      `json:"id"`
+	CreatedAt      time.Time      `json:"created_at"`
+	Username       sql.NullString `json:"username"`
+	DisplayName    string         `json:"display_name"`
+	Bio            string         `json:"bio"`
+	Avatar         string         `json:"avatar"`
+	IsChirpyRed    bool           `json:"is_chirpy_red"`
+	ChirpCount     int64          `json:"chirp_count"`
+	FollowerCount  int64          `json:"follower_count"`
+	FollowingCount int64          `json:"following_count"`
+}
+
+func (q *Queries) GetUserProfileByUsername(ctx context.Context, username string) (GetUserProfileByUsernameRow, error) {
+	row := q.db.QueryRowContext(ctx, getUserProfileByUsername, username)
+	var i GetUserProfileByUsernameRow
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.Username,
+		&i.DisplayName,
+		&i.Bio,
+		&i.Avatar,
+		&i.IsChirpyRed,
+		&i.ChirpCount,
+		&i.FollowerCount,
+		&i.FollowingCount,
+	)
+	return i, err
+}
+
+const purgeDeletedUsers = `-- name: PurgeDeletedUsers :execrows
+DELETE FROM users
+WHERE deleted_at IS NOT NULL AND purge_after < NOW()
+`
+
+func (q *Queries) PurgeDeletedUsers(ctx context.Context) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgeDeletedUsers)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const restoreUser = `-- name: RestoreUser :exec
 UPDATE users
-    SET email = $2,
-    hashed_password = $3,
+    SET deleted_at = NULL,
+    purge_after = NULL,
     updated_at = NOW()
-    WHERE id = $1 
-RETURNING id, created_at, updated_at, email, is_chirpy_red
+    WHERE id = $1
 `
 
-type UpdateUserParams struct {
-	ID             uuid.UUID `json:"id"`
-	Email          string    `json:"email"`
-	HashedPassword string    `json:"hashed_password"`
+func (q *Queries) RestoreUser(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, restoreUser, id)
+	return err
 }
 
-type UpdateUserRow struct {
-	ID          uuid.UUID `json:"id"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
-	Email       string    `json:"email"`
-	IsChirpyRed bool      `json:"is_chirpy_red"`
+const setUserRole = `-- name: SetUserRole :one
+UPDATE users
+    SET role = $2,
+    updated_at = NOW()
+    WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, suspended_at, totp_secret, totp_enabled_at, totp_last_step, email_verified_at, deleted_at, purge_after, username, display_name, bio, avatar, role
+`
+
+type SetUserRoleParams struct {
+	ID   uuid.UUID `json:"id"`
+	Role string    `json:"role"`
 }
 
-func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (UpdateUserRow, error) {
-	row := q.db.QueryRowContext(ctx, updateUser, arg.ID, arg.Email, arg.HashedPassword)
-	var i UpdateUserRow
+func (q *Queries) SetUserRole(ctx context.Context, arg SetUserRoleParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setUserRole, arg.ID, arg.Role)
+	var i User
 	err := row.Scan(
 		&i.ID,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.Email,
+		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.SuspendedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.DeletedAt,
+		&i.PurgeAfter,
+		&i.Username,
+		&i.DisplayName,
+		&i.Bio,
+		&i.Avatar,
+		&i.Role,
 	)
 	return i, err
 }
 
-const upgradeUserToChirpyRedByID = `-- name: UpgradeUserToChirpyRedByID :one
+const setUserRoleByEmail = `-- name: SetUserRoleByEmail :one
 UPDATE users
-    SET is_chirpy_red = TRUE,
+    SET role = $2,
+    updated_at = NOW()
+    WHERE email = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, suspended_at, totp_secret, totp_enabled_at, totp_last_step, email_verified_at, deleted_at, purge_after, username, display_name, bio, avatar, role
+`
+
+type SetUserRoleByEmailParams struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+func (q *Queries) SetUserRoleByEmail(ctx context.Context, arg SetUserRoleByEmailParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setUserRoleByEmail, arg.Email, arg.Role)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.SuspendedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.DeletedAt,
+		&i.PurgeAfter,
+		&i.Username,
+		&i.DisplayName,
+		&i.Bio,
+		&i.Avatar,
+		&i.Role,
+	)
+	return i, err
+}
+
+const setUserTOTPSecret = `-- name: SetUserTOTPSecret :exec
+UPDATE users
+    SET totp_secret = $2,
+    totp_enabled_at = NULL,
+    totp_last_step = NULL,
+    updated_at = NOW()
+    WHERE id = $1
+`
+
+type SetUserTOTPSecretParams struct {
+	ID         uuid.UUID `json:"id"`
+	TotpSecret []byte    `json:"totp_secret"`
+}
+
+func (q *Queries) SetUserTOTPSecret(ctx context.Context, arg SetUserTOTPSecretParams) error {
+	_, err := q.db.ExecContext(ctx, setUserTOTPSecret, arg.ID, arg.TotpSecret)
+	return err
+}
+
+const softDeleteUser = `-- name: SoftDeleteUser :exec
+UPDATE users
+    SET deleted_at = NOW(),
+    purge_after = $2,
+    updated_at = NOW()
+    WHERE id = $1
+`
+
+type SoftDeleteUserParams struct {
+	ID         uuid.UUID    `json:"id"`
+	PurgeAfter sql.NullTime `json:"purge_after"`
+}
+
+func (q *Queries) SoftDeleteUser(ctx context.Context, arg SoftDeleteUserParams) error {
+	_, err := q.db.ExecContext(ctx, softDeleteUser, arg.ID, arg.PurgeAfter)
+	return err
+}
+
+const suspendUserByID = `-- name: SuspendUserByID :one
+UPDATE users
+    SET suspended_at = NOW(),
     updated_at = NOW()
     WHERE id = $1
 RETURNING id, created_at, updated_at, email, is_chirpy_red
 `
 
-type UpgradeUserToChirpyRedByIDRow struct {
+type SuspendUserByIDRow struct {
 	ID          uuid.UUID `json:"id"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
@@ -128,9 +381,9 @@ type UpgradeUserToChirpyRedByIDRow struct {
 	IsChirpyRed bool      `json:"is_chirpy_red"`
 }
 
-func (q *Queries) UpgradeUserToChirpyRedByID(ctx context.Context, id uuid.UUID) (UpgradeUserToChirpyRedByIDRow, error) {
-	row := q.db.QueryRowContext(ctx, upgradeUserToChirpyRedByID, id)
-	var i UpgradeUserToChirpyRedByIDRow
+func (q *Queries) SuspendUserByID(ctx context.Context, id uuid.UUID) (SuspendUserByIDRow, error) {
+	row := q.db.QueryRowContext(ctx, suspendUserByID, id)
+	var i SuspendUserByIDRow
 	err := row.Scan(
 		&i.ID,
 		&i.CreatedAt,
@@ -140,3 +393,112 @@ func (q *Queries) UpgradeUserToChirpyRedByID(ctx context.Context, id uuid.UUID)
 	)
 	return i, err
 }
+
+const updateUser = `-- name: UpdateUser :one
+UPDATE users
+    SET email = COALESCE($1::text, email),
+    hashed_password = COALESCE($2::text, hashed_password),
+    email_verified_at = CASE
+        WHEN $1::text IS NULL OR $1::text = email THEN email_verified_at
+        ELSE NULL
+    END,
+    username = COALESCE($3::text, username),
+    display_name = COALESCE($4::text, display_name),
+    bio = COALESCE($5::text, bio),
+    avatar = COALESCE($6::text, avatar),
+    updated_at = NOW()
+    WHERE id = $7
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, suspended_at, totp_secret, totp_enabled_at, totp_last_step, email_verified_at, deleted_at, purge_after, username, display_name, bio, avatar, role
+`
+
+type UpdateUserParams struct {
+	Email          sql.NullString `json:"email"`
+	HashedPassword sql.NullString `json:"hashed_password"`
+	Username       sql.NullString `json:"username"`
+	DisplayName    sql.NullString `json:"display_name"`
+	Bio            sql.NullString `json:"bio"`
+	Avatar         sql.NullString `json:"avatar"`
+	ID             uuid.UUID      `json:"id"`
+}
+
+func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUser,
+		arg.Email,
+		arg.HashedPassword,
+		arg.Username,
+		arg.DisplayName,
+		arg.Bio,
+		arg.Avatar,
+		arg.ID,
+	)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.SuspendedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.DeletedAt,
+		&i.PurgeAfter,
+		&i.Username,
+		&i.DisplayName,
+		&i.Bio,
+		&i.Avatar,
+		&i.Role,
+	)
+	return i, err
+}
+
+const updateUserPassword = `-- name: UpdateUserPassword :exec
+UPDATE users
+    SET hashed_password = $2,
+    updated_at = NOW()
+    WHERE id = $1
+`
+
+type UpdateUserPasswordParams struct {
+	ID             uuid.UUID `json:"id"`
+	HashedPassword string    `json:"hashed_password"`
+}
+
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserPassword, arg.ID, arg.HashedPassword)
+	return err
+}
+
+const useUserTOTPStep = `-- name: UseUserTOTPStep :execrows
+UPDATE users
+    SET totp_last_step = $2
+    WHERE id = $1 AND (totp_last_step IS NULL OR totp_last_step < $2)
+`
+
+type UseUserTOTPStepParams struct {
+	ID           uuid.UUID     `json:"id"`
+	TotpLastStep sql.NullInt64 `json:"totp_last_step"`
+}
+
+func (q *Queries) UseUserTOTPStep(ctx context.Context, arg UseUserTOTPStepParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, useUserTOTPStep, arg.ID, arg.TotpLastStep)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const verifyUserEmail = `-- name: VerifyUserEmail :exec
+UPDATE users
+    SET email_verified_at = NOW(),
+    updated_at = NOW()
+    WHERE id = $1
+`
+
+func (q *Queries) VerifyUserEmail(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, verifyUserEmail, id)
+	return err
+}
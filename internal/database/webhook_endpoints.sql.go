@@ -0,0 +1,506 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: webhook_endpoints.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const claimWebhookDeliveries = `-- name: ClaimWebhookDeliveries :many
+WITH claimed AS (
+    UPDATE webhook_deliveries
+        SET locked_until = $1::timestamp
+        WHERE webhook_deliveries.id IN (
+            SELECT due.id FROM webhook_deliveries AS due
+            WHERE due.status = 'pending'
+                AND due.next_attempt_at <= NOW()
+                AND (due.locked_until IS NULL OR due.locked_until <= NOW())
+            ORDER BY due.next_attempt_at
+            LIMIT $2
+            FOR UPDATE SKIP LOCKED
+        )
+    RETURNING
+        webhook_deliveries.id,
+        webhook_deliveries.endpoint_id,
+        webhook_deliveries.event_id,
+        webhook_deliveries.event_type,
+        webhook_deliveries.payload,
+        webhook_deliveries.status,
+        webhook_deliveries.attempts,
+        webhook_deliveries.next_attempt_at
+)
+SELECT
+    claimed.id,
+    claimed.endpoint_id,
+    claimed.event_id,
+    claimed.event_type,
+    claimed.payload,
+    claimed.status,
+    claimed.attempts,
+    claimed.next_attempt_at,
+    webhook_endpoints.url,
+    webhook_endpoints.secret
+FROM claimed
+JOIN webhook_endpoints ON webhook_endpoints.id = claimed.endpoint_id
+ORDER BY claimed.next_attempt_at
+`
+
+type ClaimWebhookDeliveriesParams struct {
+	LockedUntil time.Time `json:"locked_until"`
+	BatchSize   int32     `json:"batch_size"`
+}
+
+type ClaimWebhookDeliveriesRow struct {
+	ID            uuid.UUID       `json:"id"`
+	EndpointID    uuid.UUID       `json:"endpoint_id"`
+	EventID       uuid.UUID       `json:"event_id"`
+	EventType     string          `json:"event_type"`
+	Payload       json.RawMessage `json:"payload"`
+	Status        string          `json:"status"`
+	Attempts      int32           `json:"attempts"`
+	NextAttemptAt time.Time       `json:"next_attempt_at"`
+	Url           string          `json:"url"`
+	Secret        []byte          `json:"secret"`
+}
+
+// Lock the due deliveries until "locked_until", SKIP LOCKED lets every
+// instance claim a different batch.
+func (q *Queries) ClaimWebhookDeliveries(ctx context.Context, arg ClaimWebhookDeliveriesParams) ([]ClaimWebhookDeliveriesRow, error) {
+	rows, err := q.db.QueryContext(ctx, claimWebhookDeliveries, arg.LockedUntil, arg.BatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ClaimWebhookDeliveriesRow
+	for rows.Next() {
+		var i ClaimWebhookDeliveriesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.EndpointID,
+			&i.EventID,
+			&i.EventType,
+			&i.Payload,
+			&i.Status,
+			&i.Attempts,
+			&i.NextAttemptAt,
+			&i.Url,
+			&i.Secret,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const createWebhookEndpoint = `-- name: CreateWebhookEndpoint :one
+INSERT INTO webhook_endpoints(
+    id,
+    created_at,
+    user_id,
+    url,
+    secret,
+    events,
+    all_users
+) VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5
+)
+RETURNING id, created_at, user_id, url, secret, events, all_users
+`
+
+type CreateWebhookEndpointParams struct {
+	UserID   uuid.UUID `json:"user_id"`
+	Url      string    `json:"url"`
+	Secret   []byte    `json:"secret"`
+	Events   []string  `json:"events"`
+	AllUsers bool      `json:"all_users"`
+}
+
+func (q *Queries) CreateWebhookEndpoint(ctx context.Context, arg CreateWebhookEndpointParams) (WebhookEndpoint, error) {
+	row := q.db.QueryRowContext(ctx, createWebhookEndpoint,
+		arg.UserID,
+		arg.Url,
+		arg.Secret,
+		pq.Array(arg.Events),
+		arg.AllUsers,
+	)
+	var i WebhookEndpoint
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UserID,
+		&i.Url,
+		&i.Secret,
+		pq.Array(&i.Events),
+		&i.AllUsers,
+	)
+	return i, err
+}
+
+const deleteWebhookEndpoint = `-- name: DeleteWebhookEndpoint :execrows
+DELETE FROM webhook_endpoints
+WHERE id = $1 AND user_id = $2
+`
+
+type DeleteWebhookEndpointParams struct {
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+}
+
+func (q *Queries) DeleteWebhookEndpoint(ctx context.Context, arg DeleteWebhookEndpointParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteWebhookEndpoint, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const enqueueWebhookDeliveries = `-- name: EnqueueWebhookDeliveries :execrows
+INSERT INTO webhook_deliveries(
+    id,
+    created_at,
+    endpoint_id,
+    event_id,
+    event_type,
+    payload,
+    next_attempt_at
+)
+SELECT
+    gen_random_uuid(),
+    NOW(),
+    webhook_endpoints.id,
+    $1::uuid,
+    $2::text,
+    $3::jsonb,
+    NOW()
+FROM webhook_endpoints
+JOIN users ON users.id = webhook_endpoints.user_id
+WHERE (
+        webhook_endpoints.user_id = $4::uuid
+        OR (
+            webhook_endpoints.all_users
+            AND users.role = 'admin'
+            AND users.suspended_at IS NULL
+            AND users.deleted_at IS NULL
+        )
+    )
+    AND (cardinality(webhook_endpoints.events) = 0 OR $2::text = ANY(webhook_endpoints.events))
+ON CONFLICT (endpoint_id, event_id) DO NOTHING
+`
+
+type EnqueueWebhookDeliveriesParams struct {
+	EventID   uuid.UUID       `json:"event_id"`
+	EventType string          `json:"event_type"`
+	Payload   json.RawMessage `json:"payload"`
+	UserID    uuid.UUID       `json:"user_id"`
+}
+
+// Queue a delivery of the event to every endpoint of the user or for every
+// user that wants its type, an event already queued isn't queued again.
+// Endpoints for every user only get it while their owner is still an admin
+// that isn't suspended or deleted.
+func (q *Queries) EnqueueWebhookDeliveries(ctx context.Context, arg EnqueueWebhookDeliveriesParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, enqueueWebhookDeliveries,
+		arg.EventID,
+		arg.EventType,
+		arg.Payload,
+		arg.UserID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getWebhookDeliveries = `-- name: GetWebhookDeliveries :many
+SELECT id, created_at, endpoint_id, event_id, event_type, payload, status, attempts, next_attempt_at, locked_until, last_status_code, last_error, delivered_at FROM webhook_deliveries
+WHERE endpoint_id = $1
+    AND ($3::text IS NULL OR status = $3::text)
+ORDER BY created_at DESC
+LIMIT $2
+`
+
+type GetWebhookDeliveriesParams struct {
+	EndpointID uuid.UUID      `json:"endpoint_id"`
+	Limit      int32          `json:"limit"`
+	Status     sql.NullString `json:"status"`
+}
+
+func (q *Queries) GetWebhookDeliveries(ctx context.Context, arg GetWebhookDeliveriesParams) ([]WebhookDelivery, error) {
+	rows, err := q.db.QueryContext(ctx, getWebhookDeliveries, arg.EndpointID, arg.Limit, arg.Status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WebhookDelivery
+	for rows.Next() {
+		var i WebhookDelivery
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.EndpointID,
+			&i.EventID,
+			&i.EventType,
+			&i.Payload,
+			&i.Status,
+			&i.Attempts,
+			&i.NextAttemptAt,
+			&i.LockedUntil,
+			&i.LastStatusCode,
+			&i.LastError,
+			&i.DeliveredAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getWebhookDelivery = `-- name: GetWebhookDelivery :one
+SELECT id, created_at, endpoint_id, event_id, event_type, payload, status, attempts, next_attempt_at, locked_until, last_status_code, last_error, delivered_at FROM webhook_deliveries
+WHERE id = $1 AND endpoint_id = $2
+`
+
+type GetWebhookDeliveryParams struct {
+	ID         uuid.UUID `json:"id"`
+	EndpointID uuid.UUID `json:"endpoint_id"`
+}
+
+func (q *Queries) GetWebhookDelivery(ctx context.Context, arg GetWebhookDeliveryParams) (WebhookDelivery, error) {
+	row := q.db.QueryRowContext(ctx, getWebhookDelivery, arg.ID, arg.EndpointID)
+	var i WebhookDelivery
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.EndpointID,
+		&i.EventID,
+		&i.EventType,
+		&i.Payload,
+		&i.Status,
+		&i.Attempts,
+		&i.NextAttemptAt,
+		&i.LockedUntil,
+		&i.LastStatusCode,
+		&i.LastError,
+		&i.DeliveredAt,
+	)
+	return i, err
+}
+
+const getWebhookDeliveryAttempts = `-- name: GetWebhookDeliveryAttempts :many
+SELECT id, delivery_id, attempted_at, status_code, error, duration_ms FROM webhook_delivery_attempts
+WHERE delivery_id = $1
+ORDER BY attempted_at
+`
+
+func (q *Queries) GetWebhookDeliveryAttempts(ctx context.Context, deliveryID uuid.UUID) ([]WebhookDeliveryAttempt, error) {
+	rows, err := q.db.QueryContext(ctx, getWebhookDeliveryAttempts, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WebhookDeliveryAttempt
+	for rows.Next() {
+		var i WebhookDeliveryAttempt
+		if err := rows.Scan(
+			&i.ID,
+			&i.DeliveryID,
+			&i.AttemptedAt,
+			&i.StatusCode,
+			&i.Error,
+			&i.DurationMs,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getWebhookEndpoint = `-- name: GetWebhookEndpoint :one
+SELECT id, created_at, user_id, url, secret, events, all_users FROM webhook_endpoints
+WHERE id = $1 AND user_id = $2
+`
+
+type GetWebhookEndpointParams struct {
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+}
+
+func (q *Queries) GetWebhookEndpoint(ctx context.Context, arg GetWebhookEndpointParams) (WebhookEndpoint, error) {
+	row := q.db.QueryRowContext(ctx, getWebhookEndpoint, arg.ID, arg.UserID)
+	var i WebhookEndpoint
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UserID,
+		&i.Url,
+		&i.Secret,
+		pq.Array(&i.Events),
+		&i.AllUsers,
+	)
+	return i, err
+}
+
+const getWebhookEndpointsFromUser = `-- name: GetWebhookEndpointsFromUser :many
+SELECT id, created_at, user_id, url, secret, events, all_users FROM webhook_endpoints
+WHERE user_id = $1
+ORDER BY created_at
+`
+
+func (q *Queries) GetWebhookEndpointsFromUser(ctx context.Context, userID uuid.UUID) ([]WebhookEndpoint, error) {
+	rows, err := q.db.QueryContext(ctx, getWebhookEndpointsFromUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WebhookEndpoint
+	for rows.Next() {
+		var i WebhookEndpoint
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UserID,
+			&i.Url,
+			&i.Secret,
+			pq.Array(&i.Events),
+			&i.AllUsers,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const recordWebhookDeliveryAttempt = `-- name: RecordWebhookDeliveryAttempt :exec
+WITH attempt AS (
+    INSERT INTO webhook_delivery_attempts(
+        id,
+        delivery_id,
+        attempted_at,
+        status_code,
+        error,
+        duration_ms
+    ) VALUES (
+        gen_random_uuid(),
+        $7,
+        $6::timestamp,
+        $4,
+        $5,
+        $8
+    )
+)
+UPDATE webhook_deliveries
+    SET status = $1::text,
+    attempts = $2,
+    next_attempt_at = $3,
+    locked_until = NULL,
+    last_status_code = $4,
+    last_error = $5,
+    delivered_at = CASE WHEN $1::text = 'delivered' THEN $6::timestamp ELSE NULL END
+    WHERE webhook_deliveries.id = $7
+`
+
+type RecordWebhookDeliveryAttemptParams struct {
+	Status        string         `json:"status"`
+	Attempts      int32          `json:"attempts"`
+	NextAttemptAt time.Time      `json:"next_attempt_at"`
+	StatusCode    sql.NullInt32  `json:"status_code"`
+	Error         sql.NullString `json:"error"`
+	AttemptedAt   time.Time      `json:"attempted_at"`
+	ID            uuid.UUID      `json:"id"`
+	DurationMs    int32          `json:"duration_ms"`
+}
+
+// Log the attempt and save the outcome on the delivery.
+func (q *Queries) RecordWebhookDeliveryAttempt(ctx context.Context, arg RecordWebhookDeliveryAttemptParams) error {
+	_, err := q.db.ExecContext(ctx, recordWebhookDeliveryAttempt,
+		arg.Status,
+		arg.Attempts,
+		arg.NextAttemptAt,
+		arg.StatusCode,
+		arg.Error,
+		arg.AttemptedAt,
+		arg.ID,
+		arg.DurationMs,
+	)
+	return err
+}
+
+const retryWebhookDelivery = `-- name: RetryWebhookDelivery :one
+UPDATE webhook_deliveries
+    SET status = 'pending',
+    attempts = 0,
+    next_attempt_at = NOW(),
+    locked_until = NULL
+    WHERE id = $1 AND endpoint_id = $2 AND status = 'dead'
+RETURNING id, created_at, endpoint_id, event_id, event_type, payload, status, attempts, next_attempt_at, locked_until, last_status_code, last_error, delivered_at
+`
+
+type RetryWebhookDeliveryParams struct {
+	ID         uuid.UUID `json:"id"`
+	EndpointID uuid.UUID `json:"endpoint_id"`
+}
+
+// Send a dead delivery again, its attempts start over.
+func (q *Queries) RetryWebhookDelivery(ctx context.Context, arg RetryWebhookDeliveryParams) (WebhookDelivery, error) {
+	row := q.db.QueryRowContext(ctx, retryWebhookDelivery, arg.ID, arg.EndpointID)
+	var i WebhookDelivery
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.EndpointID,
+		&i.EventID,
+		&i.EventType,
+		&i.Payload,
+		&i.Status,
+		&i.Attempts,
+		&i.NextAttemptAt,
+		&i.LockedUntil,
+		&i.LastStatusCode,
+		&i.LastError,
+		&i.DeliveredAt,
+	)
+	return i, err
+}
@@ -0,0 +1,230 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: webhook_events.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/google/uuid"
+)
+
+const claimWebhookEvent = `-- name: ClaimWebhookEvent :one
+UPDATE webhook_events
+    SET status = 'processing'
+    WHERE id = $1 AND status IN ('received', 'failed')
+RETURNING id, source, event_id, event_type, payload, received_at, processed_at, status, error, attempts
+`
+
+// Meant to be run in the transaction processing the event, the row stays
+// locked until it ends so a concurrent delivery or replay waits and then
+// claims nothing, unless the processing was rolled back.
+func (q *Queries) ClaimWebhookEvent(ctx context.Context, id uuid.UUID) (WebhookEvent, error) {
+	row := q.db.QueryRowContext(ctx, claimWebhookEvent, id)
+	var i WebhookEvent
+	err := row.Scan(
+		&i.ID,
+		&i.Source,
+		&i.EventID,
+		&i.EventType,
+		&i.Payload,
+		&i.ReceivedAt,
+		&i.ProcessedAt,
+		&i.Status,
+		&i.Error,
+		&i.Attempts,
+	)
+	return i, err
+}
+
+const failWebhookEvent = `-- name: FailWebhookEvent :one
+UPDATE webhook_events
+    SET status = 'failed',
+    error = $2,
+    processed_at = NOW()
+    WHERE id = $1 AND status IN ('received', 'failed')
+RETURNING id, source, event_id, event_type, payload, received_at, processed_at, status, error, attempts
+`
+
+type FailWebhookEventParams struct {
+	ID    uuid.UUID      `json:"id"`
+	Error sql.NullString `json:"error"`
+}
+
+// Unless a concurrent delivery or replay processed it in the meantime.
+func (q *Queries) FailWebhookEvent(ctx context.Context, arg FailWebhookEventParams) (WebhookEvent, error) {
+	row := q.db.QueryRowContext(ctx, failWebhookEvent, arg.ID, arg.Error)
+	var i WebhookEvent
+	err := row.Scan(
+		&i.ID,
+		&i.Source,
+		&i.EventID,
+		&i.EventType,
+		&i.Payload,
+		&i.ReceivedAt,
+		&i.ProcessedAt,
+		&i.Status,
+		&i.Error,
+		&i.Attempts,
+	)
+	return i, err
+}
+
+const finishWebhookEvent = `-- name: FinishWebhookEvent :one
+UPDATE webhook_events
+    SET status = $2,
+    error = $3,
+    processed_at = NOW()
+    WHERE id = $1
+RETURNING id, source, event_id, event_type, payload, received_at, processed_at, status, error, attempts
+`
+
+type FinishWebhookEventParams struct {
+	ID     uuid.UUID      `json:"id"`
+	Status string         `json:"status"`
+	Error  sql.NullString `json:"error"`
+}
+
+func (q *Queries) FinishWebhookEvent(ctx context.Context, arg FinishWebhookEventParams) (WebhookEvent, error) {
+	row := q.db.QueryRowContext(ctx, finishWebhookEvent, arg.ID, arg.Status, arg.Error)
+	var i WebhookEvent
+	err := row.Scan(
+		&i.ID,
+		&i.Source,
+		&i.EventID,
+		&i.EventType,
+		&i.Payload,
+		&i.ReceivedAt,
+		&i.ProcessedAt,
+		&i.Status,
+		&i.Error,
+		&i.Attempts,
+	)
+	return i, err
+}
+
+const getWebhookEvent = `-- name: GetWebhookEvent :one
+SELECT id, source, event_id, event_type, payload, received_at, processed_at, status, error, attempts FROM webhook_events
+WHERE id = $1
+`
+
+func (q *Queries) GetWebhookEvent(ctx context.Context, id uuid.UUID) (WebhookEvent, error) {
+	row := q.db.QueryRowContext(ctx, getWebhookEvent, id)
+	var i WebhookEvent
+	err := row.Scan(
+		&i.ID,
+		&i.Source,
+		&i.EventID,
+		&i.EventType,
+		&i.Payload,
+		&i.ReceivedAt,
+		&i.ProcessedAt,
+		&i.Status,
+		&i.Error,
+		&i.Attempts,
+	)
+	return i, err
+}
+
+const getWebhookEvents = `-- name: GetWebhookEvents :many
+SELECT id, source, event_id, event_type, payload, received_at, processed_at, status, error, attempts FROM webhook_events
+WHERE $2::text IS NULL OR status = $2::text
+ORDER BY received_at DESC
+LIMIT $1
+`
+
+type GetWebhookEventsParams struct {
+	Limit  int32          `json:"limit"`
+	Status sql.NullString `json:"status"`
+}
+
+func (q *Queries) GetWebhookEvents(ctx context.Context, arg GetWebhookEventsParams) ([]WebhookEvent, error) {
+	rows, err := q.db.QueryContext(ctx, getWebhookEvents, arg.Limit, arg.Status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WebhookEvent
+	for rows.Next() {
+		var i WebhookEvent
+		if err := rows.Scan(
+			&i.ID,
+			&i.Source,
+			&i.EventID,
+			&i.EventType,
+			&i.Payload,
+			&i.ReceivedAt,
+			&i.ProcessedAt,
+			&i.Status,
+			&i.Error,
+			&i.Attempts,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const recordWebhookEvent = `-- name: RecordWebhookEvent :one
+INSERT INTO webhook_events(
+    id,
+    source,
+    event_id,
+    event_type,
+    payload,
+    received_at
+) VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    $3,
+    $4,
+    NOW()
+)
+ON CONFLICT (source, event_id) DO UPDATE
+    SET attempts = webhook_events.attempts + 1
+RETURNING id, source, event_id, event_type, payload, received_at, processed_at, status, error, attempts
+`
+
+type RecordWebhookEventParams struct {
+	Source    string          `json:"source"`
+	EventID   string          `json:"event_id"`
+	EventType string          `json:"event_type"`
+	Payload   json.RawMessage `json:"payload"`
+}
+
+// A retry of an event already recorded only counts the attempt, the caller
+// checks the status to know if it was already processed.
+func (q *Queries) RecordWebhookEvent(ctx context.Context, arg RecordWebhookEventParams) (WebhookEvent, error) {
+	row := q.db.QueryRowContext(ctx, recordWebhookEvent,
+		arg.Source,
+		arg.EventID,
+		arg.EventType,
+		arg.Payload,
+	)
+	var i WebhookEvent
+	err := row.Scan(
+		&i.ID,
+		&i.Source,
+		&i.EventID,
+		&i.EventType,
+		&i.Payload,
+		&i.ReceivedAt,
+		&i.ProcessedAt,
+		&i.Status,
+		&i.Error,
+		&i.Attempts,
+	)
+	return i, err
+}
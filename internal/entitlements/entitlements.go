@@ -0,0 +1,168 @@
+// Package entitlements maps the plan of a user to what it can do, like how
+// long its chirps can be or how many it can post in an hour.
+//
+// The limits of every plan have defaults that can be changed from a JSON
+// file, see [Load], so they can be tuned without touching the code.
+package entitlements
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+)
+
+// Unlimited is the limit of a feature without a limit.
+const Unlimited = -1
+
+// Plans every user is on, "red" is the plan Chirpy Red members are on when
+// their subscription doesn't name a plan that is configured.
+const (
+	PlanFree = "free"
+	PlanRed  = "red"
+)
+
+// Feature is something limited by the plan, its limit is a number where 0
+// means it's not allowed and [Unlimited] means there is no limit.
+type Feature string
+
+const (
+	// longest chirp body, in bytes
+	FeatureChirpLength Feature = "chirp_length"
+	// chirps that can be posted in a rolling hour
+	FeatureChirpsPerHour Feature = "chirps_per_hour"
+	// seconds a chirp can be edited after being posted
+	FeatureEditWindow Feature = "edit_window_seconds"
+	// media attachments per chirp
+	FeatureMediaPerChirp Feature = "media_per_chirp"
+	// chirps scheduled to be posted later at the same time
+	FeatureScheduledChirps Feature = "scheduled_chirps"
+)
+
+// Features are all the known features, the config file can't name others.
+var Features = []Feature{
+	FeatureChirpLength,
+	FeatureChirpsPerHour,
+	FeatureEditWindow,
+	FeatureMediaPerChirp,
+	FeatureScheduledChirps,
+}
+
+// Limits of a plan by feature, features left out aren't allowed.
+type Limits map[Feature]int
+
+// User is who the entitlements are checked for.
+type User struct {
+	Plan string
+	// paying members fall back to [PlanRed] when their plan isn't configured
+	Paid bool
+}
+
+// Engine knows the limits of every plan.
+type Engine struct {
+	plans map[string]Limits
+}
+
+// DefaultPlans are the limits used for what isn't on the config file.
+func DefaultPlans() map[string]Limits {
+	return map[string]Limits{
+		PlanFree: {
+			FeatureChirpLength:     140,
+			FeatureChirpsPerHour:   30,
+			FeatureEditWindow:      0,
+			FeatureMediaPerChirp:   0,
+			FeatureScheduledChirps: 0,
+		},
+		PlanRed: {
+			FeatureChirpLength:     1000,
+			FeatureChirpsPerHour:   Unlimited,
+			FeatureEditWindow:      60 * 60,
+			FeatureMediaPerChirp:   4,
+			FeatureScheduledChirps: 20,
+		},
+	}
+}
+
+func New(plans map[string]Limits) *Engine {
+	return &Engine{plans: plans}
+}
+
+// Load the plans from a JSON object of plan names to their limits, e.g.
+// {"red": {"chirp_length": 500}}. Limits left out keep the default and new
+// plans start from the free plan, unknown features are an error so a typo
+// isn't silently ignored.
+func Load(r io.Reader) (*Engine, error) {
+	var config map[string]Limits
+	if err := json.NewDecoder(r).Decode(&config); err != nil {
+		return nil, fmt.Errorf("invalid entitlements config: %w", err)
+	}
+	plans := DefaultPlans()
+	for plan, limits := range config {
+		merged := Limits{}
+		base, ok := plans[plan]
+		if !ok {
+			base = plans[PlanFree]
+		}
+		for feature, limit := range base {
+			merged[feature] = limit
+		}
+		for feature, limit := range limits {
+			if !slices.Contains(Features, feature) {
+				return nil, fmt.Errorf("unknown feature %s on plan %s", feature, plan)
+			}
+			if limit < Unlimited {
+				return nil, fmt.Errorf("invalid limit %d for %s on plan %s", limit, feature, plan)
+			}
+			merged[feature] = limit
+		}
+		plans[plan] = merged
+	}
+	return New(plans), nil
+}
+
+// Load the plans from the JSON file at "path", see [Load].
+func LoadFile(path string) (*Engine, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return Load(file)
+}
+
+// Plan name the limits of "user" come from.
+func (e *Engine) Plan(user User) string {
+	if _, ok := e.plans[user.Plan]; ok {
+		return user.Plan
+	}
+	if user.Paid {
+		return PlanRed
+	}
+	return PlanFree
+}
+
+// Limits of every feature for "user".
+func (e *Engine) Limits(user User) Limits {
+	limits := Limits{}
+	for feature, limit := range e.plans[e.Plan(user)] {
+		limits[feature] = limit
+	}
+	return limits
+}
+
+// Limit of "feature" for "user", 0 when it's not allowed.
+func (e *Engine) Limit(user User, feature Feature) int {
+	return e.plans[e.Plan(user)][feature]
+}
+
+// Can "user" use "feature" at all.
+func (e *Engine) Can(user User, feature Feature) bool {
+	return e.Limit(user, feature) != 0
+}
+
+// Is "used" still inside the limit of "feature" for "user".
+func (e *Engine) Within(user User, feature Feature, used int) bool {
+	limit := e.Limit(user, feature)
+	return limit == Unlimited || used <= limit
+}
@@ -0,0 +1,102 @@
+package entitlements
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCan(t *testing.T) {
+	engine := New(DefaultPlans())
+	free := User{Plan: PlanFree}
+	red := User{Plan: PlanRed, Paid: true}
+
+	tests := []struct {
+		name    string
+		user    User
+		feature Feature
+		want    bool
+	}{
+		{"free can post chirps", free, FeatureChirpLength, true},
+		{"free can't edit", free, FeatureEditWindow, false},
+		{"free can't attach media", free, FeatureMediaPerChirp, false},
+		{"red can edit", red, FeatureEditWindow, true},
+		{"red can schedule", red, FeatureScheduledChirps, true},
+		{"unknown feature", red, Feature("teleport"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := engine.Can(tt.user, tt.feature); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestWithin(t *testing.T) {
+	engine := New(DefaultPlans())
+	free := User{Plan: PlanFree}
+	red := User{Plan: PlanRed, Paid: true}
+
+	if !engine.Within(free, FeatureChirpLength, 140) {
+		t.Error("expected 140 characters to be within the free limit")
+	}
+	if engine.Within(free, FeatureChirpLength, 141) {
+		t.Error("expected 141 characters to be over the free limit")
+	}
+	if !engine.Within(red, FeatureChirpsPerHour, 1_000_000) {
+		t.Error("expected red to have unlimited chirps per hour")
+	}
+}
+
+func TestPlanFallback(t *testing.T) {
+	engine := New(DefaultPlans())
+
+	if got := engine.Plan(User{Plan: "red_yearly", Paid: true}); got != PlanRed {
+		t.Errorf("expected an unknown paid plan to fall back to %s, got %s", PlanRed, got)
+	}
+	if got := engine.Plan(User{Plan: "red_yearly"}); got != PlanFree {
+		t.Errorf("expected an unknown unpaid plan to fall back to %s, got %s", PlanFree, got)
+	}
+	if got := engine.Plan(User{}); got != PlanFree {
+		t.Errorf("expected no plan to be %s, got %s", PlanFree, got)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	engine, err := Load(strings.NewReader(`{
+		"red": {"chirp_length": 500},
+		"red_yearly": {"chirp_length": 2000, "chirps_per_hour": -1}
+	}`))
+	if err != nil {
+		t.Fatalf("failed to load: %s", err)
+	}
+
+	red := User{Plan: PlanRed, Paid: true}
+	if got := engine.Limit(red, FeatureChirpLength); got != 500 {
+		t.Errorf("expected the configured red chirp length 500, got %d", got)
+	}
+	if got := engine.Limit(red, FeatureMediaPerChirp); got != 4 {
+		t.Errorf("expected red to keep the default media limit 4, got %d", got)
+	}
+
+	yearly := User{Plan: "red_yearly", Paid: true}
+	if got := engine.Limit(yearly, FeatureChirpLength); got != 2000 {
+		t.Errorf("expected the new plan chirp length 2000, got %d", got)
+	}
+	if got := engine.Limit(yearly, FeatureEditWindow); got != 0 {
+		t.Errorf("expected the new plan to start from the free limits, got edit window %d", got)
+	}
+
+	// the defaults aren't changed by loading
+	if got := New(DefaultPlans()).Limit(red, FeatureChirpLength); got != 1000 {
+		t.Errorf("expected the default red chirp length 1000, got %d", got)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	for _, config := range []string{`not json`, `{"red": {"chirp_length": -2}}`, `{"red": {"chirp_lenght": 500}}`} {
+		if _, err := Load(strings.NewReader(config)); err == nil {
+			t.Errorf("expected %s to be invalid", config)
+		}
+	}
+}
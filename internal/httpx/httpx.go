@@ -0,0 +1,90 @@
+// Package httpx has the HTTP helpers shared by the middlewares of the
+// logging, metrics and tracing packages, so none of them depends on another.
+package httpx
+
+import (
+	"context"
+	"net/http"
+)
+
+// UnmatchedRoute is the route of the requests that didn't match any route,
+// so unknown paths can't make a label or log value each.
+const UnmatchedRoute = "unmatched"
+
+// Request is what [Middleware] shares with the middlewares behind it.
+type Request struct {
+	// pattern of the route of the mux the request matched, empty when it
+	// didn't match any
+	Pattern string
+	// the writer every middleware behind [Middleware] gets
+	Recorder *ResponseRecorder
+}
+
+// Route is the pattern the request matched or [UnmatchedRoute].
+func (r *Request) Route() string {
+	if r.Pattern == "" {
+		return UnmatchedRoute
+	}
+	return r.Pattern
+}
+
+type requestKey struct{}
+
+// Middleware resolves the route of "mux" the request matches and wraps the
+// writer in a [ResponseRecorder] once, for the logging, metrics and tracing
+// middlewares of "next" to share with [FromContext].
+func Middleware(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, pattern := mux.Handler(r)
+		req := &Request{Pattern: pattern, Recorder: NewResponseRecorder(w)}
+		ctx := context.WithValue(r.Context(), requestKey{}, req)
+		next.ServeHTTP(req.Recorder, r.WithContext(ctx))
+	})
+}
+
+// The request shared by [Middleware], nil when the request didn't go through
+// it.
+func FromContext(ctx context.Context) *Request {
+	req, _ := ctx.Value(requestKey{}).(*Request)
+	return req
+}
+
+// Whether "method" is one of the standard methods, the others are reported
+// as a single value so clients can't make one each.
+func StandardMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodOptions:
+		return true
+	default:
+		return false
+	}
+}
+
+// ResponseRecorder is a [http.ResponseWriter] keeping the status code and
+// how many bytes of body were written.
+type ResponseRecorder struct {
+	http.ResponseWriter
+	Status int
+	Bytes  int
+}
+
+func NewResponseRecorder(w http.ResponseWriter) *ResponseRecorder {
+	return &ResponseRecorder{ResponseWriter: w, Status: http.StatusOK}
+}
+
+func (rr *ResponseRecorder) WriteHeader(status int) {
+	rr.Status = status
+	rr.ResponseWriter.WriteHeader(status)
+}
+
+func (rr *ResponseRecorder) Write(body []byte) (int, error) {
+	n, err := rr.ResponseWriter.Write(body)
+	rr.Bytes += n
+	return n, err
+}
+
+// Unwrap lets [http.ResponseController] reach the original writer.
+func (rr *ResponseRecorder) Unwrap() http.ResponseWriter {
+	return rr.ResponseWriter
+}
@@ -0,0 +1,53 @@
+package httpx
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResponseRecorder(t *testing.T) {
+	w := httptest.NewRecorder()
+	recorder := NewResponseRecorder(w)
+	recorder.WriteHeader(201)
+	recorder.Write([]byte("hello"))
+	recorder.Write([]byte(" world"))
+
+	if recorder.Status != 201 || recorder.Bytes != 11 {
+		t.Errorf("expected status 201 and 11 bytes, got %d and %d", recorder.Status, recorder.Bytes)
+	}
+	if NewResponseRecorder(w).Status != 200 {
+		t.Errorf("expected the status to be 200 when WriteHeader isn't called")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/chirps/{chirpID}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(404)
+	})
+	var got *Request
+	handler := Middleware(mux, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = FromContext(r.Context())
+		if got == nil || w != got.Recorder {
+			t.Fatalf("expected the shared request with its recorder as the writer")
+		}
+		mux.ServeHTTP(w, r)
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/chirps/1", nil))
+	if got.Route() != "GET /api/chirps/{chirpID}" || got.Recorder.Status != 404 {
+		t.Errorf("expected route GET /api/chirps/{chirpID} and status 404, got %s and %d", got.Route(), got.Recorder.Status)
+	}
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/nothing/here", nil))
+	if got.Pattern != "" || got.Route() != UnmatchedRoute {
+		t.Errorf("expected an unmatched route, got %q", got.Pattern)
+	}
+}
+
+func TestStandardMethod(t *testing.T) {
+	if !StandardMethod("PATCH") || StandardMethod("BREW") {
+		t.Errorf("expected only the standard methods to be standard")
+	}
+}
@@ -0,0 +1,109 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/httpx"
+)
+
+// RequestIDHeader is read from the requests, so a proxy in front of the server
+// can set it, and always set on the responses.
+const RequestIDHeader = "X-Request-ID"
+
+// request ids taken from the clients, anything else gets a new one so they
+// can't put arbitrary text on the logs
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+type requestInfoKey struct{}
+
+// What the logs know about the request being answered, the user is filled in
+// by the authentication middlewares deeper in the chain.
+type requestInfo struct {
+	id     string
+	userID string
+}
+
+func requestInfoFrom(ctx context.Context) *requestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(*requestInfo)
+	return info
+}
+
+// Get the request id of "ctx", empty if it isn't a request's.
+func RequestID(ctx context.Context) string {
+	if info := requestInfoFrom(ctx); info != nil {
+		return info.id
+	}
+	return ""
+}
+
+// Get the authenticated user of the request of "ctx", empty if there's none.
+func UserID(ctx context.Context) string {
+	if info := requestInfoFrom(ctx); info != nil {
+		return info.userID
+	}
+	return ""
+}
+
+// Record the authenticated user of the request of "ctx" for its access log.
+func SetUserID(ctx context.Context, userID string) {
+	if info := requestInfoFrom(ctx); info != nil {
+		info.userID = userID
+	}
+}
+
+// Middleware gives every request an id, taken from the X-Request-ID header or
+// generated, which is put on the context for the logs and sent back on the
+// response. Once "next" answers it logs one access log line with the route
+// the request matched, it must be behind [httpx.Middleware].
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = uuid.NewString()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		info := &requestInfo{id: id}
+		ctx := context.WithValue(r.Context(), requestInfoKey{}, info)
+
+		req := httpx.FromContext(ctx)
+		start := time.Now()
+		next.ServeHTTP(w, r.WithContext(ctx))
+
+		args := []any{
+			"method", r.Method,
+			"route", req.Route(),
+			"status", req.Recorder.Status,
+			"bytes", req.Recorder.Bytes,
+			"duration_ms", float64(time.Since(start).Microseconds()) / 1000,
+		}
+		if info.userID != "" {
+			args = append(args, "user_id", info.userID)
+		}
+		slog.Default().Log(ctx, slog.LevelInfo, "request", args...)
+	})
+}
+
+// handler adding the request id of the context to every log
+type requestIDHandler struct {
+	slog.Handler
+}
+
+func (h requestIDHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h requestIDHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return requestIDHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h requestIDHandler) WithGroup(name string) slog.Handler {
+	return requestIDHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,113 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/httpx"
+)
+
+func newTestServer() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/chirps/{chirpID}", func(w http.ResponseWriter, r *http.Request) {
+		SetUserID(r.Context(), "user-1")
+		LogInfoContext(r.Context(), "chirp read")
+		w.Write([]byte("chirp"))
+	})
+	return httpx.Middleware(mux, Middleware(mux))
+}
+
+// Decode the JSON logs written to "buf", one per line.
+func decodeAll(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var entries []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("expected a JSON log, got %q: %s", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestMiddleware(t *testing.T) {
+	buf := capture(t, "json", "info")
+	w := httptest.NewRecorder()
+
+	newTestServer().ServeHTTP(w, httptest.NewRequest("GET", "/api/chirps/1", nil))
+
+	id := w.Header().Get(RequestIDHeader)
+	if _, err := uuid.Parse(id); err != nil {
+		t.Fatalf("expected a generated request id, got %q", id)
+	}
+	entries := decodeAll(t, buf)
+	if len(entries) != 2 {
+		t.Fatalf("expected the handler log and the access log, got %d logs", len(entries))
+	}
+	if entries[0]["msg"] != "chirp read" || entries[0]["request_id"] != id {
+		t.Errorf("expected the handler log to have the request id, got %v", entries[0])
+	}
+	access := entries[1]
+	want := map[string]any{
+		"msg":        "request",
+		"method":     "GET",
+		"route":      "GET /api/chirps/{chirpID}",
+		"status":     float64(200),
+		"bytes":      float64(5),
+		"user_id":    "user-1",
+		"request_id": id,
+	}
+	for key, value := range want {
+		if access[key] != value {
+			t.Errorf("expected %s of the access log to be %v, got %v", key, value, access[key])
+		}
+	}
+	if _, ok := access["duration_ms"].(float64); !ok {
+		t.Errorf("expected the access log to have the duration, got %v", access["duration_ms"])
+	}
+}
+
+func TestMiddlewareRequestID(t *testing.T) {
+	tests := []struct {
+		name, header string
+		kept         bool
+	}{
+		{"propagated", "abc-123.proxy:1", true},
+		{"with spaces", "abc 123", false},
+		{"too long", strings.Repeat("a", 129), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			capture(t, "json", "info")
+			r := httptest.NewRequest("GET", "/nope", nil)
+			r.Header.Set(RequestIDHeader, tt.header)
+			w := httptest.NewRecorder()
+
+			newTestServer().ServeHTTP(w, r)
+
+			if got := w.Header().Get(RequestIDHeader); (got == tt.header) != tt.kept {
+				t.Errorf("expected the request id %q to be kept: %v, got %q", tt.header, tt.kept, got)
+			}
+		})
+	}
+}
+
+func TestMiddlewareUnmatched(t *testing.T) {
+	buf := capture(t, "json", "info")
+
+	newTestServer().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/nope", nil))
+
+	access := decodeAll(t, buf)[0]
+	if access["route"] != httpx.UnmatchedRoute || access["status"] != float64(404) {
+		t.Errorf("expected an unmatched 404 access log, got %v", access)
+	}
+	if _, ok := access["user_id"]; ok {
+		t.Errorf("expected no user id without authentication, got %v", access["user_id"])
+	}
+}
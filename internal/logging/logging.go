@@ -1,53 +1,182 @@
+// Package logging writes structured logs with [log/slog], as JSON for log
+// aggregation or as text for reading on a terminal, see [Setup].
+//
+// Every log takes a message and key/value attributes, like
+// LogInfo("user suspended", "user_id", user.ID). Attributes with sensitive
+// keys (passwords, tokens, secrets, Authorization headers...) are redacted
+// before being written, see [Redact]. The Log*Context functions add the id
+// of the request of the context, see [Middleware].
 package logging
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
 	"runtime"
 	"strings"
+	"time"
 )
 
-const (
-	ColorRed    = "\033[31m"
-	ColorGreen  = "\033[32m"
-	ColorYellow = "\033[33m"
-	ColorBlue   = "\033[34m"
-	ColorGray   = "\033[90m"
-	ColorReset  = "\033[0m"
-	LOGERROR    = ColorRed + "ERROR: " + ColorReset
-	LOGWARN     = ColorYellow + "WARN: " + ColorReset
-	LOGINFO     = ColorBlue + "INFO: " + ColorReset
-)
+// Redacted replaces the value of the sensitive attributes.
+const Redacted = "[REDACTED]"
 
-// Logs (s) to the terminal with (arg) arguments, before (s) you have "INFO: "
-// printed in Blue
-func LogInfo(s string, arg any) {
-	logType(LOGINFO, s, arg)
+// keys that are always sensitive, keys ending in _password, _token or
+// _secret are too
+var sensitiveKeys = map[string]bool{
+	"password":      true,
+	"token":         true,
+	"secret":        true,
+	"authorization": true,
+	"cookie":        true,
+	"set_cookie":    true,
+	"api_key":       true,
+	"apikey":        true,
+	"totp_code":     true,
+	"recovery_code": true,
 }
 
-// Logs (s) to the terminal with (arg) arguments, before (s) you have "ERROR: "
-// printed in Red
-func LogError(s string, arg any) {
-	logType(LOGERROR, s, arg)
+// Is an attribute with "key" sensitive.
+func sensitive(key string) bool {
+	key = strings.ReplaceAll(strings.ToLower(key), "-", "_")
+	return sensitiveKeys[key] ||
+		strings.HasSuffix(key, "_password") ||
+		strings.HasSuffix(key, "_token") ||
+		strings.HasSuffix(key, "_secret")
 }
 
-// Logs (s) to the terminal with (arg) arguments, before (s) you have "WARN: "
-// printed in Yellow
-func LogWarn(s string, arg any) {
-	logType(LOGWARN, s, arg)
+// Redact is a [slog.HandlerOptions] ReplaceAttr hiding the value of sensitive
+// attributes, and the sensitive headers of [http.Header] values.
+func Redact(groups []string, attr slog.Attr) slog.Attr {
+	if sensitive(attr.Key) {
+		return slog.String(attr.Key, Redacted)
+	}
+	if header, ok := attr.Value.Any().(http.Header); ok {
+		redacted := header.Clone()
+		for name := range redacted {
+			if sensitive(name) {
+				redacted[name] = []string{Redacted}
+			}
+		}
+		return slog.Any(attr.Key, redacted)
+	}
+	return attr
 }
 
-// detect which function called the log and log it
-func logType(t, s string, arg any) {
-	pc, _, _, ok := runtime.Caller(2)
-	if !ok {
-		log.Printf("%s[%sUnknown%s] %s: %v", t, ColorGray, ColorReset, s, arg)
-		return
+// Make a logger writing to "w" as "format" ("json" or "text") from "level"
+// ("debug", "info", "warn" or "error") up, with the sensitive attributes
+// redacted and the request id of the context added.
+func New(w io.Writer, format, level string) (*slog.Logger, error) {
+	var logLevel slog.Level
+	if err := logLevel.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q", level)
+	}
+	options := &slog.HandlerOptions{
+		AddSource:   true,
+		Level:       logLevel,
+		ReplaceAttr: Redact,
+	}
+	var handler slog.Handler
+	switch format {
+	case "json":
+		handler = slog.NewJSONHandler(w, options)
+	case "text":
+		handler = slog.NewTextHandler(w, options)
+	default:
+		return nil, fmt.Errorf("invalid log format %q, it must be \"json\" or \"text\"", format)
+	}
+	return slog.New(requestIDHandler{handler}), nil
+}
+
+// Make the logs go to stderr as "format" from "level" up, see [New].
+func Setup(format, level string) error {
+	logger, err := New(os.Stderr, format, level)
+	if err != nil {
+		return err
 	}
+	slog.SetDefault(logger)
+	return nil
+}
 
-	fn := runtime.FuncForPC(pc)
-	funcName := fn.Name()
-	parts := strings.Split(funcName, ".")
-	shortName := parts[len(parts)-1]
+// Logs "msg" with the "args" key/value attributes at debug level.
+func LogDebug(msg string, args ...any) {
+	logAt(context.Background(), slog.LevelDebug, msg, args...)
+}
 
-	log.Printf("%s[%s] %s: %v", t, shortName, s, arg)
+// Like [LogDebug] with the request id of "ctx".
+func LogDebugContext(ctx context.Context, msg string, args ...any) {
+	logAt(ctx, slog.LevelDebug, msg, args...)
+}
+
+// Logs "msg" with the "args" key/value attributes at info level.
+func LogInfo(msg string, args ...any) {
+	logAt(context.Background(), slog.LevelInfo, msg, args...)
+}
+
+// Like [LogInfo] with the request id of "ctx".
+func LogInfoContext(ctx context.Context, msg string, args ...any) {
+	logAt(ctx, slog.LevelInfo, msg, args...)
+}
+
+// Logs "msg" with the "args" key/value attributes at warn level.
+func LogWarn(msg string, args ...any) {
+	logAt(context.Background(), slog.LevelWarn, msg, args...)
+}
+
+// Like [LogWarn] with the request id of "ctx".
+func LogWarnContext(ctx context.Context, msg string, args ...any) {
+	logAt(ctx, slog.LevelWarn, msg, args...)
+}
+
+// Logs "msg" with the "args" key/value attributes at error level.
+func LogError(msg string, args ...any) {
+	logAt(context.Background(), slog.LevelError, msg, args...)
+}
+
+// Like [LogError] with the request id of "ctx".
+func LogErrorContext(ctx context.Context, msg string, args ...any) {
+	logAt(ctx, slog.LevelError, msg, args...)
+}
+
+// Logs "msg" at "level" like the Log*Context functions, but with the source
+// of the caller of the function calling it, for helpers logging on behalf of
+// their caller.
+func LogCallerContext(ctx context.Context, level slog.Level, msg string, args ...any) {
+	logAtDepth(ctx, 1, level, msg, args...)
+}
+
+// Logs the formatted message at error level and panics with it, for
+// configuration the server can't start without.
+func Panicf(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	logAt(context.Background(), slog.LevelError, msg)
+	panic(msg)
+}
+
+// Logs the formatted message at error level and exits with status 1.
+func Fatalf(format string, args ...any) {
+	logAt(context.Background(), slog.LevelError, fmt.Sprintf(format, args...))
+	os.Exit(1)
+}
+
+// Log with the source of the caller of the Log* function instead of this
+// package.
+func logAt(ctx context.Context, level slog.Level, msg string, args ...any) {
+	logAtDepth(ctx, 1, level, msg, args...)
+}
+
+// Like logAt with the source "depth" frames further up, logAt itself is one.
+func logAtDepth(ctx context.Context, depth int, level slog.Level, msg string, args ...any) {
+	logger := slog.Default()
+	if !logger.Enabled(ctx, level) {
+		return
+	}
+	var pcs [1]uintptr
+	// skip runtime.Callers, logAtDepth, the Log* function and "depth" more
+	runtime.Callers(3+depth, pcs[:])
+	record := slog.NewRecord(time.Now(), level, msg, pcs[0])
+	record.Add(args...)
+	logger.Handler().Handle(ctx, record)
 }
@@ -0,0 +1,136 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// Make "format" logs from "level" up the default ones until the test ends.
+func capture(t *testing.T, format, level string) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	logger, err := New(&buf, format, level)
+	if err != nil {
+		t.Fatalf("failed to make logger: %s", err)
+	}
+	previous := slog.Default()
+	slog.SetDefault(logger)
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+
+func decode(t *testing.T, buf *bytes.Buffer) map[string]any {
+	t.Helper()
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("expected a JSON log, got %q: %s", buf.String(), err)
+	}
+	return entry
+}
+
+func TestJSON(t *testing.T) {
+	buf := capture(t, "json", "info")
+
+	LogError("failed to save", "user_id", 7, "err", errors.New("boom"))
+
+	entry := decode(t, buf)
+	if entry["level"] != "ERROR" || entry["msg"] != "failed to save" {
+		t.Errorf("unexpected level or message: %v", entry)
+	}
+	if entry["user_id"] != float64(7) || entry["err"] != "boom" {
+		t.Errorf("expected the attributes to be kept, got %v", entry)
+	}
+	source, _ := entry["source"].(map[string]any)
+	if file, _ := source["file"].(string); !strings.HasSuffix(file, "logging_test.go") {
+		t.Errorf("expected the source to be the caller, got %v", entry["source"])
+	}
+}
+
+func TestLogCallerContext(t *testing.T) {
+	buf := capture(t, "json", "info")
+	helper := func() {
+		LogCallerContext(context.Background(), slog.LevelWarn, "invalid params")
+	}
+
+	helper()
+
+	entry := decode(t, buf)
+	source, _ := entry["source"].(map[string]any)
+	if function, _ := source["function"].(string); !strings.HasSuffix(function, "TestLogCallerContext") {
+		t.Errorf("expected the source to be the caller of the helper, got %v", entry["source"])
+	}
+}
+
+func TestText(t *testing.T) {
+	buf := capture(t, "text", "info")
+
+	LogInfo("user suspended", "user_id", 7)
+
+	if out := buf.String(); !strings.Contains(out, "level=INFO") || !strings.Contains(out, "user_id=7") {
+		t.Errorf("unexpected text log: %q", out)
+	}
+}
+
+func TestLevel(t *testing.T) {
+	buf := capture(t, "json", "warn")
+
+	LogDebug("debug")
+	LogInfo("info")
+	if buf.Len() != 0 {
+		t.Errorf("expected logs under warn to be dropped, got %q", buf.String())
+	}
+	LogWarn("warn")
+	if decode(t, buf)["msg"] != "warn" {
+		t.Errorf("expected the warn log to be written")
+	}
+}
+
+func TestRedact(t *testing.T) {
+	buf := capture(t, "json", "info")
+	header := http.Header{}
+	header.Set("Authorization", "Bearer abc")
+	header.Set("Content-Type", "application/json")
+
+	LogInfo("request",
+		"password", "hunter2",
+		"refresh_token", "abc",
+		"Client-Secret", "abc",
+		"token_id", 3,
+		"headers", header,
+	)
+
+	entry := decode(t, buf)
+	for _, key := range []string{"password", "refresh_token", "Client-Secret"} {
+		if entry[key] != Redacted {
+			t.Errorf("expected %s to be redacted, got %v", key, entry[key])
+		}
+	}
+	if entry["token_id"] != float64(3) {
+		t.Errorf("expected token_id not to be redacted, got %v", entry["token_id"])
+	}
+	headers, _ := entry["headers"].(map[string]any)
+	if got := headers["Authorization"].([]any)[0]; got != Redacted {
+		t.Errorf("expected the Authorization header to be redacted, got %v", got)
+	}
+	if got := headers["Content-Type"].([]any)[0]; got != "application/json" {
+		t.Errorf("expected the Content-Type header to be kept, got %v", got)
+	}
+	if header.Get("Authorization") != "Bearer abc" {
+		t.Errorf("expected the logged header not to be changed")
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	if _, err := New(&bytes.Buffer{}, "xml", "info"); err == nil {
+		t.Errorf("expected an invalid format to fail")
+	}
+	if _, err := New(&bytes.Buffer{}, "json", "loud"); err == nil {
+		t.Errorf("expected an invalid level to fail")
+	}
+}
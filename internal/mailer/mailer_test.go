@@ -0,0 +1,64 @@
+package mailer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMessageBytes(t *testing.T) {
+	msg := Message{To: "bob@example.com", Subject: "Hi", Body: "line one\nline two"}
+	date := time.Date(2025, 8, 21, 12, 0, 0, 0, time.UTC)
+	expected := "From: chirpy@example.com\r\n" +
+		"To: bob@example.com\r\n" +
+		"Subject: Hi\r\n" +
+		"Date: Thu, 21 Aug 2025 12:00:00 +0000\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" +
+		"line one\r\nline two"
+	if got := string(msg.Bytes("chirpy@example.com", date)); got != expected {
+		t.Errorf("Bytes returned:\n%q\nexpected:\n%q", got, expected)
+	}
+}
+
+func TestFileMailerWritesEml(t *testing.T) {
+	dir := t.TempDir()
+	m := &FileMailer{Dir: filepath.Join(dir, "mail"), From: "chirpy@example.com"}
+	err := m.Send(context.Background(), Message{To: "bob@example.com", Subject: "Hi", Body: "token"})
+	if err != nil {
+		t.Fatalf("failed to Send: %s", err)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "mail", "*-bob@example.com.eml"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("expected one eml file, got %v err: %v", files, err)
+	}
+	content, err := os.ReadFile(files[0])
+	if err != nil || !strings.HasSuffix(string(content), "\r\n\r\ntoken") {
+		t.Errorf("eml file has content %q err: %v", content, err)
+	}
+}
+
+func TestMemoryMailerKeepsMessages(t *testing.T) {
+	m := &MemoryMailer{}
+	for _, to := range []string{"a@example.com", "b@example.com"} {
+		if err := m.Send(context.Background(), Message{To: to}); err != nil {
+			t.Fatalf("failed to Send: %s", err)
+		}
+	}
+	messages := m.Messages()
+	if len(messages) != 2 || messages[0].To != "a@example.com" || messages[1].To != "b@example.com" {
+		t.Errorf("Messages returned %v", messages)
+	}
+}
+
+func TestSMTPMailerRejectsHeaderInjection(t *testing.T) {
+	m := &SMTPMailer{Addr: "localhost:25", From: "chirpy@example.com"}
+	err := m.Send(context.Background(), Message{To: "bob@example.com\r\nBcc: eve@example.com"})
+	if err == nil {
+		t.Errorf("Send accepted a recipient with a line break")
+	}
+}
@@ -0,0 +1,135 @@
+// Package metrics exposes the metrics of Chirpy in the Prometheus exposition
+// format: the requests of every route (see [Metrics.Middleware]), the
+// database pool and business counters like chirps created.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/httpx"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace of every metric
+const namespace = "chirpy"
+
+// Metrics of a server, on their own registry.
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	inFlight *prometheus.GaugeVec
+
+	// chirps posted
+	ChirpsCreated prometheus.Counter
+	// sessions started, by any way of logging in
+	Logins prometheus.Counter
+	// logins with a wrong password, code or passkey, and wrong passwords
+	// confirming a sensitive change
+	FailedLogins prometheus.Counter
+	// incoming webhook events by source and outcome
+	WebhookEvents *prometheus.CounterVec
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by route, method and status class.",
+		}, []string{"route", "method", "status"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Time to answer HTTP requests by route and method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method"}),
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "http_requests_in_flight",
+			Help:      "HTTP requests being answered by route.",
+		}, []string{"route"}),
+		ChirpsCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "chirps_created_total",
+			Help:      "Chirps posted.",
+		}),
+		Logins: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "logins_total",
+			Help:      "Sessions started.",
+		}),
+		FailedLogins: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "failed_logins_total",
+			Help:      "Failed credential checks, on logins and sensitive changes.",
+		}),
+		WebhookEvents: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "webhook_events_total",
+			Help:      "Incoming webhook events by source and outcome.",
+		}, []string{"source", "status"}),
+	}
+	m.Registry.MustRegister(
+		m.requests,
+		m.duration,
+		m.inFlight,
+		m.ChirpsCreated,
+		m.Logins,
+		m.FailedLogins,
+		m.WebhookEvents,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// Export the stats of the connection pool of "db" (open, in use and idle
+// connections, waits...) as the go_sql_* metrics.
+func (m *Metrics) RegisterDB(db *sql.DB, name string) {
+	m.Registry.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+// Handler answers with the metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{Registry: m.Registry})
+}
+
+// Middleware measures every request, labeled by the route it matched, it
+// must be behind [httpx.Middleware].
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := httpx.FromContext(r.Context())
+		route := req.Route()
+		method := methodLabel(r.Method)
+
+		inFlight := m.inFlight.WithLabelValues(route)
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		start := time.Now()
+		next.ServeHTTP(w, r)
+		m.duration.WithLabelValues(route, method).Observe(time.Since(start).Seconds())
+		m.requests.WithLabelValues(route, method, statusClass(req.Recorder.Status)).Inc()
+	})
+}
+
+// "2xx", "4xx"... of the status code
+func statusClass(status int) string {
+	return strconv.Itoa(status/100) + "xx"
+}
+
+// method label, the non standard methods are all "OTHER"
+func methodLabel(method string) string {
+	if httpx.StandardMethod(method) {
+		return method
+	}
+	return "OTHER"
+}
@@ -0,0 +1,112 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/httpx"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func newTestServer(m *Metrics) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/chirps/{chirpID}", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("chirpID") == "missing" {
+			w.WriteHeader(404)
+			return
+		}
+		w.Write([]byte("chirp"))
+	})
+	mux.HandleFunc("POST /api/chirps", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(500)
+	})
+	return httpx.Middleware(mux, m.Middleware(mux))
+}
+
+func serve(handler http.Handler, method, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+	return w
+}
+
+func TestMiddleware(t *testing.T) {
+	m := New()
+	handler := newTestServer(m)
+
+	serve(handler, "GET", "/api/chirps/1")
+	serve(handler, "GET", "/api/chirps/2")
+	serve(handler, "GET", "/api/chirps/missing")
+	serve(handler, "POST", "/api/chirps")
+	serve(handler, "GET", "/nope/1")
+	serve(handler, "GET", "/nope/2")
+
+	tests := []struct {
+		route, method, status string
+		want                  float64
+	}{
+		{"GET /api/chirps/{chirpID}", "GET", "2xx", 2},
+		{"GET /api/chirps/{chirpID}", "GET", "4xx", 1},
+		{"POST /api/chirps", "POST", "5xx", 1},
+		{httpx.UnmatchedRoute, "GET", "4xx", 2},
+	}
+	for _, tt := range tests {
+		if got := testutil.ToFloat64(m.requests.WithLabelValues(tt.route, tt.method, tt.status)); got != tt.want {
+			t.Errorf("%s %s: expected %v requests, got %v", tt.route, tt.status, tt.want, got)
+		}
+	}
+	if got := testutil.CollectAndCount(m.duration); got != 3 {
+		t.Errorf("expected a latency histogram for each of the 3 routes, got %d", got)
+	}
+	if got := testutil.ToFloat64(m.inFlight.WithLabelValues("POST /api/chirps")); got != 0 {
+		t.Errorf("expected no requests in flight after answering, got %v", got)
+	}
+}
+
+func TestMiddlewareInFlight(t *testing.T) {
+	m := New()
+	mux := http.NewServeMux()
+	var inFlight float64
+	mux.HandleFunc("GET /slow", func(w http.ResponseWriter, r *http.Request) {
+		inFlight = testutil.ToFloat64(m.inFlight.WithLabelValues("GET /slow"))
+	})
+
+	serve(httpx.Middleware(mux, m.Middleware(mux)), "GET", "/slow")
+
+	if inFlight != 1 {
+		t.Errorf("expected 1 request in flight while answering, got %v", inFlight)
+	}
+}
+
+func TestMethodLabel(t *testing.T) {
+	m := New()
+	serve(newTestServer(m), "BREW", "/api/chirps/1")
+
+	if got := testutil.ToFloat64(m.requests.WithLabelValues(httpx.UnmatchedRoute, "OTHER", "4xx")); got != 1 {
+		t.Errorf("expected a non standard method to be labeled OTHER, got %v", got)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	m := New()
+	m.ChirpsCreated.Inc()
+	m.WebhookEvents.WithLabelValues("polka", "processed").Inc()
+	serve(newTestServer(m), "GET", "/api/chirps/1")
+
+	response := serve(m.Handler(), "GET", "/metrics")
+	body, _ := io.ReadAll(response.Body)
+
+	for _, want := range []string{
+		"chirpy_chirps_created_total 1",
+		`chirpy_webhook_events_total{source="polka",status="processed"} 1`,
+		`chirpy_http_requests_total{method="GET",route="GET /api/chirps/{chirpID}",status="2xx"} 1`,
+		"chirpy_http_request_duration_seconds_bucket",
+		"go_goroutines",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("expected the exposition to have %s", want)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package oauth
+
+import (
+	"html/template"
+	"net/http"
+
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/auth"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/logging"
+)
+
+// what the user is told every scope allows
+var scopeDescriptions = map[auth.Scope]string{
+	auth.ScopeChirpsRead:   "Read chirps",
+	auth.ScopeChirpsWrite:  "Post and delete chirps as you",
+	auth.ScopeProfileWrite: "Update your profile and who you follow",
+}
+
+var consentTemplate = template.Must(template.New("consent").Parse(`<html>
+  <body>
+    <h1>{{.Client.Name}} wants to access your Chirpy account</h1>
+    <p>It will be able to:</p>
+    <ul>
+      {{range .Descriptions}}<li>{{.}}</li>
+      {{end}}
+    </ul>
+    {{if .Error}}<p><strong>{{.Error}}</strong></p>{{end}}
+    <form method="POST" action="/oauth/authorize">
+      <input type="hidden" name="response_type" value="code">
+      <input type="hidden" name="client_id" value="{{.Client.ID}}">
+      <input type="hidden" name="redirect_uri" value="{{.RedirectURI}}">
+      <input type="hidden" name="scope" value="{{.Scope}}">
+      <input type="hidden" name="state" value="{{.State}}">
+      <input type="hidden" name="code_challenge" value="{{.CodeChallenge}}">
+      <input type="hidden" name="code_challenge_method" value="S256">
+      <label>Email <input type="email" name="email" autocomplete="username"></label>
+      <label>Password <input type="password" name="password" autocomplete="current-password"></label>
+      <label>2FA code (if enabled) <input type="text" name="code" autocomplete="one-time-code"></label>
+      <button type="submit" name="action" value="approve">Allow</button>
+      <button type="submit" name="action" value="deny">Deny</button>
+    </form>
+    <p>You will be sent to {{.RedirectURI}}</p>
+  </body>
+</html>`))
+
+// Render the consent screen of the request, with "errorMsg" when the last
+// attempt failed.
+func renderConsent(w http.ResponseWriter, code int, req authorizationRequest, errorMsg string) {
+	descriptions := make([]string, len(req.Scopes))
+	for i, scope := range req.Scopes {
+		descriptions[i] = scopeDescriptions[scope]
+	}
+	// so other sites can't frame it and trick the user into clicking
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	err := consentTemplate.Execute(w, struct {
+		authorizationRequest
+		Scope        string
+		Descriptions []string
+		Error        string
+	}{
+		authorizationRequest: req,
+		Scope:                auth.JoinScopes(req.Scopes),
+		Descriptions:         descriptions,
+		Error:                errorMsg,
+	})
+	if err != nil {
+		logging.LogError("failed to render consent screen", "err", err)
+	}
+}
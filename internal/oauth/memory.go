@@ -0,0 +1,170 @@
+package oauth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/auth"
+)
+
+// MemoryStore keeps everything in memory, it's meant for tests. It's also an
+// [auth.DenylistStore] so the denied access tokens can be checked.
+type MemoryStore struct {
+	mu            sync.Mutex
+	clients       map[string]Client
+	codes         map[string]Code
+	refreshTokens map[string]RefreshToken
+	accessTokens  map[string]memoryAccessToken
+	denied        map[string]time.Time
+}
+
+type memoryAccessToken struct {
+	refreshToken string
+	expiresAt    time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		clients:       map[string]Client{},
+		codes:         map[string]Code{},
+		refreshTokens: map[string]RefreshToken{},
+		accessTokens:  map[string]memoryAccessToken{},
+		denied:        map[string]time.Time{},
+	}
+}
+
+// Register a client, clients are registered through the database otherwise.
+func (s *MemoryStore) AddClient(client Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clients[client.ID] = client
+}
+
+func (s *MemoryStore) GetClient(ctx context.Context, clientID string) (Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	client, ok := s.clients[clientID]
+	if !ok {
+		return Client{}, ErrNotFound
+	}
+	return client, nil
+}
+
+func (s *MemoryStore) CreateCode(ctx context.Context, code Code) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.codes[code.CodeHash] = code
+	return nil
+}
+
+func (s *MemoryStore) UseCode(ctx context.Context, codeHash string) (Code, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	code, ok := s.codes[codeHash]
+	if !ok {
+		return Code{}, ErrNotFound
+	}
+	delete(s.codes, codeHash)
+	if time.Now().After(code.ExpiresAt) {
+		return Code{}, ErrNotFound
+	}
+	return code, nil
+}
+
+func (s *MemoryStore) CreateRefreshToken(ctx context.Context, refreshToken RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refreshTokens[refreshToken.Token] = refreshToken
+	return nil
+}
+
+func (s *MemoryStore) GetRefreshToken(ctx context.Context, token string) (RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	refreshToken, ok := s.refreshTokens[token]
+	if !ok {
+		return RefreshToken{}, ErrNotFound
+	}
+	return refreshToken, nil
+}
+
+func (s *MemoryStore) RevokeRefreshToken(ctx context.Context, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	refreshToken, ok := s.refreshTokens[token]
+	if !ok || refreshToken.Revoked {
+		return ErrNotFound
+	}
+	refreshToken.Revoked = true
+	s.refreshTokens[token] = refreshToken
+	return nil
+}
+
+func (s *MemoryStore) RevokeClientTokens(ctx context.Context, clientID string, userID uuid.UUID) ([]auth.AccessToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	revoked := map[string]bool{}
+	for token, refreshToken := range s.refreshTokens {
+		if refreshToken.ClientID != clientID || refreshToken.UserID != userID {
+			continue
+		}
+		revoked[token] = true
+		refreshToken.Revoked = true
+		s.refreshTokens[token] = refreshToken
+	}
+	denied := []auth.AccessToken{}
+	for jti, accessToken := range s.accessTokens {
+		if !revoked[accessToken.refreshToken] || time.Now().After(accessToken.expiresAt) {
+			continue
+		}
+		if _, ok := s.denied[jti]; ok {
+			continue
+		}
+		s.denied[jti] = accessToken.expiresAt
+		denied = append(denied, auth.AccessToken{ID: jti, ExpiresAt: accessToken.expiresAt})
+	}
+	return denied, nil
+}
+
+func (s *MemoryStore) RecordAccessToken(ctx context.Context, userID uuid.UUID, accessToken auth.AccessToken, refreshToken string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accessTokens[accessToken.ID] = memoryAccessToken{
+		refreshToken: refreshToken,
+		expiresAt:    accessToken.ExpiresAt,
+	}
+	return nil
+}
+
+func (s *MemoryStore) DenyAccessTokensFromRefreshToken(ctx context.Context, refreshToken string) ([]auth.AccessToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	denied := []auth.AccessToken{}
+	for jti, accessToken := range s.accessTokens {
+		if accessToken.refreshToken != refreshToken || time.Now().After(accessToken.expiresAt) {
+			continue
+		}
+		if _, ok := s.denied[jti]; ok {
+			continue
+		}
+		s.denied[jti] = accessToken.expiresAt
+		denied = append(denied, auth.AccessToken{ID: jti, ExpiresAt: accessToken.expiresAt})
+	}
+	return denied, nil
+}
+
+func (s *MemoryStore) DenyAccessToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.denied[jti] = expiresAt
+	return nil
+}
+
+func (s *MemoryStore) IsAccessTokenDenied(ctx context.Context, jti string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.denied[jti]
+	return ok, nil
+}
@@ -0,0 +1,131 @@
+// Package oauth is the OAuth 2.0 authorization server that lets third-party
+// apps act on behalf of Chirpy users.
+//
+// Only the authorization code flow with PKCE (S256) is supported. Access
+// tokens are scoped JWTs made by [auth.IssueScopedJWT] and refresh tokens
+// are rotated every time they are used.
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/auth"
+)
+
+// Returned by the [Store] when a client, code or token doesn't exist, a code
+// was already used or it expired.
+var ErrNotFound = errors.New("oauth: not found")
+
+// Client is a registered third-party app.
+type Client struct {
+	ID   string
+	Name string
+	// [auth.HashToken] of the secret of confidential clients, empty for
+	// public clients (e.g. mobile apps) that can't keep a secret
+	SecretHash string
+	// the redirect_uri has to be exactly one of them
+	RedirectURIs []string
+	// most the app can ask for
+	Scopes []auth.Scope
+}
+
+// Whether the client has no secret and only authenticates with PKCE.
+func (c Client) Public() bool {
+	return c.SecretHash == ""
+}
+
+// Code is an authorization code given to the client after the user consents,
+// only its [auth.HashToken] is stored.
+type Code struct {
+	CodeHash      string
+	ClientID      string
+	UserID        uuid.UUID
+	RedirectURI   string
+	Scopes        []auth.Scope
+	CodeChallenge string
+	ExpiresAt     time.Time
+}
+
+// RefreshToken given to a client, stored on the same table as the
+// first-party ones.
+type RefreshToken struct {
+	Token     string
+	ClientID  string
+	UserID    uuid.UUID
+	Scopes    []auth.Scope
+	ExpiresAt time.Time
+	Revoked   bool
+}
+
+// Store persists the clients and tokens, use [MemoryStore] on tests and
+// [PostgresStore] otherwise.
+type Store interface {
+	GetClient(ctx context.Context, clientID string) (Client, error)
+	CreateCode(ctx context.Context, code Code) error
+	// Mark the code as used and return it, it's [ErrNotFound] when the code
+	// doesn't exist, expired or was already used
+	UseCode(ctx context.Context, codeHash string) (Code, error)
+	CreateRefreshToken(ctx context.Context, refreshToken RefreshToken) error
+	GetRefreshToken(ctx context.Context, token string) (RefreshToken, error)
+	// Revoke the refresh token, it's [ErrNotFound] when the token doesn't
+	// exist or was already revoked
+	RevokeRefreshToken(ctx context.Context, token string) error
+	// Revoke every refresh token the client has for the user and put their
+	// live access tokens on the denylist, returning them
+	RevokeClientTokens(ctx context.Context, clientID string, userID uuid.UUID) ([]auth.AccessToken, error)
+	// Keep track of an access token issued together with "refreshToken" so it
+	// can be denied when the refresh token is revoked
+	RecordAccessToken(ctx context.Context, userID uuid.UUID, accessToken auth.AccessToken, refreshToken string) error
+	// Put the live access tokens issued with "refreshToken" on the denylist
+	// and return them
+	DenyAccessTokensFromRefreshToken(ctx context.Context, refreshToken string) ([]auth.AccessToken, error)
+	DenyAccessToken(ctx context.Context, jti string, expiresAt time.Time) error
+}
+
+// Make the id and secret of a new client, only the [auth.HashToken] of the
+// secret should be stored.
+func NewClientCredentials() (id, secret string, err error) {
+	idArr := make([]byte, 16)
+	if _, err := rand.Read(idArr); err != nil {
+		return "", "", err
+	}
+	secretArr := make([]byte, 32)
+	if _, err := rand.Read(secretArr); err != nil {
+		return "", "", err
+	}
+	return hex.EncodeToString(idArr), hex.EncodeToString(secretArr), nil
+}
+
+// Make the S256 PKCE code_challenge of a "verifier".
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// Whether "verifier" is a valid RFC 7636 code_verifier of the S256
+// "challenge".
+func VerifyCodeChallenge(verifier, challenge string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(CodeChallenge(verifier)), []byte(challenge)) == 1
+}
+
+// Whether every one of the "scopes" is on "allowed".
+func allScopesAllowed(scopes, allowed []auth.Scope) bool {
+	for _, scope := range scopes {
+		if !slices.Contains(allowed, scope) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,363 @@
+package oauth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/auth"
+)
+
+const (
+	testSecret      = "secretTest"
+	testVerifier    = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	testRedirectURI = "https://bot.example.com/callback"
+)
+
+var testUserID = uuid.New()
+
+type testServer struct {
+	*httptest.Server
+	store    *MemoryStore
+	denylist *auth.Denylist
+	client   Client
+	secret   string
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	store := NewMemoryStore()
+	denylist := auth.NewDenylist(store, time.Minute)
+	provider := NewProvider(store, denylist, testSecret, func(r *http.Request) (uuid.UUID, error) {
+		if r.PostForm.Get("email") != "bob@example.com" || r.PostForm.Get("password") != "hunter22hunter22" {
+			return uuid.Nil, fmt.Errorf("wrong credentials")
+		}
+		return testUserID, nil
+	})
+
+	clientID, secret, err := NewClientCredentials()
+	if err != nil {
+		t.Fatalf("failed to make client credentials: %s", err)
+	}
+	client := Client{
+		ID:           clientID,
+		Name:         "Chirp Bot",
+		SecretHash:   auth.HashToken(secret),
+		RedirectURIs: []string{testRedirectURI},
+		Scopes:       []auth.Scope{auth.ScopeChirpsRead, auth.ScopeChirpsWrite},
+	}
+	store.AddClient(client)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /oauth/authorize", provider.AuthorizeHandler)
+	mux.HandleFunc("POST /oauth/authorize", provider.ConsentHandler)
+	mux.HandleFunc("POST /oauth/token", provider.TokenHandler)
+	mux.HandleFunc("POST /oauth/revoke", provider.RevokeHandler)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	// the redirects go to the client, so they are checked instead of followed
+	server.Client().CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	return &testServer{Server: server, store: store, denylist: denylist, client: client, secret: secret}
+}
+
+func (s *testServer) authorizeParams() url.Values {
+	return url.Values{
+		"response_type":         {"code"},
+		"client_id":             {s.client.ID},
+		"redirect_uri":          {testRedirectURI},
+		"scope":                 {"chirps:write"},
+		"state":                 {"xyz"},
+		"code_challenge":        {CodeChallenge(testVerifier)},
+		"code_challenge_method": {"S256"},
+	}
+}
+
+// Post the consent form and return where the user got redirected to.
+func (s *testServer) consent(t *testing.T, params url.Values) *url.URL {
+	t.Helper()
+	res, err := s.Client().PostForm(s.URL+"/oauth/authorize", params)
+	if err != nil {
+		t.Fatalf("failed to POST /oauth/authorize: %s", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusFound {
+		t.Fatalf("POST /oauth/authorize returned %d expected a redirect", res.StatusCode)
+	}
+	location, err := url.Parse(res.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("failed to parse redirect: %s", err)
+	}
+	return location
+}
+
+func (s *testServer) approve(t *testing.T, params url.Values) string {
+	t.Helper()
+	params.Set("email", "bob@example.com")
+	params.Set("password", "hunter22hunter22")
+	params.Set("action", "approve")
+	location := s.consent(t, params)
+	if location.Query().Get("state") != "xyz" {
+		t.Errorf("redirect %s lost the state", location)
+	}
+	code := location.Query().Get("code")
+	if code == "" {
+		t.Fatalf("redirect %s has no code", location)
+	}
+	return code
+}
+
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int    `json:"expires_in"`
+	RefreshToken     string `json:"refresh_token"`
+	Scope            string `json:"scope"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// POST "form" to "path" authenticated with HTTP Basic as the test client.
+func (s *testServer) postAsClient(t *testing.T, path string, form url.Values) (int, tokenResponse) {
+	t.Helper()
+	req, _ := http.NewRequest("POST", s.URL+path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(s.client.ID, s.secret)
+	res, err := s.Client().Do(req)
+	if err != nil {
+		t.Fatalf("failed to POST %s: %s", path, err)
+	}
+	defer res.Body.Close()
+	body := tokenResponse{}
+	if data, _ := io.ReadAll(res.Body); len(data) > 0 {
+		json.Unmarshal(data, &body)
+	}
+	return res.StatusCode, body
+}
+
+func (s *testServer) exchangeCode(t *testing.T, code, verifier string) (int, tokenResponse) {
+	t.Helper()
+	return s.postAsClient(t, "/oauth/token", url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {testRedirectURI},
+		"code_verifier": {verifier},
+	})
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	s := newTestServer(t)
+
+	res, err := s.Client().Get(s.URL + "/oauth/authorize?" + s.authorizeParams().Encode())
+	if err != nil {
+		t.Fatalf("failed to GET /oauth/authorize: %s", err)
+	}
+	page, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != 200 || !strings.Contains(string(page), "Chirp Bot") {
+		t.Fatalf("GET /oauth/authorize returned %d without the consent screen", res.StatusCode)
+	}
+
+	code := s.approve(t, s.authorizeParams())
+	status, tokens := s.exchangeCode(t, code, testVerifier)
+	if status != 200 || tokens.TokenType != "Bearer" || tokens.Scope != "chirps:write" {
+		t.Fatalf("POST /oauth/token returned %d %+v", status, tokens)
+	}
+	claims, err := auth.ParseJWT(tokens.AccessToken, testSecret)
+	if err != nil {
+		t.Fatalf("access token isn't a valid JWT: %s", err)
+	}
+	if claims.UserID != testUserID || !reflect.DeepEqual(claims.Scopes, []auth.Scope{auth.ScopeChirpsWrite}) {
+		t.Errorf("access token has claims %+v", claims)
+	}
+
+	if status, body := s.exchangeCode(t, code, testVerifier); status != 400 || body.Error != "invalid_grant" {
+		t.Errorf("reusing the code returned %d %+v", status, body)
+	}
+
+	status, refreshed := s.postAsClient(t, "/oauth/token", url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {tokens.RefreshToken},
+	})
+	if status != 200 || refreshed.RefreshToken == tokens.RefreshToken {
+		t.Fatalf("refreshing returned %d %+v", status, refreshed)
+	}
+	status, body := s.postAsClient(t, "/oauth/token", url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {tokens.RefreshToken},
+	})
+	if status != 400 || body.Error != "invalid_grant" {
+		t.Errorf("reusing a rotated refresh token returned %d %+v", status, body)
+	}
+
+	if status, _ := s.postAsClient(t, "/oauth/revoke", url.Values{"token": {refreshed.RefreshToken}}); status != 200 {
+		t.Fatalf("POST /oauth/revoke returned %d", status)
+	}
+	claims, _ = auth.ParseJWT(refreshed.AccessToken, testSecret)
+	if denied, _ := s.denylist.IsDenied(t.Context(), claims.ID); !denied {
+		t.Errorf("access token of the revoked refresh token isn't denied")
+	}
+}
+
+// Reusing a rotated refresh token means it leaked, so the tokens issued
+// from it are revoked too.
+func TestRefreshTokenReuse(t *testing.T) {
+	s := newTestServer(t)
+	_, tokens := s.exchangeCode(t, s.approve(t, s.authorizeParams()), testVerifier)
+	refresh := func(refreshToken string) (int, tokenResponse) {
+		return s.postAsClient(t, "/oauth/token", url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {refreshToken},
+		})
+	}
+
+	status, refreshed := refresh(tokens.RefreshToken)
+	if status != 200 {
+		t.Fatalf("refreshing returned %d %+v", status, refreshed)
+	}
+	if status, body := refresh(tokens.RefreshToken); status != 400 || body.Error != "invalid_grant" {
+		t.Errorf("reusing a rotated refresh token returned %d %+v", status, body)
+	}
+	if status, body := refresh(refreshed.RefreshToken); status != 400 || body.Error != "invalid_grant" {
+		t.Errorf("refresh token issued from a reused one still works, returned %d %+v", status, body)
+	}
+	claims, _ := auth.ParseJWT(refreshed.AccessToken, testSecret)
+	if denied, _ := s.denylist.IsDenied(t.Context(), claims.ID); !denied {
+		t.Errorf("access token issued from a reused refresh token isn't denied")
+	}
+}
+
+func TestRevokeAccessToken(t *testing.T) {
+	s := newTestServer(t)
+	_, tokens := s.exchangeCode(t, s.approve(t, s.authorizeParams()), testVerifier)
+
+	if status, _ := s.postAsClient(t, "/oauth/revoke", url.Values{"token": {tokens.AccessToken}}); status != 200 {
+		t.Fatalf("POST /oauth/revoke returned %d", status)
+	}
+	claims, _ := auth.ParseJWT(tokens.AccessToken, testSecret)
+	if denied, _ := s.denylist.IsDenied(t.Context(), claims.ID); !denied {
+		t.Errorf("revoked access token isn't denied")
+	}
+	if status, _ := s.postAsClient(t, "/oauth/revoke", url.Values{"token": {"unknown"}}); status != 200 {
+		t.Errorf("revoking an unknown token returned %d expected 200", status)
+	}
+}
+
+func TestAuthorizeErrors(t *testing.T) {
+	s := newTestServer(t)
+
+	params := s.authorizeParams()
+	params.Set("redirect_uri", "https://evil.example.com/callback")
+	res, err := s.Client().Get(s.URL + "/oauth/authorize?" + params.Encode())
+	if err != nil {
+		t.Fatalf("failed to GET /oauth/authorize: %s", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != 400 {
+		t.Errorf("unregistered redirect_uri returned %d expected 400 without redirecting", res.StatusCode)
+	}
+
+	cases := []struct {
+		name     string
+		change   func(url.Values)
+		expected string
+	}{
+		{"without PKCE", func(v url.Values) { v.Del("code_challenge") }, "invalid_request"},
+		{"plain PKCE", func(v url.Values) { v.Set("code_challenge_method", "plain") }, "invalid_request"},
+		{"scope not allowed", func(v url.Values) { v.Set("scope", "profile:write") }, "invalid_scope"},
+		{"unknown scope", func(v url.Values) { v.Set("scope", "chirps:delete") }, "invalid_scope"},
+		{"denied", func(v url.Values) { v.Set("action", "deny") }, "access_denied"},
+	}
+	for _, c := range cases {
+		params := s.authorizeParams()
+		params.Set("action", "approve")
+		c.change(params)
+		location := s.consent(t, params)
+		if location.Query().Get("error") != c.expected || location.Query().Get("state") != "xyz" {
+			t.Errorf("%s redirected to %s expected error %s", c.name, location, c.expected)
+		}
+	}
+
+	params = s.authorizeParams()
+	params.Set("action", "approve")
+	params.Set("email", "bob@example.com")
+	params.Set("password", "wrong")
+	res, err = s.Client().PostForm(s.URL+"/oauth/authorize", params)
+	if err != nil {
+		t.Fatalf("failed to POST /oauth/authorize: %s", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != 401 {
+		t.Errorf("wrong password returned %d expected 401", res.StatusCode)
+	}
+}
+
+func TestTokenErrors(t *testing.T) {
+	s := newTestServer(t)
+
+	code := s.approve(t, s.authorizeParams())
+	if status, body := s.exchangeCode(t, code, strings.Repeat("a", 43)); status != 400 || body.Error != "invalid_grant" {
+		t.Errorf("wrong code_verifier returned %d %+v", status, body)
+	}
+
+	s.secret = "wrong"
+	code = s.approve(t, s.authorizeParams())
+	if status, body := s.exchangeCode(t, code, testVerifier); status != 401 || body.Error != "invalid_client" {
+		t.Errorf("wrong client secret returned %d %+v", status, body)
+	}
+}
+
+func TestPublicClient(t *testing.T) {
+	s := newTestServer(t)
+	public := Client{
+		ID:           "public-app",
+		Name:         "Chirp Mobile",
+		RedirectURIs: []string{testRedirectURI},
+		Scopes:       []auth.Scope{auth.ScopeChirpsRead},
+	}
+	s.store.AddClient(public)
+
+	params := s.authorizeParams()
+	params.Set("client_id", public.ID)
+	params.Del("scope")
+	code := s.approve(t, params)
+
+	res, err := s.Client().PostForm(s.URL+"/oauth/token", url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {public.ID},
+		"code":          {code},
+		"redirect_uri":  {testRedirectURI},
+		"code_verifier": {testVerifier},
+	})
+	if err != nil {
+		t.Fatalf("failed to POST /oauth/token: %s", err)
+	}
+	defer res.Body.Close()
+	tokens := tokenResponse{}
+	json.NewDecoder(res.Body).Decode(&tokens)
+	if res.StatusCode != 200 || tokens.Scope != "chirps:read" {
+		t.Errorf("public client got %d %+v expected the client scopes", res.StatusCode, tokens)
+	}
+}
+
+func TestVerifyCodeChallenge(t *testing.T) {
+	// example from RFC 7636 appendix B
+	if challenge := CodeChallenge(testVerifier); challenge != "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM" {
+		t.Errorf("CodeChallenge returned %s", challenge)
+	}
+	if !VerifyCodeChallenge(testVerifier, "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM") {
+		t.Errorf("VerifyCodeChallenge rejected the RFC 7636 example")
+	}
+	if VerifyCodeChallenge("short", CodeChallenge("short")) {
+		t.Errorf("VerifyCodeChallenge accepted a verifier shorter than 43 characters")
+	}
+}
@@ -0,0 +1,178 @@
+package oauth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/auth"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/database"
+)
+
+// PostgresStore keeps the clients and codes on their own tables and the
+// tokens on the refresh_tokens and access_tokens tables used by the
+// first-party login.
+type PostgresStore struct {
+	db *database.Queries
+}
+
+func NewPostgresStore(db *database.Queries) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (s *PostgresStore) GetClient(ctx context.Context, clientID string) (Client, error) {
+	client, err := s.db.GetOAuthClient(ctx, clientID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Client{}, ErrNotFound
+	}
+	if err != nil {
+		return Client{}, err
+	}
+	return Client{
+		ID:           client.ID,
+		Name:         client.Name,
+		SecretHash:   client.SecretHash.String,
+		RedirectURIs: client.RedirectUris,
+		Scopes:       toScopes(client.Scopes),
+	}, nil
+}
+
+func (s *PostgresStore) CreateCode(ctx context.Context, code Code) error {
+	return s.db.CreateOAuthCode(ctx, database.CreateOAuthCodeParams{
+		CodeHash:      code.CodeHash,
+		ClientID:      code.ClientID,
+		UserID:        code.UserID,
+		RedirectUri:   code.RedirectURI,
+		Scopes:        fromScopes(code.Scopes),
+		CodeChallenge: code.CodeChallenge,
+		ExpiresAt:     code.ExpiresAt,
+	})
+}
+
+func (s *PostgresStore) UseCode(ctx context.Context, codeHash string) (Code, error) {
+	code, err := s.db.UseOAuthCode(ctx, codeHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Code{}, ErrNotFound
+	}
+	if err != nil {
+		return Code{}, err
+	}
+	return Code{
+		CodeHash:      code.CodeHash,
+		ClientID:      code.ClientID,
+		UserID:        code.UserID,
+		RedirectURI:   code.RedirectUri,
+		Scopes:        toScopes(code.Scopes),
+		CodeChallenge: code.CodeChallenge,
+		ExpiresAt:     code.ExpiresAt,
+	}, nil
+}
+
+func (s *PostgresStore) CreateRefreshToken(ctx context.Context, refreshToken RefreshToken) error {
+	_, err := s.db.CreateOAuthRefreshToken(ctx, database.CreateOAuthRefreshTokenParams{
+		Token:     refreshToken.Token,
+		UserID:    refreshToken.UserID,
+		ExpiresAt: refreshToken.ExpiresAt,
+		ClientID:  sql.NullString{String: refreshToken.ClientID, Valid: true},
+		Scopes:    fromScopes(refreshToken.Scopes),
+	})
+	return err
+}
+
+func (s *PostgresStore) GetRefreshToken(ctx context.Context, token string) (RefreshToken, error) {
+	refreshToken, err := s.db.GetRefreshToken(ctx, token)
+	if errors.Is(err, sql.ErrNoRows) {
+		return RefreshToken{}, ErrNotFound
+	}
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	return RefreshToken{
+		Token:     refreshToken.Token,
+		ClientID:  refreshToken.ClientID.String,
+		UserID:    refreshToken.UserID,
+		Scopes:    toScopes(refreshToken.Scopes),
+		ExpiresAt: refreshToken.ExpiresAt,
+		Revoked:   refreshToken.RevokedAt.Valid,
+	}, nil
+}
+
+func (s *PostgresStore) RevokeRefreshToken(ctx context.Context, token string) error {
+	revoked, err := s.db.RevokeOAuthRefreshToken(ctx, token)
+	if err != nil {
+		return err
+	}
+	if revoked == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *PostgresStore) RevokeClientTokens(ctx context.Context, clientID string, userID uuid.UUID) ([]auth.AccessToken, error) {
+	err := s.db.RevokeOAuthRefreshTokensFromClient(ctx, database.RevokeOAuthRefreshTokensFromClientParams{
+		ClientID: sql.NullString{String: clientID, Valid: true},
+		UserID:   userID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	deniedTokens, err := s.db.DenyAccessTokensFromClient(ctx, database.DenyAccessTokensFromClientParams{
+		ClientID: sql.NullString{String: clientID, Valid: true},
+		UserID:   userID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	denied := make([]auth.AccessToken, len(deniedTokens))
+	for i, deniedToken := range deniedTokens {
+		denied[i] = auth.AccessToken{ID: deniedToken.Jti, ExpiresAt: deniedToken.ExpiresAt}
+	}
+	return denied, nil
+}
+
+func (s *PostgresStore) RecordAccessToken(ctx context.Context, userID uuid.UUID, accessToken auth.AccessToken, refreshToken string) error {
+	_, err := s.db.CreateAccessToken(ctx, database.CreateAccessTokenParams{
+		Jti:          accessToken.ID,
+		UserID:       userID,
+		RefreshToken: sql.NullString{String: refreshToken, Valid: true},
+		ExpiresAt:    accessToken.ExpiresAt,
+	})
+	return err
+}
+
+func (s *PostgresStore) DenyAccessTokensFromRefreshToken(ctx context.Context, refreshToken string) ([]auth.AccessToken, error) {
+	deniedTokens, err := s.db.DenyAccessTokensFromRefreshToken(ctx, sql.NullString{String: refreshToken, Valid: true})
+	if err != nil {
+		return nil, err
+	}
+	denied := make([]auth.AccessToken, len(deniedTokens))
+	for i, deniedToken := range deniedTokens {
+		denied[i] = auth.AccessToken{ID: deniedToken.Jti, ExpiresAt: deniedToken.ExpiresAt}
+	}
+	return denied, nil
+}
+
+func (s *PostgresStore) DenyAccessToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	return s.db.DenyAccessToken(ctx, database.DenyAccessTokenParams{
+		Jti:       jti,
+		ExpiresAt: expiresAt,
+	})
+}
+
+func toScopes(scopes []string) []auth.Scope {
+	parsed := make([]auth.Scope, len(scopes))
+	for i, scope := range scopes {
+		parsed[i] = auth.Scope(scope)
+	}
+	return parsed
+}
+
+func fromScopes(scopes []auth.Scope) []string {
+	strs := make([]string, len(scopes))
+	for i, scope := range scopes {
+		strs[i] = string(scope)
+	}
+	return strs
+}
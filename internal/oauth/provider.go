@@ -0,0 +1,460 @@
+package oauth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/auth"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/logging"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/utils"
+)
+
+// Provider has the authorization, token and revocation endpoints.
+type Provider struct {
+	Store    Store
+	Denylist *auth.Denylist
+	// secret the access JWTs are signed with
+	TokenSecret string
+	// Authenticate the user from the form posted by the consent screen
+	// (email, password and, with 2FA on, code), returning who they are
+	Authenticate func(r *http.Request) (uuid.UUID, error)
+
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	CodeTTL         time.Duration
+}
+
+// Access tokens last 1 hour, refresh tokens 60 days and codes 10 minutes.
+func NewProvider(store Store, denylist *auth.Denylist, tokenSecret string, authenticate func(r *http.Request) (uuid.UUID, error)) *Provider {
+	return &Provider{
+		Store:           store,
+		Denylist:        denylist,
+		TokenSecret:     tokenSecret,
+		Authenticate:    authenticate,
+		AccessTokenTTL:  time.Hour,
+		RefreshTokenTTL: time.Hour * 24 * 60,
+		CodeTTL:         time.Minute * 10,
+	}
+}
+
+// GET /oauth/authorize
+//
+// Shows the consent screen, where the user logs in and approves or denies
+// the scopes the client asked for.
+func (p *Provider) AuthorizeHandler(w http.ResponseWriter, r *http.Request) {
+	req, authErr := p.parseAuthorizationRequest(r.Context(), r.URL.Query())
+	if authErr != nil {
+		p.failAuthorization(w, r, req, authErr)
+		return
+	}
+	renderConsent(w, 200, req, "")
+}
+
+// POST /oauth/authorize
+//
+// Form posted by the consent screen, on approval the user is redirected back
+// to the client with a code.
+func (p *Provider) ConsentHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		utils.ResponseWithError(w, r, 400, "Invalid form", "failed to parse consent form", err)
+		return
+	}
+	req, authErr := p.parseAuthorizationRequest(r.Context(), r.PostForm)
+	if authErr != nil {
+		p.failAuthorization(w, r, req, authErr)
+		return
+	}
+	if r.PostForm.Get("action") != "approve" {
+		p.failAuthorization(w, r, req, &authorizeError{Code: "access_denied", Description: "The user denied the request.", redirect: true})
+		return
+	}
+
+	userID, err := p.Authenticate(r)
+	if err != nil {
+		logging.LogInfoContext(r.Context(), "consent login failed", "err", err)
+		renderConsent(w, 401, req, "Incorrect email, password or code.")
+		return
+	}
+
+	code, err := auth.MakeOneTimeToken()
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to make oauth code", err)
+		return
+	}
+	err = p.Store.CreateCode(r.Context(), Code{
+		CodeHash:      auth.HashToken(code),
+		ClientID:      req.Client.ID,
+		UserID:        userID,
+		RedirectURI:   req.RedirectURI,
+		Scopes:        req.Scopes,
+		CodeChallenge: req.CodeChallenge,
+		ExpiresAt:     time.Now().Add(p.CodeTTL),
+	})
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to create oauth code", err)
+		return
+	}
+	logging.LogInfoContext(r.Context(), "oauth client authorized by user", "user_id", userID)
+
+	redirectWith(w, r, req, url.Values{"code": {code}})
+}
+
+// authorizationRequest is a validated request to GET or POST /oauth/authorize
+type authorizationRequest struct {
+	Client        Client
+	RedirectURI   string
+	State         string
+	Scopes        []auth.Scope
+	CodeChallenge string
+}
+
+// authorizeError is an error of the authorization request, it's sent back
+// to the client on the redirect_uri unless the client or the redirect_uri
+// are the problem.
+type authorizeError struct {
+	Code        string
+	Description string
+	redirect    bool
+}
+
+func (p *Provider) parseAuthorizationRequest(ctx context.Context, values url.Values) (authorizationRequest, *authorizeError) {
+	req := authorizationRequest{State: values.Get("state")}
+
+	client, err := p.Store.GetClient(ctx, values.Get("client_id"))
+	if err != nil {
+		return req, &authorizeError{Code: "invalid_request", Description: "Unknown client_id."}
+	}
+	req.Client = client
+
+	req.RedirectURI = values.Get("redirect_uri")
+	if req.RedirectURI == "" && len(client.RedirectURIs) == 1 {
+		req.RedirectURI = client.RedirectURIs[0]
+	}
+	if !slices.Contains(client.RedirectURIs, req.RedirectURI) {
+		return req, &authorizeError{Code: "invalid_request", Description: "The redirect_uri isn't registered for this client."}
+	}
+
+	if values.Get("response_type") != "code" {
+		return req, &authorizeError{Code: "unsupported_response_type", Description: "Only the \"code\" response_type is supported.", redirect: true}
+	}
+	req.CodeChallenge = values.Get("code_challenge")
+	if req.CodeChallenge == "" || values.Get("code_challenge_method") != "S256" {
+		return req, &authorizeError{Code: "invalid_request", Description: "PKCE with the S256 code_challenge_method is required.", redirect: true}
+	}
+
+	req.Scopes = client.Scopes
+	if scope := values.Get("scope"); scope != "" {
+		scopes, err := auth.ParseScopes(strings.Fields(scope))
+		if err != nil || !allScopesAllowed(scopes, client.Scopes) {
+			return req, &authorizeError{Code: "invalid_scope", Description: "The client can't ask for these scopes.", redirect: true}
+		}
+		req.Scopes = scopes
+	}
+	return req, nil
+}
+
+// Send the error back to the client when the redirect_uri can be trusted,
+// otherwise show it to the user.
+func (p *Provider) failAuthorization(w http.ResponseWriter, r *http.Request, req authorizationRequest, authErr *authorizeError) {
+	logging.LogInfoContext(r.Context(), "oauth authorization failed", "code", authErr.Code, "description", authErr.Description)
+	if !authErr.redirect {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(400)
+		w.Write([]byte(authErr.Description))
+		return
+	}
+	redirectWith(w, r, req, url.Values{
+		"error":             {authErr.Code},
+		"error_description": {authErr.Description},
+	})
+}
+
+// Redirect to the redirect_uri of the request with the "params" and state.
+func redirectWith(w http.ResponseWriter, r *http.Request, req authorizationRequest, params url.Values) {
+	redirectURL, err := url.Parse(req.RedirectURI)
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to parse registered redirect_uri", err)
+		return
+	}
+	query := redirectURL.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	if req.State != "" {
+		query.Set("state", req.State)
+	}
+	redirectURL.RawQuery = query.Encode()
+	http.Redirect(w, r, redirectURL.String(), http.StatusFound)
+}
+
+// POST /oauth/token
+//
+// Exchanges a code (grant_type=authorization_code) or a refresh token
+// (grant_type=refresh_token) for new tokens. The refresh token given is
+// revoked, a new one comes with the response.
+func (p *Provider) TokenHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, 400, "invalid_request", "The body must be a form.")
+		return
+	}
+	client, ok := p.authenticateClient(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		p.exchangeCode(w, r, client)
+	case "refresh_token":
+		p.exchangeRefreshToken(w, r, client)
+	default:
+		tokenError(w, 400, "unsupported_grant_type", "Only authorization_code and refresh_token are supported.")
+	}
+}
+
+func (p *Provider) exchangeCode(w http.ResponseWriter, r *http.Request, client Client) {
+	// the code is used up even if the rest of the request is wrong
+	code, err := p.Store.UseCode(r.Context(), auth.HashToken(r.PostForm.Get("code")))
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			logging.LogErrorContext(r.Context(), "failed to use oauth code", "err", err)
+		}
+		tokenError(w, 400, "invalid_grant", "The code is invalid, expired or was already used.")
+		return
+	}
+	if code.ClientID != client.ID || code.RedirectURI != r.PostForm.Get("redirect_uri") {
+		tokenError(w, 400, "invalid_grant", "The code was issued to another client or redirect_uri.")
+		return
+	}
+	if !VerifyCodeChallenge(r.PostForm.Get("code_verifier"), code.CodeChallenge) {
+		tokenError(w, 400, "invalid_grant", "The code_verifier doesn't match the code_challenge.")
+		return
+	}
+	p.issueTokens(w, r.Context(), client, code.UserID, code.Scopes)
+}
+
+func (p *Provider) exchangeRefreshToken(w http.ResponseWriter, r *http.Request, client Client) {
+	token := r.PostForm.Get("refresh_token")
+	refreshToken, err := p.Store.GetRefreshToken(r.Context(), token)
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			logging.LogErrorContext(r.Context(), "failed to retrieve oauth refresh token", "err", err)
+		}
+		tokenError(w, 400, "invalid_grant", "The refresh_token is invalid.")
+		return
+	}
+	if refreshToken.ClientID != client.ID || time.Now().After(refreshToken.ExpiresAt) {
+		tokenError(w, 400, "invalid_grant", "The refresh_token is invalid, expired or revoked.")
+		return
+	}
+	if refreshToken.Revoked {
+		p.revokeReusedRefreshToken(w, r, client, refreshToken.UserID)
+		return
+	}
+
+	// the client may ask for less scopes than it was given
+	scopes := refreshToken.Scopes
+	if scope := r.PostForm.Get("scope"); scope != "" {
+		scopes = auth.SplitScopes(scope)
+		if !allScopesAllowed(scopes, refreshToken.Scopes) {
+			tokenError(w, 400, "invalid_scope", "The scope must be within the one originally granted.")
+			return
+		}
+	}
+
+	err = p.Store.RevokeRefreshToken(r.Context(), token)
+	if errors.Is(err, ErrNotFound) {
+		// a concurrent request rotated it first
+		p.revokeReusedRefreshToken(w, r, client, refreshToken.UserID)
+		return
+	}
+	if err != nil {
+		logging.LogErrorContext(r.Context(), "failed to revoke rotated oauth refresh token", "err", err)
+		tokenError(w, 500, "server_error", "Something went wrong.")
+		return
+	}
+	p.issueTokens(w, r.Context(), client, refreshToken.UserID, scopes)
+}
+
+// A rotated refresh token is only used again when it leaked, so whoever has
+// it or its successors loses every token the client has for the user and
+// the user has to authorize the client again.
+func (p *Provider) revokeReusedRefreshToken(w http.ResponseWriter, r *http.Request, client Client, userID uuid.UUID) {
+	logging.LogWarnContext(r.Context(), "revoked oauth refresh token reused", "client_id", client.ID, "user_id", userID)
+	deniedTokens, err := p.Store.RevokeClientTokens(r.Context(), client.ID, userID)
+	if err != nil {
+		logging.LogErrorContext(r.Context(), "failed to revoke oauth client tokens", "err", err)
+		tokenError(w, 500, "server_error", "Something went wrong.")
+		return
+	}
+	for _, deniedToken := range deniedTokens {
+		p.Denylist.Deny(deniedToken.ID, deniedToken.ExpiresAt)
+	}
+	tokenError(w, 400, "invalid_grant", "The refresh_token is invalid, expired or revoked.")
+}
+
+func (p *Provider) issueTokens(w http.ResponseWriter, ctx context.Context, client Client, userID uuid.UUID, scopes []auth.Scope) {
+	type returnVals struct {
+		AccessToken  string `json:"access_token"`
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int    `json:"expires_in"`
+		RefreshToken string `json:"refresh_token"`
+		Scope        string `json:"scope"`
+	}
+
+	refreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		logging.LogErrorContext(ctx, "failed to make oauth refresh token", "err", err)
+		tokenError(w, 500, "server_error", "Something went wrong.")
+		return
+	}
+	err = p.Store.CreateRefreshToken(ctx, RefreshToken{
+		Token:     refreshToken,
+		ClientID:  client.ID,
+		UserID:    userID,
+		Scopes:    scopes,
+		ExpiresAt: time.Now().Add(p.RefreshTokenTTL),
+	})
+	if err != nil {
+		logging.LogErrorContext(ctx, "failed to create oauth refresh token", "err", err)
+		tokenError(w, 500, "server_error", "Something went wrong.")
+		return
+	}
+	accessToken, err := auth.IssueScopedJWT(userID, p.TokenSecret, p.AccessTokenTTL, scopes)
+	if err != nil {
+		logging.LogErrorContext(ctx, "failed to issue oauth access token", "err", err)
+		tokenError(w, 500, "server_error", "Something went wrong.")
+		return
+	}
+	if err := p.Store.RecordAccessToken(ctx, userID, accessToken, refreshToken); err != nil {
+		logging.LogErrorContext(ctx, "failed to record oauth access token", "err", err)
+		tokenError(w, 500, "server_error", "Something went wrong.")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	utils.ResponseWithJson(w, 200, returnVals{
+		AccessToken:  accessToken.Token,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(p.AccessTokenTTL.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        auth.JoinScopes(scopes),
+	})
+}
+
+// POST /oauth/revoke
+//
+// Revokes a refresh token of the client, together with its access tokens, or
+// a single access token. As RFC 7009 asks it answers 200 even for unknown
+// tokens.
+func (p *Provider) RevokeHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, 400, "invalid_request", "The body must be a form.")
+		return
+	}
+	client, ok := p.authenticateClient(w, r)
+	if !ok {
+		return
+	}
+	token := r.PostForm.Get("token")
+	if token == "" {
+		tokenError(w, 400, "invalid_request", "The token is missing.")
+		return
+	}
+
+	refreshToken, err := p.Store.GetRefreshToken(r.Context(), token)
+	if err == nil && refreshToken.ClientID == client.ID {
+		// already revoked ones still get their access tokens denied
+		if err := p.Store.RevokeRefreshToken(r.Context(), token); err != nil && !errors.Is(err, ErrNotFound) {
+			logging.LogErrorContext(r.Context(), "failed to revoke oauth refresh token", "err", err)
+			tokenError(w, 500, "server_error", "Something went wrong.")
+			return
+		}
+		deniedTokens, err := p.Store.DenyAccessTokensFromRefreshToken(r.Context(), token)
+		if err != nil {
+			logging.LogErrorContext(r.Context(), "failed to deny oauth access tokens", "err", err)
+			tokenError(w, 500, "server_error", "Something went wrong.")
+			return
+		}
+		for _, deniedToken := range deniedTokens {
+			p.Denylist.Deny(deniedToken.ID, deniedToken.ExpiresAt)
+		}
+		w.WriteHeader(200)
+		return
+	}
+
+	// only the scoped tokens given to third-parties can be revoked here
+	claims, err := auth.ParseJWT(token, p.TokenSecret)
+	if err == nil && claims.Scopes != nil && claims.ID != "" {
+		if err := p.Store.DenyAccessToken(r.Context(), claims.ID, claims.ExpiresAt); err != nil {
+			logging.LogErrorContext(r.Context(), "failed to deny oauth access token", "err", err)
+			tokenError(w, 500, "server_error", "Something went wrong.")
+			return
+		}
+		p.Denylist.Deny(claims.ID, claims.ExpiresAt)
+	}
+	w.WriteHeader(200)
+}
+
+// Authenticate the client with HTTP Basic or the client_id and client_secret
+// form fields, public clients only send their client_id.
+func (p *Provider) authenticateClient(w http.ResponseWriter, r *http.Request) (Client, bool) {
+	clientID, secret, basic := r.BasicAuth()
+	if basic {
+		// RFC 6749 has them form encoded before going into the header
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientID = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+
+	client, err := p.Store.GetClient(r.Context(), clientID)
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			logging.LogErrorContext(r.Context(), "failed to retrieve oauth client", "err", err)
+		}
+		failClientAuthentication(w, basic)
+		return Client{}, false
+	}
+	if client.Public() {
+		if secret != "" {
+			failClientAuthentication(w, basic)
+			return Client{}, false
+		}
+		return client, true
+	}
+	if subtle.ConstantTimeCompare([]byte(auth.HashToken(secret)), []byte(client.SecretHash)) != 1 {
+		failClientAuthentication(w, basic)
+		return Client{}, false
+	}
+	return client, true
+}
+
+func failClientAuthentication(w http.ResponseWriter, basic bool) {
+	if basic {
+		w.Header().Set("WWW-Authenticate", `Basic realm="chirpy"`)
+	}
+	tokenError(w, 401, "invalid_client", "Client authentication failed.")
+}
+
+// Write an RFC 6749 error response of the token and revocation endpoints.
+func tokenError(w http.ResponseWriter, code int, oauthError, description string) {
+	type returnVals struct {
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	logging.LogInfo("oauth token request failed", "error", oauthError, "description", description)
+	w.Header().Set("Cache-Control", "no-store")
+	utils.ResponseWithJson(w, code, returnVals{
+		Error:            oauthError,
+		ErrorDescription: description,
+	})
+}
@@ -0,0 +1,48 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// AllEvents subscribes a handler to every event type.
+const AllEvents = "*"
+
+// Handler reacts to an event published on the [Bus].
+type Handler func(ctx context.Context, event Event) error
+
+// Bus is a [Sink] calling the handlers subscribed to each event type in the
+// same process, in the order they subscribed.
+type Bus struct {
+	mu       sync.RWMutex
+	handlers map[string][]Handler
+}
+
+func NewBus() *Bus {
+	return &Bus{handlers: map[string][]Handler{}}
+}
+
+// Call "handler" on every event of "eventType", or every event when it's
+// [AllEvents].
+func (b *Bus) Subscribe(eventType string, handler Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[eventType] = append(b.handlers[eventType], handler)
+}
+
+// Call every handler of the event type, the event is published again when
+// any of them fails so they all must be idempotent.
+func (b *Bus) Publish(ctx context.Context, event Event) error {
+	b.mu.RLock()
+	handlers := append(append([]Handler(nil), b.handlers[event.Type]...), b.handlers[AllEvents]...)
+	b.mu.RUnlock()
+
+	var errs []error
+	for _, handler := range handlers {
+		if err := handler(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
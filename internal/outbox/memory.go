@@ -0,0 +1,113 @@
+package outbox
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MemoryStore keeps the outbox in memory, it's meant for tests.
+type MemoryStore struct {
+	mu     sync.Mutex
+	events map[uuid.UUID]*memoryEvent
+	// used for the due time and the locks
+	Now func() time.Time
+}
+
+type memoryEvent struct {
+	Event
+	nextAttempt time.Time
+	lockedUntil time.Time
+	lastError   string
+	publishedAt time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{events: map[uuid.UUID]*memoryEvent{}}
+}
+
+func (s *MemoryStore) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
+
+// Store an event, events are written with [Write] in a transaction otherwise.
+func (s *MemoryStore) Add(event Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events[event.ID] = &memoryEvent{Event: event, nextAttempt: event.CreatedAt}
+}
+
+func (s *MemoryStore) ClaimDue(ctx context.Context, limit int, lockedUntil time.Time) ([]Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	var due []*memoryEvent
+	for _, event := range s.events {
+		if event.publishedAt.IsZero() && !event.nextAttempt.After(now) && !event.lockedUntil.After(now) {
+			due = append(due, event)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].CreatedAt.Before(due[j].CreatedAt) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	claimed := make([]Event, len(due))
+	for i, event := range due {
+		event.lockedUntil = lockedUntil
+		claimed[i] = event.Event
+	}
+	return claimed, nil
+}
+
+func (s *MemoryStore) MarkPublished(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if event, ok := s.events[id]; ok {
+		event.Attempts++
+		event.publishedAt = s.now()
+		event.lockedUntil = time.Time{}
+		event.lastError = ""
+	}
+	return nil
+}
+
+func (s *MemoryStore) RecordFailure(ctx context.Context, id uuid.UUID, reason string, retryAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if event, ok := s.events[id]; ok {
+		event.Attempts++
+		event.nextAttempt = retryAt
+		event.lockedUntil = time.Time{}
+		event.lastError = reason
+	}
+	return nil
+}
+
+func (s *MemoryStore) DeletePublished(ctx context.Context, before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	deleted := 0
+	for id, event := range s.events {
+		if !event.publishedAt.IsZero() && event.publishedAt.Before(before) {
+			delete(s.events, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// Is the event with "id" published, and why the last attempt failed.
+func (s *MemoryStore) Status(id uuid.UUID) (published bool, lastError string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if event, ok := s.events[id]; ok {
+		return !event.publishedAt.IsZero(), event.lastError
+	}
+	return false, ""
+}
@@ -0,0 +1,189 @@
+// Package outbox records the domain events of Chirpy, like a chirp being
+// posted, on the outbox table in the same transaction as the change they're
+// about, so an event is stored if and only if the change is. A [Relay] then
+// publishes the stored events to the [Sink]s.
+//
+// Events are published at least once: an event is only marked as published
+// after every sink took it, so after a failure (or a crash between publishing
+// and marking it) the sinks get it again. Sinks dedupe by [Event.ID].
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/database"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/logging"
+)
+
+// Event is something that happened to a user.
+type Event struct {
+	// the same every time the event is published
+	ID        uuid.UUID
+	Type      string
+	CreatedAt time.Time
+	// user the event is about
+	UserID  uuid.UUID
+	Payload json.RawMessage
+	// times publishing it was tried before
+	Attempts int
+}
+
+// Make an event of "eventType" about "userID" with "data" as the JSON
+// payload.
+func NewEvent(eventType string, userID uuid.UUID, data any) (Event, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, fmt.Errorf("failed to marshal %s event: %w", eventType, err)
+	}
+	return Event{
+		ID:        uuid.New(),
+		Type:      eventType,
+		CreatedAt: time.Now(),
+		UserID:    userID,
+		Payload:   payload,
+	}, nil
+}
+
+// Store an event on the outbox, "db" must be the queries of the transaction
+// making the change, see [database.Queries.WithTx].
+func Write(ctx context.Context, db *database.Queries, eventType string, userID uuid.UUID, data any) error {
+	event, err := NewEvent(eventType, userID, data)
+	if err != nil {
+		return err
+	}
+	return db.CreateOutboxEvent(ctx, database.CreateOutboxEventParams{
+		ID:        event.ID,
+		EventType: event.Type,
+		UserID:    event.UserID,
+		Payload:   event.Payload,
+	})
+}
+
+// Sink is where the events are published to, like the in-process [Bus], the
+// webhook endpoints or a message broker. Publishing must be idempotent by
+// [Event.ID], the same event can be published more than once.
+type Sink interface {
+	Publish(ctx context.Context, event Event) error
+}
+
+// SinkFunc lets a function be a [Sink].
+type SinkFunc func(ctx context.Context, event Event) error
+
+func (f SinkFunc) Publish(ctx context.Context, event Event) error {
+	return f(ctx, event)
+}
+
+// Store is the outbox the events are relayed from.
+type Store interface {
+	// Get up to "limit" unpublished events that are due, oldest first, they
+	// aren't returned again until "lockedUntil".
+	ClaimDue(ctx context.Context, limit int, lockedUntil time.Time) ([]Event, error)
+	MarkPublished(ctx context.Context, id uuid.UUID) error
+	// Save why publishing failed, the event is due again at "retryAt".
+	RecordFailure(ctx context.Context, id uuid.UUID, reason string, retryAt time.Time) error
+	// Delete the events published before "before", returning how many.
+	DeletePublished(ctx context.Context, before time.Time) (int, error)
+}
+
+// Backoff is how long to wait after the "attempt"th failed attempt: 1 second
+// doubling every attempt, up to 5 minutes. Events are never given up on.
+func Backoff(attempt int) time.Duration {
+	wait := time.Second
+	for i := 1; i < attempt && wait < time.Minute*5; i++ {
+		wait *= 2
+	}
+	return min(wait, time.Minute*5)
+}
+
+// Relay publishes the stored events to every sink.
+type Relay struct {
+	Store Store
+	Sinks []Sink
+	// events published on each run
+	BatchSize int
+	// how long an event is claimed for, publishing it must take less
+	LockFor time.Duration
+	// how long published events are kept
+	Retention time.Duration
+	// wait after the nth failed attempt, [Backoff] by default
+	Backoff func(attempt int) time.Duration
+	// current time, [time.Now] when nil
+	Now func() time.Time
+}
+
+func NewRelay(store Store, sinks ...Sink) *Relay {
+	return &Relay{
+		Store:     store,
+		Sinks:     sinks,
+		BatchSize: 100,
+		LockFor:   time.Minute,
+		Retention: time.Hour * 24 * 7,
+		Backoff:   Backoff,
+	}
+}
+
+func (r *Relay) now() time.Time {
+	if r.Now != nil {
+		return r.Now()
+	}
+	return time.Now()
+}
+
+// Publish the events that are due, returning how many were published to
+// every sink.
+func (r *Relay) PublishDue(ctx context.Context) (int, error) {
+	events, err := r.Store.ClaimDue(ctx, r.BatchSize, r.now().Add(r.LockFor))
+	if err != nil {
+		return 0, err
+	}
+	published := 0
+	for _, event := range events {
+		var errs []error
+		for _, sink := range r.Sinks {
+			if err := sink.Publish(ctx, event); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if err := errors.Join(errs...); err != nil {
+			retryAt := r.now().Add(r.Backoff(event.Attempts + 1))
+			if err := r.Store.RecordFailure(ctx, event.ID, err.Error(), retryAt); err != nil {
+				return published, err
+			}
+			continue
+		}
+		if err := r.Store.MarkPublished(ctx, event.ID); err != nil {
+			return published, err
+		}
+		published++
+	}
+	return published, nil
+}
+
+// Publish the due events every "interval" until "ctx" is done, and delete
+// the ones published before the retention.
+func (r *Relay) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	lastPrune := time.Time{}
+	for {
+		if _, err := r.PublishDue(ctx); err != nil {
+			logging.LogError("failed to publish outbox events", "err", err)
+		}
+		if time.Since(lastPrune) > time.Hour {
+			if _, err := r.Store.DeletePublished(ctx, r.now().Add(-r.Retention)); err != nil {
+				logging.LogError("failed to delete published outbox events", "err", err)
+			}
+			lastPrune = time.Now()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
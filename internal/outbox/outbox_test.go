@@ -0,0 +1,227 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// clock is a fake time shared by the relay and the store.
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+// recorder is a sink keeping what was published, failing while "fail" is set.
+type recorder struct {
+	mu     sync.Mutex
+	events []Event
+	fail   error
+}
+
+func (rc *recorder) Publish(ctx context.Context, event Event) error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.events = append(rc.events, event)
+	return rc.fail
+}
+
+func (rc *recorder) published() []Event {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return append([]Event(nil), rc.events...)
+}
+
+func newTestRelay(t *testing.T, c *clock, sinks ...Sink) (*Relay, *MemoryStore) {
+	t.Helper()
+	store := NewMemoryStore()
+	store.Now = c.Now
+	relay := NewRelay(store, sinks...)
+	relay.Now = c.Now
+	return relay, store
+}
+
+func addEvent(t *testing.T, store *MemoryStore, c *clock, eventType string) Event {
+	t.Helper()
+	event, err := NewEvent(eventType, uuid.New(), map[string]string{"hello": "world"})
+	if err != nil {
+		t.Fatalf("failed to make event: %s", err)
+	}
+	event.CreatedAt = c.now
+	store.Add(event)
+	return event
+}
+
+func TestPublishDue(t *testing.T) {
+	ctx := context.Background()
+	c := &clock{now: time.Now()}
+	first, second := &recorder{}, &recorder{}
+	relay, store := newTestRelay(t, c, first, second)
+
+	created := addEvent(t, store, c, "chirp.created")
+	c.now = c.now.Add(time.Second)
+	deleted := addEvent(t, store, c, "chirp.deleted")
+
+	published, err := relay.PublishDue(ctx)
+	if err != nil {
+		t.Fatalf("failed to publish: %s", err)
+	}
+	if published != 2 {
+		t.Fatalf("expected 2 events published, got %d", published)
+	}
+	for _, sink := range []*recorder{first, second} {
+		events := sink.published()
+		if len(events) != 2 || events[0].ID != created.ID || events[1].ID != deleted.ID {
+			t.Errorf("expected every sink to get both events oldest first, got %+v", events)
+		}
+	}
+	if string(first.published()[0].Payload) != `{"hello":"world"}` {
+		t.Errorf("unexpected payload %s", first.published()[0].Payload)
+	}
+
+	// published events aren't published again
+	if published, _ := relay.PublishDue(ctx); published != 0 || len(first.published()) != 2 {
+		t.Errorf("expected nothing to be published again, got %d", published)
+	}
+}
+
+func TestPublishDueRetriesFailures(t *testing.T) {
+	ctx := context.Background()
+	c := &clock{now: time.Now()}
+	working := &recorder{}
+	failing := &recorder{fail: errors.New("broker down")}
+	relay, store := newTestRelay(t, c, working, failing)
+	event := addEvent(t, store, c, "user.upgraded")
+
+	if published, _ := relay.PublishDue(ctx); published != 0 {
+		t.Fatalf("expected the event not to be published while a sink fails, got %d", published)
+	}
+	if published, lastError := store.Status(event.ID); published || lastError != "broker down" {
+		t.Errorf("expected the failure to be recorded, got published %v and error %q", published, lastError)
+	}
+
+	// not due before the backoff
+	relay.PublishDue(ctx)
+	if got := len(failing.published()); got != 1 {
+		t.Fatalf("expected no retry before the backoff, got %d attempts", got)
+	}
+
+	failing.fail = nil
+	c.now = c.now.Add(Backoff(1))
+	if published, _ := relay.PublishDue(ctx); published != 1 {
+		t.Fatalf("expected the retry to publish the event, got %d", published)
+	}
+	// at least once: the working sink got the event again
+	if got := len(working.published()); got != 2 {
+		t.Errorf("expected the working sink to get the event twice, got %d", got)
+	}
+	if events := failing.published(); events[0].ID != events[1].ID {
+		t.Errorf("expected the retry to keep the event id")
+	}
+	if published, _ := store.Status(event.ID); !published {
+		t.Errorf("expected the event to be published")
+	}
+}
+
+func TestPublishDueLocksClaimedEvents(t *testing.T) {
+	ctx := context.Background()
+	c := &clock{now: time.Now()}
+	relay, store := newTestRelay(t, c)
+	addEvent(t, store, c, "chirp.created")
+
+	claimed, _ := store.ClaimDue(ctx, 10, c.now.Add(relay.LockFor))
+	if len(claimed) != 1 {
+		t.Fatalf("expected to claim the event, got %d", len(claimed))
+	}
+	// another relay doesn't get it while it's claimed
+	if claimed, _ := store.ClaimDue(ctx, 10, c.now.Add(relay.LockFor)); len(claimed) != 0 {
+		t.Errorf("expected a claimed event not to be claimed again, got %d", len(claimed))
+	}
+	// a relay that crashed before publishing it loses the claim
+	c.now = c.now.Add(relay.LockFor)
+	if claimed, _ := store.ClaimDue(ctx, 10, c.now.Add(relay.LockFor)); len(claimed) != 1 {
+		t.Errorf("expected the event to be claimed again after the lock, got %d", len(claimed))
+	}
+}
+
+func TestDeletePublished(t *testing.T) {
+	ctx := context.Background()
+	c := &clock{now: time.Now()}
+	relay, store := newTestRelay(t, c, &recorder{})
+	published := addEvent(t, store, c, "chirp.created")
+	relay.PublishDue(ctx)
+	pending := addEvent(t, store, c, "chirp.deleted")
+
+	c.now = c.now.Add(relay.Retention + time.Second)
+	deleted, err := store.DeletePublished(ctx, c.now.Add(-relay.Retention))
+	if err != nil || deleted != 1 {
+		t.Fatalf("expected 1 event deleted, got %d and %v", deleted, err)
+	}
+	if isPublished, _ := store.Status(published.ID); isPublished {
+		t.Errorf("expected the published event to be deleted")
+	}
+	if claimed, _ := store.ClaimDue(ctx, 10, c.now); len(claimed) != 1 || claimed[0].ID != pending.ID {
+		t.Errorf("expected the unpublished event to be kept, got %+v", claimed)
+	}
+}
+
+func TestBus(t *testing.T) {
+	ctx := context.Background()
+	bus := NewBus()
+	var chirps, all []string
+	bus.Subscribe("chirp.created", func(ctx context.Context, event Event) error {
+		chirps = append(chirps, event.Type)
+		return nil
+	})
+	bus.Subscribe(AllEvents, func(ctx context.Context, event Event) error {
+		all = append(all, event.Type)
+		return nil
+	})
+
+	bus.Publish(ctx, Event{Type: "chirp.created"})
+	bus.Publish(ctx, Event{Type: "user.upgraded"})
+
+	if len(chirps) != 1 {
+		t.Errorf("expected the chirp handler to get 1 event, got %v", chirps)
+	}
+	if len(all) != 2 {
+		t.Errorf("expected the handler of every event to get 2 events, got %v", all)
+	}
+
+	failure := errors.New("handler failed")
+	bus.Subscribe("user.upgraded", func(ctx context.Context, event Event) error {
+		return failure
+	})
+	if err := bus.Publish(ctx, Event{Type: "user.upgraded"}); !errors.Is(err, failure) {
+		t.Errorf("expected the handler error, got %v", err)
+	}
+	if len(all) != 3 {
+		t.Errorf("expected the other handlers to run when one fails, got %v", all)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, time.Second},
+		{2, time.Second * 2},
+		{5, time.Second * 16},
+		{9, time.Minute*4 + time.Second*16},
+		{10, time.Minute * 5},
+		{100, time.Minute * 5},
+	}
+	for _, tt := range tests {
+		if got := Backoff(tt.attempt); got != tt.want {
+			t.Errorf("Backoff(%d): expected %s, got %s", tt.attempt, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/database"
+)
+
+// PostgresStore relays the events from the outbox table.
+type PostgresStore struct {
+	db *database.Queries
+}
+
+func NewPostgresStore(db *database.Queries) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (s *PostgresStore) ClaimDue(ctx context.Context, limit int, lockedUntil time.Time) ([]Event, error) {
+	rows, err := s.db.ClaimOutboxEvents(ctx, database.ClaimOutboxEventsParams{
+		LockedUntil: lockedUntil,
+		BatchSize:   int32(limit),
+	})
+	if err != nil {
+		return nil, err
+	}
+	events := make([]Event, len(rows))
+	for i, row := range rows {
+		events[i] = Event{
+			ID:        row.ID,
+			Type:      row.EventType,
+			CreatedAt: row.CreatedAt,
+			UserID:    row.UserID,
+			Payload:   row.Payload,
+			Attempts:  int(row.Attempts),
+		}
+	}
+	// the UPDATE doesn't keep the order of the claim
+	sort.Slice(events, func(i, j int) bool { return events[i].CreatedAt.Before(events[j].CreatedAt) })
+	return events, nil
+}
+
+func (s *PostgresStore) MarkPublished(ctx context.Context, id uuid.UUID) error {
+	return s.db.MarkOutboxEventPublished(ctx, id)
+}
+
+func (s *PostgresStore) RecordFailure(ctx context.Context, id uuid.UUID, reason string, retryAt time.Time) error {
+	return s.db.RecordOutboxEventFailure(ctx, database.RecordOutboxEventFailureParams{
+		ID:            id,
+		NextAttemptAt: retryAt,
+		LastError:     sql.NullString{String: reason, Valid: true},
+	})
+}
+
+func (s *PostgresStore) DeletePublished(ctx context.Context, before time.Time) (int, error) {
+	deleted, err := s.db.DeletePublishedOutboxEvents(ctx, before)
+	return int(deleted), err
+}
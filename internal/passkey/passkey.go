@@ -0,0 +1,163 @@
+// Package passkey lets users register passkeys (WebAuthn discoverable
+// credentials) and log in with them instead of a password.
+package passkey
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+)
+
+// Timeout is how long a user has to answer a registration or a login, the
+// session kept between begin and finish isn't valid after it.
+const Timeout = time.Minute * 5
+
+// ErrClonedAuthenticator is returned when the sign counter of a login isn't
+// bigger than the stored one, the private key may have been copied.
+var ErrClonedAuthenticator = errors.New("passkey sign counter went backwards")
+
+// User is who the passkeys are registered to, its ID is the WebAuthn user
+// handle returned by the authenticator on login.
+type User struct {
+	ID          uuid.UUID
+	Name        string
+	DisplayName string
+	Credentials []webauthn.Credential
+}
+
+func (u User) WebAuthnID() []byte {
+	return u.ID[:]
+}
+
+func (u User) WebAuthnName() string {
+	return u.Name
+}
+
+func (u User) WebAuthnDisplayName() string {
+	if u.DisplayName == "" {
+		return u.Name
+	}
+	return u.DisplayName
+}
+
+func (u User) WebAuthnCredentials() []webauthn.Credential {
+	return u.Credentials
+}
+
+// RelyingParty runs the registration and login ceremonies for a single site.
+type RelyingParty struct {
+	webauthn *webauthn.WebAuthn
+}
+
+// Make a relying party for the site at "baseURL", its host is the relying
+// party ID and it's the only origin allowed.
+func New(name, baseURL string) (*RelyingParty, error) {
+	origin, err := url.Parse(baseURL)
+	if err != nil || origin.Hostname() == "" {
+		return nil, fmt.Errorf("invalid base url %q", baseURL)
+	}
+	timeout := webauthn.TimeoutConfig{Enforce: true, Timeout: Timeout, TimeoutUVD: Timeout}
+	w, err := webauthn.New(&webauthn.Config{
+		RPID:          origin.Hostname(),
+		RPDisplayName: name,
+		RPOrigins:     []string{origin.Scheme + "://" + origin.Host},
+		// a passkey replaces the password and the second factor, so the
+		// authenticator has to check it's the user (PIN, biometrics...)
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			ResidentKey:      protocol.ResidentKeyRequirementRequired,
+			UserVerification: protocol.VerificationRequired,
+		},
+		Timeouts: webauthn.TimeoutsConfig{Login: timeout, Registration: timeout},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &RelyingParty{webauthn: w}, nil
+}
+
+// Start registering a new passkey for "user", returning the options for
+// navigator.credentials.create() and the session to keep until
+// [RelyingParty.FinishRegistration]. The passkeys the user already has are
+// excluded so the same authenticator isn't registered twice.
+func (rp *RelyingParty) BeginRegistration(user User) (*protocol.CredentialCreation, []byte, error) {
+	exclusions := webauthn.Credentials(user.Credentials).CredentialDescriptors()
+	creation, session, err := rp.webauthn.BeginRegistration(user, webauthn.WithExclusions(exclusions))
+	if err != nil {
+		return nil, nil, err
+	}
+	sessionData, err := json.Marshal(session)
+	if err != nil {
+		return nil, nil, err
+	}
+	return creation, sessionData, nil
+}
+
+// Verify the attestation "response" sent by the browser, returning the
+// credential to store for "user".
+func (rp *RelyingParty) FinishRegistration(user User, sessionData []byte, response []byte) (webauthn.Credential, error) {
+	var session webauthn.SessionData
+	if err := json.Unmarshal(sessionData, &session); err != nil {
+		return webauthn.Credential{}, fmt.Errorf("invalid session: %w", err)
+	}
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(response)
+	if err != nil {
+		return webauthn.Credential{}, err
+	}
+	credential, err := rp.webauthn.CreateCredential(user, session, parsed)
+	if err != nil {
+		return webauthn.Credential{}, err
+	}
+	return *credential, nil
+}
+
+// Start a passwordless login, the user isn't known until the authenticator
+// answers with one of its passkeys for this site.
+func (rp *RelyingParty) BeginLogin() (*protocol.CredentialAssertion, []byte, error) {
+	assertion, session, err := rp.webauthn.BeginDiscoverableLogin()
+	if err != nil {
+		return nil, nil, err
+	}
+	sessionData, err := json.Marshal(session)
+	if err != nil {
+		return nil, nil, err
+	}
+	return assertion, sessionData, nil
+}
+
+// Verify the assertion "response" sent by the browser. "findUser" gets the
+// user with the handle sent by the authenticator along with its passkeys.
+// The returned credential has the new sign counter to store.
+func (rp *RelyingParty) FinishLogin(sessionData []byte, response []byte, findUser func(userID uuid.UUID) (User, error)) (User, webauthn.Credential, error) {
+	var session webauthn.SessionData
+	if err := json.Unmarshal(sessionData, &session); err != nil {
+		return User{}, webauthn.Credential{}, fmt.Errorf("invalid session: %w", err)
+	}
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(response)
+	if err != nil {
+		return User{}, webauthn.Credential{}, err
+	}
+
+	var user User
+	handler := func(_, userHandle []byte) (webauthn.User, error) {
+		userID, err := uuid.FromBytes(userHandle)
+		if err != nil {
+			return nil, err
+		}
+		user, err = findUser(userID)
+		return user, err
+	}
+	_, credential, err := rp.webauthn.ValidatePasskeyLogin(handler, session, parsed)
+	if err != nil {
+		return User{}, webauthn.Credential{}, err
+	}
+	if credential.Authenticator.CloneWarning {
+		return User{}, webauthn.Credential{}, ErrClonedAuthenticator
+	}
+	return user, *credential, nil
+}
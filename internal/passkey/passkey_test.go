@@ -0,0 +1,358 @@
+package passkey
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+)
+
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+)
+
+// softAuthenticator is a passkey authenticator in memory: it makes a P-256
+// key on registration, answers with "none" attestation and signs assertions
+// with a counter.
+type softAuthenticator struct {
+	key        *ecdsa.PrivateKey
+	id         []byte
+	userHandle []byte
+	counter    uint32
+	origin     string
+	flags      byte
+}
+
+func newSoftAuthenticator(t *testing.T, origin string) *softAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %s", err)
+	}
+	id := make([]byte, 32)
+	rand.Read(id)
+	return &softAuthenticator{
+		key:    key,
+		id:     id,
+		origin: origin,
+		flags:  flagUserPresent | flagUserVerified,
+	}
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func (a *softAuthenticator) clientData(t *testing.T, ceremony string, challenge protocol.URLEncodedBase64) []byte {
+	t.Helper()
+	clientData, err := json.Marshal(map[string]string{
+		"type":      ceremony,
+		"challenge": challenge.String(),
+		"origin":    a.origin,
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal client data: %s", err)
+	}
+	return clientData
+}
+
+func (a *softAuthenticator) authData(rpID string, flags byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	authData := append(rpIDHash[:], flags)
+	return binary.BigEndian.AppendUint32(authData, a.counter)
+}
+
+// Answer navigator.credentials.create() with the JSON the browser would send.
+func (a *softAuthenticator) create(t *testing.T, creation *protocol.CredentialCreation) []byte {
+	t.Helper()
+	userHandle, ok := creation.Response.User.ID.(protocol.URLEncodedBase64)
+	if !ok {
+		t.Fatalf("unexpected user id type %T", creation.Response.User.ID)
+	}
+	a.userHandle = userHandle
+
+	point, err := a.key.PublicKey.ECDH()
+	if err != nil {
+		t.Fatalf("failed to get public key: %s", err)
+	}
+	uncompressed := point.Bytes()
+	publicKey, err := webauthncbor.Marshal(map[int]any{
+		1:  2,  // kty: EC2
+		3:  -7, // alg: ES256
+		-1: 1,  // crv: P-256
+		-2: uncompressed[1:33],
+		-3: uncompressed[33:],
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal public key: %s", err)
+	}
+
+	authData := a.authData(creation.Response.RelyingParty.ID, a.flags|flagAttested)
+	authData = append(authData, make([]byte, 16)...) // AAGUID
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(a.id)))
+	authData = append(authData, a.id...)
+	authData = append(authData, publicKey...)
+
+	attestationObject, err := webauthncbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": authData,
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal attestation object: %s", err)
+	}
+
+	response, err := json.Marshal(map[string]any{
+		"id":    b64(a.id),
+		"rawId": b64(a.id),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    b64(a.clientData(t, "webauthn.create", creation.Response.Challenge)),
+			"attestationObject": b64(attestationObject),
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal response: %s", err)
+	}
+	return response
+}
+
+// Answer navigator.credentials.get() with the JSON the browser would send.
+func (a *softAuthenticator) get(t *testing.T, assertion *protocol.CredentialAssertion) []byte {
+	t.Helper()
+	a.counter++
+	clientData := a.clientData(t, "webauthn.get", assertion.Response.Challenge)
+	authData := a.authData(assertion.Response.RelyingPartyID, a.flags)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(authData, clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatalf("failed to sign assertion: %s", err)
+	}
+
+	response, err := json.Marshal(map[string]any{
+		"id":    b64(a.id),
+		"rawId": b64(a.id),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    b64(clientData),
+			"authenticatorData": b64(authData),
+			"signature":         b64(signature),
+			"userHandle":        b64(a.userHandle),
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal response: %s", err)
+	}
+	return response
+}
+
+func newTestRelyingParty(t *testing.T) *RelyingParty {
+	t.Helper()
+	rp, err := New("Chirpy", "https://chirpy.example.com")
+	if err != nil {
+		t.Fatalf("failed to make relying party: %s", err)
+	}
+	return rp
+}
+
+// Register a passkey of "authenticator" for a new user.
+func register(t *testing.T, rp *RelyingParty, authenticator *softAuthenticator) User {
+	t.Helper()
+	user := User{ID: uuid.New(), Name: "user@example.com"}
+	creation, session, err := rp.BeginRegistration(user)
+	if err != nil {
+		t.Fatalf("failed to begin registration: %s", err)
+	}
+	credential, err := rp.FinishRegistration(user, session, authenticator.create(t, creation))
+	if err != nil {
+		t.Fatalf("failed to finish registration: %s", err)
+	}
+	user.Credentials = append(user.Credentials, credential)
+	return user
+}
+
+func login(t *testing.T, rp *RelyingParty, authenticator *softAuthenticator, user User) (User, webauthn.Credential, error) {
+	t.Helper()
+	assertion, session, err := rp.BeginLogin()
+	if err != nil {
+		t.Fatalf("failed to begin login: %s", err)
+	}
+	return rp.FinishLogin(session, authenticator.get(t, assertion), func(userID uuid.UUID) (User, error) {
+		if userID != user.ID {
+			return User{}, errors.New("unknown user")
+		}
+		return user, nil
+	})
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	rp := newTestRelyingParty(t)
+	authenticator := newSoftAuthenticator(t, "https://chirpy.example.com")
+	user := register(t, rp, authenticator)
+
+	credential := user.Credentials[0]
+	if string(credential.ID) != string(authenticator.id) {
+		t.Errorf("expected credential id %x, got %x", authenticator.id, credential.ID)
+	}
+	if credential.AttestationType != "none" {
+		t.Errorf("expected attestation type none, got %q", credential.AttestationType)
+	}
+	if !credential.Flags.UserVerified {
+		t.Error("expected the credential to be user verified")
+	}
+
+	loggedIn, credential, err := login(t, rp, authenticator, user)
+	if err != nil {
+		t.Fatalf("failed to login: %s", err)
+	}
+	if loggedIn.ID != user.ID {
+		t.Errorf("expected user %s, got %s", user.ID, loggedIn.ID)
+	}
+	if credential.Authenticator.SignCount != 1 {
+		t.Errorf("expected sign count 1, got %d", credential.Authenticator.SignCount)
+	}
+}
+
+func TestRegisterExcludesExistingPasskeys(t *testing.T) {
+	rp := newTestRelyingParty(t)
+	authenticator := newSoftAuthenticator(t, "https://chirpy.example.com")
+	user := register(t, rp, authenticator)
+
+	creation, _, err := rp.BeginRegistration(user)
+	if err != nil {
+		t.Fatalf("failed to begin registration: %s", err)
+	}
+	if len(creation.Response.CredentialExcludeList) != 1 {
+		t.Fatalf("expected 1 excluded credential, got %d", len(creation.Response.CredentialExcludeList))
+	}
+	if string(creation.Response.CredentialExcludeList[0].CredentialID) != string(authenticator.id) {
+		t.Error("expected the registered passkey to be excluded")
+	}
+}
+
+func TestRegisterRequiresUserVerification(t *testing.T) {
+	rp := newTestRelyingParty(t)
+	authenticator := newSoftAuthenticator(t, "https://chirpy.example.com")
+	authenticator.flags = flagUserPresent
+
+	user := User{ID: uuid.New(), Name: "user@example.com"}
+	creation, session, err := rp.BeginRegistration(user)
+	if err != nil {
+		t.Fatalf("failed to begin registration: %s", err)
+	}
+	if _, err := rp.FinishRegistration(user, session, authenticator.create(t, creation)); err == nil {
+		t.Error("expected registration without user verification to fail")
+	}
+}
+
+func TestRegisterWithAnotherUserSession(t *testing.T) {
+	rp := newTestRelyingParty(t)
+	authenticator := newSoftAuthenticator(t, "https://chirpy.example.com")
+
+	user := User{ID: uuid.New(), Name: "user@example.com"}
+	creation, session, err := rp.BeginRegistration(user)
+	if err != nil {
+		t.Fatalf("failed to begin registration: %s", err)
+	}
+	other := User{ID: uuid.New(), Name: "other@example.com"}
+	if _, err := rp.FinishRegistration(other, session, authenticator.create(t, creation)); err == nil {
+		t.Error("expected registration with the session of another user to fail")
+	}
+}
+
+func TestLoginWrongOrigin(t *testing.T) {
+	rp := newTestRelyingParty(t)
+	authenticator := newSoftAuthenticator(t, "https://chirpy.example.com")
+	user := register(t, rp, authenticator)
+
+	authenticator.origin = "https://evil.example.com"
+	if _, _, err := login(t, rp, authenticator, user); err == nil {
+		t.Error("expected login from another origin to fail")
+	}
+}
+
+func TestLoginBadSignature(t *testing.T) {
+	rp := newTestRelyingParty(t)
+	authenticator := newSoftAuthenticator(t, "https://chirpy.example.com")
+	user := register(t, rp, authenticator)
+
+	// same credential id, different private key
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %s", err)
+	}
+	authenticator.key = key
+	if _, _, err := login(t, rp, authenticator, user); err == nil {
+		t.Error("expected login signed by another key to fail")
+	}
+}
+
+func TestLoginUnknownPasskey(t *testing.T) {
+	rp := newTestRelyingParty(t)
+	authenticator := newSoftAuthenticator(t, "https://chirpy.example.com")
+	user := register(t, rp, authenticator)
+
+	// the passkey was deleted
+	user.Credentials = nil
+	if _, _, err := login(t, rp, authenticator, user); err == nil {
+		t.Error("expected login with a deleted passkey to fail")
+	}
+}
+
+func TestLoginWithAnotherChallenge(t *testing.T) {
+	rp := newTestRelyingParty(t)
+	authenticator := newSoftAuthenticator(t, "https://chirpy.example.com")
+	user := register(t, rp, authenticator)
+
+	assertion, _, err := rp.BeginLogin()
+	if err != nil {
+		t.Fatalf("failed to begin login: %s", err)
+	}
+	_, session, err := rp.BeginLogin()
+	if err != nil {
+		t.Fatalf("failed to begin login: %s", err)
+	}
+	_, _, err = rp.FinishLogin(session, authenticator.get(t, assertion), func(uuid.UUID) (User, error) {
+		return user, nil
+	})
+	if err == nil {
+		t.Error("expected login answering another challenge to fail")
+	}
+}
+
+func TestLoginClonedAuthenticator(t *testing.T) {
+	rp := newTestRelyingParty(t)
+	authenticator := newSoftAuthenticator(t, "https://chirpy.example.com")
+	user := register(t, rp, authenticator)
+
+	_, credential, err := login(t, rp, authenticator, user)
+	if err != nil {
+		t.Fatalf("failed to login: %s", err)
+	}
+	user.Credentials[0] = credential
+
+	// a copy of the key that didn't see the last login
+	clone := *authenticator
+	clone.counter = 0
+	_, _, err = login(t, rp, &clone, user)
+	if !errors.Is(err, ErrClonedAuthenticator) {
+		t.Errorf("expected ErrClonedAuthenticator, got %v", err)
+	}
+
+	if _, _, err := login(t, rp, authenticator, user); err != nil {
+		t.Errorf("expected the original authenticator to still login, got %s", err)
+	}
+}
@@ -0,0 +1,92 @@
+package profile
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	UsernameMinLength    = 3
+	UsernameMaxLength    = 15
+	DisplayNameMaxLength = 50
+	BioMaxLength         = 160
+	AvatarMaxLength      = 2048
+)
+
+var usernameRegex = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// Usernames nobody can take, either because they are routes under
+// /api/users/ or because they could be used to impersonate the staff.
+// They are compared case-insensitively.
+var ReservedUsernames = map[string]bool{
+	"admin":         true,
+	"administrator": true,
+	"api":           true,
+	"app":           true,
+	"chirpy":        true,
+	"export":        true,
+	"help":          true,
+	"login":         true,
+	"logout":        true,
+	"me":            true,
+	"moderator":     true,
+	"null":          true,
+	"root":          true,
+	"settings":      true,
+	"staff":         true,
+	"support":       true,
+	"system":        true,
+	"totp":          true,
+	"undefined":     true,
+	"verify":        true,
+}
+
+// Check if "username" can be taken: 3 to 15 letters, digits or underscores,
+// not reserved and not starting with "chirpy" so no one poses as us.
+// It doesn't check if it's already taken, the database does that.
+func ValidateUsername(username string) error {
+	if len(username) < UsernameMinLength || len(username) > UsernameMaxLength {
+		return fmt.Errorf("Username must have between %d and %d characters", UsernameMinLength, UsernameMaxLength)
+	}
+	if !usernameRegex.MatchString(username) {
+		return fmt.Errorf("Username can only have letters, numbers and underscores")
+	}
+	lower := strings.ToLower(username)
+	if ReservedUsernames[lower] || strings.HasPrefix(lower, "chirpy") {
+		return fmt.Errorf("Username \"%s\" is reserved", username)
+	}
+	return nil
+}
+
+// Check the free text fields of a profile.
+func ValidateDisplayName(displayName string) error {
+	if utf8.RuneCountInString(displayName) > DisplayNameMaxLength {
+		return fmt.Errorf("Display name must have at most %d characters", DisplayNameMaxLength)
+	}
+	return nil
+}
+
+func ValidateBio(bio string) error {
+	if utf8.RuneCountInString(bio) > BioMaxLength {
+		return fmt.Errorf("Bio must have at most %d characters", BioMaxLength)
+	}
+	return nil
+}
+
+// The avatar is an https URL to an image, or empty to remove it.
+func ValidateAvatar(avatar string) error {
+	if avatar == "" {
+		return nil
+	}
+	if len(avatar) > AvatarMaxLength {
+		return fmt.Errorf("Avatar URL must have at most %d characters", AvatarMaxLength)
+	}
+	u, err := url.Parse(avatar)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("Avatar must be an https URL")
+	}
+	return nil
+}
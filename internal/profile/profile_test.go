@@ -0,0 +1,53 @@
+package profile
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateUsername(t *testing.T) {
+	valid := []string{"bob", "Bob_42", "a_b", strings.Repeat("x", UsernameMaxLength)}
+	for _, username := range valid {
+		if err := ValidateUsername(username); err != nil {
+			t.Errorf("ValidateUsername rejected '%s' with: %s", username, err)
+		}
+	}
+	invalid := []string{
+		"",
+		"ab",
+		strings.Repeat("x", UsernameMaxLength+1),
+		"bob smith",
+		"bob-smith",
+		"bób",
+		"Admin",
+		"EXPORT",
+		"chirpy_team",
+	}
+	for _, username := range invalid {
+		if err := ValidateUsername(username); err == nil {
+			t.Errorf("ValidateUsername accepted '%s'", username)
+		}
+	}
+}
+
+func TestValidateAvatar(t *testing.T) {
+	for _, avatar := range []string{"", "https://example.com/me.png"} {
+		if err := ValidateAvatar(avatar); err != nil {
+			t.Errorf("ValidateAvatar rejected '%s' with: %s", avatar, err)
+		}
+	}
+	for _, avatar := range []string{"http://example.com/me.png", "javascript:alert(1)", "https://"} {
+		if err := ValidateAvatar(avatar); err == nil {
+			t.Errorf("ValidateAvatar accepted '%s'", avatar)
+		}
+	}
+}
+
+func TestValidateBioCountsCharacters(t *testing.T) {
+	if err := ValidateBio(strings.Repeat("é", BioMaxLength)); err != nil {
+		t.Errorf("ValidateBio rejected %d multi-byte characters: %s", BioMaxLength, err)
+	}
+	if err := ValidateBio(strings.Repeat("é", BioMaxLength+1)); err == nil {
+		t.Errorf("ValidateBio accepted %d characters", BioMaxLength+1)
+	}
+}
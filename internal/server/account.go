@@ -0,0 +1,202 @@
+package server
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/api"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/auth"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/database"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/logging"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/utils"
+)
+
+// DELETE /api/users
+//
+// The account is only soft-deleted, it's hidden and logged out right away
+// but only purged after the grace period, logging in before that cancels the
+// deletion.
+func (cfg *ApiConfig) DeleteUsersHandler(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Password string `json:"password"`
+	}
+
+	idVal := r.Context().Value("id")
+	id, ok := idVal.(uuid.UUID)
+	if !ok {
+		utils.ResponseWithError(w, r, 401, "You're not logged in.", "failed to get id from middleware", r.Context().Value("id"))
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to decode params", err)
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), id)
+	if err != nil {
+		utils.ResponseWithError(w, r, 404, "This user was deleted or don't exist", "failed to retrieve user", err)
+		return
+	}
+
+	throttleKeys := []string{accountThrottleKey(user.Email), ipThrottleKey(r)}
+	if !cfg.checkThrottle(w, r, throttleKeys) {
+		return
+	}
+	err = auth.CheckPasswordHash(params.Password, user.HashedPassword)
+	if err != nil {
+		cfg.failThrottled(w, r, throttleKeys, "Incorrect password", "failed to check password", err)
+		return
+	}
+
+	purgeAfter := time.Now().Add(cfg.deletionGracePeriod)
+	err = cfg.db.SoftDeleteUser(r.Context(), database.SoftDeleteUserParams{
+		ID:         user.ID,
+		PurgeAfter: sql.NullTime{Time: purgeAfter, Valid: true},
+	})
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to soft delete user", err)
+		return
+	}
+	err = cfg.db.RevokeAllRefreshTokensFromUser(r.Context(), user.ID)
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to revoke user refresh tokens", err)
+		return
+	}
+	err = cfg.denyUserAccessTokens(r.Context(), user.ID, "")
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to deny user access tokens", err)
+		return
+	}
+	logging.LogInfoContext(r.Context(), "user scheduled for deletion", "user_id", user.ID)
+
+	utils.ResponseWithJson(w, 202, api.NewAccountDeletion(purgeAfter))
+}
+
+// GET /api/users/export
+//
+// Returns a ZIP with a JSON file for every kind of data we have from the
+// user, or a single JSON with all of them with "?format=json".
+func (cfg *ApiConfig) ExportUsersHandler(w http.ResponseWriter, r *http.Request) {
+	idVal := r.Context().Value("id")
+	id, ok := idVal.(uuid.UUID)
+	if !ok {
+		utils.ResponseWithError(w, r, 401, "You're not logged in.", "failed to get id from middleware", r.Context().Value("id"))
+		return
+	}
+
+	export, err := cfg.buildUserExport(r.Context(), id)
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to build user export", err)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "json" {
+		w.Header().Set("Content-Disposition", `attachment; filename="chirpy-export.json"`)
+		utils.ResponseWithJson(w, 200, export)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="chirpy-export.zip"`)
+	w.WriteHeader(200)
+	archive := zip.NewWriter(w)
+	files := []struct {
+		name string
+		data any
+	}{
+		{"profile.json", export.Profile},
+		{"chirps.json", export.Chirps},
+		{"sessions.json", export.Sessions},
+		{"billing.json", export.Billing},
+	}
+	for _, file := range files {
+		fileWriter, err := archive.Create(file.name)
+		if err != nil {
+			logging.LogErrorContext(r.Context(), "failed to add file to export zip", "err", err)
+			return
+		}
+		encoder := json.NewEncoder(fileWriter)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.data); err != nil {
+			logging.LogErrorContext(r.Context(), "failed to write file to export zip", "err", err)
+			return
+		}
+	}
+	if err := archive.Close(); err != nil {
+		logging.LogErrorContext(r.Context(), "failed to close export zip", "err", err)
+	}
+}
+
+// Assemble the export of the user from everything we have stored about them.
+func (cfg *ApiConfig) buildUserExport(ctx context.Context, userID uuid.UUID) (api.Export, error) {
+	user, err := cfg.db.GetUserByID(ctx, userID)
+	if err != nil {
+		return api.Export{}, fmt.Errorf("failed to retrieve user: %w", err)
+	}
+
+	chirps, err := cfg.db.GetAllChirpsFromUser(ctx, database.GetAllChirpsFromUserParams{
+		UserID:    userID,
+		SortOrder: "asc",
+	})
+	if err != nil {
+		return api.Export{}, fmt.Errorf("failed to retrieve chirps: %w", err)
+	}
+
+	refreshTokens, err := cfg.db.GetRefreshTokensFromUser(ctx, userID)
+	if err != nil {
+		return api.Export{}, fmt.Errorf("failed to retrieve refresh tokens: %w", err)
+	}
+
+	subscriptions, err := cfg.db.GetSubscriptionsFromUser(ctx, userID)
+	if err != nil {
+		return api.Export{}, fmt.Errorf("failed to retrieve subscriptions: %w", err)
+	}
+
+	return api.NewExport(user, chirps, refreshTokens, subscriptions, time.Now()), nil
+}
+
+// Hard delete the users whose deletion grace period is over, the expired
+// access tokens, the expired oauth codes and the stale login attempts, every
+// "interval" until "ctx" is done.
+func (cfg *ApiConfig) purgeLoop(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		cfg.purge(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (cfg *ApiConfig) purge(ctx context.Context) {
+	purges := []struct {
+		name string
+		fn   func(context.Context) (int64, error)
+	}{
+		{"deleted users", cfg.db.PurgeDeletedUsers},
+		{"expired access tokens", cfg.db.DeleteExpiredAccessTokens},
+		{"expired denied access tokens", cfg.db.DeleteExpiredDeniedAccessTokens},
+		{"expired oauth codes", cfg.db.DeleteExpiredOAuthCodes},
+		{"stale login attempts", cfg.throttler.Prune},
+	}
+	for _, p := range purges {
+		purged, err := p.fn(ctx)
+		if err != nil {
+			logging.LogError("failed to purge "+p.name, "err", err)
+		} else if purged > 0 {
+			logging.LogInfo("purged "+p.name, "count", purged)
+		}
+	}
+}
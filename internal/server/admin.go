@@ -1,26 +1,37 @@
 package server
 
 import (
-	"fmt"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
 
+	"github.com/google/uuid"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/api"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/auth"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/database"
 	"github.com/luigiMinardi/bootdotdev-chirpy/internal/logging"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/utils"
 )
 
-// endpoint to visualize the utils.ApiConfig.fileServerHits metric in html.
+// endpoint Prometheus scrapes the metrics from, with the METRICS_TOKEN as a
+// bearer token. Without a token it's only open on dev environment.
 func (cfg *ApiConfig) endpointMetrics(w http.ResponseWriter, r *http.Request) {
-	w.Header().Add("Content-Type", "text/html; charset=utf-8")
-	w.WriteHeader(200)
-
-	_, err := w.Write(fmt.Appendf([]byte{}, `<html>
-  <body>
-    <h1>Welcome, Chirpy Admin</h1>
-    <p>Chirpy has been visited %d times!</p>
-  </body>
-</html>`, cfg.fileServerHits.Load()))
-	if err != nil {
-		logging.LogError("/metrics failed to write with error", err)
+	if cfg.metricsToken == "" {
+		if cfg.platform != "dev" {
+			w.WriteHeader(404)
+			return
+		}
+	} else {
+		token, err := auth.GetBearerToken(r.Header)
+		if err != nil || subtle.ConstantTimeCompare([]byte(token), []byte(cfg.metricsToken)) != 1 {
+			utils.ResponseWithError(w, r, 401, "You are not authenticated", "invalid metrics token", err)
+			return
+		}
 	}
+	cfg.metrics.Handler().ServeHTTP(w, r)
 }
 
 // endpoint to reset the utils.ApiConfig related things on dev environment.
@@ -32,20 +43,197 @@ func (cfg *ApiConfig) endpointReset(w http.ResponseWriter, r *http.Request) {
 	}
 	err := cfg.db.DeleteAllUsers(r.Context())
 	if err != nil {
-		logging.LogError("failed to delete users", err)
+		logging.LogErrorContext(r.Context(), "failed to delete users", "err", err)
 		w.WriteHeader(500)
 		w.Write([]byte("failed to reset db with err: " + err.Error()))
 		return
 	}
 	err = cfg.db.DeleteAllChirps(r.Context())
 	if err != nil {
-		logging.LogError("failed to delete chirps", err)
+		logging.LogErrorContext(r.Context(), "failed to delete chirps", "err", err)
 		w.WriteHeader(500)
 		w.Write([]byte("failed to reset db with err: " + err.Error()))
 		return
 	}
-	logging.LogInfo("users reset at env", cfg.platform)
+	logging.LogInfoContext(r.Context(), "users reset at env", "platform", cfg.platform)
 	w.WriteHeader(200)
-	cfg.fileServerHits.Store(0)
-	w.Write([]byte("fileServerHits reset to 0 and database reset to initial state."))
+	w.Write([]byte("Database reset to initial state."))
+}
+
+// endpoint for moderators to suspend an user, it logs the user out of
+// every session and puts all their access tokens on the denylist.
+func (cfg *ApiConfig) endpointSuspendUser(w http.ResponseWriter, r *http.Request) {
+	target, ok := cfg.moderatedUser(w, r)
+	if !ok {
+		return
+	}
+	user, err := cfg.db.SuspendUserByID(r.Context(), target.ID)
+	if err != nil {
+		utils.ResponseWithError(w, r, 404, "This user was deleted or don't exist", "failed to suspend user", err)
+		return
+	}
+	err = cfg.db.RevokeAllRefreshTokensFromUser(r.Context(), user.ID)
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to revoke user refresh tokens", err)
+		return
+	}
+	err = cfg.denyUserAccessTokens(r.Context(), user.ID, "")
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to deny user access tokens", err)
+		return
+	}
+	logging.LogInfoContext(r.Context(), "user suspended", "user_id", user.ID)
+	w.WriteHeader(204)
+}
+
+// Get the user of the "userID" path parameter for a moderation action, only
+// users with a role below the one of the moderator can be acted on. It answers
+// the request and returns false otherwise.
+func (cfg *ApiConfig) moderatedUser(w http.ResponseWriter, r *http.Request) (database.User, bool) {
+	actorRole, ok := r.Context().Value("role").(auth.Role)
+	if !ok {
+		utils.ResponseWithError(w, r, 401, "You're not logged in.", "failed to get role from middleware", r.Context().Value("role"))
+		return database.User{}, false
+	}
+	userId, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		utils.ResponseWithError(w, r, 400, "Invaid \"userID\" path parameter", "failed to get uuid", err)
+		return database.User{}, false
+	}
+	user, err := cfg.db.GetUserByID(r.Context(), userId)
+	if err != nil {
+		utils.ResponseWithError(w, r, 404, "This user was deleted or don't exist", "failed to retrieve user", err)
+		return database.User{}, false
+	}
+	if !actorRole.Outranks(auth.Role(user.Role)) {
+		utils.ResponseWithError(w, r, 403, "You don't have permission to do this.", "moderation of an user with an equal or higher role", user.ID)
+		return database.User{}, false
+	}
+	return user, true
+}
+
+// endpoint for moderators to unlock an user locked out by too many failed
+// logins.
+func (cfg *ApiConfig) endpointUnlockUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := cfg.moderatedUser(w, r)
+	if !ok {
+		return
+	}
+	for _, key := range []string{accountThrottleKey(user.Email), mfaThrottleKey(user.ID)} {
+		err := cfg.throttler.Reset(r.Context(), key)
+		if err != nil {
+			utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to reset throttle", err)
+			return
+		}
+	}
+	logging.LogInfoContext(r.Context(), "user unlocked", "user_id", user.ID)
+	w.WriteHeader(204)
+}
+
+// endpoint for admins to change the role of an user.
+func (cfg *ApiConfig) endpointSetUserRole(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Role string `json:"role"`
+	}
+
+	adminId, ok := r.Context().Value("id").(uuid.UUID)
+	if !ok {
+		utils.ResponseWithError(w, r, 401, "You're not logged in.", "failed to get id from middleware", r.Context().Value("id"))
+		return
+	}
+	userId, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		utils.ResponseWithError(w, r, 400, "Invaid \"userID\" path parameter", "failed to get uuid", err)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to decode params", err)
+		return
+	}
+	role, err := auth.ParseRole(params.Role)
+	if err != nil {
+		utils.ResponseWithError(w, r, 400, "Invalid \"role\", it must be user, moderator or admin", "invalid role", err)
+		return
+	}
+	// so there is always at least one admin left
+	if userId == adminId && role != auth.RoleAdmin {
+		utils.ResponseWithError(w, r, 400, "You can't remove your own admin role", "admin tried to demote themselves", adminId)
+		return
+	}
+
+	user, err := cfg.db.SetUserRole(r.Context(), database.SetUserRoleParams{
+		ID:   userId,
+		Role: string(role),
+	})
+	if err != nil {
+		utils.ResponseWithError(w, r, 404, "This user was deleted or don't exist", "failed to set user role", err)
+		return
+	}
+	logging.LogInfoContext(r.Context(), "user role changed", "user_id", user.ID, "role", user.Role)
+	utils.ResponseWithJson(w, 200, api.NewUser(user))
+}
+
+// endpoint for admins to list the received webhook events, newest first.
+// "?status=" filters by outcome (received, processed, ignored or failed) and
+// "?limit=" caps how many are returned, 50 by default.
+func (cfg *ApiConfig) endpointWebhookEvents(w http.ResponseWriter, r *http.Request) {
+	params := database.GetWebhookEventsParams{Limit: 50}
+	if status := r.URL.Query().Get("status"); status != "" {
+		switch status {
+		case webhookStatusReceived, webhookStatusProcessed, webhookStatusIgnored, webhookStatusFailed:
+		default:
+			utils.ResponseWithError(w, r, 400, "Invalid \"status\", it must be received, processed, ignored or failed", "invalid webhook status", status)
+			return
+		}
+		params.Status = sql.NullString{String: status, Valid: true}
+	}
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		number, err := strconv.Atoi(limit)
+		if err != nil || number < 1 || number > 500 {
+			utils.ResponseWithError(w, r, 400, "The \"limit\" must be between 1 and 500", "invalid webhook events limit", limit)
+			return
+		}
+		params.Limit = int32(number)
+	}
+
+	events, err := cfg.db.GetWebhookEvents(r.Context(), params)
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to retrieve webhook events", err)
+		return
+	}
+	utils.ResponseWithJson(w, 200, api.NewWebhookEvents(events))
+}
+
+// endpoint for admins to process a failed webhook event again, e.g. after
+// fixing what made it fail. Answers with the event and its new outcome.
+func (cfg *ApiConfig) endpointReplayWebhookEvent(w http.ResponseWriter, r *http.Request) {
+	eventId, err := uuid.Parse(r.PathValue("eventID"))
+	if err != nil {
+		utils.ResponseWithError(w, r, 400, "Invaid \"eventID\" path parameter", "failed to get uuid", err)
+		return
+	}
+	event, err := cfg.db.GetWebhookEvent(r.Context(), eventId)
+	if err != nil {
+		utils.ResponseWithError(w, r, 404, "Webhook event not found", "failed to retrieve webhook event", err)
+		return
+	}
+	if event.Status != webhookStatusFailed {
+		utils.ResponseWithError(w, r, 409, "Only failed webhook events can be replayed", "replay of webhook event not failed", event.Status)
+		return
+	}
+
+	event, err = cfg.processWebhookEvent(r.Context(), event)
+	if errors.Is(err, errWebhookEventClaimed) {
+		utils.ResponseWithError(w, r, 409, "This webhook event was processed meanwhile", "replay of webhook event processed concurrently", event.ID)
+		return
+	}
+	if err != nil {
+		logging.LogWarnContext(r.Context(), "webhook event replay failed", "err", err)
+	} else {
+		logging.LogInfoContext(r.Context(), "webhook event replayed", "event_id", event.ID)
+	}
+	utils.ResponseWithJson(w, 200, api.NewWebhookEvent(event))
 }
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/auth"
+)
+
+func TestSuspendUserRank(t *testing.T) {
+	tests := []struct {
+		actor, target auth.Role
+		status        int
+	}{
+		{auth.RoleModerator, auth.RoleUser, 204},
+		{auth.RoleModerator, auth.RoleModerator, 403},
+		{auth.RoleModerator, auth.RoleAdmin, 403},
+		{auth.RoleAdmin, auth.RoleModerator, 204},
+		{auth.RoleAdmin, auth.RoleAdmin, 403},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.actor)+" suspends "+string(tt.target), func(t *testing.T) {
+			cfg, mock, _ := newTestConfig(t)
+			target := newTestUser()
+			target.Role = string(tt.target)
+			mock.ExpectQuery("GetUserByID").WillReturnRows(userRows(target))
+			if tt.status == 204 {
+				mock.ExpectQuery("SuspendUserByID").WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at", "email", "is_chirpy_red"}).
+					AddRow(target.ID.String(), target.CreatedAt, target.UpdatedAt, target.Email, false))
+				mock.ExpectExec("RevokeAllRefreshTokensFromUser").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery("DenyAccessTokensFromUser").WillReturnRows(sqlmock.NewRows([]string{"jti", "expires_at"}))
+			}
+
+			r := httptest.NewRequest("POST", "/admin/users/"+target.ID.String()+"/suspend", nil)
+			r.SetPathValue("userID", target.ID.String())
+			r = r.WithContext(context.WithValue(r.Context(), "role", tt.actor))
+			w := httptest.NewRecorder()
+			cfg.endpointSuspendUser(w, r)
+
+			if w.Code != tt.status {
+				t.Errorf("expected %d, got %d %s", tt.status, w.Code, w.Body)
+			}
+			checkQueries(t, mock)
+		})
+	}
+}
+
+func TestUnlockUserRank(t *testing.T) {
+	cfg, mock, _ := newTestConfig(t)
+	target := newTestUser()
+	target.Role = string(auth.RoleAdmin)
+	mock.ExpectQuery("GetUserByID").WillReturnRows(userRows(target))
+
+	r := httptest.NewRequest("POST", "/admin/users/"+target.ID.String()+"/unlock", nil)
+	r.SetPathValue("userID", target.ID.String())
+	r = r.WithContext(context.WithValue(r.Context(), "role", auth.RoleModerator))
+	w := httptest.NewRecorder()
+	cfg.endpointUnlockUser(w, r)
+
+	if w.Code != 403 {
+		t.Errorf("expected a moderator not to unlock an admin, got %d", w.Code)
+	}
+	checkQueries(t, mock)
+}
+
+func TestReplayWebhookEventConcurrent(t *testing.T) {
+	cfg, mock, _ := newTestConfig(t)
+	id := uuid.New()
+	mock.ExpectQuery("GetWebhookEvent").WillReturnRows(webhookEventRows(id, webhookStatusFailed))
+	mock.ExpectBegin()
+	mock.ExpectQuery("ClaimWebhookEvent").WillReturnRows(sqlmock.NewRows(nil))
+	mock.ExpectRollback()
+
+	r := httptest.NewRequest("POST", "/admin/webhooks/events/"+id.String()+"/replay", nil)
+	r.SetPathValue("eventID", id.String())
+	w := httptest.NewRecorder()
+	cfg.endpointReplayWebhookEvent(w, r)
+
+	if w.Code != 409 {
+		t.Errorf("expected 409, got %d %s", w.Code, w.Body)
+	}
+	checkQueries(t, mock)
+}
@@ -1,10 +1,14 @@
 package server
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
 	"net/http"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/api"
 	"github.com/luigiMinardi/bootdotdev-chirpy/internal/auth"
 	"github.com/luigiMinardi/bootdotdev-chirpy/internal/database"
 	"github.com/luigiMinardi/bootdotdev-chirpy/internal/logging"
@@ -17,44 +21,88 @@ func (cfg *ApiConfig) LoginHandler(w http.ResponseWriter, r *http.Request) {
 		Email    string `json:"email"`
 		Password string `json:"password"`
 	}
-	type returnVals struct {
-		Id           string `json:"id"`
-		CreatedAt    string `json:"created_at"`
-		UpdatedAt    string `json:"updated_at"`
-		Email        string `json:"email"`
-		IsChirpyRed  bool   `json:"is_chirpy_red"`
-		Token        string `json:"token"`
-		RefreshToken string `json:"refresh_token"`
-	}
 
 	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
 	if err := decoder.Decode(&params); err != nil {
-		utils.ResponseWithError(w, 500, "Something went wrong", "failed to decode params", err)
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to decode params", err)
+		return
+	}
+
+	throttleKeys := []string{accountThrottleKey(params.Email), ipThrottleKey(r)}
+	if !cfg.checkThrottle(w, r, throttleKeys) {
 		return
 	}
 
 	user, err := cfg.db.GetUserByEmail(r.Context(), params.Email)
 	if err != nil {
-		utils.ResponseWithError(w, 401, "Incorrect email or password", "failed to retrieve user", err)
+		cfg.failThrottled(w, r, throttleKeys, "Incorrect email or password", "failed to retrieve user", err)
 		return
 	}
 
 	err = auth.CheckPasswordHash(params.Password, user.HashedPassword)
 	if err != nil {
-		utils.ResponseWithError(w, 401, "Incorrect email or password", "failed to retrieve user", err)
+		cfg.failThrottled(w, r, throttleKeys, "Incorrect email or password", "failed to retrieve user", err)
 		return
 	}
+	if err := cfg.throttler.Reset(r.Context(), throttleKeys[0]); err != nil {
+		logging.LogErrorContext(r.Context(), "failed to reset login throttle", "err", err)
+	}
 
-	userJWT, err := auth.MakeJWT(user.ID, cfg.jwtSecret, time.Hour)
+	if auth.PasswordNeedsRehash(user.HashedPassword) {
+		cfg.rehashPassword(r.Context(), user.ID, params.Password)
+	}
+
+	if user.SuspendedAt.Valid {
+		utils.ResponseWithError(w, r, 403, "This account is suspended", "suspended user tried to login", user.ID)
+		return
+	}
+
+	// with 2FA on the password is not enough, the client has to send the
+	// mfa_token with a code to POST /api/login/mfa to get the tokens
+	if user.TotpEnabledAt.Valid {
+		cfg.respondWithMFAChallenge(w, r, user)
+		return
+	}
+
+	cfg.respondWithSession(w, r, user)
+}
+
+// Answer a login of a user with 2FA on with the mfa_token to send with a code
+// to POST /api/login/mfa.
+func (cfg *ApiConfig) respondWithMFAChallenge(w http.ResponseWriter, r *http.Request, user database.User) {
+	type returnVals struct {
+		MFARequired bool   `json:"mfa_required"`
+		MFAToken    string `json:"mfa_token"`
+	}
+
+	mfaToken, err := auth.MakeMFAChallengeJWT(user.ID, cfg.jwtSecret, time.Minute*5)
 	if err != nil {
-		utils.ResponseWithError(w, 500, "Something wrong happened please contact the admin.", "failed to generate user jwt", err)
+		utils.ResponseWithError(w, r, 500, "Something wrong happened please contact the admin.", "failed to generate mfa challenge jwt", err)
 		return
 	}
+	utils.ResponseWithJson(w, 200, returnVals{
+		MFARequired: true,
+		MFAToken:    mfaToken,
+	})
+}
+
+// Start a new session (refresh token and access JWT) for the user and write
+// the login response, every way of logging in ends here.
+func (cfg *ApiConfig) respondWithSession(w http.ResponseWriter, r *http.Request, user database.User) {
+	// logging in during the deletion grace period cancels the deletion
+	if user.DeletedAt.Valid {
+		err := cfg.db.RestoreUser(r.Context(), user.ID)
+		if err != nil {
+			utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to restore user", err)
+			return
+		}
+		logging.LogInfoContext(r.Context(), "user deletion canceled by login", "user_id", user.ID)
+	}
 
 	refreshTokenToken, err := auth.MakeRefreshToken()
 	if err != nil {
-		logging.LogError("refresh token failed to be generated", err)
+		logging.LogErrorContext(r.Context(), "refresh token failed to be generated", "err", err)
 	}
 
 	refreshTokenParams := database.CreateRefreshTokenParams{
@@ -64,21 +112,18 @@ func (cfg *ApiConfig) LoginHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	refreshToken, err := cfg.db.CreateRefreshToken(r.Context(), refreshTokenParams)
 	if err != nil {
-		utils.ResponseWithError(w, 500, "Something went wrong", "failed to create refreshToken", err)
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to create refreshToken", err)
 		return
 	}
 
-	respBody := returnVals{
-		Id:           user.ID.String(),
-		CreatedAt:    user.CreatedAt.String(),
-		UpdatedAt:    user.UpdatedAt.String(),
-		Email:        user.Email,
-		IsChirpyRed:  user.IsChirpyRed,
-		Token:        userJWT,
-		RefreshToken: refreshToken.Token,
+	userJWT, err := cfg.issueAccessToken(r.Context(), user.ID, refreshToken.Token)
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something wrong happened please contact the admin.", "failed to generate user jwt", err)
+		return
 	}
 
-	utils.ResponseWithJson(w, 200, respBody)
+	cfg.metrics.Logins.Inc()
+	utils.ResponseWithJson(w, 200, api.NewSession(user, userJWT, refreshToken.Token))
 }
 
 // POST /api/refresh
@@ -89,21 +134,26 @@ func (cfg *ApiConfig) RefreshHandler(w http.ResponseWriter, r *http.Request) {
 
 	refreshTokenToken, err := auth.GetBearerToken(r.Header)
 	if err != nil {
-		utils.ResponseWithError(w, 401, "You're not logged in.", "failed to get refresh token", err)
+		utils.ResponseWithError(w, r, 401, "You're not logged in.", "failed to get refresh token", err)
 		return
 	}
 	refreshToken, err := cfg.db.GetRefreshToken(r.Context(), refreshTokenToken)
 	if err != nil {
-		utils.ResponseWithError(w, 401, "You're not logged in.", "POST /api/refresh failed to find refresh token", err)
+		utils.ResponseWithError(w, r, 401, "You're not logged in.", "POST /api/refresh failed to find refresh token", err)
 		return
 	}
 	if time.Now().Compare(refreshToken.ExpiresAt) != -1 || refreshToken.RevokedAt.Valid == true {
-		utils.ResponseWithError(w, 401, "You're not logged in.", "refresh token expired or got revoked at", err)
+		utils.ResponseWithError(w, r, 401, "You're not logged in.", "refresh token expired or got revoked at", err)
+		return
+	}
+	// the ones given to third-party apps are refreshed on POST /oauth/token
+	if refreshToken.ClientID.Valid {
+		utils.ResponseWithError(w, r, 401, "You're not logged in.", "oauth refresh token used on POST /api/refresh", refreshToken.ClientID.String)
 		return
 	}
-	token, err := auth.MakeJWT(refreshToken.UserID, cfg.jwtSecret, time.Hour)
+	token, err := cfg.issueAccessToken(r.Context(), refreshToken.UserID, refreshToken.Token)
 	if err != nil {
-		utils.ResponseWithError(w, 500, "Something wrong happened please contact the admin.", "failed to generate user jwt", err)
+		utils.ResponseWithError(w, r, 500, "Something wrong happened please contact the admin.", "failed to generate user jwt", err)
 		return
 	}
 	respBody := returnVals{
@@ -116,13 +166,76 @@ func (cfg *ApiConfig) RefreshHandler(w http.ResponseWriter, r *http.Request) {
 func (cfg *ApiConfig) RevokeHandler(w http.ResponseWriter, r *http.Request) {
 	refreshTokenToken, err := auth.GetBearerToken(r.Header)
 	if err != nil {
-		utils.ResponseWithError(w, 401, "You're not logged in.", "failed to get refresh token", err)
+		utils.ResponseWithError(w, r, 401, "You're not logged in.", "failed to get refresh token", err)
 		return
 	}
 	err = cfg.db.RevokeRefreshToken(r.Context(), refreshTokenToken)
 	if err != nil {
-		utils.ResponseWithError(w, 401, "You're not logged in.", "POST /api/revoke failed to find refresh token", err)
+		utils.ResponseWithError(w, r, 401, "You're not logged in.", "POST /api/revoke failed to find refresh token", err)
 		return
 	}
+	deniedTokens, err := cfg.db.DenyAccessTokensFromRefreshToken(r.Context(), sql.NullString{String: refreshTokenToken, Valid: true})
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to deny access tokens from refresh token", err)
+		return
+	}
+	for _, deniedToken := range deniedTokens {
+		cfg.denylist.Deny(deniedToken.Jti, deniedToken.ExpiresAt)
+	}
 	w.WriteHeader(204)
 }
+
+// Replace the user password hash by one made with the current hasher
+// parameters, it only logs on failure since the user already proved who they
+// are and the old hash still works.
+func (cfg *ApiConfig) rehashPassword(ctx context.Context, userID uuid.UUID, password string) {
+	passwd, err := auth.HashPassword(password)
+	if err != nil {
+		logging.LogErrorContext(ctx, "failed to rehash password", "err", err)
+		return
+	}
+	err = cfg.db.UpdateUserPassword(ctx, database.UpdateUserPasswordParams{
+		ID:             userID,
+		HashedPassword: passwd,
+	})
+	if err != nil {
+		logging.LogErrorContext(ctx, "failed to persist rehashed password", "err", err)
+		return
+	}
+	logging.LogInfoContext(ctx, "password rehashed for user", "user_id", userID)
+}
+
+// Issue a new access JWT for the user and keep track of its jti so it can be
+// revoked together with the "refreshToken" it came from.
+func (cfg *ApiConfig) issueAccessToken(ctx context.Context, userID uuid.UUID, refreshToken string) (string, error) {
+	accessToken, err := auth.IssueJWT(userID, cfg.jwtSecret, time.Hour)
+	if err != nil {
+		return "", err
+	}
+	_, err = cfg.db.CreateAccessToken(ctx, database.CreateAccessTokenParams{
+		Jti:          accessToken.ID,
+		UserID:       userID,
+		RefreshToken: sql.NullString{String: refreshToken, Valid: refreshToken != ""},
+		ExpiresAt:    accessToken.ExpiresAt,
+	})
+	if err != nil {
+		return "", err
+	}
+	return accessToken.Token, nil
+}
+
+// Put every live access token from the user, except the one with "keepJti",
+// on the denylist. Use an empty "keepJti" to deny all of them.
+func (cfg *ApiConfig) denyUserAccessTokens(ctx context.Context, userID uuid.UUID, keepJti string) error {
+	deniedTokens, err := cfg.db.DenyAccessTokensFromUser(ctx, database.DenyAccessTokensFromUserParams{
+		UserID:  userID,
+		KeepJti: keepJti,
+	})
+	if err != nil {
+		return err
+	}
+	for _, deniedToken := range deniedTokens {
+		cfg.denylist.Deny(deniedToken.Jti, deniedToken.ExpiresAt)
+	}
+	return nil
+}
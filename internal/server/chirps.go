@@ -4,11 +4,16 @@ import (
 	"encoding/json"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/api"
 	"github.com/luigiMinardi/bootdotdev-chirpy/internal/database"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/entitlements"
 	"github.com/luigiMinardi/bootdotdev-chirpy/internal/logging"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/outbox"
 	"github.com/luigiMinardi/bootdotdev-chirpy/internal/utils"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/webhook"
 )
 
 // POST /api/chirps
@@ -16,35 +21,57 @@ func (cfg *ApiConfig) PostChirpsHandler(w http.ResponseWriter, r *http.Request)
 	type parameters struct {
 		Body string `json:"body"`
 	}
-	type returnVals struct {
-		Id        string `json:"id"`
-		CreatedAt string `json:"created_at"`
-		UpdatedAt string `json:"updated_at"`
-		Body      string `json:"body"`
-		UserID    string `json:"user_id"`
-	}
 
 	idVal := r.Context().Value("id")
 	userId, ok := idVal.(uuid.UUID)
 	if !ok {
-		utils.ResponseWithError(w, 401, "You're not logged in.", "failed to get id from middleware", r.Context().Value("id"))
+		utils.ResponseWithError(w, r, 401, "You're not logged in.", "failed to get id from middleware", r.Context().Value("id"))
 		return
 	}
 
 	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
 	if err := decoder.Decode(&params); err != nil {
-		utils.ResponseWithError(w, 500, "Something went wrong", "failed to decode params", err)
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to decode params", err)
 		return
 	}
-	if len(params.Body) > 140 {
-		utils.ResponseWithError(w, 400, "Chirp is too long", "chirp is too long", params.Body)
+	if params.Body == "" {
+		utils.ResponseWithError(w, r, 400, "Empty \"body\" field", "empty \"body\" field", params)
 		return
 	}
-	if params.Body == "" {
-		utils.ResponseWithError(w, 400, "Empty \"body\" field", "empty \"body\" field", params)
+
+	author, err := cfg.db.GetUserByID(r.Context(), userId)
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to retrieve chirp author", err)
+		return
+	}
+	entitled, err := cfg.entitlementsUser(r.Context(), author)
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to retrieve user plan", err)
+		return
+	}
+	if !cfg.entitlements.Can(entitled, entitlements.FeatureChirpLength) {
+		utils.ResponseWithError(w, r, 403, "Your plan doesn't allow posting chirps", "chirps not allowed by plan", userId)
+		return
+	}
+	if !cfg.entitlements.Within(entitled, entitlements.FeatureChirpLength, len(params.Body)) {
+		utils.ResponseWithError(w, r, 400, "Chirp is too long", "chirp is too long", params.Body)
 		return
 	}
+	if cfg.entitlements.Limit(entitled, entitlements.FeatureChirpsPerHour) != entitlements.Unlimited {
+		posted, err := cfg.db.CountChirpsFromUserSince(r.Context(), database.CountChirpsFromUserSinceParams{
+			UserID:    userId,
+			CreatedAt: time.Now().Add(-time.Hour),
+		})
+		if err != nil {
+			utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to count user chirps", err)
+			return
+		}
+		if !cfg.entitlements.Within(entitled, entitlements.FeatureChirpsPerHour, int(posted)+1) {
+			utils.ResponseWithError(w, r, 429, "You posted too many chirps, try again later", "chirps per hour limit reached", userId)
+			return
+		}
+	}
 
 	words := strings.Split(params.Body, " ")
 	for wordIndex := range words {
@@ -68,20 +95,21 @@ func (cfg *ApiConfig) PostChirpsHandler(w http.ResponseWriter, r *http.Request)
 		Body:   params.Body,
 		UserID: userId,
 	}
-	chirp, err := cfg.db.CreateChirp(r.Context(), chirpParams)
+	var chirp database.Chirp
+	err = cfg.inTx(r.Context(), func(db *database.Queries) error {
+		var err error
+		chirp, err = db.CreateChirp(r.Context(), chirpParams)
+		if err != nil {
+			return err
+		}
+		return outbox.Write(r.Context(), db, webhook.EventChirpCreated, userId, api.NewCreatedChirp(chirp, author))
+	})
 	if err != nil {
-		utils.ResponseWithError(w, 500, "Something went wrong", "failed to create chirp", err)
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to create chirp", err)
 		return
 	}
-	respBody := returnVals{
-		Id:        chirp.ID.String(),
-		CreatedAt: chirp.CreatedAt.String(),
-		UpdatedAt: chirp.UpdatedAt.String(),
-		Body:      chirp.Body,
-		UserID:    chirp.UserID.String(),
-	}
-
-	utils.ResponseWithJson(w, 201, respBody)
+	cfg.metrics.ChirpsCreated.Inc()
+	utils.ResponseWithJson(w, 201, api.NewCreatedChirp(chirp, author))
 }
 
 // GET /api/chirps
@@ -90,14 +118,13 @@ func (cfg *ApiConfig) GetChirpsHandler(w http.ResponseWriter, r *http.Request) {
 	sort := r.URL.Query().Get("sort")
 
 	if sort != "asc" && sort != "desc" {
-		logging.LogInfo("sort", sort)
 		sort = "asc"
 	}
 
 	if authorId != "" {
 		authorUid, err := uuid.Parse(authorId)
 		if err != nil {
-			utils.ResponseWithError(w, 404, "Invalid Author ID", "invalid authorId", err)
+			utils.ResponseWithError(w, r, 404, "Invalid Author ID", "invalid authorId", err)
 			return
 		}
 		params := database.GetAllChirpsFromUserParams{
@@ -106,42 +133,39 @@ func (cfg *ApiConfig) GetChirpsHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		chirps, err := cfg.db.GetAllChirpsFromUser(r.Context(), params)
 		if err != nil {
-			utils.ResponseWithError(w, 500, "Something went wrong", "failed to retrieve chirps", err)
+			utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to retrieve chirps", err)
 			return
 		}
-		utils.ResponseWithJson(w, 200, chirps)
+		utils.ResponseWithJson(w, 200, api.NewChirps(chirps))
 		return
 	}
 
 	chirps, err := cfg.db.GetAllChirps(r.Context(), sort)
 	if err != nil {
-		utils.ResponseWithError(w, 500, "Something went wrong", "failed to retrieve chirps", err)
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to retrieve chirps", err)
 		return
 	}
 
-	utils.ResponseWithJson(w, 200, chirps)
+	utils.ResponseWithJson(w, 200, api.NewChirps(chirps))
 }
 
 // GET /api/chirps/{chirpID}
 func (cfg *ApiConfig) GetChirpsByIdHandler(w http.ResponseWriter, r *http.Request) {
 	idString := r.PathValue("chirpID")
 
-	logging.LogError("erroring", "this failed")
-	logging.LogInfo("infoing", "this infoed")
-	logging.LogWarn("warning", "this warned")
 	id, err := uuid.Parse(idString)
 	if err != nil {
-		utils.ResponseWithError(w, 400, "Invaid \"chirpID\" path parameter", "failed to get uuid", err)
+		utils.ResponseWithError(w, r, 400, "Invaid \"chirpID\" path parameter", "failed to get uuid", err)
 		return
 	}
 
 	chirp, err := cfg.db.GetChirp(r.Context(), id)
 	if err != nil {
-		utils.ResponseWithError(w, 404, "This chirp was deleted or don't exist", "failed to retrieve chirp", err)
+		utils.ResponseWithError(w, r, 404, "This chirp was deleted or don't exist", "failed to retrieve chirp", err)
 		return
 	}
 
-	utils.ResponseWithJson(w, 200, chirp)
+	utils.ResponseWithJson(w, 200, api.NewChirp(chirp))
 }
 
 // DELETE /api/chirps/{chirpID}
@@ -150,7 +174,7 @@ func (cfg *ApiConfig) DeleteChirpsByIdHandler(w http.ResponseWriter, r *http.Req
 	idVal := r.Context().Value("id")
 	userId, ok := idVal.(uuid.UUID)
 	if !ok {
-		utils.ResponseWithError(w, 401, "You're not logged in.", "failed to get id from middleware", r.Context().Value("id"))
+		utils.ResponseWithError(w, r, 401, "You're not logged in.", "failed to get id from middleware", r.Context().Value("id"))
 		return
 	}
 
@@ -158,7 +182,7 @@ func (cfg *ApiConfig) DeleteChirpsByIdHandler(w http.ResponseWriter, r *http.Req
 
 	chirpId, err := uuid.Parse(idString)
 	if err != nil {
-		utils.ResponseWithError(w, 400, "Invaid \"chirpID\" path parameter", "failed to get uuid", err)
+		utils.ResponseWithError(w, r, 400, "Invaid \"chirpID\" path parameter", "failed to get uuid", err)
 		return
 	}
 
@@ -169,7 +193,7 @@ func (cfg *ApiConfig) DeleteChirpsByIdHandler(w http.ResponseWriter, r *http.Req
 
 	chirp, err := cfg.db.GetChirp(r.Context(), chirpId)
 	if err != nil {
-		utils.ResponseWithError(w, 404, "This chirp was deleted or don't exist", "failed to retrieve chirp", err)
+		utils.ResponseWithError(w, r, 404, "This chirp was deleted or don't exist", "failed to retrieve chirp", err)
 		return
 	}
 	if chirp.UserID != userId {
@@ -177,12 +201,20 @@ func (cfg *ApiConfig) DeleteChirpsByIdHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	deletedChirp, err := cfg.db.DeleteChirp(r.Context(), dta)
+	var deletedChirp database.Chirp
+	err = cfg.inTx(r.Context(), func(db *database.Queries) error {
+		var err error
+		deletedChirp, err = db.DeleteChirp(r.Context(), dta)
+		if err != nil {
+			return err
+		}
+		return outbox.Write(r.Context(), db, webhook.EventChirpDeleted, userId, map[string]string{"id": deletedChirp.ID.String()})
+	})
 	if err != nil {
-		utils.ResponseWithError(w, 404, "This chirp was deleted or don't exist", "failed to retrieve chirp", err)
+		utils.ResponseWithError(w, r, 404, "This chirp was deleted or don't exist", "failed to retrieve chirp", err)
 		return
 	}
-	logging.LogInfo("removed", deletedChirp)
+	logging.LogInfoContext(r.Context(), "chirp deleted", "chirp_id", deletedChirp.ID)
 
 	w.WriteHeader(204)
 	w.Header().Set("Content-Type", "application/json")
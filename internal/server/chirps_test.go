@@ -0,0 +1,29 @@
+package server
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/entitlements"
+)
+
+func TestPostChirpsNotAllowedByPlan(t *testing.T) {
+	cfg, mock, _ := newTestConfig(t)
+	cfg.entitlements = entitlements.New(map[string]entitlements.Limits{
+		entitlements.PlanFree: {entitlements.FeatureChirpLength: 0},
+	})
+	user := newTestUser()
+	mock.ExpectQuery("GetUserByID").WillReturnRows(userRows(user))
+
+	r := httptest.NewRequest("POST", "/api/chirps", strings.NewReader(`{"body": "hello"}`))
+	r = r.WithContext(context.WithValue(r.Context(), "id", user.ID))
+	w := httptest.NewRecorder()
+	cfg.PostChirpsHandler(w, r)
+
+	if w.Code != 403 {
+		t.Errorf("expected 403, got %d %s", w.Code, w.Body)
+	}
+	checkQueries(t, mock)
+}
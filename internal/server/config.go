@@ -0,0 +1,255 @@
+package server
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/auth"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/database"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/entitlements"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/logging"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/mailer"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/sso"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/throttle"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/tracing"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/webhook"
+)
+
+// Get an optional integer environment variable, returns "fallback" if it's
+// not set and panics if it's not a number.
+func envInt(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		logging.Panicf("%s must be a number, got: %s", name, value)
+	}
+	return number
+}
+
+// Send the logs to stderr as LOG_FORMAT ("json" by default or "text") from
+// LOG_LEVEL ("debug", "info" by default, "warn" or "error") up.
+func setupLoggingFromEnv() {
+	format := os.Getenv("LOG_FORMAT")
+	if format == "" {
+		format = "json"
+	}
+	level := os.Getenv("LOG_LEVEL")
+	if level == "" {
+		level = "info"
+	}
+	if err := logging.Setup(format, level); err != nil {
+		logging.Panicf("LOG_FORMAT or LOG_LEVEL is invalid, got err: %v", err)
+	}
+}
+
+// Set up the tracing from OTEL_TRACES_EXPORTER, "none" by default or "otlp"
+// to send the spans to OTEL_EXPORTER_OTLP_ENDPOINT. The returned function
+// flushes the spans left.
+func setupTracingFromEnv(ctx context.Context) func(context.Context) error {
+	exporter := os.Getenv("OTEL_TRACES_EXPORTER")
+	if exporter == "" {
+		exporter = "none"
+	}
+	shutdown, err := tracing.Setup(ctx, exporter)
+	if err != nil {
+		logging.Panicf("OTEL_TRACES_EXPORTER is invalid, got err: %v", err)
+	}
+	return shutdown
+}
+
+// Build the password hasher from the PASSWORD_HASHER ("argon2id" or "bcrypt")
+// environment variable and its tunables, every hash made by older schemes or
+// parameters is still accepted and gets rehashed on login.
+func passwordHasherFromEnv() auth.PasswordHasher {
+	switch scheme := os.Getenv("PASSWORD_HASHER"); scheme {
+	case "", "argon2id":
+		params := auth.DefaultArgon2idParams
+		params.Memory = uint32(envInt("ARGON2ID_MEMORY", int(params.Memory)))
+		params.Iterations = uint32(envInt("ARGON2ID_ITERATIONS", int(params.Iterations)))
+		params.Parallelism = uint8(envInt("ARGON2ID_PARALLELISM", int(params.Parallelism)))
+		return auth.VersionedHasher{Current: auth.Argon2idHasher{Params: params}}
+	case "bcrypt":
+		cost := envInt("BCRYPT_COST", 12)
+		return auth.VersionedHasher{Current: auth.BcryptHasher{Cost: cost}}
+	default:
+		logging.Panicf("PASSWORD_HASHER must be \"argon2id\" or \"bcrypt\", got: %s", scheme)
+	}
+	return nil
+}
+
+// Build the password policy from PASSWORD_MIN_LENGTH, PASSWORD_MAX_LENGTH (in
+// bytes, defaults to the bcrypt limit) and BREACHED_PASSWORDS_DIR (a local
+// k-anonymity corpus, the check is skipped if it's not set).
+func passwordPolicyFromEnv() auth.PasswordPolicy {
+	policy := auth.DefaultPasswordPolicy
+	policy.MinLength = envInt("PASSWORD_MIN_LENGTH", policy.MinLength)
+	policy.MaxLength = envInt("PASSWORD_MAX_LENGTH", policy.MaxLength)
+	if policy.MinLength < 1 {
+		logging.Panicf("PASSWORD_MIN_LENGTH must be at least 1, got: %d", policy.MinLength)
+	}
+	if policy.MaxLength < policy.MinLength {
+		logging.Panicf("PASSWORD_MAX_LENGTH must be at least PASSWORD_MIN_LENGTH (%d), got: %d", policy.MinLength, policy.MaxLength)
+	}
+	if breachedDir := os.Getenv("BREACHED_PASSWORDS_DIR"); breachedDir != "" {
+		// a missing prefix file counts as no breach, so a wrong dir would let
+		// every password through
+		entries, err := os.ReadDir(breachedDir)
+		if err != nil {
+			logging.Panicf("BREACHED_PASSWORDS_DIR must be a readable directory, got err: %v", err)
+		}
+		if len(entries) == 0 {
+			logging.Panicf("BREACHED_PASSWORDS_DIR must have the corpus, %s is empty", breachedDir)
+		}
+		policy.Breached = &auth.BreachedPasswords{Dir: breachedDir}
+	}
+	return policy
+}
+
+// Build the mailer from MAILER ("file" by default or "smtp"). The "file" one
+// writes the emails to MAILER_DIR and "smtp" sends them through SMTP_ADDR
+// with SMTP_USERNAME and SMTP_PASSWORD. Both send from MAIL_FROM.
+func mailerFromEnv() mailer.Mailer {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "Chirpy <no-reply@localhost>"
+	}
+	switch kind := os.Getenv("MAILER"); kind {
+	case "", "file":
+		dir := os.Getenv("MAILER_DIR")
+		if dir == "" {
+			dir = "tmp/mail"
+		}
+		return &mailer.FileMailer{Dir: dir, From: from}
+	case "smtp":
+		addr := os.Getenv("SMTP_ADDR")
+		if addr == "" {
+			logging.Panicf("SMTP_ADDR must be set when MAILER is \"smtp\"")
+		}
+		return &mailer.SMTPMailer{
+			Addr:     addr,
+			From:     from,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+		}
+	default:
+		logging.Panicf("MAILER must be \"file\" or \"smtp\", got: %s", kind)
+	}
+	return nil
+}
+
+// Public URL of the app from BASE_URL without the trailing slash, defaults
+// to the local server.
+func baseURLFromEnv() string {
+	baseURL := strings.TrimSuffix(os.Getenv("BASE_URL"), "/")
+	if baseURL == "" {
+		return "http://localhost:8080"
+	}
+	return baseURL
+}
+
+// Build how the Polka webhooks are authenticated from POLKA_AUTH.
+// "signature" (default) checks the HMAC signature made with any of the comma
+// separated POLKA_WEBHOOK_SECRETS, more than one while rotating them, and
+// rejects deliveries older than POLKA_WEBHOOK_TOLERANCE_SECONDS. "apikey" is
+// the legacy mode comparing the "Authorization: ApiKey" header with POLKA_KEY,
+// it's still the default when only POLKA_KEY is set so older deployments keep
+// working.
+func polkaAuthFromEnv() (string, *webhook.Verifier) {
+	var secrets [][]byte
+	for _, secret := range strings.Split(os.Getenv("POLKA_WEBHOOK_SECRETS"), ",") {
+		if secret = strings.TrimSpace(secret); secret != "" {
+			secrets = append(secrets, []byte(secret))
+		}
+	}
+
+	mode := os.Getenv("POLKA_AUTH")
+	if mode == "" && len(secrets) == 0 && os.Getenv("POLKA_KEY") != "" {
+		logging.LogWarn("POLKA_KEY without POLKA_AUTH is deprecated, set POLKA_AUTH=\"apikey\" or move to POLKA_WEBHOOK_SECRETS")
+		mode = "apikey"
+	}
+	switch mode {
+	case "", "signature":
+		if len(secrets) == 0 {
+			logging.Panicf("POLKA_WEBHOOK_SECRETS must be set when POLKA_AUTH is \"signature\"")
+		}
+		tolerance := time.Second * time.Duration(envInt("POLKA_WEBHOOK_TOLERANCE_SECONDS", 300))
+		return "", webhook.NewVerifier(secrets, tolerance)
+	case "apikey":
+		polkaKey := os.Getenv("POLKA_KEY")
+		if polkaKey == "" {
+			logging.Panicf("POLKA_KEY must be set when POLKA_AUTH is \"apikey\"")
+		}
+		return polkaKey, nil
+	default:
+		logging.Panicf("POLKA_AUTH must be \"signature\" or \"apikey\", got: %s", mode)
+	}
+	return "", nil
+}
+
+// Load the limits of every plan from the JSON file at ENTITLEMENTS_FILE, the
+// defaults are used when it's not set.
+func entitlementsFromEnv() *entitlements.Engine {
+	path := os.Getenv("ENTITLEMENTS_FILE")
+	if path == "" {
+		return entitlements.New(entitlements.DefaultPlans())
+	}
+	engine, err := entitlements.LoadFile(path)
+	if err != nil {
+		logging.Panicf("ENTITLEMENTS_FILE couldn't be loaded, got err: %v", err)
+	}
+	return engine
+}
+
+// Build the login throttle store from THROTTLE_STORE, "memory" (default) only
+// works with a single instance, use "postgres" when running more than one.
+func throttleStoreFromEnv(db *database.Queries) throttle.Store {
+	switch kind := os.Getenv("THROTTLE_STORE"); kind {
+	case "", "memory":
+		return throttle.NewMemoryStore()
+	case "postgres":
+		return throttle.NewPostgresStore(db)
+	default:
+		logging.Panicf("THROTTLE_STORE must be \"memory\" or \"postgres\", got: %s", kind)
+	}
+	return nil
+}
+
+// Build a relying party for every provider on OIDC_PROVIDERS, a comma
+// separated list of names. Each one is configured with OIDC_<NAME>_ISSUER,
+// OIDC_<NAME>_CLIENT_ID and OIDC_<NAME>_CLIENT_SECRET. Providers that can't
+// be discovered are logged and left out so the rest of the app still works.
+func relyingPartiesFromEnv(baseURL string) map[string]*sso.RelyingParty {
+	relyingParties := map[string]*sso.RelyingParty{}
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		config := sso.Config{
+			Name:         name,
+			IssuerURL:    os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  baseURL + "/api/login/oidc/" + name + "/callback",
+		}
+		if config.IssuerURL == "" || config.ClientID == "" {
+			logging.Panicf("%sISSUER and %sCLIENT_ID must be set for the OIDC provider %s", prefix, prefix, name)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+		relyingParty, err := sso.New(ctx, config)
+		cancel()
+		if err != nil {
+			logging.LogError("failed to set up OIDC provider", "provider", name, "err", err)
+			continue
+		}
+		relyingParties[name] = relyingParty
+	}
+	return relyingParties
+}
@@ -0,0 +1,24 @@
+package server
+
+import "testing"
+
+func TestPolkaAuthFromEnv(t *testing.T) {
+	t.Run("only POLKA_KEY falls back to apikey", func(t *testing.T) {
+		t.Setenv("POLKA_AUTH", "")
+		t.Setenv("POLKA_WEBHOOK_SECRETS", "")
+		t.Setenv("POLKA_KEY", "f271c81ff7084ee5b99a5091b42d486e")
+		polkaKey, verifier := polkaAuthFromEnv()
+		if polkaKey != "f271c81ff7084ee5b99a5091b42d486e" || verifier != nil {
+			t.Errorf("expected the apikey mode, got key %q and verifier %v", polkaKey, verifier)
+		}
+	})
+	t.Run("secrets default to signature", func(t *testing.T) {
+		t.Setenv("POLKA_AUTH", "")
+		t.Setenv("POLKA_WEBHOOK_SECRETS", "a,b")
+		t.Setenv("POLKA_KEY", "f271c81ff7084ee5b99a5091b42d486e")
+		polkaKey, verifier := polkaAuthFromEnv()
+		if polkaKey != "" || verifier == nil {
+			t.Errorf("expected the signature mode, got key %q and verifier %v", polkaKey, verifier)
+		}
+	})
+}
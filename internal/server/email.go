@@ -0,0 +1,283 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/auth"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/database"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/logging"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/mailer"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/utils"
+)
+
+// Purposes of the user_tokens, a token only works for the purpose it was
+// made for.
+const (
+	tokenPurposeVerifyEmail   = "verify_email"
+	tokenPurposeResetPassword = "reset_password"
+)
+
+const (
+	verifyEmailTokenExpiresIn   = time.Hour * 24
+	resetPasswordTokenExpiresIn = time.Hour
+)
+
+var (
+	errInvalidUserToken = errors.New("invalid or expired token")
+	errPasswordPolicy   = errors.New("password violates the policy")
+)
+
+// POST /api/users/verify
+func (cfg *ApiConfig) VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Token string `json:"token"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to decode params", err)
+		return
+	}
+
+	userId, err := cfg.db.UseUserToken(r.Context(), database.UseUserTokenParams{
+		TokenHash: auth.HashToken(params.Token),
+		Purpose:   tokenPurposeVerifyEmail,
+	})
+	if err != nil {
+		utils.ResponseWithError(w, r, 400, "Invalid or expired token", "failed to use verify email token", err)
+		return
+	}
+
+	err = cfg.db.VerifyUserEmail(r.Context(), userId)
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to verify user email", err)
+		return
+	}
+	logging.LogInfoContext(r.Context(), "email verified for user", "user_id", userId)
+
+	w.WriteHeader(204)
+}
+
+// POST /api/users/verify/resend
+func (cfg *ApiConfig) ResendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	idVal := r.Context().Value("id")
+	userId, ok := idVal.(uuid.UUID)
+	if !ok {
+		utils.ResponseWithError(w, r, 401, "You're not logged in.", "failed to get id from middleware", r.Context().Value("id"))
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), userId)
+	if err != nil {
+		utils.ResponseWithError(w, r, 404, "This user was deleted or don't exist", "failed to retrieve user", err)
+		return
+	}
+	if user.EmailVerifiedAt.Valid {
+		utils.ResponseWithError(w, r, 409, "Your email is already verified", "email already verified", user.ID)
+		return
+	}
+
+	err = cfg.sendVerificationEmail(r.Context(), user.ID, user.Email)
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to send verification email", err)
+		return
+	}
+
+	w.WriteHeader(202)
+}
+
+// POST /api/password/forgot
+func (cfg *ApiConfig) ForgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Email string `json:"email"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to decode params", err)
+		return
+	}
+
+	// every request counts, so it can't be used to flood an inbox with emails
+	throttleKeys := resetPasswordThrottleKeys(r, params.Email)
+	if !cfg.checkThrottle(w, r, throttleKeys) {
+		return
+	}
+	if _, err := cfg.throttler.Fail(r.Context(), throttleKeys...); err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to record password reset request", err)
+		return
+	}
+
+	// the response is always the same, and doesn't wait for the email, so it
+	// can't be used to find out which emails have an account
+	go cfg.sendResetPasswordEmail(context.WithoutCancel(r.Context()), params.Email)
+
+	w.WriteHeader(202)
+}
+
+// Send the email with the reset password link to the user with the "email",
+// if there's one. Failures are only logged, the request was answered already.
+func (cfg *ApiConfig) sendResetPasswordEmail(ctx context.Context, email string) {
+	user, err := cfg.db.GetUserByEmail(ctx, email)
+	if err != nil {
+		logging.LogInfoContext(ctx, "password reset requested for unknown email", "err", err)
+		return
+	}
+
+	token, err := cfg.createUserToken(ctx, user.ID, tokenPurposeResetPassword, resetPasswordTokenExpiresIn)
+	if err != nil {
+		logging.LogErrorContext(ctx, "failed to create reset password token", "err", err)
+		return
+	}
+	err = cfg.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your Chirpy password",
+		Body: fmt.Sprintf(
+			"Someone asked to reset the password of your Chirpy account.\n\n"+
+				"If it was you, open the link below in the next hour:\n%s\n\n"+
+				"If it wasn't, you can ignore this email.\n",
+			cfg.appLink("/app/password/reset", token),
+		),
+	})
+	if err != nil {
+		logging.LogErrorContext(ctx, "failed to send reset password email", "err", err, "user_id", user.ID)
+	}
+}
+
+// POST /api/password/reset
+func (cfg *ApiConfig) ResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to decode params", err)
+		return
+	}
+
+	// the token is used in the same transaction as the password is changed,
+	// so a password breaking the policy doesn't burn the link
+	var user database.User
+	var violations []auth.PolicyViolation
+	err := cfg.inTx(r.Context(), func(db *database.Queries) error {
+		userId, err := db.UseUserToken(r.Context(), database.UseUserTokenParams{
+			TokenHash: auth.HashToken(params.Token),
+			Purpose:   tokenPurposeResetPassword,
+		})
+		if err != nil {
+			return fmt.Errorf("%w: %w", errInvalidUserToken, err)
+		}
+		user, err = db.GetUserByID(r.Context(), userId)
+		if err != nil {
+			return fmt.Errorf("failed to retrieve user: %w", err)
+		}
+		if violations = cfg.passwordPolicy.Check(params.Password, user.Email); len(violations) > 0 {
+			return errPasswordPolicy
+		}
+		passwd, err := auth.HashPassword(params.Password)
+		if err != nil {
+			return fmt.Errorf("failed to hash password: %w", err)
+		}
+		return db.UpdateUserPassword(r.Context(), database.UpdateUserPasswordParams{
+			ID:             user.ID,
+			HashedPassword: passwd,
+		})
+	})
+	switch {
+	case errors.Is(err, errInvalidUserToken):
+		utils.ResponseWithError(w, r, 400, "Invalid or expired token", "failed to use reset password token", err)
+		return
+	case errors.Is(err, errPasswordPolicy):
+		logging.LogInfoContext(r.Context(), "password violates the policy", "violations", violations)
+		utils.ResponseWithJson(w, 422, utils.ReturnValidationError{
+			Error:      "Password doesn't follow the password policy",
+			Violations: violations,
+		})
+		return
+	case err != nil:
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to reset password", err)
+		return
+	}
+
+	// whoever had the old password is logged out
+	err = cfg.db.RevokeAllRefreshTokensFromUser(r.Context(), user.ID)
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to revoke user refresh tokens", err)
+		return
+	}
+	err = cfg.denyUserAccessTokens(r.Context(), user.ID, "")
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to deny user access tokens", err)
+		return
+	}
+	err = cfg.db.DeleteUserTokensFromUser(r.Context(), database.DeleteUserTokensFromUserParams{
+		UserID:  user.ID,
+		Purpose: tokenPurposeResetPassword,
+	})
+	if err != nil {
+		logging.LogErrorContext(r.Context(), "failed to delete unused reset password tokens", "err", err)
+	}
+	logging.LogInfoContext(r.Context(), "password reset for user", "user_id", user.ID)
+
+	w.WriteHeader(204)
+}
+
+// Send the email with the link the user has to open to verify their email.
+func (cfg *ApiConfig) sendVerificationEmail(ctx context.Context, userID uuid.UUID, email string) error {
+	token, err := cfg.createUserToken(ctx, userID, tokenPurposeVerifyEmail, verifyEmailTokenExpiresIn)
+	if err != nil {
+		return err
+	}
+	return cfg.mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Verify your Chirpy email",
+		Body: fmt.Sprintf(
+			"Welcome to Chirpy!\n\n"+
+				"Open the link below in the next 24 hours to verify your email:\n%s\n",
+			cfg.appLink("/app/verify", token),
+		),
+	})
+}
+
+// Create a single use token for the user "purpose", the older unused ones
+// with the same purpose stop working.
+func (cfg *ApiConfig) createUserToken(ctx context.Context, userID uuid.UUID, purpose string, expiresIn time.Duration) (string, error) {
+	token, err := auth.MakeOneTimeToken()
+	if err != nil {
+		return "", err
+	}
+	err = cfg.db.DeleteUserTokensFromUser(ctx, database.DeleteUserTokensFromUserParams{
+		UserID:  userID,
+		Purpose: purpose,
+	})
+	if err != nil {
+		return "", err
+	}
+	err = cfg.db.CreateUserToken(ctx, database.CreateUserTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    userID,
+		Purpose:   purpose,
+		ExpiresAt: time.Now().Add(expiresIn),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Link to the app "path" with the "token" as a query parameter.
+func (cfg *ApiConfig) appLink(path, token string) string {
+	return cfg.baseURL + path + "?" + url.Values{"token": {token}}.Encode()
+}
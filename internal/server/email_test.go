@@ -0,0 +1,195 @@
+package server
+
+import (
+	"database/sql"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/auth"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/database"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/throttle"
+)
+
+func newTestUser() database.User {
+	return database.User{
+		ID:        uuid.New(),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		Email:     "saul@example.com",
+		Role:      string(auth.RoleUser),
+	}
+}
+
+func TestVerifyEmail(t *testing.T) {
+	cfg, mock, _ := newTestConfig(t)
+	user := newTestUser()
+	mock.ExpectQuery("UseUserToken").WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(user.ID.String()))
+	mock.ExpectExec("VerifyUserEmail").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	w := httptest.NewRecorder()
+	cfg.VerifyEmailHandler(w, httptest.NewRequest("POST", "/api/users/verify", strings.NewReader(`{"token": "abc"}`)))
+
+	if w.Code != 204 {
+		t.Errorf("expected 204, got %d %s", w.Code, w.Body)
+	}
+	checkQueries(t, mock)
+}
+
+func TestVerifyEmailInvalidToken(t *testing.T) {
+	cfg, mock, _ := newTestConfig(t)
+	mock.ExpectQuery("UseUserToken").WillReturnError(sql.ErrNoRows)
+
+	w := httptest.NewRecorder()
+	cfg.VerifyEmailHandler(w, httptest.NewRequest("POST", "/api/users/verify", strings.NewReader(`{"token": "abc"}`)))
+
+	if w.Code != 400 {
+		t.Errorf("expected 400, got %d %s", w.Code, w.Body)
+	}
+	checkQueries(t, mock)
+}
+
+func TestResetPassword(t *testing.T) {
+	cfg, mock, _ := newTestConfig(t)
+	user := newTestUser()
+	mock.ExpectBegin()
+	mock.ExpectQuery("UseUserToken").WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(user.ID.String()))
+	mock.ExpectQuery("GetUserByID").WillReturnRows(userRows(user))
+	mock.ExpectExec("UpdateUserPassword").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectExec("RevokeAllRefreshTokensFromUser").WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectQuery("DenyAccessTokensFromUser").WillReturnRows(sqlmock.NewRows([]string{"jti", "expires_at"}).AddRow("jti-1", time.Now().Add(time.Hour)))
+	mock.ExpectExec("DeleteUserTokensFromUser").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	w := httptest.NewRecorder()
+	cfg.ResetPasswordHandler(w, httptest.NewRequest("POST", "/api/password/reset",
+		strings.NewReader(`{"token": "abc", "password": "correct horse battery"}`)))
+
+	if w.Code != 204 {
+		t.Errorf("expected 204, got %d %s", w.Code, w.Body)
+	}
+	checkQueries(t, mock)
+}
+
+func TestResetPasswordPolicyKeepsToken(t *testing.T) {
+	cfg, mock, _ := newTestConfig(t)
+	user := newTestUser()
+	mock.ExpectBegin()
+	mock.ExpectQuery("UseUserToken").WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(user.ID.String()))
+	mock.ExpectQuery("GetUserByID").WillReturnRows(userRows(user))
+	mock.ExpectRollback()
+
+	w := httptest.NewRecorder()
+	cfg.ResetPasswordHandler(w, httptest.NewRequest("POST", "/api/password/reset",
+		strings.NewReader(`{"token": "abc", "password": "short"}`)))
+
+	if w.Code != 422 {
+		t.Errorf("expected 422, got %d %s", w.Code, w.Body)
+	}
+	// rolled back, so the token can be used again with a better password
+	checkQueries(t, mock)
+}
+
+func TestResetPasswordInvalidToken(t *testing.T) {
+	cfg, mock, _ := newTestConfig(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery("UseUserToken").WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	w := httptest.NewRecorder()
+	cfg.ResetPasswordHandler(w, httptest.NewRequest("POST", "/api/password/reset",
+		strings.NewReader(`{"token": "abc", "password": "correct horse battery"}`)))
+
+	if w.Code != 400 {
+		t.Errorf("expected 400, got %d %s", w.Code, w.Body)
+	}
+	checkQueries(t, mock)
+}
+
+func TestForgotPassword(t *testing.T) {
+	cfg, mock, mail := newTestConfig(t)
+	user := newTestUser()
+	mock.ExpectQuery("GetUserByEmail").WillReturnRows(userRows(user))
+	mock.ExpectExec("DeleteUserTokensFromUser").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("CreateUserToken").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	w := httptest.NewRecorder()
+	cfg.ForgotPasswordHandler(w, httptest.NewRequest("POST", "/api/password/forgot",
+		strings.NewReader(`{"email": "saul@example.com"}`)))
+
+	if w.Code != 202 {
+		t.Errorf("expected 202, got %d %s", w.Code, w.Body)
+	}
+	eventually(t, func() bool { return len(mail.Messages()) == 1 })
+	msg := mail.Messages()[0]
+	if msg.To != user.Email || !strings.Contains(msg.Body, "http://localhost:8080/app/password/reset?token=") {
+		t.Errorf("unexpected reset email to %s: %s", msg.To, msg.Body)
+	}
+	checkQueries(t, mock)
+}
+
+// Unknown emails and failing emails must look like a sent one.
+func TestForgotPasswordSameResponse(t *testing.T) {
+	t.Run("unknown email", func(t *testing.T) {
+		cfg, mock, mail := newTestConfig(t)
+		mock.ExpectQuery("GetUserByEmail").WillReturnError(sql.ErrNoRows)
+
+		w := httptest.NewRecorder()
+		cfg.ForgotPasswordHandler(w, httptest.NewRequest("POST", "/api/password/forgot",
+			strings.NewReader(`{"email": "nobody@example.com"}`)))
+
+		if w.Code != 202 {
+			t.Errorf("expected 202, got %d %s", w.Code, w.Body)
+		}
+		eventually(t, func() bool { return mock.ExpectationsWereMet() == nil })
+		if len(mail.Messages()) != 0 {
+			t.Errorf("expected no email to be sent")
+		}
+	})
+	t.Run("mailer failure", func(t *testing.T) {
+		cfg, mock, _ := newTestConfig(t)
+		cfg.mailer = failingMailer{}
+		mock.ExpectQuery("GetUserByEmail").WillReturnRows(userRows(newTestUser()))
+		mock.ExpectExec("DeleteUserTokensFromUser").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("CreateUserToken").WillReturnResult(sqlmock.NewResult(0, 1))
+
+		w := httptest.NewRecorder()
+		cfg.ForgotPasswordHandler(w, httptest.NewRequest("POST", "/api/password/forgot",
+			strings.NewReader(`{"email": "saul@example.com"}`)))
+
+		if w.Code != 202 {
+			t.Errorf("expected 202, got %d %s", w.Code, w.Body)
+		}
+		eventually(t, func() bool { return mock.ExpectationsWereMet() == nil })
+	})
+}
+
+func TestForgotPasswordThrottled(t *testing.T) {
+	cfg, mock, mail := newTestConfig(t)
+	cfg.throttler = throttle.New(throttle.NewMemoryStore(), throttle.Policy{
+		FreeAttempts: 1,
+		BaseDelay:    time.Minute,
+		MaxDelay:     time.Minute,
+		Window:       time.Hour,
+	})
+	// the second request locks the email, so only two are sent
+	mock.ExpectQuery("GetUserByEmail").WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery("GetUserByEmail").WillReturnError(sql.ErrNoRows)
+
+	for i, status := range []int{202, 202, 429} {
+		w := httptest.NewRecorder()
+		cfg.ForgotPasswordHandler(w, httptest.NewRequest("POST", "/api/password/forgot",
+			strings.NewReader(`{"email": "nobody@example.com"}`)))
+
+		if w.Code != status {
+			t.Errorf("expected %d on request %d, got %d %s", status, i+1, w.Code, w.Body)
+		}
+	}
+	eventually(t, func() bool { return mock.ExpectationsWereMet() == nil })
+	if len(mail.Messages()) != 0 {
+		t.Errorf("expected no email to be sent")
+	}
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/api"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/database"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/entitlements"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/utils"
+)
+
+// GET /api/users/entitlements
+//
+// The plan of the user and its limits, so clients can show them before
+// hitting them.
+func (cfg *ApiConfig) GetEntitlementsHandler(w http.ResponseWriter, r *http.Request) {
+	idVal := r.Context().Value("id")
+	id, ok := idVal.(uuid.UUID)
+	if !ok {
+		utils.ResponseWithError(w, r, 401, "You're not logged in.", "failed to get id from middleware", r.Context().Value("id"))
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), id)
+	if err != nil {
+		utils.ResponseWithError(w, r, 404, "This user was deleted or don't exist", "failed to retrieve user", err)
+		return
+	}
+	entitled, err := cfg.entitlementsUser(r.Context(), user)
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to retrieve user plan", err)
+		return
+	}
+
+	utils.ResponseWithJson(w, 200, api.NewEntitlements(cfg.entitlements.Plan(entitled), cfg.entitlements.Limits(entitled)))
+}
+
+// The plan of "user" comes from its live subscription, users without one are
+// on the free plan.
+func (cfg *ApiConfig) entitlementsUser(ctx context.Context, user database.User) (entitlements.User, error) {
+	if !user.IsChirpyRed {
+		return entitlements.User{Plan: entitlements.PlanFree}, nil
+	}
+	subscription, err := cfg.db.GetLiveSubscription(ctx, user.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return entitlements.User{Plan: entitlements.PlanRed, Paid: true}, nil
+	}
+	if err != nil {
+		return entitlements.User{}, err
+	}
+	return entitlements.User{Plan: subscription.Plan, Paid: true}, nil
+}
@@ -0,0 +1,327 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/auth"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/database"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/logging"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/utils"
+)
+
+// how many recovery codes the user gets when enabling 2FA
+const recoveryCodesAmount = 10
+
+// POST /api/users/totp
+//
+// Enrolling needs the current password, otherwise a stolen access token could
+// enable 2FA with a secret only the thief has. The confirm step doesn't, its
+// code can only be made with the secret answered here.
+func (cfg *ApiConfig) PostTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		CurrentPassword string `json:"current_password"`
+	}
+	type returnVals struct {
+		Secret     string `json:"secret"`
+		OtpauthURI string `json:"otpauth_uri"`
+	}
+
+	idVal := r.Context().Value("id")
+	userId, ok := idVal.(uuid.UUID)
+	if !ok {
+		utils.ResponseWithError(w, r, 401, "You're not logged in.", "failed to get id from middleware", r.Context().Value("id"))
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to decode params", err)
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), userId)
+	if err != nil {
+		utils.ResponseWithError(w, r, 404, "This user was deleted or don't exist", "failed to retrieve user", err)
+		return
+	}
+	if user.TotpEnabledAt.Valid {
+		utils.ResponseWithError(w, r, 409, "Two-factor authentication is already enabled", "totp already enabled", user.ID)
+		return
+	}
+	if !cfg.confirmPassword(w, r, user, params.CurrentPassword) {
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to generate totp secret", err)
+		return
+	}
+	sealedSecret, err := cfg.secretBox.Seal(secret)
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to encrypt totp secret", err)
+		return
+	}
+	err = cfg.db.SetUserTOTPSecret(r.Context(), database.SetUserTOTPSecretParams{
+		ID:         user.ID,
+		TotpSecret: sealedSecret,
+	})
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to save totp secret", err)
+		return
+	}
+
+	respBody := returnVals{
+		Secret:     auth.TOTPSecretString(secret),
+		OtpauthURI: auth.TOTPURI(auth.TokenIssuerAPI, user.Email, secret),
+	}
+	utils.ResponseWithJson(w, 201, respBody)
+}
+
+// POST /api/users/totp/confirm
+func (cfg *ApiConfig) ConfirmTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Code string `json:"code"`
+	}
+	type returnVals struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+
+	idVal := r.Context().Value("id")
+	userId, ok := idVal.(uuid.UUID)
+	if !ok {
+		utils.ResponseWithError(w, r, 401, "You're not logged in.", "failed to get id from middleware", r.Context().Value("id"))
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to decode params", err)
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), userId)
+	if err != nil {
+		utils.ResponseWithError(w, r, 404, "This user was deleted or don't exist", "failed to retrieve user", err)
+		return
+	}
+	if user.TotpEnabledAt.Valid {
+		utils.ResponseWithError(w, r, 409, "Two-factor authentication is already enabled", "totp already enabled", user.ID)
+		return
+	}
+	if user.TotpSecret == nil {
+		utils.ResponseWithError(w, r, 400, "Start the two-factor authentication enrolment first", "totp confirm without secret", user.ID)
+		return
+	}
+
+	secret, err := cfg.secretBox.Open(user.TotpSecret)
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to decrypt totp secret", err)
+		return
+	}
+	step, ok := auth.ValidateTOTP(secret, params.Code, time.Now())
+	if !ok {
+		utils.ResponseWithError(w, r, 401, "Invalid code", "invalid totp code on confirm", user.ID)
+		return
+	}
+	err = cfg.db.EnableUserTOTP(r.Context(), database.EnableUserTOTPParams{
+		ID:           user.ID,
+		TotpLastStep: sql.NullInt64{Int64: step, Valid: true},
+	})
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to enable totp", err)
+		return
+	}
+
+	recoveryCodes, err := cfg.replaceRecoveryCodes(r.Context(), user.ID)
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to create recovery codes", err)
+		return
+	}
+	logging.LogInfoContext(r.Context(), "totp enabled for user", "user_id", user.ID)
+
+	utils.ResponseWithJson(w, 200, returnVals{RecoveryCodes: recoveryCodes})
+}
+
+// DELETE /api/users/totp
+//
+// Needs the current password and a TOTP or recovery code, so a stolen access
+// token isn't enough to turn 2FA off.
+func (cfg *ApiConfig) DeleteTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		CurrentPassword string `json:"current_password"`
+		Code            string `json:"code"`
+		RecoveryCode    string `json:"recovery_code"`
+	}
+
+	idVal := r.Context().Value("id")
+	userId, ok := idVal.(uuid.UUID)
+	if !ok {
+		utils.ResponseWithError(w, r, 401, "You're not logged in.", "failed to get id from middleware", r.Context().Value("id"))
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to decode params", err)
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), userId)
+	if err != nil {
+		utils.ResponseWithError(w, r, 404, "This user was deleted or don't exist", "failed to retrieve user", err)
+		return
+	}
+	if !user.TotpEnabledAt.Valid {
+		utils.ResponseWithError(w, r, 409, "Two-factor authentication is not enabled", "totp not enabled", user.ID)
+		return
+	}
+
+	if !cfg.confirmPassword(w, r, user, params.CurrentPassword) {
+		return
+	}
+	if !cfg.confirmSecondFactor(w, r, user, params.Code, params.RecoveryCode) {
+		return
+	}
+
+	err = cfg.db.DisableUserTOTP(r.Context(), user.ID)
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to disable totp", err)
+		return
+	}
+	err = cfg.db.DeleteRecoveryCodesFromUser(r.Context(), user.ID)
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to delete recovery codes", err)
+		return
+	}
+	logging.LogInfoContext(r.Context(), "totp disabled for user", "user_id", user.ID)
+
+	w.WriteHeader(204)
+}
+
+// POST /api/login/mfa
+func (cfg *ApiConfig) LoginMFAHandler(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		MFAToken     string `json:"mfa_token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to decode params", err)
+		return
+	}
+
+	userId, err := auth.ValidateMFAChallengeJWT(params.MFAToken, cfg.jwtSecret)
+	if err != nil {
+		utils.ResponseWithError(w, r, 401, "Your login expired, try again.", "failed to validate mfa challenge token", err)
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), userId)
+	if err != nil {
+		utils.ResponseWithError(w, r, 401, "Your login expired, try again.", "failed to retrieve user", err)
+		return
+	}
+	if user.SuspendedAt.Valid {
+		utils.ResponseWithError(w, r, 403, "This account is suspended", "suspended user tried to login", user.ID)
+		return
+	}
+	if !user.TotpEnabledAt.Valid {
+		utils.ResponseWithError(w, r, 401, "Your login expired, try again.", "mfa login for user without totp", user.ID)
+		return
+	}
+
+	throttleKeys := []string{mfaThrottleKey(user.ID), ipThrottleKey(r)}
+	if !cfg.checkThrottle(w, r, throttleKeys) {
+		return
+	}
+	err = cfg.verifySecondFactor(r.Context(), user, params.Code, params.RecoveryCode)
+	if err != nil {
+		cfg.failThrottled(w, r, throttleKeys, "Invalid code", "failed to verify second factor", err)
+		return
+	}
+	if err := cfg.throttler.Reset(r.Context(), throttleKeys[0]); err != nil {
+		logging.LogErrorContext(r.Context(), "failed to reset mfa throttle", "err", err)
+	}
+
+	cfg.respondWithSession(w, r, user)
+}
+
+// Check the TOTP "code" or, if it's empty, the "recoveryCode" of the user.
+// Both are single use, a TOTP code can't be used twice and a recovery code is
+// burned when it's accepted.
+func (cfg *ApiConfig) verifySecondFactor(ctx context.Context, user database.User, code, recoveryCode string) error {
+	if code == "" {
+		if recoveryCode == "" {
+			return fmt.Errorf("no code or recovery code given")
+		}
+		used, err := cfg.db.UseRecoveryCode(ctx, database.UseRecoveryCodeParams{
+			UserID:   user.ID,
+			CodeHash: auth.HashRecoveryCode(recoveryCode),
+		})
+		if err != nil {
+			return err
+		}
+		if used == 0 {
+			return fmt.Errorf("invalid or already used recovery code")
+		}
+		logging.LogInfoContext(ctx, "recovery code used by user", "user_id", user.ID)
+		return nil
+	}
+
+	secret, err := cfg.secretBox.Open(user.TotpSecret)
+	if err != nil {
+		return err
+	}
+	step, ok := auth.ValidateTOTP(secret, code, time.Now())
+	if !ok {
+		return fmt.Errorf("invalid totp code")
+	}
+	// only moves forward so the same code can't be replayed
+	used, err := cfg.db.UseUserTOTPStep(ctx, database.UseUserTOTPStepParams{
+		ID:           user.ID,
+		TotpLastStep: sql.NullInt64{Int64: step, Valid: true},
+	})
+	if err != nil {
+		return err
+	}
+	if used == 0 {
+		return fmt.Errorf("totp code already used")
+	}
+	return nil
+}
+
+// Replace every recovery code of the user by new ones and return them, only
+// their hashes are stored so this is the only time they can be seen.
+func (cfg *ApiConfig) replaceRecoveryCodes(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	recoveryCodes, err := auth.GenerateRecoveryCodes(recoveryCodesAmount)
+	if err != nil {
+		return nil, err
+	}
+	err = cfg.db.DeleteRecoveryCodesFromUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, recoveryCode := range recoveryCodes {
+		err = cfg.db.CreateRecoveryCode(ctx, database.CreateRecoveryCodeParams{
+			UserID:   userID,
+			CodeHash: auth.HashRecoveryCode(recoveryCode),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return recoveryCodes, nil
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/auth"
+)
+
+// A stolen access token must not be enough to turn 2FA off.
+func TestDeleteTOTPConfirms(t *testing.T) {
+	hash, err := auth.HashPassword("correct horse battery")
+	if err != nil {
+		t.Fatalf("failed to hash password: %s", err)
+	}
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"without password", `{"code": "123456"}`},
+		{"wrong password", `{"current_password": "wrong", "code": "123456"}`},
+		{"without code", `{"current_password": "correct horse battery"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mock, _ := newTestConfig(t)
+			user := newTestUser()
+			user.HashedPassword = hash
+			user.TotpEnabledAt = sql.NullTime{Time: time.Now(), Valid: true}
+			mock.ExpectQuery("GetUserByID").WillReturnRows(userRows(user))
+
+			r := httptest.NewRequest("DELETE", "/api/users/totp", strings.NewReader(tt.body))
+			r = r.WithContext(context.WithValue(r.Context(), "id", user.ID))
+			w := httptest.NewRecorder()
+			cfg.DeleteTOTPHandler(w, r)
+
+			if w.Code != 401 {
+				t.Errorf("expected 401, got %d %s", w.Code, w.Body)
+			}
+			checkQueries(t, mock)
+		})
+	}
+}
+
+func TestDeleteTOTPThrottled(t *testing.T) {
+	hash, err := auth.HashPassword("correct horse battery")
+	if err != nil {
+		t.Fatalf("failed to hash password: %s", err)
+	}
+	cfg, mock, _ := newTestConfig(t)
+	user := newTestUser()
+	user.HashedPassword = hash
+	user.TotpEnabledAt = sql.NullTime{Time: time.Now(), Valid: true}
+
+	for range 10 {
+		mock.ExpectQuery("GetUserByID").WillReturnRows(userRows(user))
+		r := httptest.NewRequest("DELETE", "/api/users/totp", strings.NewReader(`{"current_password": "correct horse battery"}`))
+		r = r.WithContext(context.WithValue(r.Context(), "id", user.ID))
+		w := httptest.NewRecorder()
+		cfg.DeleteTOTPHandler(w, r)
+
+		if w.Code == 429 {
+			checkQueries(t, mock)
+			return
+		}
+		if w.Code != 401 {
+			t.Fatalf("expected 401 or 429, got %d %s", w.Code, w.Body)
+		}
+	}
+	t.Errorf("expected guessing the code to be throttled")
+}
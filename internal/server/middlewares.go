@@ -4,38 +4,146 @@ import (
 	"context"
 	"net/http"
 
+	"github.com/google/uuid"
 	"github.com/luigiMinardi/bootdotdev-chirpy/internal/auth"
 	"github.com/luigiMinardi/bootdotdev-chirpy/internal/logging"
 	"github.com/luigiMinardi/bootdotdev-chirpy/internal/utils"
 )
 
-// Middleware function that counts how many times an endpoint has been hit, it
-// does not save it so when server resets it's restarted.
-func (cfg *ApiConfig) MiddlewareMetricsInc(next http.Handler) http.Handler {
+// Middleware function that validates JWT, the scoped ones given to
+// third-party apps are only accepted by RequireScope.
+func (cfg *ApiConfig) MiddlewareValidateJWT(next http.HandlerFunc) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		cfg.fileServerHits.Add(1)
-		logging.LogInfo("current cfg.fileServerHits", cfg.fileServerHits.Load())
-		next.ServeHTTP(w, r)
+		claims, ok := cfg.authenticateJWT(w, r)
+		if !ok {
+			return
+		}
+		if claims.Scopes != nil {
+			utils.ResponseWithError(w, r, 403, "This token can't be used here.", "scoped token used on an unscoped route", claims.ID)
+			return
+		}
+		next.ServeHTTP(w, withClaims(r, claims))
 	})
 }
 
-// Middleware function that validates JWT
-func (cfg *ApiConfig) MiddlewareValidateJWT(next http.HandlerFunc) http.Handler {
+// Validate the bearer JWT of the request, writing the error response and
+// returning false when it isn't valid.
+func (cfg *ApiConfig) authenticateJWT(w http.ResponseWriter, r *http.Request) (auth.Claims, bool) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		utils.ResponseWithError(w, r, 401, "You're not logged in.", "failed to get token", err)
+		return auth.Claims{}, false
+	}
+
+	claims, err := auth.ParseJWT(token, cfg.jwtSecret)
+	if err != nil {
+		utils.ResponseWithError(w, r, 401, "You're not logged in.", "failed to validate token", err)
+		return auth.Claims{}, false
+	}
+	// tokens without a jti can't be revoked so we don't accept them
+	if claims.ID == "" {
+		utils.ResponseWithError(w, r, 401, "You're not logged in.", "token without jti", claims.UserID)
+		return auth.Claims{}, false
+	}
+	denied, err := cfg.denylist.IsDenied(r.Context(), claims.ID)
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to check token denylist", err)
+		return auth.Claims{}, false
+	}
+	if denied {
+		utils.ResponseWithError(w, r, 401, "You're not logged in.", "token is on the denylist", claims.ID)
+		return auth.Claims{}, false
+	}
+	return claims, true
+}
+
+// adding the parsed id and jti (and scopes of third-party tokens) from the jwt
+// to the Context so that it can be accessed by the HandleFunc's. This is a
+// shallow copy of request so it only changes r.Context
+func withClaims(r *http.Request, claims auth.Claims) *http.Request {
+	logging.SetUserID(r.Context(), claims.UserID.String())
+	ctx := context.WithValue(r.Context(), "id", claims.UserID)
+	ctx = context.WithValue(ctx, "jti", claims.ID)
+	if claims.Scopes != nil {
+		ctx = context.WithValue(ctx, "scopes", claims.Scopes)
+	}
+	return r.WithContext(ctx)
+}
+
+// Middleware function that validates the JWT like MiddlewareValidateJWT and
+// only lets users with the "role" (or one above it) through. The role is read
+// from the database on every request so demoting someone works right away.
+func (cfg *ApiConfig) RequireRole(role auth.Role, next http.HandlerFunc) http.Handler {
+	return cfg.MiddlewareValidateJWT(func(w http.ResponseWriter, r *http.Request) {
+		userId, ok := r.Context().Value("id").(uuid.UUID)
+		if !ok {
+			utils.ResponseWithError(w, r, 401, "You're not logged in.", "failed to get id from middleware", r.Context().Value("id"))
+			return
+		}
+		user, err := cfg.db.GetUserByID(r.Context(), userId)
+		if err != nil {
+			utils.ResponseWithError(w, r, 401, "You're not logged in.", "failed to retrieve user for role check", err)
+			return
+		}
+		userRole := auth.Role(user.Role)
+		if !userRole.Includes(role) {
+			utils.ResponseWithError(w, r, 403, "You don't have permission to do this.", "user without the required role "+string(role), user.ID)
+			return
+		}
+		ctx := context.WithValue(r.Context(), "role", userRole)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Middleware function that accepts personal API tokens and third-party JWTs
+// with the "scope" as well as first-party JWTs, which can do everything. The
+// scopes of the token are put on the Context so handlers can tell them apart
+// from first-party JWTs.
+func (cfg *ApiConfig) RequireScope(scope auth.Scope, next http.HandlerFunc) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		token, err := auth.GetBearerToken(r.Header)
-		if err != nil {
-			utils.ResponseWithError(w, 401, "You're not logged in.", "failed to get token", err)
+		if err != nil || !auth.IsAPIToken(token) {
+			claims, ok := cfg.authenticateJWT(w, r)
+			if !ok {
+				return
+			}
+			if claims.Scopes != nil && !auth.HasScope(claims.Scopes, scope) {
+				utils.ResponseWithError(w, r, 403, "This token doesn't have the \""+string(scope)+"\" scope.", "jwt without the required scope "+string(scope), claims.ID)
+				return
+			}
+			next.ServeHTTP(w, withClaims(r, claims))
 			return
 		}
 
-		id, err := auth.ValidateJWT(token, cfg.jwtSecret)
+		apiToken, err := cfg.db.UseAPIToken(r.Context(), auth.HashToken(token))
 		if err != nil {
-			utils.ResponseWithError(w, 401, "You're not logged in.", "failed to validate token", err)
+			utils.ResponseWithError(w, r, 401, "You're not logged in.", "failed to find live api token", err)
+			return
+		}
+		scopes := make([]auth.Scope, len(apiToken.Scopes))
+		for i, tokenScope := range apiToken.Scopes {
+			scopes[i] = auth.Scope(tokenScope)
+		}
+		if !auth.HasScope(scopes, scope) {
+			utils.ResponseWithError(w, r, 403, "This token doesn't have the \""+string(scope)+"\" scope.", "api token without the required scope "+string(scope), apiToken.ID)
+			return
+		}
+		logging.SetUserID(r.Context(), apiToken.UserID.String())
+		ctx := context.WithValue(r.Context(), "id", apiToken.UserID)
+		ctx = context.WithValue(ctx, "scopes", scopes)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Middleware function for public routes, requests without credentials go
+// through as they are but the ones with credentials must pass RequireScope.
+func (cfg *ApiConfig) OptionalScope(scope auth.Scope, next http.HandlerFunc) http.Handler {
+	requireScope := cfg.RequireScope(scope, next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			next.ServeHTTP(w, r)
 			return
 		}
-		// adding the parsed id from the jwt to the Context so that it can be accessed by the HandleFunc's
-		// This is a shallow copy of request so it only changes r.Context
-		r = r.WithContext(context.WithValue(r.Context(), "id", id))
-		next.ServeHTTP(w, r)
+		requireScope.ServeHTTP(w, r)
 	})
 }
@@ -0,0 +1,219 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/api"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/auth"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/database"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/logging"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/oauth"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/utils"
+)
+
+// POST /api/oauth/clients
+//
+// Registers a third-party app owned by the user. Apps that can't keep a
+// secret, like mobile ones, are registered with "public" and only use PKCE.
+func (cfg *ApiConfig) PostOAuthClientsHandler(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Name         string   `json:"name"`
+		RedirectURIs []string `json:"redirect_uris"`
+		Scopes       []string `json:"scopes"`
+		Public       bool     `json:"public"`
+	}
+
+	idVal := r.Context().Value("id")
+	id, ok := idVal.(uuid.UUID)
+	if !ok {
+		utils.ResponseWithError(w, r, 401, "You're not logged in.", "failed to get id from middleware", r.Context().Value("id"))
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to decode params", err)
+		return
+	}
+	params.Name = strings.TrimSpace(params.Name)
+	if params.Name == "" || len(params.Name) > 50 {
+		utils.ResponseWithError(w, r, 400, "The \"name\" must have between 1 and 50 characters", "invalid oauth client name", params.Name)
+		return
+	}
+	if len(params.RedirectURIs) == 0 {
+		utils.ResponseWithError(w, r, 400, "At least one \"redirect_uris\" is needed", "oauth client without redirect uris", params.Name)
+		return
+	}
+	for _, redirectURI := range params.RedirectURIs {
+		if err := validateRedirectURI(redirectURI); err != nil {
+			utils.ResponseWithError(w, r, 400, "Invalid \"redirect_uris\": "+err.Error(), "invalid oauth redirect uri", redirectURI)
+			return
+		}
+	}
+	scopes, err := auth.ParseScopes(params.Scopes)
+	if err != nil {
+		utils.ResponseWithError(w, r, 400, "Invalid \"scopes\", use chirps:write, chirps:read or profile:write", "invalid oauth client scopes", err)
+		return
+	}
+
+	clientID, secret, err := oauth.NewClientCredentials()
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to make oauth client credentials", err)
+		return
+	}
+	secretHash := sql.NullString{String: auth.HashToken(secret), Valid: true}
+	if params.Public {
+		secret = ""
+		secretHash = sql.NullString{}
+	}
+	scopeStrings := make([]string, len(scopes))
+	for i, scope := range scopes {
+		scopeStrings[i] = string(scope)
+	}
+	client, err := cfg.db.CreateOAuthClient(r.Context(), database.CreateOAuthClientParams{
+		ID:           clientID,
+		UserID:       id,
+		Name:         params.Name,
+		SecretHash:   secretHash,
+		RedirectUris: params.RedirectURIs,
+		Scopes:       scopeStrings,
+	})
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to create oauth client", err)
+		return
+	}
+	logging.LogInfoContext(r.Context(), "oauth client registered", "client_id", client.ID)
+
+	utils.ResponseWithJson(w, 201, api.NewCreatedOAuthClient(client, secret))
+}
+
+// GET /api/oauth/clients
+func (cfg *ApiConfig) GetOAuthClientsHandler(w http.ResponseWriter, r *http.Request) {
+	idVal := r.Context().Value("id")
+	id, ok := idVal.(uuid.UUID)
+	if !ok {
+		utils.ResponseWithError(w, r, 401, "You're not logged in.", "failed to get id from middleware", r.Context().Value("id"))
+		return
+	}
+
+	clients, err := cfg.db.GetOAuthClientsFromUser(r.Context(), id)
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to retrieve oauth clients", err)
+		return
+	}
+
+	utils.ResponseWithJson(w, 200, api.NewOAuthClients(clients))
+}
+
+// DELETE /api/oauth/clients/{clientID}
+//
+// Deleting a client deletes its refresh tokens and denies the access tokens
+// it already has, so a compromised client is cut off right away.
+func (cfg *ApiConfig) DeleteOAuthClientsHandler(w http.ResponseWriter, r *http.Request) {
+	idVal := r.Context().Value("id")
+	id, ok := idVal.(uuid.UUID)
+	if !ok {
+		utils.ResponseWithError(w, r, 401, "You're not logged in.", "failed to get id from middleware", r.Context().Value("id"))
+		return
+	}
+
+	var deniedTokens []database.DenyAllAccessTokensFromClientRow
+	err := cfg.inTx(r.Context(), func(db *database.Queries) error {
+		var err error
+		// before the delete, it cascades to the access tokens we need to deny
+		deniedTokens, err = db.DenyAllAccessTokensFromClient(r.Context(), database.DenyAllAccessTokensFromClientParams{
+			ID:     r.PathValue("clientID"),
+			UserID: id,
+		})
+		if err != nil {
+			return err
+		}
+		deleted, err := db.DeleteOAuthClient(r.Context(), database.DeleteOAuthClientParams{
+			ID:     r.PathValue("clientID"),
+			UserID: id,
+		})
+		if err != nil {
+			return err
+		}
+		if deleted == 0 {
+			return errOAuthClientNotFound
+		}
+		return nil
+	})
+	if errors.Is(err, errOAuthClientNotFound) {
+		utils.ResponseWithError(w, r, 404, "This client was deleted or don't exist", "oauth client not found", r.PathValue("clientID"))
+		return
+	}
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to delete oauth client", err)
+		return
+	}
+	for _, deniedToken := range deniedTokens {
+		cfg.denylist.Deny(deniedToken.Jti, deniedToken.ExpiresAt)
+	}
+
+	w.WriteHeader(204)
+}
+
+var errOAuthClientNotFound = errors.New("oauth client not found")
+
+// Redirect URIs must be absolute, without a fragment and on https, plain
+// http is only allowed for loopback addresses used by desktop apps.
+func validateRedirectURI(redirectURI string) error {
+	parsed, err := url.Parse(redirectURI)
+	if err != nil || !parsed.IsAbs() || parsed.Host == "" {
+		return fmt.Errorf("%q must be an absolute URL", redirectURI)
+	}
+	if parsed.Fragment != "" {
+		return fmt.Errorf("%q can't have a fragment", redirectURI)
+	}
+	loopback := parsed.Hostname() == "localhost" || parsed.Hostname() == "127.0.0.1" || parsed.Hostname() == "::1"
+	if parsed.Scheme != "https" && !(parsed.Scheme == "http" && loopback) {
+		return fmt.Errorf("%q must use https", redirectURI)
+	}
+	return nil
+}
+
+// Authenticate the user on the OAuth consent screen with the same checks as
+// the login: throttling, suspension and the second factor when it's on.
+func (cfg *ApiConfig) authenticateConsent(r *http.Request) (uuid.UUID, error) {
+	email := r.PostForm.Get("email")
+	throttleKeys := []string{accountThrottleKey(email), ipThrottleKey(r)}
+	retryAfter, err := cfg.throttler.Check(r.Context(), throttleKeys...)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if retryAfter > 0 {
+		return uuid.Nil, fmt.Errorf("throttled for %s", retryAfter)
+	}
+
+	user, err := cfg.db.GetUserByEmail(r.Context(), email)
+	if err == nil {
+		err = auth.CheckPasswordHash(r.PostForm.Get("password"), user.HashedPassword)
+	}
+	if err == nil && user.TotpEnabledAt.Valid {
+		err = cfg.verifySecondFactor(r.Context(), user, r.PostForm.Get("code"), "")
+	}
+	if err != nil {
+		if _, throttleErr := cfg.throttler.Fail(r.Context(), throttleKeys...); throttleErr != nil {
+			logging.LogErrorContext(r.Context(), "failed to record throttle failure", "err", throttleErr)
+		}
+		return uuid.Nil, err
+	}
+	if err := cfg.throttler.Reset(r.Context(), throttleKeys[0]); err != nil {
+		logging.LogErrorContext(r.Context(), "failed to reset login throttle", "err", err)
+	}
+
+	if user.SuspendedAt.Valid || user.DeletedAt.Valid {
+		return uuid.Nil, fmt.Errorf("user %s is suspended or deleted", user.ID)
+	}
+	return user.ID, nil
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+)
+
+// A deleted client must be cut off right away, not when its tokens expire.
+func TestDeleteOAuthClientDeniesAccessTokens(t *testing.T) {
+	cfg, mock, _ := newTestConfig(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery("DenyAllAccessTokensFromClient").WillReturnRows(sqlmock.NewRows([]string{"jti", "expires_at"}).
+		AddRow("jti-1", time.Now().Add(time.Hour)))
+	mock.ExpectExec("DeleteOAuthClient").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	r := httptest.NewRequest("DELETE", "/api/oauth/clients/client-1", nil)
+	r.SetPathValue("clientID", "client-1")
+	r = r.WithContext(context.WithValue(r.Context(), "id", uuid.New()))
+	w := httptest.NewRecorder()
+	cfg.DeleteOAuthClientsHandler(w, r)
+
+	if w.Code != 204 {
+		t.Errorf("expected 204, got %d %s", w.Code, w.Body)
+	}
+	checkQueries(t, mock)
+	if denied, _ := cfg.denylist.IsDenied(context.Background(), "jti-1"); !denied {
+		t.Errorf("expected the client access token to be denied")
+	}
+}
+
+func TestDeleteOAuthClientNotFound(t *testing.T) {
+	cfg, mock, _ := newTestConfig(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery("DenyAllAccessTokensFromClient").WillReturnRows(sqlmock.NewRows([]string{"jti", "expires_at"}))
+	mock.ExpectExec("DeleteOAuthClient").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	r := httptest.NewRequest("DELETE", "/api/oauth/clients/client-1", nil)
+	r.SetPathValue("clientID", "client-1")
+	r = r.WithContext(context.WithValue(r.Context(), "id", uuid.New()))
+	w := httptest.NewRecorder()
+	cfg.DeleteOAuthClientsHandler(w, r)
+
+	if w.Code != 404 {
+		t.Errorf("expected 404, got %d %s", w.Code, w.Body)
+	}
+	checkQueries(t, mock)
+}
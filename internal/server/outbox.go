@@ -0,0 +1,53 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/database"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/logging"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/outbox"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/tracing"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/webhook"
+)
+
+// Run "fn" with the (traced) queries of a transaction, committing it when
+// "fn" succeeds and rolling it back otherwise.
+func (cfg *ApiConfig) inTx(ctx context.Context, fn func(db *database.Queries) error) error {
+	tx, err := cfg.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	if err := fn(database.New(tracing.WrapDB(tx))); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Sink queueing the outbox events users can get on their webhook endpoints,
+// the outbox event id is the webhook event id so republishing it doesn't
+// send it twice.
+func webhookSink(dispatcher *webhook.Dispatcher) outbox.Sink {
+	return outbox.SinkFunc(func(ctx context.Context, event outbox.Event) error {
+		if !slices.Contains(webhook.Events, event.Type) {
+			return nil
+		}
+		return dispatcher.PublishEvent(ctx, webhook.Event{
+			ID:        event.ID,
+			Type:      event.Type,
+			CreatedAt: event.CreatedAt,
+			UserID:    event.UserID,
+			Data:      event.Payload,
+		})
+	})
+}
+
+// Handlers in this process reacting to the outbox events.
+func (cfg *ApiConfig) subscribeEvents(bus *outbox.Bus) {
+	bus.Subscribe(outbox.AllEvents, func(ctx context.Context, event outbox.Event) error {
+		logging.LogInfo("event published", "event_type", event.Type, "event_id", event.ID)
+		return nil
+	})
+}
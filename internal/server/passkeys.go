@@ -0,0 +1,377 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/api"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/database"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/logging"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/mailer"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/passkey"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/utils"
+)
+
+// POST /api/passkeys/begin
+//
+// Starts registering a passkey, the browser answer is sent to
+// POST /api/passkeys. A passkey logs in on its own, so adding one asks for
+// the current password and, with 2FA on, a code, the registration session
+// then carries that to POST /api/passkeys.
+func (cfg *ApiConfig) PasskeyRegistrationBeginHandler(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		CurrentPassword string `json:"current_password"`
+		Code            string `json:"code"`
+		RecoveryCode    string `json:"recovery_code"`
+	}
+
+	idVal := r.Context().Value("id")
+	id, ok := idVal.(uuid.UUID)
+	if !ok {
+		utils.ResponseWithError(w, r, 401, "You're not logged in.", "failed to get id from middleware", r.Context().Value("id"))
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to decode params", err)
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), id)
+	if err != nil {
+		utils.ResponseWithError(w, r, 404, "This user was deleted or don't exist", "failed to retrieve user", err)
+		return
+	}
+	if !cfg.confirmPassword(w, r, user, params.CurrentPassword) {
+		return
+	}
+	if !cfg.confirmSecondFactor(w, r, user, params.Code, params.RecoveryCode) {
+		return
+	}
+	passkeyUser, err := cfg.passkeyUser(r.Context(), user)
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to retrieve user passkeys", err)
+		return
+	}
+
+	creation, session, err := cfg.passkeys.BeginRegistration(passkeyUser)
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to begin passkey registration", err)
+		return
+	}
+	sessionID, err := cfg.createWebAuthnSession(r.Context(), uuid.NullUUID{UUID: id, Valid: true}, session)
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to create webauthn session", err)
+		return
+	}
+
+	utils.ResponseWithJson(w, 200, api.NewPasskeyChallenge(sessionID, creation))
+}
+
+// POST /api/passkeys
+func (cfg *ApiConfig) PostPasskeysHandler(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		SessionID  uuid.UUID       `json:"session_id"`
+		Name       string          `json:"name"`
+		Credential json.RawMessage `json:"credential"`
+	}
+
+	idVal := r.Context().Value("id")
+	id, ok := idVal.(uuid.UUID)
+	if !ok {
+		utils.ResponseWithError(w, r, 401, "You're not logged in.", "failed to get id from middleware", r.Context().Value("id"))
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to decode params", err)
+		return
+	}
+	params.Name = strings.TrimSpace(params.Name)
+	if params.Name == "" {
+		params.Name = "Passkey"
+	}
+	if len(params.Name) > 50 {
+		utils.ResponseWithError(w, r, 400, "The \"name\" must have between 1 and 50 characters", "invalid passkey name", params.Name)
+		return
+	}
+
+	session, err := cfg.useWebAuthnSession(r.Context(), params.SessionID)
+	if err != nil || session.UserID.UUID != id {
+		utils.ResponseWithError(w, r, 400, "Your passkey registration expired, try again.", "invalid passkey registration session", err)
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), id)
+	if err != nil {
+		utils.ResponseWithError(w, r, 404, "This user was deleted or don't exist", "failed to retrieve user", err)
+		return
+	}
+	passkeyUser, err := cfg.passkeyUser(r.Context(), user)
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to retrieve user passkeys", err)
+		return
+	}
+	credential, err := cfg.passkeys.FinishRegistration(passkeyUser, session.Data, params.Credential)
+	if err != nil {
+		utils.ResponseWithError(w, r, 400, "The passkey couldn't be verified", "failed to finish passkey registration", err)
+		return
+	}
+
+	transports := make([]string, len(credential.Transport))
+	for i, transport := range credential.Transport {
+		transports[i] = string(transport)
+	}
+	created, err := cfg.db.CreatePasskey(r.Context(), database.CreatePasskeyParams{
+		ID:              credential.ID,
+		UserID:          id,
+		Name:            params.Name,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		Aaguid:          credential.Authenticator.AAGUID,
+		SignCount:       int64(credential.Authenticator.SignCount),
+		Transports:      transports,
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+	})
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			utils.ResponseWithError(w, r, 409, "This passkey is already registered", "passkey already registered", err)
+			return
+		}
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to create passkey", err)
+		return
+	}
+	logging.LogInfoContext(r.Context(), "passkey registered", "passkey_id", base64.RawURLEncoding.EncodeToString(created.ID), "user_id", id)
+	go cfg.sendPasskeyAddedEmail(context.WithoutCancel(r.Context()), user, created.Name)
+
+	utils.ResponseWithJson(w, 201, api.NewPasskey(created))
+}
+
+// Let the user know a passkey was added to their account, in case it wasn't
+// them. Failures are only logged, the request was answered already.
+func (cfg *ApiConfig) sendPasskeyAddedEmail(ctx context.Context, user database.User, name string) {
+	err := cfg.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "A passkey was added to your Chirpy account",
+		Body: fmt.Sprintf(
+			"The passkey %q was added to your Chirpy account, it can be used to log in.\n\n"+
+				"If it wasn't you, change your password and remove the passkey from your settings.\n",
+			name,
+		),
+	})
+	if err != nil {
+		logging.LogErrorContext(ctx, "failed to send passkey added email", "err", err, "user_id", user.ID)
+	}
+}
+
+// GET /api/passkeys
+func (cfg *ApiConfig) GetPasskeysHandler(w http.ResponseWriter, r *http.Request) {
+	idVal := r.Context().Value("id")
+	id, ok := idVal.(uuid.UUID)
+	if !ok {
+		utils.ResponseWithError(w, r, 401, "You're not logged in.", "failed to get id from middleware", r.Context().Value("id"))
+		return
+	}
+
+	passkeys, err := cfg.db.GetPasskeysFromUser(r.Context(), id)
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to retrieve passkeys", err)
+		return
+	}
+
+	utils.ResponseWithJson(w, 200, api.NewPasskeys(passkeys))
+}
+
+// DELETE /api/passkeys/{passkeyID}
+func (cfg *ApiConfig) DeletePasskeysHandler(w http.ResponseWriter, r *http.Request) {
+	idVal := r.Context().Value("id")
+	id, ok := idVal.(uuid.UUID)
+	if !ok {
+		utils.ResponseWithError(w, r, 401, "You're not logged in.", "failed to get id from middleware", r.Context().Value("id"))
+		return
+	}
+	passkeyID, err := base64.RawURLEncoding.DecodeString(r.PathValue("passkeyID"))
+	if err != nil {
+		utils.ResponseWithError(w, r, 400, "Invalid \"passkeyID\" path parameter", "failed to decode passkey id", err)
+		return
+	}
+
+	deleted, err := cfg.db.DeletePasskey(r.Context(), database.DeletePasskeyParams{
+		ID:     passkeyID,
+		UserID: id,
+	})
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to delete passkey", err)
+		return
+	}
+	if deleted == 0 {
+		utils.ResponseWithError(w, r, 404, "Passkey not found", "passkey not found", r.PathValue("passkeyID"))
+		return
+	}
+	logging.LogInfoContext(r.Context(), "passkey deleted", "passkey_id", base64.RawURLEncoding.EncodeToString(passkeyID), "user_id", id)
+
+	w.WriteHeader(204)
+}
+
+// POST /api/login/passkey/begin
+//
+// Starts a passwordless login, the browser answer is sent to
+// POST /api/login/passkey.
+func (cfg *ApiConfig) PasskeyLoginBeginHandler(w http.ResponseWriter, r *http.Request) {
+	assertion, session, err := cfg.passkeys.BeginLogin()
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to begin passkey login", err)
+		return
+	}
+	sessionID, err := cfg.createWebAuthnSession(r.Context(), uuid.NullUUID{}, session)
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to create webauthn session", err)
+		return
+	}
+
+	utils.ResponseWithJson(w, 200, api.NewPasskeyChallenge(sessionID, assertion))
+}
+
+// POST /api/login/passkey
+//
+// Answers like POST /api/login. The passkey checked the user (PIN or
+// biometrics) so 2FA isn't asked for.
+func (cfg *ApiConfig) PasskeyLoginHandler(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		SessionID  uuid.UUID       `json:"session_id"`
+		Credential json.RawMessage `json:"credential"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to decode params", err)
+		return
+	}
+
+	throttleKeys := []string{ipThrottleKey(r)}
+	if !cfg.checkThrottle(w, r, throttleKeys) {
+		return
+	}
+
+	session, err := cfg.useWebAuthnSession(r.Context(), params.SessionID)
+	if err != nil || session.UserID.Valid {
+		utils.ResponseWithError(w, r, 400, "Your login expired, try again.", "invalid passkey login session", err)
+		return
+	}
+
+	var user database.User
+	_, credential, err := cfg.passkeys.FinishLogin(session.Data, params.Credential, func(userID uuid.UUID) (passkey.User, error) {
+		found, err := cfg.db.GetUserByID(r.Context(), userID)
+		if err != nil {
+			return passkey.User{}, err
+		}
+		user = found
+		return cfg.passkeyUser(r.Context(), user)
+	})
+	if errors.Is(err, passkey.ErrClonedAuthenticator) {
+		logging.LogWarnContext(r.Context(), "passkey sign counter went backwards, it may be cloned", "user_id", user.ID)
+		cfg.failThrottled(w, r, throttleKeys, "This passkey can't be used, log in another way", "cloned passkey", err)
+		return
+	}
+	if err != nil {
+		cfg.failThrottled(w, r, throttleKeys, "The passkey couldn't be verified", "failed to finish passkey login", err)
+		return
+	}
+
+	err = cfg.db.UsePasskey(r.Context(), database.UsePasskeyParams{
+		ID:          credential.ID,
+		SignCount:   int64(credential.Authenticator.SignCount),
+		BackupState: credential.Flags.BackupState,
+	})
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to update passkey", err)
+		return
+	}
+
+	if user.SuspendedAt.Valid {
+		utils.ResponseWithError(w, r, 403, "This account is suspended", "suspended user tried to login", user.ID)
+		return
+	}
+
+	cfg.respondWithSession(w, r, user)
+}
+
+// Keep the webauthn "session" until the ceremony finishes, "userID" is only
+// set on registrations. Expired sessions are cleaned up on the way.
+func (cfg *ApiConfig) createWebAuthnSession(ctx context.Context, userID uuid.NullUUID, session []byte) (uuid.UUID, error) {
+	if err := cfg.db.DeleteExpiredWebAuthnSessions(ctx); err != nil {
+		logging.LogErrorContext(ctx, "failed to delete expired webauthn sessions", "err", err)
+	}
+	return cfg.db.CreateWebAuthnSession(ctx, database.CreateWebAuthnSessionParams{
+		UserID:    userID,
+		Data:      session,
+		ExpiresAt: time.Now().Add(passkey.Timeout),
+	})
+}
+
+var errWebAuthnSessionExpired = errors.New("webauthn session expired")
+
+// Get and delete the webauthn session, a session can only be used once.
+func (cfg *ApiConfig) useWebAuthnSession(ctx context.Context, sessionID uuid.UUID) (database.WebauthnSession, error) {
+	session, err := cfg.db.UseWebAuthnSession(ctx, sessionID)
+	if err != nil {
+		return database.WebauthnSession{}, err
+	}
+	if session.ExpiresAt.Before(time.Now()) {
+		return database.WebauthnSession{}, errWebAuthnSessionExpired
+	}
+	return session, nil
+}
+
+// The user with its stored passkeys as WebAuthn credentials.
+func (cfg *ApiConfig) passkeyUser(ctx context.Context, user database.User) (passkey.User, error) {
+	passkeys, err := cfg.db.GetPasskeysFromUser(ctx, user.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return passkey.User{}, err
+	}
+	credentials := make([]webauthn.Credential, len(passkeys))
+	for i, p := range passkeys {
+		transports := make([]protocol.AuthenticatorTransport, len(p.Transports))
+		for j, transport := range p.Transports {
+			transports[j] = protocol.AuthenticatorTransport(transport)
+		}
+		credentials[i] = webauthn.Credential{
+			ID:              p.ID,
+			PublicKey:       p.PublicKey,
+			AttestationType: p.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				BackupEligible: p.BackupEligible,
+				BackupState:    p.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:    p.Aaguid,
+				SignCount: uint32(p.SignCount),
+			},
+		}
+	}
+	return passkey.User{
+		ID:          user.ID,
+		Name:        user.Email,
+		DisplayName: user.DisplayName,
+		Credentials: credentials,
+	}, nil
+}
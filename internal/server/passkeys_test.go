@@ -0,0 +1,47 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/auth"
+)
+
+// A stolen access token must not be enough to add a passkey.
+func TestPasskeyRegistrationBeginConfirms(t *testing.T) {
+	hash, err := auth.HashPassword("correct horse battery")
+	if err != nil {
+		t.Fatalf("failed to hash password: %s", err)
+	}
+	tests := []struct {
+		name string
+		body string
+		totp bool
+	}{
+		{"wrong password", `{"current_password": "wrong"}`, false},
+		{"without code", `{"current_password": "correct horse battery"}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mock, _ := newTestConfig(t)
+			user := newTestUser()
+			user.HashedPassword = hash
+			user.TotpEnabledAt = sql.NullTime{Time: time.Now(), Valid: tt.totp}
+			mock.ExpectQuery("GetUserByID").WillReturnRows(userRows(user))
+
+			r := httptest.NewRequest("POST", "/api/passkeys/begin", strings.NewReader(tt.body))
+			r = r.WithContext(context.WithValue(r.Context(), "id", user.ID))
+			w := httptest.NewRecorder()
+			cfg.PasskeyRegistrationBeginHandler(w, r)
+
+			if w.Code != 401 {
+				t.Errorf("expected 401, got %d %s", w.Code, w.Body)
+			}
+			checkQueries(t, mock)
+		})
+	}
+}
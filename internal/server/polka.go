@@ -1,50 +1,213 @@
 package server
 
 import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/luigiMinardi/bootdotdev-chirpy/internal/auth"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/database"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/logging"
 	"github.com/luigiMinardi/bootdotdev-chirpy/internal/utils"
 )
 
+// biggest webhook body read, Polka events are tiny
+const polkaMaxBodyBytes = 1 << 20
+
+// source of the webhook events sent by Polka
+const webhookSourcePolka = "polka"
+
+// outcomes of a webhook event, see the webhook_events table
+const (
+	webhookStatusReceived  = "received"
+	webhookStatusProcessed = "processed"
+	webhookStatusIgnored   = "ignored"
+	webhookStatusFailed    = "failed"
+)
+
+type polkaEvent struct {
+	// the same on every retry of the event
+	ID    string `json:"id"`
+	Event string `json:"event"`
+	Data  struct {
+		UserID uuid.UUID `json:"user_id"`
+		// optional, the subscription plan and when the paid period ends
+		Plan             string     `json:"plan"`
+		CurrentPeriodEnd *time.Time `json:"current_period_end"`
+	} `json:"data"`
+}
+
+var (
+	errWebhookUserNotFound = errors.New("webhook event user not found")
+	errWebhookIgnored      = errors.New("webhook event type not handled")
+	errWebhookEventClaimed = errors.New("webhook event processed by a concurrent delivery or replay")
+)
+
 // POST /api/polka/webhooks
+//
+// Every event is recorded before being processed, Polka retries until it
+// gets a 2xx so a retry of an event already processed is answered without
+// processing it again.
 func (cfg *ApiConfig) PolkaWebhookHandler(w http.ResponseWriter, r *http.Request) {
-	type parameters struct {
-		Event string `json:"event"`
-		Data  struct {
-			UserID uuid.UUID `json:"user_id"`
-		} `json:"data"`
-	}
-	apiKey, err := auth.GetAPIKey(r.Header)
+	// the signature is over the raw body, so it's read before decoding
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, polkaMaxBodyBytes))
 	if err != nil {
-		utils.ResponseWithError(w, 401, "You are not authenticated", "failed to get api key", err)
+		utils.ResponseWithError(w, r, 400, "Invalid body", "failed to read polka webhook body", err)
 		return
 	}
-
-	if apiKey != cfg.polkaKey {
-		utils.ResponseWithError(w, 401, "You are not authenticated", "POST /api/polka/webhooks failed to validate api key", err)
+	if err := cfg.authenticatePolka(r.Header, body); err != nil {
+		utils.ResponseWithError(w, r, 401, "You are not authenticated", "failed to authenticate polka webhook", err)
 		return
 	}
 
-	decoder := json.NewDecoder(r.Body)
-	params := parameters{}
-	if err := decoder.Decode(&params); err != nil {
-		utils.ResponseWithError(w, 500, "Something went wrong", "failed to decode params", err)
+	params := polkaEvent{}
+	if err := json.Unmarshal(body, &params); err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to decode params", err)
 		return
 	}
+	eventID := params.ID
+	if eventID == "" {
+		// deliveries without an id are deduped by their content
+		sum := sha256.Sum256(body)
+		eventID = "sha256:" + hex.EncodeToString(sum[:])
+	}
 
-	if params.Event != "user.upgraded" {
+	event, err := cfg.db.RecordWebhookEvent(r.Context(), database.RecordWebhookEventParams{
+		Source:    webhookSourcePolka,
+		EventID:   eventID,
+		EventType: params.Event,
+		Payload:   body,
+	})
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to record webhook event", err)
+		return
+	}
+	if event.Status == webhookStatusProcessed || event.Status == webhookStatusIgnored {
+		logging.LogInfoContext(r.Context(), "webhook event already processed", "event_id", event.EventID)
 		w.WriteHeader(204)
 		return
 	}
 
-	_, err = cfg.db.UpgradeUserToChirpyRedByID(r.Context(), params.Data.UserID)
+	_, err = cfg.processWebhookEvent(r.Context(), event)
+	if errors.Is(err, errWebhookEventClaimed) {
+		logging.LogInfoContext(r.Context(), "webhook event already processed", "event_id", event.EventID)
+		w.WriteHeader(204)
+		return
+	}
+	if errors.Is(err, errWebhookUserNotFound) {
+		utils.ResponseWithError(w, r, 404, "This user was deleted or don't exist", "failed to retrieve user", err)
+		return
+	}
+	if errors.Is(err, errWebhookSubscriptionNotFound) {
+		utils.ResponseWithError(w, r, 404, "This user has no subscription", "failed to retrieve subscription", err)
+		return
+	}
 	if err != nil {
-		utils.ResponseWithError(w, 404, "This user was deleted or don't exist", "failed to retrieve user", err)
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to process webhook event", err)
 		return
 	}
 
 	w.WriteHeader(204)
 }
+
+// Process a recorded webhook event and store its outcome, the returned error
+// is why it failed. The event is claimed, the change, its outbox events and
+// the outcome are stored in one transaction, a failed event only stores the
+// failure. It's [errWebhookEventClaimed] when a concurrent delivery or replay
+// processed it, so it isn't applied twice.
+func (cfg *ApiConfig) processWebhookEvent(ctx context.Context, event database.WebhookEvent) (database.WebhookEvent, error) {
+	var finished database.WebhookEvent
+	err := cfg.inTx(ctx, func(db *database.Queries) error {
+		_, err := db.ClaimWebhookEvent(ctx, event.ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return errWebhookEventClaimed
+		}
+		if err != nil {
+			return fmt.Errorf("failed to claim webhook event: %w", err)
+		}
+
+		switch event.Source {
+		case webhookSourcePolka:
+			params := polkaEvent{}
+			if err = json.Unmarshal(event.Payload, &params); err == nil {
+				err = cfg.applyPolkaEvent(ctx, db, params)
+			}
+		default:
+			err = fmt.Errorf("unknown webhook source %q", event.Source)
+		}
+
+		finish := database.FinishWebhookEventParams{ID: event.ID, Status: webhookStatusProcessed}
+		if errors.Is(err, errWebhookIgnored) {
+			finish.Status = webhookStatusIgnored
+		} else if err != nil {
+			return err
+		}
+		finished, err = db.FinishWebhookEvent(ctx, finish)
+		if err != nil {
+			return fmt.Errorf("failed to store webhook event outcome: %w", err)
+		}
+		return nil
+	})
+	if err == nil {
+		cfg.metrics.WebhookEvents.WithLabelValues(event.Source, finished.Status).Inc()
+		return finished, nil
+	}
+	if errors.Is(err, errWebhookEventClaimed) {
+		return event, err
+	}
+	cfg.metrics.WebhookEvents.WithLabelValues(event.Source, webhookStatusFailed).Inc()
+
+	finished, finishErr := cfg.db.FailWebhookEvent(ctx, database.FailWebhookEventParams{
+		ID:    event.ID,
+		Error: sql.NullString{String: err.Error(), Valid: true},
+	})
+	if errors.Is(finishErr, sql.ErrNoRows) {
+		return event, errWebhookEventClaimed
+	}
+	if finishErr != nil {
+		return event, fmt.Errorf("failed to store webhook event outcome: %w", finishErr)
+	}
+	return finished, err
+}
+
+func (cfg *ApiConfig) applyPolkaEvent(ctx context.Context, db *database.Queries, event polkaEvent) error {
+	switch event.Event {
+	case "user.upgraded":
+		return cfg.startSubscription(ctx, db, event.Data.UserID, event.Data.Plan, event.Data.CurrentPeriodEnd)
+	case "subscription.renewed":
+		return cfg.renewUserSubscription(ctx, db, event.Data.UserID, event.Data.Plan, event.Data.CurrentPeriodEnd)
+	case "payment.failed":
+		return cfg.failSubscriptionPayment(ctx, db, event.Data.UserID)
+	case "user.downgraded":
+		return cfg.cancelSubscription(ctx, db, event.Data.UserID)
+	default:
+		return errWebhookIgnored
+	}
+}
+
+var errInvalidPolkaKey = errors.New("invalid polka api key")
+
+// Check the webhook signature, or the api key on the legacy POLKA_AUTH=apikey
+// mode.
+func (cfg *ApiConfig) authenticatePolka(header http.Header, body []byte) error {
+	if cfg.polkaVerifier != nil {
+		return cfg.polkaVerifier.Verify(header, body)
+	}
+	apiKey, err := auth.GetAPIKey(header)
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare([]byte(apiKey), []byte(cfg.polkaKey)) != 1 {
+		return errInvalidPolkaKey
+	}
+	return nil
+}
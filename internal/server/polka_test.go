@@ -0,0 +1,61 @@
+package server
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+)
+
+const testPolkaEvent = `{"id": "evt_1", "event": "user.unknown", "data": {"user_id": "3311741c-680c-4546-99f3-fc9efac2036c"}}`
+
+// Rows of a query returning the webhook event "id" with "status".
+func webhookEventRows(id uuid.UUID, status string) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{
+		"id", "source", "event_id", "event_type", "payload", "received_at", "processed_at", "status", "error", "attempts",
+	}).AddRow(id.String(), webhookSourcePolka, "evt_1", "user.unknown", []byte(testPolkaEvent), time.Now(), nil, status, nil, 1)
+}
+
+func postPolkaEvent(cfg *ApiConfig) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("POST", "/api/polka/webhooks", strings.NewReader(testPolkaEvent))
+	r.Header.Set("Authorization", "ApiKey "+cfg.polkaKey)
+	w := httptest.NewRecorder()
+	cfg.PolkaWebhookHandler(w, r)
+	return w
+}
+
+func TestPolkaWebhook(t *testing.T) {
+	cfg, mock, _ := newTestConfig(t)
+	cfg.polkaKey = "f271c81ff7084ee5b99a5091b42d486e"
+	id := uuid.New()
+	mock.ExpectQuery("RecordWebhookEvent").WillReturnRows(webhookEventRows(id, webhookStatusReceived))
+	mock.ExpectBegin()
+	mock.ExpectQuery("ClaimWebhookEvent").WillReturnRows(webhookEventRows(id, "processing"))
+	mock.ExpectQuery("FinishWebhookEvent").WillReturnRows(webhookEventRows(id, webhookStatusIgnored))
+	mock.ExpectCommit()
+
+	if w := postPolkaEvent(cfg); w.Code != 204 {
+		t.Errorf("expected 204, got %d %s", w.Code, w.Body)
+	}
+	checkQueries(t, mock)
+}
+
+// A retry arriving while the first delivery is processed must not apply the
+// event again.
+func TestPolkaWebhookConcurrentDelivery(t *testing.T) {
+	cfg, mock, _ := newTestConfig(t)
+	cfg.polkaKey = "f271c81ff7084ee5b99a5091b42d486e"
+	id := uuid.New()
+	mock.ExpectQuery("RecordWebhookEvent").WillReturnRows(webhookEventRows(id, webhookStatusReceived))
+	mock.ExpectBegin()
+	mock.ExpectQuery("ClaimWebhookEvent").WillReturnRows(sqlmock.NewRows(nil))
+	mock.ExpectRollback()
+
+	if w := postPolkaEvent(cfg); w.Code != 204 {
+		t.Errorf("expected 204, got %d %s", w.Code, w.Body)
+	}
+	checkQueries(t, mock)
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/api"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/database"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/utils"
+)
+
+// GET /api/users/{username}
+func (cfg *ApiConfig) GetProfileHandler(w http.ResponseWriter, r *http.Request) {
+	profile, err := cfg.db.GetUserProfileByUsername(r.Context(), r.PathValue("username"))
+	if err != nil {
+		utils.ResponseWithError(w, r, 404, "This user was deleted or don't exist", "failed to retrieve profile", err)
+		return
+	}
+
+	utils.ResponseWithJson(w, 200, api.NewProfile(profile))
+}
+
+// POST /api/users/{username}/follow
+func (cfg *ApiConfig) FollowHandler(w http.ResponseWriter, r *http.Request) {
+	idVal := r.Context().Value("id")
+	userId, ok := idVal.(uuid.UUID)
+	if !ok {
+		utils.ResponseWithError(w, r, 401, "You're not logged in.", "failed to get id from middleware", r.Context().Value("id"))
+		return
+	}
+
+	profile, err := cfg.db.GetUserProfileByUsername(r.Context(), r.PathValue("username"))
+	if err != nil {
+		utils.ResponseWithError(w, r, 404, "This user was deleted or don't exist", "failed to retrieve profile", err)
+		return
+	}
+	if profile.ID == userId {
+		utils.ResponseWithError(w, r, 400, "You can't follow yourself", "user tried to follow themselves", userId)
+		return
+	}
+
+	err = cfg.db.CreateFollow(r.Context(), database.CreateFollowParams{
+		FollowerID: userId,
+		FolloweeID: profile.ID,
+	})
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to create follow", err)
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
+// DELETE /api/users/{username}/follow
+func (cfg *ApiConfig) UnfollowHandler(w http.ResponseWriter, r *http.Request) {
+	idVal := r.Context().Value("id")
+	userId, ok := idVal.(uuid.UUID)
+	if !ok {
+		utils.ResponseWithError(w, r, 401, "You're not logged in.", "failed to get id from middleware", r.Context().Value("id"))
+		return
+	}
+
+	profile, err := cfg.db.GetUserProfileByUsername(r.Context(), r.PathValue("username"))
+	if err != nil {
+		utils.ResponseWithError(w, r, 404, "This user was deleted or don't exist", "failed to retrieve profile", err)
+		return
+	}
+
+	err = cfg.db.DeleteFollow(r.Context(), database.DeleteFollowParams{
+		FollowerID: userId,
+		FolloweeID: profile.ID,
+	})
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to delete follow", err)
+		return
+	}
+
+	w.WriteHeader(204)
+}
@@ -1,95 +1,235 @@
 package server
 
 import (
+	"context"
 	"database/sql"
-	"log"
+	"encoding/base64"
 	"net/http"
 	"os"
-	"sync/atomic"
+	"time"
 
 	_ "github.com/joho/godotenv/autoload"
 	_ "github.com/lib/pq"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/auth"
 	"github.com/luigiMinardi/bootdotdev-chirpy/internal/database"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/entitlements"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/httpx"
 	"github.com/luigiMinardi/bootdotdev-chirpy/internal/logging"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/mailer"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/metrics"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/oauth"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/outbox"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/passkey"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/sso"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/throttle"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/tracing"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/webhook"
 )
 
 // struct that holds api data like metrics environments, db etc.
 type ApiConfig struct {
-	// metric that counts how many times all endpoints that use it have been hit
-	fileServerHits atomic.Int32
+	// Prometheus metrics of every route, the database and the business
+	metrics *metrics.Metrics
+	// bearer token Prometheus scrapes /metrics with
+	metricsToken string
 	// if you're in prod or dev environment
 	platform string
 	// data base
 	db *database.Queries
+	// connection the queries run on, used to begin transactions
+	dbConn *sql.DB
 	// jwt secret generated with "openssl rand -base64 64"
 	jwtSecret string
-	// polka key
+	// legacy polka key, only set when POLKA_AUTH is "apikey"
 	polkaKey string
+	// checks the signature of the polka webhooks, nil when POLKA_AUTH is "apikey"
+	polkaVerifier *webhook.Verifier
+	// revoked access tokens
+	denylist *auth.Denylist
+	// rules new passwords must follow
+	passwordPolicy auth.PasswordPolicy
+	// encrypts secrets stored at rest, like the TOTP ones
+	secretBox *auth.SecretBox
+	// sends the verification and password reset emails
+	mailer mailer.Mailer
+	// public URL of the app, used on the links we send by email
+	baseURL string
+	// locks accounts and IPs after too many failed logins
+	throttler *throttle.Throttler
+	// how long a deleted account is kept before being purged
+	deletionGracePeriod time.Duration
+	// how long a Chirpy Red subscription lasts when Polka doesn't say
+	subscriptionPeriod time.Duration
+	// limits of each plan, like the chirp length
+	entitlements *entitlements.Engine
+	// how long a subscription keeps the perks after its period ended or a
+	// payment failed
+	subscriptionGracePeriod time.Duration
+	// OAuth 2.0 authorization server for third-party apps
+	oauth *oauth.Provider
+	// external OpenID Connect providers users can log in with, by name
+	relyingParties map[string]*sso.RelyingParty
+	// registers passkeys and logs in with them
+	passkeys *passkey.RelyingParty
+	// queues and sends the events to the webhook endpoints users registered
+	webhooks *webhook.Dispatcher
+	// in-process subscribers of the outbox events
+	events *outbox.Bus
+	// publishes the outbox events to the bus and the webhooks
+	relay *outbox.Relay
 }
 
 func NewServer() {
+	setupLoggingFromEnv()
+	shutdownTracing := setupTracingFromEnv(context.Background())
+	defer shutdownTracing(context.Background())
 	dbURL := os.Getenv("DB_URL")
 	if dbURL == "" {
-		log.Panicf(logging.LOGERROR + "DB_URL must be set")
+		logging.Panicf("DB_URL must be set")
 	}
 	platform := os.Getenv("PLATFORM")
 	if platform == "" {
-		log.Panicf(logging.LOGERROR + "PLATFORM must be set")
+		logging.Panicf("PLATFORM must be set")
 	}
 	jwtSecret := os.Getenv("JWT_SECRET")
 	if jwtSecret == "" {
-		log.Panicf(logging.LOGERROR + "JWT_SECRET must be set")
+		logging.Panicf("JWT_SECRET must be set")
 	}
-	polkaKey := os.Getenv("POLKA_KEY")
-	if polkaKey == "" {
-		log.Panicf(logging.LOGERROR + "POLKA_KEY must be set")
+	mfaEncryptionKey, err := base64.StdEncoding.DecodeString(os.Getenv("MFA_ENCRYPTION_KEY"))
+	if err != nil {
+		logging.Panicf("MFA_ENCRYPTION_KEY must be base64, got err: %v", err)
+	}
+	secretBox, err := auth.NewSecretBox(mfaEncryptionKey)
+	if err != nil {
+		logging.Panicf("MFA_ENCRYPTION_KEY must be set with 32 bytes, got err: %v", err)
 	}
+	auth.DefaultPasswordHasher = passwordHasherFromEnv()
 	db, err := sql.Open("postgres", dbURL)
 	if err != nil {
-		log.Panicf(logging.LOGERROR+"db connection failed with err: %v", err)
+		logging.Panicf("db connection failed with err: %v", err)
 	}
-	dbQueries := database.New(db)
+	dbQueries := database.New(tracing.WrapDB(db))
 	mux := http.NewServeMux()
+	apiCfg := &ApiConfig{}
+	apiCfg.metrics = metrics.New()
+	apiCfg.metrics.RegisterDB(db, "chirpy")
+	apiCfg.metricsToken = os.Getenv("METRICS_TOKEN")
 	srv := &http.Server{
-		Handler: mux,
+		Handler: httpx.Middleware(mux, tracing.Middleware(logging.Middleware(apiCfg.metrics.Middleware(mux)))),
 		Addr:    ":8080",
 	}
-	apiCfg := &ApiConfig{}
 	apiCfg.platform = platform
 	apiCfg.db = dbQueries
+	apiCfg.dbConn = db
 	apiCfg.jwtSecret = jwtSecret
-	apiCfg.polkaKey = polkaKey
+	apiCfg.polkaKey, apiCfg.polkaVerifier = polkaAuthFromEnv()
+	apiCfg.denylist = auth.NewDenylist(dbQueries, time.Second*30)
+	apiCfg.passwordPolicy = passwordPolicyFromEnv()
+	apiCfg.secretBox = secretBox
+	apiCfg.mailer = mailerFromEnv()
+	apiCfg.baseURL = baseURLFromEnv()
+	apiCfg.throttler = throttle.New(throttleStoreFromEnv(dbQueries), throttle.DefaultPolicy)
+	apiCfg.deletionGracePeriod = time.Hour * 24 * time.Duration(envInt("ACCOUNT_DELETION_GRACE_DAYS", 30))
+	apiCfg.entitlements = entitlementsFromEnv()
+	apiCfg.subscriptionPeriod = time.Hour * 24 * time.Duration(envInt("SUBSCRIPTION_PERIOD_DAYS", 30))
+	apiCfg.subscriptionGracePeriod = time.Hour * 24 * time.Duration(envInt("SUBSCRIPTION_GRACE_DAYS", 7))
+	apiCfg.relyingParties = relyingPartiesFromEnv(apiCfg.baseURL)
+	apiCfg.passkeys, err = passkey.New("Chirpy", apiCfg.baseURL)
+	if err != nil {
+		logging.Panicf("BASE_URL must be a valid URL for passkeys, got err: %v", err)
+	}
+	apiCfg.webhooks = webhook.NewDispatcher(webhook.NewPostgresStore(dbQueries, secretBox))
+	if platform == "dev" {
+		// so endpoints on the machine of the developer can be tried
+		apiCfg.webhooks.Client = webhook.NewClient(true)
+	}
+	apiCfg.events = outbox.NewBus()
+	apiCfg.subscribeEvents(apiCfg.events)
+	apiCfg.relay = outbox.NewRelay(outbox.NewPostgresStore(dbQueries), apiCfg.events, webhookSink(apiCfg.webhooks))
+	apiCfg.oauth = oauth.NewProvider(oauth.NewPostgresStore(dbQueries), apiCfg.denylist, jwtSecret, apiCfg.authenticateConsent)
 
-	mux.Handle("/app/", apiCfg.MiddlewareMetricsInc(http.StripPrefix("/app/", http.FileServer(http.Dir(".")))))
-	mux.HandleFunc("GET /api/healthz", func(w http.ResponseWriter, r *http.Request) {
-		logging.LogInfo("method", r.Method)
+	go apiCfg.purgeLoop(context.Background(), time.Hour)
+	go apiCfg.expireSubscriptionsLoop(context.Background(), time.Hour)
+	go apiCfg.relay.Run(context.Background(), time.Second)
+	go apiCfg.webhooks.Run(context.Background(), time.Second*10)
 
+	mux.Handle("/app/", http.StripPrefix("/app/", http.FileServer(http.Dir("."))))
+	mux.HandleFunc("GET /api/healthz", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
 		w.WriteHeader(200)
 		_, err := w.Write([]byte("OK"))
 		if err != nil {
-			logging.LogError("/healthz failed to write with error", err)
+			logging.LogError("/healthz failed to write with error", "err", err)
 		}
 	})
 
-	mux.HandleFunc("GET /admin/metrics", apiCfg.endpointMetrics)
-	mux.HandleFunc("POST /admin/reset", apiCfg.endpointReset)
+	mux.HandleFunc("GET /metrics", apiCfg.endpointMetrics)
+	mux.Handle("POST /admin/reset", apiCfg.RequireRole(auth.RoleAdmin, apiCfg.endpointReset))
+	mux.Handle("POST /admin/users/{userID}/suspend", apiCfg.RequireRole(auth.RoleModerator, apiCfg.endpointSuspendUser))
+	mux.Handle("POST /admin/users/{userID}/unlock", apiCfg.RequireRole(auth.RoleModerator, apiCfg.endpointUnlockUser))
+	mux.Handle("PUT /admin/users/{userID}/role", apiCfg.RequireRole(auth.RoleAdmin, apiCfg.endpointSetUserRole))
+	mux.Handle("GET /admin/webhooks/events", apiCfg.RequireRole(auth.RoleAdmin, apiCfg.endpointWebhookEvents))
+	mux.Handle("POST /admin/webhooks/events/{eventID}/replay", apiCfg.RequireRole(auth.RoleAdmin, apiCfg.endpointReplayWebhookEvent))
 
-	mux.Handle("POST /api/chirps", apiCfg.MiddlewareValidateJWT(apiCfg.PostChirpsHandler))
-	mux.HandleFunc("GET /api/chirps", apiCfg.GetChirpsHandler)
-	mux.HandleFunc("GET /api/chirps/{chirpID}", apiCfg.GetChirpsByIdHandler)
-	mux.Handle("DELETE /api/chirps/{chirpID}", apiCfg.MiddlewareValidateJWT(apiCfg.DeleteChirpsByIdHandler))
+	mux.Handle("POST /api/chirps", apiCfg.RequireScope(auth.ScopeChirpsWrite, apiCfg.PostChirpsHandler))
+	mux.Handle("GET /api/chirps", apiCfg.OptionalScope(auth.ScopeChirpsRead, apiCfg.GetChirpsHandler))
+	mux.Handle("GET /api/chirps/{chirpID}", apiCfg.OptionalScope(auth.ScopeChirpsRead, apiCfg.GetChirpsByIdHandler))
+	mux.Handle("DELETE /api/chirps/{chirpID}", apiCfg.RequireScope(auth.ScopeChirpsWrite, apiCfg.DeleteChirpsByIdHandler))
 
 	mux.HandleFunc("POST /api/users", apiCfg.PostUsersHandler)
-	mux.Handle("PUT /api/users", apiCfg.MiddlewareValidateJWT(apiCfg.PutUsersHandler))
+	mux.HandleFunc("POST /api/users/verify", apiCfg.VerifyEmailHandler)
+	mux.Handle("POST /api/users/verify/resend", apiCfg.MiddlewareValidateJWT(apiCfg.ResendVerificationHandler))
+	mux.Handle("PUT /api/users", apiCfg.RequireScope(auth.ScopeProfileWrite, apiCfg.PutUsersHandler))
+	mux.Handle("PATCH /api/users", apiCfg.RequireScope(auth.ScopeProfileWrite, apiCfg.PutUsersHandler))
+	mux.Handle("DELETE /api/users", apiCfg.MiddlewareValidateJWT(apiCfg.DeleteUsersHandler))
+	mux.Handle("GET /api/users/export", apiCfg.MiddlewareValidateJWT(apiCfg.ExportUsersHandler))
+	mux.Handle("GET /api/users/entitlements", apiCfg.MiddlewareValidateJWT(apiCfg.GetEntitlementsHandler))
+	mux.HandleFunc("GET /api/users/{username}", apiCfg.GetProfileHandler)
+	mux.Handle("POST /api/users/{username}/follow", apiCfg.RequireScope(auth.ScopeProfileWrite, apiCfg.FollowHandler))
+	mux.Handle("DELETE /api/users/{username}/follow", apiCfg.RequireScope(auth.ScopeProfileWrite, apiCfg.UnfollowHandler))
+	mux.Handle("POST /api/users/totp", apiCfg.MiddlewareValidateJWT(apiCfg.PostTOTPHandler))
+	mux.Handle("POST /api/users/totp/confirm", apiCfg.MiddlewareValidateJWT(apiCfg.ConfirmTOTPHandler))
+	mux.Handle("DELETE /api/users/totp", apiCfg.MiddlewareValidateJWT(apiCfg.DeleteTOTPHandler))
+
+	mux.Handle("POST /api/tokens", apiCfg.MiddlewareValidateJWT(apiCfg.PostAPITokensHandler))
+	mux.Handle("GET /api/tokens", apiCfg.MiddlewareValidateJWT(apiCfg.GetAPITokensHandler))
+	mux.Handle("DELETE /api/tokens/{tokenID}", apiCfg.MiddlewareValidateJWT(apiCfg.DeleteAPITokensHandler))
+
+	mux.Handle("POST /api/passkeys/begin", apiCfg.MiddlewareValidateJWT(apiCfg.PasskeyRegistrationBeginHandler))
+	mux.Handle("POST /api/passkeys", apiCfg.MiddlewareValidateJWT(apiCfg.PostPasskeysHandler))
+	mux.Handle("GET /api/passkeys", apiCfg.MiddlewareValidateJWT(apiCfg.GetPasskeysHandler))
+	mux.Handle("DELETE /api/passkeys/{passkeyID}", apiCfg.MiddlewareValidateJWT(apiCfg.DeletePasskeysHandler))
+
+	mux.Handle("POST /api/webhooks", apiCfg.MiddlewareValidateJWT(apiCfg.PostWebhookEndpointsHandler))
+	mux.Handle("GET /api/webhooks", apiCfg.MiddlewareValidateJWT(apiCfg.GetWebhookEndpointsHandler))
+	mux.Handle("DELETE /api/webhooks/{endpointID}", apiCfg.MiddlewareValidateJWT(apiCfg.DeleteWebhookEndpointsHandler))
+	mux.Handle("GET /api/webhooks/{endpointID}/deliveries", apiCfg.MiddlewareValidateJWT(apiCfg.GetWebhookDeliveriesHandler))
+	mux.Handle("GET /api/webhooks/{endpointID}/deliveries/{deliveryID}/attempts", apiCfg.MiddlewareValidateJWT(apiCfg.GetWebhookDeliveryAttemptsHandler))
+	mux.Handle("POST /api/webhooks/{endpointID}/deliveries/{deliveryID}/retry", apiCfg.MiddlewareValidateJWT(apiCfg.RetryWebhookDeliveryHandler))
+
+	mux.Handle("POST /api/oauth/clients", apiCfg.MiddlewareValidateJWT(apiCfg.PostOAuthClientsHandler))
+	mux.Handle("GET /api/oauth/clients", apiCfg.MiddlewareValidateJWT(apiCfg.GetOAuthClientsHandler))
+	mux.Handle("DELETE /api/oauth/clients/{clientID}", apiCfg.MiddlewareValidateJWT(apiCfg.DeleteOAuthClientsHandler))
+	mux.HandleFunc("GET /oauth/authorize", apiCfg.oauth.AuthorizeHandler)
+	mux.HandleFunc("POST /oauth/authorize", apiCfg.oauth.ConsentHandler)
+	mux.HandleFunc("POST /oauth/token", apiCfg.oauth.TokenHandler)
+	mux.HandleFunc("POST /oauth/revoke", apiCfg.oauth.RevokeHandler)
 
 	mux.HandleFunc("POST /api/login", apiCfg.LoginHandler)
+	mux.HandleFunc("POST /api/login/mfa", apiCfg.LoginMFAHandler)
+	mux.HandleFunc("POST /api/login/passkey/begin", apiCfg.PasskeyLoginBeginHandler)
+	mux.HandleFunc("POST /api/login/passkey", apiCfg.PasskeyLoginHandler)
+	mux.HandleFunc("GET /api/login/oidc/{provider}", apiCfg.SSOLoginHandler)
+	mux.HandleFunc("GET /api/login/oidc/{provider}/callback", apiCfg.SSOCallbackHandler)
+	mux.Handle("POST /api/users/identities/{provider}", apiCfg.MiddlewareValidateJWT(apiCfg.LinkSSOHandler))
 	mux.HandleFunc("POST /api/refresh", apiCfg.RefreshHandler)
 	mux.HandleFunc("POST /api/revoke", apiCfg.RevokeHandler)
+	mux.HandleFunc("POST /api/password/forgot", apiCfg.ForgotPasswordHandler)
+	mux.HandleFunc("POST /api/password/reset", apiCfg.ResetPasswordHandler)
 	mux.HandleFunc("POST /api/polka/webhooks", apiCfg.PolkaWebhookHandler)
 
-	log.Printf(logging.LOGINFO+"HTTP server started on http://localhost%v\n", srv.Addr)
+	logging.LogInfo("HTTP server started", "addr", "http://localhost"+srv.Addr)
 	if err := srv.ListenAndServe(); err != nil {
-		logging.LogError("HTTP Server ListenAndServe error", err)
+		logging.LogError("HTTP Server ListenAndServe error", "err", err)
 	}
 }
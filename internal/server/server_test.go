@@ -0,0 +1,107 @@
+package server
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/auth"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/database"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/mailer"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/metrics"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/throttle"
+)
+
+// Expectations are matched by the sqlc name of the query, so
+// mock.ExpectQuery("GetUserByID") expects the GetUserByID query.
+var queryNameMatcher = sqlmock.QueryMatcherFunc(func(expected, actual string) error {
+	header, _, _ := strings.Cut(actual, "\n")
+	name, _, _ := strings.Cut(strings.TrimPrefix(header, "-- name: "), " ")
+	if name != expected {
+		return fmt.Errorf("expected query %s, got %s", expected, name)
+	}
+	return nil
+})
+
+// Config of a server whose database is "mock" and whose emails are kept in
+// memory.
+func newTestConfig(t *testing.T) (*ApiConfig, sqlmock.Sqlmock, *mailer.MemoryMailer) {
+	t.Helper()
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(queryNameMatcher))
+	if err != nil {
+		t.Fatalf("failed to make the database mock: %s", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	queries := database.New(db)
+	mail := &mailer.MemoryMailer{}
+	cfg := &ApiConfig{
+		db:             queries,
+		dbConn:         db,
+		platform:       "dev",
+		mailer:         mail,
+		baseURL:        "http://localhost:8080",
+		passwordPolicy: auth.DefaultPasswordPolicy,
+		denylist:       auth.NewDenylist(queries, time.Minute),
+		throttler:      throttle.New(throttle.NewMemoryStore(), throttle.DefaultPolicy),
+		metrics:        metrics.New(),
+	}
+	return cfg, mock, mail
+}
+
+// Fail unless every expected query ran.
+func checkQueries(t *testing.T, mock sqlmock.Sqlmock) {
+	t.Helper()
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// Wait up to a second for "done", for the work done after answering.
+func eventually(t *testing.T, done func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !done() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for the background work")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+var userColumns = []string{
+	"id", "created_at", "updated_at", "email", "hashed_password", "is_chirpy_red", "suspended_at",
+	"totp_secret", "totp_enabled_at", "totp_last_step", "email_verified_at", "deleted_at",
+	"purge_after", "username", "display_name", "bio", "avatar", "role",
+}
+
+// Rows of a query returning the "users".
+func userRows(users ...database.User) *sqlmock.Rows {
+	rows := sqlmock.NewRows(userColumns)
+	for _, user := range users {
+		rows.AddRow(
+			user.ID.String(), user.CreatedAt, user.UpdatedAt, user.Email, user.HashedPassword,
+			user.IsChirpyRed, value(user.SuspendedAt), user.TotpSecret, value(user.TotpEnabledAt),
+			value(user.TotpLastStep), value(user.EmailVerifiedAt), value(user.DeletedAt),
+			value(user.PurgeAfter), value(user.Username), user.DisplayName, user.Bio, user.Avatar,
+			user.Role,
+		)
+	}
+	return rows
+}
+
+// driver value of a nullable column
+func value(v driver.Valuer) driver.Value {
+	val, _ := v.Value()
+	return val
+}
+
+// Mailer failing every email.
+type failingMailer struct{}
+
+func (failingMailer) Send(context.Context, mailer.Message) error {
+	return fmt.Errorf("smtp is down")
+}
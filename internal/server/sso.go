@@ -0,0 +1,273 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/auth"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/database"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/logging"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/sso"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/utils"
+)
+
+// keeps the signed sso.Flow between the redirect and the callback
+const ssoFlowCookie = "chirpy_sso_flow"
+
+// GET /api/login/oidc/{provider}
+//
+// Sends the user to log in on the OpenID Connect provider.
+func (cfg *ApiConfig) SSOLoginHandler(w http.ResponseWriter, r *http.Request) {
+	relyingParty, ok := cfg.relyingParties[r.PathValue("provider")]
+	if !ok {
+		utils.ResponseWithError(w, r, 404, "Unknown login provider", "unknown oidc provider", r.PathValue("provider"))
+		return
+	}
+
+	authURL, ok := cfg.startSSOFlow(w, r, relyingParty, uuid.Nil)
+	if !ok {
+		return
+	}
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// POST /api/users/identities/{provider}
+//
+// Starts linking the provider to the account of the logged in user, the
+// client has to send the user to the returned URL with the cookie set here,
+// the callback links the identity instead of logging in.
+func (cfg *ApiConfig) LinkSSOHandler(w http.ResponseWriter, r *http.Request) {
+	type returnVals struct {
+		URL string `json:"url"`
+	}
+
+	idVal := r.Context().Value("id")
+	id, ok := idVal.(uuid.UUID)
+	if !ok {
+		utils.ResponseWithError(w, r, 401, "You're not logged in.", "failed to get id from middleware", r.Context().Value("id"))
+		return
+	}
+	relyingParty, ok := cfg.relyingParties[r.PathValue("provider")]
+	if !ok {
+		utils.ResponseWithError(w, r, 404, "Unknown login provider", "unknown oidc provider", r.PathValue("provider"))
+		return
+	}
+
+	authURL, ok := cfg.startSSOFlow(w, r, relyingParty, id)
+	if !ok {
+		return
+	}
+	utils.ResponseWithJson(w, 200, returnVals{URL: authURL})
+}
+
+// Start a login on the provider, or the linking of it to the account of
+// "linkUserID", keeping the flow on a cookie and returning the provider URL.
+// It answers the request and returns false when it fails.
+func (cfg *ApiConfig) startSSOFlow(w http.ResponseWriter, r *http.Request, relyingParty *sso.RelyingParty, linkUserID uuid.UUID) (string, bool) {
+	flow, authURL, err := relyingParty.Start()
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to start oidc login", err)
+		return "", false
+	}
+	flow.LinkUserID = linkUserID
+	sealedFlow, err := sso.SealFlow(flow, cfg.jwtSecret, time.Minute*10)
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to seal oidc flow", err)
+		return "", false
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     ssoFlowCookie,
+		Value:    sealedFlow,
+		Path:     "/api/login/oidc/",
+		MaxAge:   int((time.Minute * 10).Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(cfg.baseURL, "https://"),
+		// Lax so it's sent on the top level redirect back from the provider
+		SameSite: http.SameSiteLaxMode,
+	})
+	return authURL, true
+}
+
+// GET /api/login/oidc/{provider}/callback
+//
+// Where the provider sends the user back to, it answers like POST /api/login,
+// users with 2FA on still have to send a code to POST /api/login/mfa. When
+// the flow was started by POST /api/users/identities/{provider} it links the
+// identity instead.
+func (cfg *ApiConfig) SSOCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	relyingParty, ok := cfg.relyingParties[r.PathValue("provider")]
+	if !ok {
+		utils.ResponseWithError(w, r, 404, "Unknown login provider", "unknown oidc provider", r.PathValue("provider"))
+		return
+	}
+	if providerErr := r.URL.Query().Get("error"); providerErr != "" {
+		utils.ResponseWithError(w, r, 401, "The login was canceled or failed", "oidc provider returned error", providerErr)
+		return
+	}
+
+	cookie, err := r.Cookie(ssoFlowCookie)
+	if err != nil {
+		utils.ResponseWithError(w, r, 401, "Your login expired, try again.", "oidc callback without flow cookie", err)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     ssoFlowCookie,
+		Path:     "/api/login/oidc/",
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+	flow, err := sso.OpenFlow(cookie.Value, cfg.jwtSecret)
+	if err != nil {
+		utils.ResponseWithError(w, r, 401, "Your login expired, try again.", "invalid oidc flow cookie", err)
+		return
+	}
+
+	identity, err := relyingParty.Finish(r.Context(), flow, r.URL.Query().Get("state"), r.URL.Query().Get("code"))
+	if err != nil {
+		utils.ResponseWithError(w, r, 401, "The login failed, try again.", "failed to finish oidc login", err)
+		return
+	}
+
+	if flow.LinkUserID != uuid.Nil {
+		cfg.linkIdentity(w, r, flow.LinkUserID, identity)
+		return
+	}
+
+	user, err := cfg.userFromIdentity(r.Context(), identity)
+	if errors.Is(err, errUnverifiedIdentity) {
+		utils.ResponseWithError(w, r, 403, "Your email isn't verified by the login provider", "oidc identity without verified email", identity.Subject)
+		return
+	}
+	if errors.Is(err, errUnlinkedAccount) {
+		utils.ResponseWithError(w, r, 409, "An account with this email already exists, log in with your password and link this provider from your settings", "oidc identity matches unlinked user", identity.Subject)
+		return
+	}
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to get user of oidc identity", err)
+		return
+	}
+	if user.SuspendedAt.Valid {
+		utils.ResponseWithError(w, r, 403, "This account is suspended", "suspended user tried to login", user.ID)
+		return
+	}
+	if user.TotpEnabledAt.Valid {
+		cfg.respondWithMFAChallenge(w, r, user)
+		return
+	}
+
+	cfg.respondWithSession(w, r, user)
+}
+
+// Link the "identity" to the account of "userID", unless it's already linked
+// to another one.
+func (cfg *ApiConfig) linkIdentity(w http.ResponseWriter, r *http.Request, userID uuid.UUID, identity sso.Identity) {
+	linkedUserID, err := cfg.db.GetUserIDByIdentity(r.Context(), database.GetUserIDByIdentityParams{
+		Issuer:  identity.Issuer,
+		Subject: identity.Subject,
+	})
+	if err == nil {
+		if linkedUserID != userID {
+			utils.ResponseWithError(w, r, 409, "This login is already linked to another account", "oidc identity linked to another user", identity.Subject)
+			return
+		}
+		w.WriteHeader(204)
+		return
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to get user of oidc identity", err)
+		return
+	}
+
+	err = cfg.db.CreateUserIdentity(r.Context(), database.CreateUserIdentityParams{
+		Issuer:  identity.Issuer,
+		Subject: identity.Subject,
+		UserID:  userID,
+		Email:   identity.Email,
+	})
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to link oidc identity", err)
+		return
+	}
+	logging.LogInfoContext(r.Context(), "oidc identity linked to user", "user_id", userID)
+	w.WriteHeader(204)
+}
+
+var (
+	errUnverifiedIdentity = errors.New("identity without a verified email")
+	errUnlinkedAccount    = errors.New("identity matches an unlinked account")
+)
+
+// Find the user of the "identity". The first time an identity logs in a new
+// user is made, but only if the provider verified the email. When there's
+// already an account with the email it's [errUnlinkedAccount], the email
+// alone doesn't prove who owns it, so its owner has to link the identity
+// after logging in.
+func (cfg *ApiConfig) userFromIdentity(ctx context.Context, identity sso.Identity) (database.User, error) {
+	userID, err := cfg.db.GetUserIDByIdentity(ctx, database.GetUserIDByIdentityParams{
+		Issuer:  identity.Issuer,
+		Subject: identity.Subject,
+	})
+	if err == nil {
+		return cfg.db.GetUserByID(ctx, userID)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, err
+	}
+
+	if !identity.EmailVerified || identity.Email == "" {
+		return database.User{}, errUnverifiedIdentity
+	}
+	_, err = cfg.db.GetUserByEmail(ctx, identity.Email)
+	if err == nil {
+		return database.User{}, errUnlinkedAccount
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, err
+	}
+	user, err := cfg.createSSOUser(ctx, identity.Email)
+	if err != nil {
+		return database.User{}, err
+	}
+	if err := cfg.db.VerifyUserEmail(ctx, user.ID); err != nil {
+		return database.User{}, err
+	}
+	err = cfg.db.CreateUserIdentity(ctx, database.CreateUserIdentityParams{
+		Issuer:  identity.Issuer,
+		Subject: identity.Subject,
+		UserID:  user.ID,
+		Email:   identity.Email,
+	})
+	if err != nil {
+		return database.User{}, err
+	}
+	logging.LogInfoContext(ctx, "oidc identity linked to user", "user_id", user.ID)
+	return cfg.db.GetUserByID(ctx, user.ID)
+}
+
+// Make a user for someone that only logs in through a provider, its password
+// is random so it can only be used after a password reset.
+func (cfg *ApiConfig) createSSOUser(ctx context.Context, email string) (database.User, error) {
+	password, err := auth.MakeOneTimeToken()
+	if err != nil {
+		return database.User{}, err
+	}
+	passwd, err := auth.HashPassword(password)
+	if err != nil {
+		return database.User{}, err
+	}
+	user, err := cfg.db.CreateUser(ctx, database.CreateUserParams{
+		Email:          email,
+		HashedPassword: passwd,
+	})
+	if err != nil {
+		return database.User{}, fmt.Errorf("failed to create user: %w", err)
+	}
+	logging.LogInfoContext(ctx, "user created from oidc identity", "user_id", user.ID)
+	return user, nil
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/sso"
+)
+
+var testIdentity = sso.Identity{
+	Issuer:        "https://idp.example.com",
+	Subject:       "saul",
+	Email:         "saul@example.com",
+	EmailVerified: true,
+}
+
+// Someone controlling an identity with the email of an account must not be
+// logged in as it.
+func TestUserFromIdentityUnlinkedAccount(t *testing.T) {
+	cfg, mock, _ := newTestConfig(t)
+	mock.ExpectQuery("GetUserIDByIdentity").WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery("GetUserByEmail").WillReturnRows(userRows(newTestUser()))
+
+	_, err := cfg.userFromIdentity(t.Context(), testIdentity)
+	if !errors.Is(err, errUnlinkedAccount) {
+		t.Errorf("expected errUnlinkedAccount, got %v", err)
+	}
+	checkQueries(t, mock)
+}
+
+func TestUserFromIdentityNewUser(t *testing.T) {
+	cfg, mock, _ := newTestConfig(t)
+	user := newTestUser()
+	mock.ExpectQuery("GetUserIDByIdentity").WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery("GetUserByEmail").WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery("CreateUser").WillReturnRows(userRows(user))
+	mock.ExpectExec("VerifyUserEmail").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("CreateUserIdentity").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("GetUserByID").WillReturnRows(userRows(user))
+
+	got, err := cfg.userFromIdentity(t.Context(), testIdentity)
+	if err != nil || got.ID != user.ID {
+		t.Errorf("expected user %s, got %s err: %v", user.ID, got.ID, err)
+	}
+	checkQueries(t, mock)
+}
+
+func TestLinkIdentity(t *testing.T) {
+	userID := uuid.New()
+	tests := []struct {
+		name   string
+		expect func(sqlmock.Sqlmock)
+		status int
+	}{
+		{"new identity", func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery("GetUserIDByIdentity").WillReturnError(sql.ErrNoRows)
+			mock.ExpectExec("CreateUserIdentity").WillReturnResult(sqlmock.NewResult(0, 1))
+		}, 204},
+		{"already linked", func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery("GetUserIDByIdentity").WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(userID.String()))
+		}, 204},
+		{"linked to another user", func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery("GetUserIDByIdentity").WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(uuid.NewString()))
+		}, 409},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mock, _ := newTestConfig(t)
+			tt.expect(mock)
+
+			w := httptest.NewRecorder()
+			cfg.linkIdentity(w, httptest.NewRequest("GET", "/api/login/oidc/corp/callback", nil), userID, testIdentity)
+
+			if w.Code != tt.status {
+				t.Errorf("expected %d, got %d %s", tt.status, w.Code, w.Body)
+			}
+			checkQueries(t, mock)
+		})
+	}
+}
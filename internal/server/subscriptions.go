@@ -0,0 +1,162 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/database"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/logging"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/outbox"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/webhook"
+)
+
+// plan of the subscriptions Polka doesn't name
+const defaultSubscriptionPlan = "red"
+
+var errWebhookSubscriptionNotFound = errors.New("webhook event user has no live subscription")
+
+// Start a Chirpy Red subscription, or renew the live one if the user
+// already has it.
+func (cfg *ApiConfig) startSubscription(ctx context.Context, db *database.Queries, userID uuid.UUID, plan string, periodEnd *time.Time) error {
+	subscription, err := db.GetLiveSubscription(ctx, userID)
+	if err == nil {
+		return cfg.renewSubscription(ctx, db, subscription, plan, periodEnd)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	if plan == "" {
+		plan = defaultSubscriptionPlan
+	}
+	end := time.Now().Add(cfg.subscriptionPeriod)
+	if periodEnd != nil {
+		end = *periodEnd
+	}
+	subscription, err = db.StartSubscription(ctx, database.StartSubscriptionParams{
+		UserID:           userID,
+		Plan:             plan,
+		CurrentPeriodEnd: end,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return errWebhookUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+	logging.LogInfoContext(ctx, "subscription started", "subscription_id", subscription.ID)
+	return outbox.Write(ctx, db, webhook.EventUserUpgraded, userID, map[string]string{"plan": subscription.Plan})
+}
+
+// Renew the live subscription of the user, starting a new one if it already
+// ended.
+func (cfg *ApiConfig) renewUserSubscription(ctx context.Context, db *database.Queries, userID uuid.UUID, plan string, periodEnd *time.Time) error {
+	subscription, err := db.GetLiveSubscription(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return cfg.startSubscription(ctx, db, userID, plan, periodEnd)
+	}
+	if err != nil {
+		return err
+	}
+	return cfg.renewSubscription(ctx, db, subscription, plan, periodEnd)
+}
+
+// Extend "subscription" until "periodEnd", or one period after its current
+// end (or now, if that is later) when Polka doesn't say. It's active again
+// even if it was past due.
+func (cfg *ApiConfig) renewSubscription(ctx context.Context, db *database.Queries, subscription database.Subscription, plan string, periodEnd *time.Time) error {
+	if plan == "" {
+		plan = subscription.Plan
+	}
+	start := subscription.CurrentPeriodEnd
+	if now := time.Now(); start.Before(now) {
+		start = now
+	}
+	end := start.Add(cfg.subscriptionPeriod)
+	if periodEnd != nil {
+		end = *periodEnd
+	}
+	_, err := db.RenewSubscription(ctx, database.RenewSubscriptionParams{
+		ID:               subscription.ID,
+		Plan:             plan,
+		CurrentPeriodEnd: end,
+	})
+	if err != nil {
+		return err
+	}
+	logging.LogInfoContext(ctx, "subscription renewed", "subscription_id", subscription.ID)
+	return nil
+}
+
+// Mark the live subscription of the user as past due, it keeps the perks for
+// the grace period so the payment can be fixed.
+func (cfg *ApiConfig) failSubscriptionPayment(ctx context.Context, db *database.Queries, userID uuid.UUID) error {
+	subscription, err := db.GetLiveSubscription(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errWebhookSubscriptionNotFound
+	}
+	if err != nil {
+		return err
+	}
+	_, err = db.MarkSubscriptionPastDue(ctx, database.MarkSubscriptionPastDueParams{
+		ID:         subscription.ID,
+		GraceUntil: sql.NullTime{Time: time.Now().Add(cfg.subscriptionGracePeriod), Valid: true},
+	})
+	if err != nil {
+		return err
+	}
+	logging.LogInfoContext(ctx, "subscription past due", "subscription_id", subscription.ID)
+	return nil
+}
+
+// End the live subscription of the user right away, the user loses the perks.
+func (cfg *ApiConfig) cancelSubscription(ctx context.Context, db *database.Queries, userID uuid.UUID) error {
+	subscription, err := db.GetLiveSubscription(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errWebhookSubscriptionNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := db.CancelSubscription(ctx, subscription.ID); err != nil {
+		return err
+	}
+	logging.LogInfoContext(ctx, "subscription canceled", "subscription_id", subscription.ID)
+	return outbox.Write(ctx, db, webhook.EventUserDowngraded, userID, map[string]string{"reason": "canceled"})
+}
+
+// Expire the subscriptions that weren't renewed or paid in their grace period
+// every "interval" until "ctx" is done.
+func (cfg *ApiConfig) expireSubscriptionsLoop(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		var expired []uuid.UUID
+		err := cfg.inTx(ctx, func(db *database.Queries) error {
+			var err error
+			expired, err = db.ExpireLapsedSubscriptions(ctx, time.Now().Add(-cfg.subscriptionGracePeriod))
+			if err != nil {
+				return err
+			}
+			for _, userID := range expired {
+				if err := outbox.Write(ctx, db, webhook.EventUserDowngraded, userID, map[string]string{"reason": "expired"}); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			logging.LogError("failed to expire subscriptions", "err", err)
+		} else if len(expired) > 0 {
+			logging.LogInfo("expired subscriptions", "count", len(expired))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
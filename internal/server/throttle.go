@@ -0,0 +1,111 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/auth"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/database"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/logging"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/utils"
+)
+
+// throttle key of the account with "email"
+func accountThrottleKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+// throttle key of the second factor of the user
+func mfaThrottleKey(userID uuid.UUID) string {
+	return "mfa:" + userID.String()
+}
+
+// throttle keys of password reset requests for "email" from the client IP,
+// apart from the login ones so asking for resets can't lock anyone out
+func resetPasswordThrottleKeys(r *http.Request, email string) []string {
+	return []string{"reset:" + accountThrottleKey(email), "reset:" + ipThrottleKey(r)}
+}
+
+// throttle key of the client IP, it uses the connection address since we
+// don't know which proxies to trust with X-Forwarded-For
+func ipThrottleKey(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// Check the "password" of the "user" before a sensitive change, so a stolen
+// access token isn't enough to take over the account. It's throttled like a
+// login, answering with 401 or 429 and returning false when it fails.
+func (cfg *ApiConfig) confirmPassword(w http.ResponseWriter, r *http.Request, user database.User, password string) bool {
+	throttleKeys := []string{accountThrottleKey(user.Email), ipThrottleKey(r)}
+	if !cfg.checkThrottle(w, r, throttleKeys) {
+		return false
+	}
+	if err := auth.CheckPasswordHash(password, user.HashedPassword); err != nil {
+		cfg.failThrottled(w, r, throttleKeys, "Incorrect current password", "failed to check current password", err)
+		return false
+	}
+	return true
+}
+
+// Check the TOTP "code" or "recoveryCode" of a user with 2FA on before a
+// sensitive change, users without it pass. It's throttled like
+// POST /api/login/mfa, answering with 401 or 429 and returning false when it
+// fails.
+func (cfg *ApiConfig) confirmSecondFactor(w http.ResponseWriter, r *http.Request, user database.User, code, recoveryCode string) bool {
+	if !user.TotpEnabledAt.Valid {
+		return true
+	}
+	throttleKeys := []string{mfaThrottleKey(user.ID), ipThrottleKey(r)}
+	if !cfg.checkThrottle(w, r, throttleKeys) {
+		return false
+	}
+	if err := cfg.verifySecondFactor(r.Context(), user, code, recoveryCode); err != nil {
+		cfg.failThrottled(w, r, throttleKeys, "Invalid code", "failed to verify second factor", err)
+		return false
+	}
+	return true
+}
+
+// Answer with 429 and returns false if any of the throttle "keys" is locked.
+func (cfg *ApiConfig) checkThrottle(w http.ResponseWriter, r *http.Request, keys []string) bool {
+	retryAfter, err := cfg.throttler.Check(r.Context(), keys...)
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to check throttle", err)
+		return false
+	}
+	if retryAfter > 0 {
+		setRetryAfter(w, retryAfter)
+		utils.ResponseWithError(w, r, 429, "Too many failed attempts, try again later", "throttled attempt on", keys)
+		return false
+	}
+	return true
+}
+
+// Record a failure on the throttle "keys" and answer with 401, with a
+// Retry-After header if the failure locked any of them.
+func (cfg *ApiConfig) failThrottled(w http.ResponseWriter, r *http.Request, keys []string, errorMsg, logErrMsg string, err any) {
+	cfg.metrics.FailedLogins.Inc()
+	retryAfter, throttleErr := cfg.throttler.Fail(r.Context(), keys...)
+	if throttleErr != nil {
+		logging.LogErrorContext(r.Context(), "failed to record throttle failure", "err", throttleErr)
+	}
+	if retryAfter > 0 {
+		logging.LogWarnContext(r.Context(), "throttle locked", "keys", keys, "retry_after", retryAfter)
+		setRetryAfter(w, retryAfter)
+	}
+	utils.ResponseWithError(w, r, 401, errorMsg, logErrMsg, err)
+}
+
+// Retry-After is in whole seconds, rounded up so clients don't retry early
+func setRetryAfter(w http.ResponseWriter, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(retryAfter.Seconds()))))
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/api"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/auth"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/database"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/logging"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/utils"
+)
+
+const (
+	apiTokenDefaultDays = 90
+	apiTokenMaxDays     = 365
+)
+
+// POST /api/tokens
+//
+// Creates a personal API token for bots, it only works with a JWT so a token
+// can't be used to make other tokens.
+func (cfg *ApiConfig) PostAPITokensHandler(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays *int     `json:"expires_in_days"`
+	}
+
+	idVal := r.Context().Value("id")
+	id, ok := idVal.(uuid.UUID)
+	if !ok {
+		utils.ResponseWithError(w, r, 401, "You're not logged in.", "failed to get id from middleware", r.Context().Value("id"))
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to decode params", err)
+		return
+	}
+	params.Name = strings.TrimSpace(params.Name)
+	if params.Name == "" || len(params.Name) > 50 {
+		utils.ResponseWithError(w, r, 400, "The \"name\" must have between 1 and 50 characters", "invalid api token name", params.Name)
+		return
+	}
+	scopes, err := auth.ParseScopes(params.Scopes)
+	if err != nil {
+		utils.ResponseWithError(w, r, 400, "Invalid \"scopes\", use chirps:write, chirps:read or profile:write", "invalid api token scopes", err)
+		return
+	}
+	expiresInDays := apiTokenDefaultDays
+	if params.ExpiresInDays != nil {
+		expiresInDays = *params.ExpiresInDays
+	}
+	if expiresInDays < 1 || expiresInDays > apiTokenMaxDays {
+		utils.ResponseWithError(w, r, 400, "The \"expires_in_days\" must be between 1 and 365", "invalid api token expiration", expiresInDays)
+		return
+	}
+
+	token, err := auth.MakeAPIToken()
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to make api token", err)
+		return
+	}
+	scopeStrings := make([]string, len(scopes))
+	for i, scope := range scopes {
+		scopeStrings[i] = string(scope)
+	}
+	apiToken, err := cfg.db.CreateAPIToken(r.Context(), database.CreateAPITokenParams{
+		UserID:    id,
+		Name:      params.Name,
+		TokenHash: auth.HashToken(token),
+		Scopes:    scopeStrings,
+		ExpiresAt: time.Now().Add(time.Hour * 24 * time.Duration(expiresInDays)),
+	})
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to create api token", err)
+		return
+	}
+	logging.LogInfoContext(r.Context(), "api token created", "token_id", apiToken.ID)
+
+	utils.ResponseWithJson(w, 201, api.NewCreatedAPIToken(apiToken, token))
+}
+
+// GET /api/tokens
+func (cfg *ApiConfig) GetAPITokensHandler(w http.ResponseWriter, r *http.Request) {
+	idVal := r.Context().Value("id")
+	id, ok := idVal.(uuid.UUID)
+	if !ok {
+		utils.ResponseWithError(w, r, 401, "You're not logged in.", "failed to get id from middleware", r.Context().Value("id"))
+		return
+	}
+
+	apiTokens, err := cfg.db.GetAPITokensFromUser(r.Context(), id)
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to retrieve api tokens", err)
+		return
+	}
+
+	utils.ResponseWithJson(w, 200, api.NewAPITokens(apiTokens))
+}
+
+// DELETE /api/tokens/{tokenID}
+func (cfg *ApiConfig) DeleteAPITokensHandler(w http.ResponseWriter, r *http.Request) {
+	idVal := r.Context().Value("id")
+	id, ok := idVal.(uuid.UUID)
+	if !ok {
+		utils.ResponseWithError(w, r, 401, "You're not logged in.", "failed to get id from middleware", r.Context().Value("id"))
+		return
+	}
+	tokenId, err := uuid.Parse(r.PathValue("tokenID"))
+	if err != nil {
+		utils.ResponseWithError(w, r, 400, "Invaid \"tokenID\" path parameter", "failed to get uuid", err)
+		return
+	}
+
+	revoked, err := cfg.db.RevokeAPIToken(r.Context(), database.RevokeAPITokenParams{
+		ID:     tokenId,
+		UserID: id,
+	})
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to revoke api token", err)
+		return
+	}
+	if revoked == 0 {
+		utils.ResponseWithError(w, r, 404, "This token was revoked or don't exist", "api token not found", tokenId)
+		return
+	}
+
+	w.WriteHeader(204)
+}
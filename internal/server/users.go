@@ -1,12 +1,18 @@
 package server
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/api"
 	"github.com/luigiMinardi/bootdotdev-chirpy/internal/auth"
 	"github.com/luigiMinardi/bootdotdev-chirpy/internal/database"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/logging"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/profile"
 	"github.com/luigiMinardi/bootdotdev-chirpy/internal/utils"
 )
 
@@ -20,12 +26,20 @@ func (cfg *ApiConfig) PostUsersHandler(w http.ResponseWriter, r *http.Request) {
 	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
 	if err := decoder.Decode(&params); err != nil {
-		utils.ResponseWithError(w, 500, "Something went wrong", "failed to decode params", err)
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to decode params", err)
+		return
+	}
+	if violations := cfg.passwordPolicy.Check(params.Password, params.Email); len(violations) > 0 {
+		logging.LogInfoContext(r.Context(), "password violates the policy", "violations", violations)
+		utils.ResponseWithJson(w, 422, utils.ReturnValidationError{
+			Error:      "Password doesn't follow the password policy",
+			Violations: violations,
+		})
 		return
 	}
 	passwd, err := auth.HashPassword(params.Password)
 	if err != nil {
-		utils.ResponseWithError(w, 500, "Something went wrong", "Hash Password failed", err)
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "Hash Password failed", err)
 		return
 	}
 
@@ -35,56 +49,184 @@ func (cfg *ApiConfig) PostUsersHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	user, err := cfg.db.CreateUser(r.Context(), userParams)
 	if err != nil {
-		utils.ResponseWithError(w, 500, "Something went wrong", "failed to create user", err)
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to create user", err)
 		return
 	}
-	respBody := utils.UserWithNoPassword{
-		ID:          user.ID,
-		CreatedAt:   user.CreatedAt,
-		UpdatedAt:   user.UpdatedAt,
-		Email:       user.Email,
-		IsChirpyRed: user.IsChirpyRed,
+	// the account works without it, so the user can ask for a new one later
+	if err := cfg.sendVerificationEmail(r.Context(), user.ID, user.Email); err != nil {
+		logging.LogErrorContext(r.Context(), "failed to send verification email", "err", err)
 	}
-
-	utils.ResponseWithJson(w, 201, respBody)
+	utils.ResponseWithJson(w, 201, api.NewUser(user))
 }
 
-// PUT /api/users
+// PUT /api/users and PATCH /api/users
+//
+// Only the fields sent are updated. Changing the email or the password needs
+// the current password, changing the password logs out every other session
+// and changing the email needs it to be verified again. The public profile
+// fields (username, display_name, bio and avatar) don't need the password,
+// they are the only ones personal API tokens with "profile:write" can change.
 func (cfg *ApiConfig) PutUsersHandler(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Email           *string `json:"email"`
+		Password        *string `json:"password"`
+		CurrentPassword string  `json:"current_password"`
+		Username        *string `json:"username"`
+		DisplayName     *string `json:"display_name"`
+		Bio             *string `json:"bio"`
+		Avatar          *string `json:"avatar"`
+	}
+	type violation struct {
+		Field   string `json:"field"`
+		Message string `json:"message"`
 	}
 
 	idVal := r.Context().Value("id")
 	id, ok := idVal.(uuid.UUID)
 	if !ok {
-		utils.ResponseWithError(w, 401, "You're not logged in.", "failed to get id from middleware", r.Context().Value("id"))
+		utils.ResponseWithError(w, r, 401, "You're not logged in.", "failed to get id from middleware", r.Context().Value("id"))
 		return
 	}
 
 	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
 	if err := decoder.Decode(&params); err != nil {
-		utils.ResponseWithError(w, 500, "Something went wrong", "failed to decode params", err)
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to decode params", err)
 		return
 	}
-	passwd, err := auth.HashPassword(params.Password)
+
+	currentUser, err := cfg.db.GetUserByID(r.Context(), id)
 	if err != nil {
-		utils.ResponseWithError(w, 500, "Something went wrong", "Hash Password failed", err)
+		utils.ResponseWithError(w, r, 404, "This user was deleted or don't exist", "failed to retrieve user", err)
+		return
+	}
+
+	emailChanged := params.Email != nil && *params.Email != currentUser.Email
+	passwordChanged := params.Password != nil
+	if _, apiToken := r.Context().Value("scopes").([]auth.Scope); apiToken && (params.Email != nil || passwordChanged) {
+		utils.ResponseWithError(w, r, 403, "API tokens can't change the email or the password", "api token tried to change credentials", id)
+		return
+	}
+	if params.Email != nil && *params.Email == "" {
+		utils.ResponseWithError(w, r, 400, "Empty \"email\" field", "empty \"email\" field", id)
+		return
+	}
+
+	violations := []violation{}
+	profileFields := []struct {
+		name     string
+		value    *string
+		validate func(string) error
+	}{
+		{"username", params.Username, profile.ValidateUsername},
+		{"display_name", params.DisplayName, profile.ValidateDisplayName},
+		{"bio", params.Bio, profile.ValidateBio},
+		{"avatar", params.Avatar, profile.ValidateAvatar},
+	}
+	for _, field := range profileFields {
+		if field.value == nil {
+			continue
+		}
+		if err := field.validate(*field.value); err != nil {
+			violations = append(violations, violation{Field: field.name, Message: err.Error()})
+		}
+	}
+	if len(violations) > 0 {
+		logging.LogInfoContext(r.Context(), "profile fields are invalid", "violations", violations)
+		utils.ResponseWithJson(w, 422, utils.ReturnValidationError{
+			Error:      "Invalid profile fields",
+			Violations: violations,
+		})
+		return
+	}
+
+	// a stolen access token shouldn't be enough to take over the account
+	if (emailChanged || passwordChanged) && !cfg.confirmPassword(w, r, currentUser, params.CurrentPassword) {
 		return
 	}
 
 	userParams := database.UpdateUserParams{
-		ID:             id,
-		Email:          params.Email,
-		HashedPassword: passwd,
+		ID:          id,
+		Username:    ptrNullString(params.Username),
+		DisplayName: ptrNullString(params.DisplayName),
+		Bio:         ptrNullString(params.Bio),
+		Avatar:      ptrNullString(params.Avatar),
+	}
+	email := currentUser.Email
+	if emailChanged {
+		email = *params.Email
+		userParams.Email = sql.NullString{String: email, Valid: true}
+	}
+	if passwordChanged {
+		if violations := cfg.passwordPolicy.Check(*params.Password, email); len(violations) > 0 {
+			logging.LogInfoContext(r.Context(), "password violates the policy", "violations", violations)
+			utils.ResponseWithJson(w, 422, utils.ReturnValidationError{
+				Error:      "Password doesn't follow the password policy",
+				Violations: violations,
+			})
+			return
+		}
+		passwd, err := auth.HashPassword(*params.Password)
+		if err != nil {
+			utils.ResponseWithError(w, r, 500, "Something went wrong", "Hash Password failed", err)
+			return
+		}
+		userParams.HashedPassword = sql.NullString{String: passwd, Valid: true}
 	}
+
 	user, err := cfg.db.UpdateUser(r.Context(), userParams)
 	if err != nil {
-		utils.ResponseWithError(w, 500, "Something went wrong", "failed to update user", err)
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "users_username_lower_idx" {
+			utils.ResponseWithError(w, r, 409, "This username is already taken", "username already taken", err)
+			return
+		}
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			utils.ResponseWithError(w, r, 409, "This email is already in use", "email already in use", err)
+			return
+		}
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to update user", err)
 		return
 	}
 
-	utils.ResponseWithJson(w, 200, user)
+	if passwordChanged {
+		// only the session used to change the password stays logged in
+		jti, _ := r.Context().Value("jti").(string)
+		err = cfg.db.RevokeOtherRefreshTokensFromUser(r.Context(), database.RevokeOtherRefreshTokensFromUserParams{
+			UserID:  id,
+			KeepJti: jti,
+		})
+		if err != nil {
+			utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to revoke user refresh tokens", err)
+			return
+		}
+		err = cfg.denyUserAccessTokens(r.Context(), id, jti)
+		if err != nil {
+			utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to deny user access tokens", err)
+			return
+		}
+	}
+
+	if emailChanged {
+		err = cfg.db.DeleteUserTokensFromUser(r.Context(), database.DeleteUserTokensFromUserParams{
+			UserID:  id,
+			Purpose: tokenPurposeVerifyEmail,
+		})
+		if err != nil {
+			logging.LogErrorContext(r.Context(), "failed to delete verify email tokens of the old email", "err", err)
+		}
+		if err := cfg.sendVerificationEmail(r.Context(), user.ID, user.Email); err != nil {
+			logging.LogErrorContext(r.Context(), "failed to send verification email", "err", err)
+		}
+	}
+
+	utils.ResponseWithJson(w, 200, api.NewUser(user))
+}
+
+// NULL when the field wasn't sent so the update keeps the current value
+func ptrNullString(s *string) sql.NullString {
+	if s == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: *s, Valid: true}
 }
@@ -0,0 +1,304 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/api"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/auth"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/database"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/logging"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/utils"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/webhook"
+)
+
+// most endpoints a user can register
+const webhookEndpointsMax = 10
+
+// POST /api/webhooks
+//
+// Registers an endpoint to receive the events of the user, or of every user
+// when an admin sets "all_users". The deliveries are signed with the secret
+// returned here, see the webhook package for how to verify them.
+func (cfg *ApiConfig) PostWebhookEndpointsHandler(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		URL      string   `json:"url"`
+		Events   []string `json:"events"`
+		AllUsers bool     `json:"all_users"`
+	}
+
+	idVal := r.Context().Value("id")
+	id, ok := idVal.(uuid.UUID)
+	if !ok {
+		utils.ResponseWithError(w, r, 401, "You're not logged in.", "failed to get id from middleware", r.Context().Value("id"))
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to decode params", err)
+		return
+	}
+	endpointURL, err := url.Parse(params.URL)
+	if err != nil || endpointURL.Host == "" || len(params.URL) > 2048 ||
+		(endpointURL.Scheme != "https" && !(cfg.platform == "dev" && endpointURL.Scheme == "http")) {
+		utils.ResponseWithError(w, r, 400, "The \"url\" must be a valid https URL", "invalid webhook endpoint url", params.URL)
+		return
+	}
+	// hostnames are checked when connecting, as they can resolve to anything
+	if addr, err := netip.ParseAddr(endpointURL.Hostname()); err == nil && !webhook.PublicAddr(addr) && cfg.platform != "dev" {
+		utils.ResponseWithError(w, r, 400, "The \"url\" can't be on a private address", "private webhook endpoint address", params.URL)
+		return
+	}
+	if params.Events == nil {
+		params.Events = []string{}
+	}
+	for _, event := range params.Events {
+		if !slices.Contains(webhook.Events, event) {
+			utils.ResponseWithError(w, r, 400, "Invalid \"events\", use chirp.created, chirp.deleted, user.upgraded or user.downgraded", "invalid webhook event", event)
+			return
+		}
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), id)
+	if err != nil {
+		utils.ResponseWithError(w, r, 404, "This user was deleted or don't exist", "failed to retrieve user", err)
+		return
+	}
+	if params.AllUsers && !auth.Role(user.Role).Includes(auth.RoleAdmin) {
+		utils.ResponseWithError(w, r, 403, "Only admins can receive the events of every user.", "non admin registering webhook for all users", id)
+		return
+	}
+	endpoints, err := cfg.db.GetWebhookEndpointsFromUser(r.Context(), id)
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to retrieve webhook endpoints", err)
+		return
+	}
+	if len(endpoints) >= webhookEndpointsMax {
+		utils.ResponseWithError(w, r, 409, "You can't register more than 10 webhook endpoints", "too many webhook endpoints", id)
+		return
+	}
+
+	secret, err := webhook.NewSecret()
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to make webhook secret", err)
+		return
+	}
+	sealedSecret, err := cfg.secretBox.Seal([]byte(secret))
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to seal webhook secret", err)
+		return
+	}
+	endpoint, err := cfg.db.CreateWebhookEndpoint(r.Context(), database.CreateWebhookEndpointParams{
+		UserID:   id,
+		Url:      endpointURL.String(),
+		Secret:   sealedSecret,
+		Events:   params.Events,
+		AllUsers: params.AllUsers,
+	})
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to create webhook endpoint", err)
+		return
+	}
+	logging.LogInfoContext(r.Context(), "webhook endpoint registered", "endpoint_id", endpoint.ID)
+
+	utils.ResponseWithJson(w, 201, api.NewCreatedWebhookEndpoint(endpoint, secret))
+}
+
+// GET /api/webhooks
+func (cfg *ApiConfig) GetWebhookEndpointsHandler(w http.ResponseWriter, r *http.Request) {
+	idVal := r.Context().Value("id")
+	id, ok := idVal.(uuid.UUID)
+	if !ok {
+		utils.ResponseWithError(w, r, 401, "You're not logged in.", "failed to get id from middleware", r.Context().Value("id"))
+		return
+	}
+
+	endpoints, err := cfg.db.GetWebhookEndpointsFromUser(r.Context(), id)
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to retrieve webhook endpoints", err)
+		return
+	}
+
+	utils.ResponseWithJson(w, 200, api.NewWebhookEndpoints(endpoints))
+}
+
+// DELETE /api/webhooks/{endpointID}
+//
+// Removes the endpoint, its queued deliveries are dropped with it.
+func (cfg *ApiConfig) DeleteWebhookEndpointsHandler(w http.ResponseWriter, r *http.Request) {
+	idVal := r.Context().Value("id")
+	id, ok := idVal.(uuid.UUID)
+	if !ok {
+		utils.ResponseWithError(w, r, 401, "You're not logged in.", "failed to get id from middleware", r.Context().Value("id"))
+		return
+	}
+	endpointID, err := uuid.Parse(r.PathValue("endpointID"))
+	if err != nil {
+		utils.ResponseWithError(w, r, 400, "Invalid \"endpointID\" path parameter", "failed to get uuid", err)
+		return
+	}
+
+	deleted, err := cfg.db.DeleteWebhookEndpoint(r.Context(), database.DeleteWebhookEndpointParams{
+		ID:     endpointID,
+		UserID: id,
+	})
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to delete webhook endpoint", err)
+		return
+	}
+	if deleted == 0 {
+		utils.ResponseWithError(w, r, 404, "Webhook endpoint not found", "webhook endpoint not found", endpointID)
+		return
+	}
+	logging.LogInfoContext(r.Context(), "webhook endpoint deleted", "endpoint_id", endpointID)
+
+	w.WriteHeader(204)
+}
+
+// GET /api/webhooks/{endpointID}/deliveries
+//
+// Newest deliveries to the endpoint, filtered by ?status (pending, delivered
+// or dead) and at most ?limit (1 to 500, 50 by default).
+func (cfg *ApiConfig) GetWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	endpoint, ok := cfg.userWebhookEndpoint(w, r)
+	if !ok {
+		return
+	}
+	params := database.GetWebhookDeliveriesParams{EndpointID: endpoint.ID, Limit: 50}
+	if status := r.URL.Query().Get("status"); status != "" {
+		switch status {
+		case webhook.StatusPending, webhook.StatusDelivered, webhook.StatusDead:
+		default:
+			utils.ResponseWithError(w, r, 400, "Invalid \"status\", it must be pending, delivered or dead", "invalid webhook delivery status", status)
+			return
+		}
+		params.Status = sql.NullString{String: status, Valid: true}
+	}
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		number, err := strconv.Atoi(limit)
+		if err != nil || number < 1 || number > 500 {
+			utils.ResponseWithError(w, r, 400, "The \"limit\" must be between 1 and 500", "invalid webhook deliveries limit", limit)
+			return
+		}
+		params.Limit = int32(number)
+	}
+
+	deliveries, err := cfg.db.GetWebhookDeliveries(r.Context(), params)
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to retrieve webhook deliveries", err)
+		return
+	}
+	utils.ResponseWithJson(w, 200, api.NewWebhookDeliveries(deliveries))
+}
+
+// GET /api/webhooks/{endpointID}/deliveries/{deliveryID}/attempts
+func (cfg *ApiConfig) GetWebhookDeliveryAttemptsHandler(w http.ResponseWriter, r *http.Request) {
+	delivery, ok := cfg.userWebhookDelivery(w, r)
+	if !ok {
+		return
+	}
+
+	attempts, err := cfg.db.GetWebhookDeliveryAttempts(r.Context(), delivery.ID)
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to retrieve webhook delivery attempts", err)
+		return
+	}
+	utils.ResponseWithJson(w, 200, api.NewWebhookDeliveryAttempts(attempts))
+}
+
+// POST /api/webhooks/{endpointID}/deliveries/{deliveryID}/retry
+//
+// Queues a dead delivery again, e.g. after fixing the endpoint.
+func (cfg *ApiConfig) RetryWebhookDeliveryHandler(w http.ResponseWriter, r *http.Request) {
+	delivery, ok := cfg.userWebhookDelivery(w, r)
+	if !ok {
+		return
+	}
+	if delivery.Status != webhook.StatusDead {
+		utils.ResponseWithError(w, r, 409, "Only dead deliveries can be retried", "retrying webhook delivery that isn't dead", delivery.ID)
+		return
+	}
+
+	retried, err := cfg.db.RetryWebhookDelivery(r.Context(), database.RetryWebhookDeliveryParams{
+		ID:         delivery.ID,
+		EndpointID: delivery.EndpointID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.ResponseWithError(w, r, 409, "Only dead deliveries can be retried", "webhook delivery retried concurrently", delivery.ID)
+		return
+	}
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to retry webhook delivery", err)
+		return
+	}
+	logging.LogInfoContext(r.Context(), "webhook delivery retried", "delivery_id", retried.ID)
+
+	utils.ResponseWithJson(w, 200, api.NewWebhookDelivery(retried))
+}
+
+// Get the endpoint on the "endpointID" path parameter if it's from the logged
+// in user, answering the request otherwise.
+func (cfg *ApiConfig) userWebhookEndpoint(w http.ResponseWriter, r *http.Request) (database.WebhookEndpoint, bool) {
+	idVal := r.Context().Value("id")
+	id, ok := idVal.(uuid.UUID)
+	if !ok {
+		utils.ResponseWithError(w, r, 401, "You're not logged in.", "failed to get id from middleware", r.Context().Value("id"))
+		return database.WebhookEndpoint{}, false
+	}
+	endpointID, err := uuid.Parse(r.PathValue("endpointID"))
+	if err != nil {
+		utils.ResponseWithError(w, r, 400, "Invalid \"endpointID\" path parameter", "failed to get uuid", err)
+		return database.WebhookEndpoint{}, false
+	}
+
+	endpoint, err := cfg.db.GetWebhookEndpoint(r.Context(), database.GetWebhookEndpointParams{
+		ID:     endpointID,
+		UserID: id,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.ResponseWithError(w, r, 404, "Webhook endpoint not found", "webhook endpoint not found", endpointID)
+		return database.WebhookEndpoint{}, false
+	}
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to retrieve webhook endpoint", err)
+		return database.WebhookEndpoint{}, false
+	}
+	return endpoint, true
+}
+
+// Get the delivery on the "deliveryID" path parameter if it's to an endpoint
+// of the logged in user, answering the request otherwise.
+func (cfg *ApiConfig) userWebhookDelivery(w http.ResponseWriter, r *http.Request) (database.WebhookDelivery, bool) {
+	endpoint, ok := cfg.userWebhookEndpoint(w, r)
+	if !ok {
+		return database.WebhookDelivery{}, false
+	}
+	deliveryID, err := uuid.Parse(r.PathValue("deliveryID"))
+	if err != nil {
+		utils.ResponseWithError(w, r, 400, "Invalid \"deliveryID\" path parameter", "failed to get uuid", err)
+		return database.WebhookDelivery{}, false
+	}
+
+	delivery, err := cfg.db.GetWebhookDelivery(r.Context(), database.GetWebhookDeliveryParams{
+		ID:         deliveryID,
+		EndpointID: endpoint.ID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.ResponseWithError(w, r, 404, "Webhook delivery not found", "webhook delivery not found", deliveryID)
+		return database.WebhookDelivery{}, false
+	}
+	if err != nil {
+		utils.ResponseWithError(w, r, 500, "Something went wrong", "failed to retrieve webhook delivery", err)
+		return database.WebhookDelivery{}, false
+	}
+	return delivery, true
+}
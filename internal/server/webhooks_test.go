@@ -0,0 +1,35 @@
+package server
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestPostWebhookEndpointsPrivateAddress(t *testing.T) {
+	for _, endpointURL := range []string{
+		"https://127.0.0.1/hook",
+		"https://10.0.0.5/hook",
+		"https://169.254.169.254/latest/meta-data",
+		"https://[::1]:8443/hook",
+		"https://0.0.0.0/hook",
+	} {
+		t.Run(endpointURL, func(t *testing.T) {
+			cfg, mock, _ := newTestConfig(t)
+			cfg.platform = "production"
+
+			r := httptest.NewRequest("POST", "/api/webhooks", strings.NewReader(`{"url": "`+endpointURL+`"}`))
+			r = r.WithContext(context.WithValue(r.Context(), "id", uuid.New()))
+			w := httptest.NewRecorder()
+			cfg.PostWebhookEndpointsHandler(w, r)
+
+			if w.Code != 400 {
+				t.Errorf("expected 400, got %d %s", w.Code, w.Body)
+			}
+			checkQueries(t, mock)
+		})
+	}
+}
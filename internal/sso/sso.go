@@ -0,0 +1,203 @@
+// Package sso lets users log in with external OpenID Connect providers, like
+// a corporate IdP, with the authorization code flow and PKCE.
+package sso
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"golang.org/x/oauth2"
+)
+
+// issuer of the flow tokens, so they can't be used as any other token
+const flowIssuer = "chirpy-sso"
+
+// Config of an OpenID Connect provider.
+type Config struct {
+	// used on the login URLs, e.g. "corp" for /api/login/oidc/corp
+	Name string
+	// the discovery document is at IssuerURL + "/.well-known/openid-configuration"
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	// Chirpy callback registered on the provider
+	RedirectURL string
+}
+
+// Identity of the user as told by the validated ID token.
+type Identity struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// RelyingParty logs users in with a single provider.
+type RelyingParty struct {
+	Name     string
+	oauth2   oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// Make a relying party for the provider of "config", its discovery document
+// and keys are fetched from the provider.
+func New(ctx context.Context, config Config) (*RelyingParty, error) {
+	provider, err := oidc.NewProvider(ctx, config.IssuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover %s: %w", config.IssuerURL, err)
+	}
+	return &RelyingParty{
+		Name: config.Name,
+		oauth2: oauth2.Config{
+			ClientID:     config.ClientID,
+			ClientSecret: config.ClientSecret,
+			Endpoint:     provider.Endpoint(),
+			RedirectURL:  config.RedirectURL,
+			Scopes:       []string{oidc.ScopeOpenID, "email", "profile"},
+		},
+		verifier: provider.Verifier(&oidc.Config{ClientID: config.ClientID}),
+	}, nil
+}
+
+// Flow is what has to be kept between sending the user to the provider and
+// the callback, see [SealFlow].
+type Flow struct {
+	Provider string
+	State    string
+	Nonce    string
+	Verifier string
+	// logged in user linking the provider to their account, [uuid.Nil] on
+	// logins
+	LinkUserID uuid.UUID
+}
+
+// Start a login, returning the flow to keep and the provider URL to send the
+// user to.
+func (rp *RelyingParty) Start() (Flow, string, error) {
+	state, err := randomString()
+	if err != nil {
+		return Flow{}, "", err
+	}
+	nonce, err := randomString()
+	if err != nil {
+		return Flow{}, "", err
+	}
+	flow := Flow{
+		Provider: rp.Name,
+		State:    state,
+		Nonce:    nonce,
+		Verifier: oauth2.GenerateVerifier(),
+	}
+	authURL := rp.oauth2.AuthCodeURL(state, oauth2.S256ChallengeOption(flow.Verifier), oidc.Nonce(nonce))
+	return flow, authURL, nil
+}
+
+// Finish the login of "flow" with the "state" and "code" given to the
+// callback, the ID token is validated against the provider keys (JWKS),
+// audience, expiration and nonce.
+func (rp *RelyingParty) Finish(ctx context.Context, flow Flow, state, code string) (Identity, error) {
+	if flow.Provider != rp.Name || state == "" || state != flow.State {
+		return Identity{}, errors.New("state doesn't match the login flow")
+	}
+	token, err := rp.oauth2.Exchange(ctx, code, oauth2.VerifierOption(flow.Verifier))
+	if err != nil {
+		return Identity{}, fmt.Errorf("failed to exchange code: %w", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return Identity{}, errors.New("token response without id_token")
+	}
+	idToken, err := rp.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return Identity{}, fmt.Errorf("invalid id_token: %w", err)
+	}
+	if idToken.Nonce != flow.Nonce {
+		return Identity{}, errors.New("id_token nonce doesn't match the login flow")
+	}
+
+	claims := struct {
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+		Name          string `json:"name"`
+	}{}
+	if err := idToken.Claims(&claims); err != nil {
+		return Identity{}, fmt.Errorf("failed to parse id_token claims: %w", err)
+	}
+	return Identity{
+		Issuer:        idToken.Issuer,
+		Subject:       idToken.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		Name:          claims.Name,
+	}, nil
+}
+
+type flowClaims struct {
+	jwt.RegisteredClaims
+	Provider string `json:"provider"`
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	LinkUser string `json:"link_user,omitempty"`
+}
+
+// Sign the "flow" so it can be kept on a cookie of the user until the
+// callback, it can be read but not changed.
+func SealFlow(flow Flow, secret string, expiresIn time.Duration) (string, error) {
+	now := time.Now()
+	claims := flowClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    flowIssuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
+		},
+		Provider: flow.Provider,
+		State:    flow.State,
+		Nonce:    flow.Nonce,
+		Verifier: flow.Verifier,
+	}
+	if flow.LinkUserID != uuid.Nil {
+		claims.LinkUser = flow.LinkUserID.String()
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+}
+
+// Validate a flow signed by [SealFlow].
+func OpenFlow(sealed, secret string) (Flow, error) {
+	claims := flowClaims{}
+	_, err := jwt.ParseWithClaims(sealed, &claims, func(t *jwt.Token) (any, error) {
+		return []byte(secret), nil
+	}, jwt.WithIssuer(flowIssuer), jwt.WithValidMethods([]string{"HS256"}), jwt.WithExpirationRequired())
+	if err != nil {
+		return Flow{}, err
+	}
+	flow := Flow{
+		Provider: claims.Provider,
+		State:    claims.State,
+		Nonce:    claims.Nonce,
+		Verifier: claims.Verifier,
+	}
+	if claims.LinkUser != "" {
+		flow.LinkUserID, err = uuid.Parse(claims.LinkUser)
+		if err != nil {
+			return Flow{}, err
+		}
+	}
+	return flow, nil
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,234 @@
+package sso
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// fakeProvider is a minimal OpenID Connect provider: discovery, JWKS and a
+// token endpoint checking PKCE.
+type fakeProvider struct {
+	*httptest.Server
+	key   *rsa.PrivateKey
+	mu    sync.Mutex
+	codes map[string]fakeCode
+}
+
+type fakeCode struct {
+	challenge string
+	claims    jwt.MapClaims
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %s", err)
+	}
+	p := &fakeProvider{key: key, codes: map[string]fakeCode{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                p.URL,
+			"authorization_endpoint":                p.URL + "/authorize",
+			"token_endpoint":                        p.URL + "/token",
+			"jwks_uri":                              p.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"alg": "RS256",
+				"use": "sig",
+				"kid": "test",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		p.mu.Lock()
+		code, ok := p.codes[r.PostForm.Get("code")]
+		delete(p.codes, r.PostForm.Get("code"))
+		p.mu.Unlock()
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != code.challenge {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(400)
+			w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, code.claims)
+		token.Header["kid"] = "test"
+		idToken, _ := token.SignedString(key)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "opaque",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     idToken,
+		})
+	})
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+// Play the user logging in on the provider for "authURL", returning the
+// state and code sent to the callback. "change" can tamper with the claims.
+func (p *fakeProvider) authorize(t *testing.T, authURL string, change func(jwt.MapClaims)) (string, string) {
+	t.Helper()
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("failed to parse auth URL: %s", err)
+	}
+	query := parsed.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		t.Fatalf("auth URL %s without PKCE", authURL)
+	}
+	claims := jwt.MapClaims{
+		"iss":            p.URL,
+		"sub":            "employee-42",
+		"aud":            query.Get("client_id"),
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(time.Minute).Unix(),
+		"nonce":          query.Get("nonce"),
+		"email":          "bob@corp.example.com",
+		"email_verified": true,
+		"name":           "Bob",
+	}
+	if change != nil {
+		change(claims)
+	}
+	code := "code-" + query.Get("state")
+	p.mu.Lock()
+	p.codes[code] = fakeCode{challenge: query.Get("code_challenge"), claims: claims}
+	p.mu.Unlock()
+	return query.Get("state"), code
+}
+
+func newTestRelyingParty(t *testing.T, p *fakeProvider) *RelyingParty {
+	t.Helper()
+	rp, err := New(context.Background(), Config{
+		Name:         "corp",
+		IssuerURL:    p.URL,
+		ClientID:     "chirpy",
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost:8080/api/login/oidc/corp/callback",
+	})
+	if err != nil {
+		t.Fatalf("failed to make relying party: %s", err)
+	}
+	return rp
+}
+
+func TestLoginFlow(t *testing.T) {
+	p := newFakeProvider(t)
+	rp := newTestRelyingParty(t, p)
+
+	flow, authURL, err := rp.Start()
+	if err != nil {
+		t.Fatalf("failed to Start: %s", err)
+	}
+	if !strings.HasPrefix(authURL, p.URL+"/authorize?") {
+		t.Errorf("Start returned auth URL %s", authURL)
+	}
+	state, code := p.authorize(t, authURL, nil)
+
+	identity, err := rp.Finish(context.Background(), flow, state, code)
+	if err != nil {
+		t.Fatalf("failed to Finish: %s", err)
+	}
+	expected := Identity{
+		Issuer:        p.URL,
+		Subject:       "employee-42",
+		Email:         "bob@corp.example.com",
+		EmailVerified: true,
+		Name:          "Bob",
+	}
+	if identity != expected {
+		t.Errorf("Finish returned %+v expected %+v", identity, expected)
+	}
+}
+
+func TestFinishRejectsInvalidLogins(t *testing.T) {
+	p := newFakeProvider(t)
+	rp := newTestRelyingParty(t, p)
+
+	cases := []struct {
+		name   string
+		change func(jwt.MapClaims)
+		state  func(string) string
+	}{
+		{"wrong nonce", func(c jwt.MapClaims) { c["nonce"] = "replayed" }, nil},
+		{"wrong audience", func(c jwt.MapClaims) { c["aud"] = "other-app" }, nil},
+		{"wrong issuer", func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }, nil},
+		{"expired", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() }, nil},
+		{"wrong state", nil, func(string) string { return "forged" }},
+	}
+	for _, c := range cases {
+		flow, authURL, err := rp.Start()
+		if err != nil {
+			t.Fatalf("failed to Start: %s", err)
+		}
+		state, code := p.authorize(t, authURL, c.change)
+		if c.state != nil {
+			state = c.state(state)
+		}
+		if _, err := rp.Finish(context.Background(), flow, state, code); err == nil {
+			t.Errorf("Finish accepted a login with %s", c.name)
+		}
+	}
+
+	// another flow means another PKCE verifier
+	_, authURL, _ := rp.Start()
+	otherFlow, _, _ := rp.Start()
+	state, code := p.authorize(t, authURL, nil)
+	otherFlow.State = state
+	if _, err := rp.Finish(context.Background(), otherFlow, state, code); err == nil {
+		t.Errorf("Finish accepted a code with the wrong code_verifier")
+	}
+}
+
+func TestSealAndOpenFlow(t *testing.T) {
+	flow := Flow{Provider: "corp", State: "state", Nonce: "nonce", Verifier: "verifier"}
+	sealed, err := SealFlow(flow, "secretTest", time.Minute)
+	if err != nil {
+		t.Fatalf("failed to SealFlow: %s", err)
+	}
+	opened, err := OpenFlow(sealed, "secretTest")
+	if err != nil || opened != flow {
+		t.Errorf("OpenFlow returned %+v err: %v expected %+v", opened, err, flow)
+	}
+	flow.LinkUserID = uuid.New()
+	sealed, _ = SealFlow(flow, "secretTest", time.Minute)
+	if opened, err := OpenFlow(sealed, "secretTest"); err != nil || opened != flow {
+		t.Errorf("OpenFlow returned %+v err: %v expected %+v", opened, err, flow)
+	}
+	if _, err := OpenFlow(sealed, "otherSecret"); err == nil {
+		t.Errorf("OpenFlow accepted a flow signed with another secret")
+	}
+	expired, _ := SealFlow(flow, "secretTest", -time.Minute)
+	if _, err := OpenFlow(expired, "secretTest"); err == nil {
+		t.Errorf("OpenFlow accepted an expired flow")
+	}
+}
@@ -0,0 +1,66 @@
+package throttle
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/database"
+)
+
+// PostgresStore keeps the attempts on the login_attempts table so every
+// instance sees the same failures and locks.
+type PostgresStore struct {
+	db *database.Queries
+}
+
+func NewPostgresStore(db *database.Queries) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (s *PostgresStore) Get(ctx context.Context, key string) (Attempt, error) {
+	loginAttempt, err := s.db.GetLoginAttempts(ctx, key)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Attempt{}, nil
+	}
+	if err != nil {
+		return Attempt{}, err
+	}
+	return toAttempt(loginAttempt), nil
+}
+
+func (s *PostgresStore) RecordFailure(ctx context.Context, key string, now, windowStart time.Time) (Attempt, error) {
+	loginAttempt, err := s.db.RecordLoginFailure(ctx, database.RecordLoginFailureParams{
+		Key:         key,
+		Now:         now,
+		WindowStart: windowStart,
+	})
+	if err != nil {
+		return Attempt{}, err
+	}
+	return toAttempt(loginAttempt), nil
+}
+
+func (s *PostgresStore) Lock(ctx context.Context, key string, until time.Time) error {
+	return s.db.LockLoginAttempts(ctx, database.LockLoginAttemptsParams{
+		Key:         key,
+		LockedUntil: sql.NullTime{Time: until, Valid: true},
+	})
+}
+
+func (s *PostgresStore) Reset(ctx context.Context, key string) error {
+	return s.db.DeleteLoginAttempts(ctx, key)
+}
+
+func (s *PostgresStore) Prune(ctx context.Context, windowStart time.Time) (int64, error) {
+	return s.db.DeleteStaleLoginAttempts(ctx, windowStart)
+}
+
+func toAttempt(loginAttempt database.LoginAttempt) Attempt {
+	return Attempt{
+		Failures:      int(loginAttempt.Failures),
+		LastFailureAt: loginAttempt.LastFailureAt,
+		LockedUntil:   loginAttempt.LockedUntil.Time,
+	}
+}
@@ -0,0 +1,202 @@
+package throttle
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Attempt is how many times in a row a key (e.g. an account or a client IP)
+// failed and until when it's locked.
+type Attempt struct {
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   time.Time
+}
+
+// Store persists the [Attempt]s, use [MemoryStore] when running a single
+// instance and [PostgresStore] to share them between instances.
+type Store interface {
+	// Get the attempt of the key, a key without failures returns a zero Attempt
+	Get(ctx context.Context, key string) (Attempt, error)
+	// Add a failure to the key at "now", failures before "windowStart" are
+	// forgotten, and return the updated attempt
+	RecordFailure(ctx context.Context, key string, now, windowStart time.Time) (Attempt, error)
+	// Lock the key until "until"
+	Lock(ctx context.Context, key string, until time.Time) error
+	// Forget every failure and lock of the key
+	Reset(ctx context.Context, key string) error
+	// Forget the keys whose failures and locks are all before "windowStart",
+	// returning how many were forgotten
+	Prune(ctx context.Context, windowStart time.Time) (int64, error)
+}
+
+// Policy of a [Throttler].
+type Policy struct {
+	// failures allowed before the key starts to get locked
+	FreeAttempts int
+	// lock of the first failure after the free ones, it doubles on every
+	// following failure
+	BaseDelay time.Duration
+	// the lock never gets longer than this
+	MaxDelay time.Duration
+	// failures older than this are forgotten
+	Window time.Duration
+}
+
+// 5 free attempts, then 1s, 2s, 4s... up to 15 minutes of lockout.
+var DefaultPolicy = Policy{
+	FreeAttempts: 5,
+	BaseDelay:    time.Second,
+	MaxDelay:     time.Minute * 15,
+	Window:       time.Hour,
+}
+
+// Throttler slows down guessing by locking keys with an exponential backoff
+// after too many failures.
+type Throttler struct {
+	store  Store
+	policy Policy
+	// used to override time.Now on tests
+	now func() time.Time
+}
+
+func New(store Store, policy Policy) *Throttler {
+	return &Throttler{
+		store:  store,
+		policy: policy,
+		now:    time.Now,
+	}
+}
+
+// Check returns for how long the most locked of the "keys" is still locked,
+// zero means none of them is locked and the attempt can go on.
+func (t *Throttler) Check(ctx context.Context, keys ...string) (time.Duration, error) {
+	now := t.now()
+	retryAfter := time.Duration(0)
+	for _, key := range keys {
+		attempt, err := t.store.Get(ctx, key)
+		if err != nil {
+			return 0, err
+		}
+		retryAfter = max(retryAfter, attempt.LockedUntil.Sub(now))
+	}
+	return retryAfter, nil
+}
+
+// Fail records a failure on every one of the "keys" and locks the ones that
+// ran out of free attempts, returning for how long the most locked one is
+// locked.
+func (t *Throttler) Fail(ctx context.Context, keys ...string) (time.Duration, error) {
+	now := t.now()
+	retryAfter := time.Duration(0)
+	for _, key := range keys {
+		attempt, err := t.store.RecordFailure(ctx, key, now, now.Add(-t.policy.Window))
+		if err != nil {
+			return 0, err
+		}
+		delay := t.delay(attempt.Failures)
+		if delay <= 0 {
+			continue
+		}
+		if err := t.store.Lock(ctx, key, now.Add(delay)); err != nil {
+			return 0, err
+		}
+		retryAfter = max(retryAfter, delay)
+	}
+	return retryAfter, nil
+}
+
+// Reset forgets the failures of the "key", call it after a successful attempt
+// or to unlock it.
+func (t *Throttler) Reset(ctx context.Context, key string) error {
+	return t.store.Reset(ctx, key)
+}
+
+// Prune forgets the keys that failed last out of the window and aren't
+// locked, they would be reset on their next failure anyway.
+func (t *Throttler) Prune(ctx context.Context) (int64, error) {
+	return t.store.Prune(ctx, t.now().Add(-t.policy.Window))
+}
+
+// lock duration after "failures" failures in a row
+func (t *Throttler) delay(failures int) time.Duration {
+	over := failures - t.policy.FreeAttempts
+	if over <= 0 {
+		return 0
+	}
+	delay := t.policy.BaseDelay
+	for range over - 1 {
+		delay *= 2
+		if delay >= t.policy.MaxDelay {
+			return t.policy.MaxDelay
+		}
+	}
+	return min(delay, t.policy.MaxDelay)
+}
+
+// MemoryStore keeps the attempts in memory, they are lost on restart and not
+// shared between instances.
+type MemoryStore struct {
+	mu       sync.Mutex
+	attempts map[string]Attempt
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{attempts: map[string]Attempt{}}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) (Attempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.attempts[key], nil
+}
+
+func (s *MemoryStore) RecordFailure(ctx context.Context, key string, now, windowStart time.Time) (Attempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	attempt := s.attempts[key]
+	if attempt.LastFailureAt.Before(windowStart) {
+		attempt.Failures = 0
+	}
+	attempt.Failures++
+	attempt.LastFailureAt = now
+	s.attempts[key] = attempt
+	s.sweep(windowStart)
+	return attempt, nil
+}
+
+func (s *MemoryStore) Lock(ctx context.Context, key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	attempt := s.attempts[key]
+	attempt.LockedUntil = until
+	s.attempts[key] = attempt
+	return nil
+}
+
+func (s *MemoryStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.attempts, key)
+	return nil
+}
+
+func (s *MemoryStore) Prune(ctx context.Context, windowStart time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sweep(windowStart), nil
+}
+
+// drop the keys that are out of the window and not locked so the map don't
+// grow forever, it must be called with the lock held
+func (s *MemoryStore) sweep(windowStart time.Time) int64 {
+	swept := int64(0)
+	for key, attempt := range s.attempts {
+		if attempt.LastFailureAt.Before(windowStart) && attempt.LockedUntil.Before(windowStart) {
+			delete(s.attempts, key)
+			swept++
+		}
+	}
+	return swept
+}
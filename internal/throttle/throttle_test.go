@@ -0,0 +1,111 @@
+package throttle
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func newTestThrottler() (*Throttler, *time.Time) {
+	throttler := New(NewMemoryStore(), DefaultPolicy)
+	now := time.Date(2025, 8, 21, 12, 0, 0, 0, time.UTC)
+	throttler.now = func() time.Time { return now }
+	return throttler, &now
+}
+
+func TestThrottlerBacksOffExponentially(t *testing.T) {
+	throttler, now := newTestThrottler()
+	ctx := context.Background()
+
+	for i := range DefaultPolicy.FreeAttempts {
+		retryAfter, err := throttler.Fail(ctx, "account:bob")
+		if err != nil || retryAfter != 0 {
+			t.Fatalf("Fail %d returned retryAfter: %s err: %v inside the free attempts", i, retryAfter, err)
+		}
+	}
+	for _, expected := range []time.Duration{time.Second, time.Second * 2, time.Second * 4} {
+		retryAfter, err := throttler.Fail(ctx, "account:bob")
+		if err != nil || retryAfter != expected {
+			t.Errorf("Fail returned retryAfter: %s err: %v expected %s", retryAfter, err, expected)
+		}
+		locked, _ := throttler.Check(ctx, "account:bob")
+		if locked != expected {
+			t.Errorf("Check returned %s expected %s", locked, expected)
+		}
+		*now = now.Add(expected)
+	}
+	locked, _ := throttler.Check(ctx, "account:bob")
+	if locked > 0 {
+		t.Errorf("Check returned %s after the lock expired", locked)
+	}
+}
+
+func TestThrottlerCapsTheDelay(t *testing.T) {
+	throttler, _ := newTestThrottler()
+	if delay := throttler.delay(DefaultPolicy.FreeAttempts + 100); delay != DefaultPolicy.MaxDelay {
+		t.Errorf("delay returned %s expected %s", delay, DefaultPolicy.MaxDelay)
+	}
+}
+
+func TestThrottlerChecksEveryKey(t *testing.T) {
+	throttler, _ := newTestThrottler()
+	ctx := context.Background()
+
+	// the same ip failing on many accounts gets locked
+	for i := range DefaultPolicy.FreeAttempts + 1 {
+		if _, err := throttler.Fail(ctx, "account:"+string(rune('a'+i)), "ip:10.0.0.1"); err != nil {
+			t.Fatalf("failed to Fail: %s", err)
+		}
+	}
+	locked, _ := throttler.Check(ctx, "account:z", "ip:10.0.0.1")
+	if locked <= 0 {
+		t.Errorf("Check didn't lock an ip that failed on many accounts")
+	}
+	locked, _ = throttler.Check(ctx, "account:a", "ip:10.0.0.2")
+	if locked > 0 {
+		t.Errorf("Check locked an account with a single failure from another ip")
+	}
+}
+
+func TestThrottlerForgetsFailuresOutOfTheWindowAndOnReset(t *testing.T) {
+	throttler, now := newTestThrottler()
+	ctx := context.Background()
+
+	for range DefaultPolicy.FreeAttempts {
+		throttler.Fail(ctx, "account:bob")
+	}
+	*now = now.Add(DefaultPolicy.Window + time.Second)
+	if retryAfter, _ := throttler.Fail(ctx, "account:bob"); retryAfter != 0 {
+		t.Errorf("Fail locked the key with failures out of the window")
+	}
+
+	for range DefaultPolicy.FreeAttempts {
+		throttler.Fail(ctx, "account:bob")
+	}
+	if err := throttler.Reset(ctx, "account:bob"); err != nil {
+		t.Fatalf("failed to Reset: %s", err)
+	}
+	if locked, _ := throttler.Check(ctx, "account:bob"); locked > 0 {
+		t.Errorf("Check returned %s after Reset", locked)
+	}
+}
+
+func TestThrottlerPrunesStaleKeys(t *testing.T) {
+	throttler, now := newTestThrottler()
+	ctx := context.Background()
+
+	throttler.Fail(ctx, "ip:1.2.3.4")
+	*now = now.Add(DefaultPolicy.Window / 2)
+	throttler.Fail(ctx, "ip:5.6.7.8")
+	*now = now.Add(DefaultPolicy.Window/2 + time.Second)
+	pruned, err := throttler.Prune(ctx)
+	if err != nil {
+		t.Fatalf("failed to Prune: %s", err)
+	}
+	if pruned != 1 {
+		t.Errorf("expected Prune to forget only the stale key, it forgot %d", pruned)
+	}
+	if attempt, _ := throttler.store.Get(ctx, "ip:5.6.7.8"); attempt.Failures != 1 {
+		t.Errorf("Prune forgot a key still in the window")
+	}
+}
@@ -0,0 +1,93 @@
+package tracing
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/database"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.41.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// span name of the queries without a sqlc name
+const unnamedQuery = "postgresql"
+
+// DB traces the queries made on a [database.DBTX] as client spans named by
+// the sqlc name of the query, like "GetUserByID". Queries made outside of a
+// trace, like the ones of the background loops, aren't traced so polling
+// doesn't make a trace each time.
+type DB struct {
+	db database.DBTX
+}
+
+// Trace the queries made on "db", see [DB].
+func WrapDB(db database.DBTX) *DB {
+	return &DB{db: db}
+}
+
+func (d *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := startQuery(ctx, query)
+	result, err := d.db.ExecContext(ctx, query, args...)
+	endQuery(span, err)
+	return result, err
+}
+
+func (d *DB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	ctx, span := startQuery(ctx, query)
+	stmt, err := d.db.PrepareContext(ctx, query)
+	endQuery(span, err)
+	return stmt, err
+}
+
+// The span ends once the query answers, reading the rows isn't on it.
+func (d *DB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, span := startQuery(ctx, query)
+	rows, err := d.db.QueryContext(ctx, query, args...)
+	endQuery(span, err)
+	return rows, err
+}
+
+func (d *DB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, span := startQuery(ctx, query)
+	row := d.db.QueryRowContext(ctx, query, args...)
+	endQuery(span, row.Err())
+	return row
+}
+
+// Start the span of "query" if "ctx" is part of a trace, the span returned
+// otherwise does nothing.
+func startQuery(ctx context.Context, query string) (context.Context, trace.Span) {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx, trace.SpanFromContext(ctx)
+	}
+	name := queryName(query)
+	return tracer().Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemNamePostgreSQL,
+			semconv.DBQuerySummary(name),
+			semconv.DBQueryText(query),
+		),
+	)
+}
+
+func endQuery(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Name of a query from its sqlc "-- name: GetUserByID :one" header.
+func queryName(query string) string {
+	header, _, _ := strings.Cut(query, "\n")
+	name, ok := strings.CutPrefix(header, "-- name: ")
+	if !ok {
+		return unnamedQuery
+	}
+	name, _, _ = strings.Cut(name, " ")
+	return name
+}
@@ -0,0 +1,128 @@
+// Package tracing traces the requests to Chirpy with OpenTelemetry: a server
+// span per request named by the route it matched (see [Middleware]) with a
+// child span per database query named by its sqlc name (see [WrapDB]). The
+// trace context of the callers is continued from the W3C traceparent header.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/httpx"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.41.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// name of the tracer of the spans made here
+const instrumentationName = "github.com/luigiMinardi/bootdotdev-chirpy/internal/tracing"
+
+// service.name of the spans unless OTEL_SERVICE_NAME says otherwise
+const serviceName = "chirpy"
+
+func tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Set up the global tracer provider with the "exporter", "none" (the spans
+// are dropped but the trace context still goes through) or "otlp" (sent over
+// HTTP to OTEL_EXPORTER_OTLP_ENDPOINT, see [otlptracehttp]). The returned
+// function flushes the spans left and must be called before exiting.
+func Setup(ctx context.Context, exporter string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+	switch exporter {
+	case "none":
+		otel.SetTracerProvider(noop.NewTracerProvider())
+		return func(context.Context) error { return nil }, nil
+	case "otlp":
+		spanExporter, err := otlptracehttp.New(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to make OTLP exporter: %w", err)
+		}
+		res, err := resource.New(ctx,
+			resource.WithTelemetrySDK(),
+			resource.WithAttributes(semconv.ServiceName(serviceName)),
+			resource.WithFromEnv(),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to make resource: %w", err)
+		}
+		provider := sdktrace.NewTracerProvider(
+			sdktrace.WithBatcher(spanExporter),
+			sdktrace.WithResource(res),
+		)
+		otel.SetTracerProvider(provider)
+		return provider.Shutdown, nil
+	default:
+		return nil, fmt.Errorf("invalid exporter %q, it must be \"none\" or \"otlp\"", exporter)
+	}
+}
+
+// Middleware answers every request within a server span continuing the trace
+// of the traceparent header, named by the pattern of the route the request
+// matched, it must be behind [httpx.Middleware].
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		req := httpx.FromContext(ctx)
+		method := standardMethod(r.Method)
+		name, route := spanName(method, req.Pattern)
+
+		attrs := []trace.SpanStartOption{
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPRequestMethodKey.String(method), semconv.URLPath(r.URL.Path)),
+		}
+		if route != "" {
+			attrs = append(attrs, trace.WithAttributes(semconv.HTTPRoute(route)))
+		}
+		ctx, span := tracer().Start(ctx, name, attrs...)
+		defer span.End()
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+
+		span.SetAttributes(semconv.HTTPResponseStatusCode(req.Recorder.Status))
+		if req.Recorder.Status >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(req.Recorder.Status))
+		}
+	})
+}
+
+// Name of the span of a request matching the "pattern" of a route, "{method}
+// {route}" like the OpenTelemetry conventions ask, and the route without the
+// method. Requests that didn't match any route are only named by the method
+// so unknown paths can't make a name each.
+func spanName(method, pattern string) (string, string) {
+	if method == otherMethod {
+		method = "HTTP"
+	}
+	if pattern == "" {
+		return method, ""
+	}
+	if patternMethod, route, ok := strings.Cut(pattern, " "); ok {
+		return patternMethod + " " + route, route
+	}
+	return method + " " + pattern, pattern
+}
+
+// method of the requests with a non standard one
+const otherMethod = "_OTHER"
+
+// method of the span, the non standard methods are all "_OTHER" like the
+// OpenTelemetry conventions ask
+func standardMethod(method string) string {
+	if httpx.StandardMethod(method) {
+		return method
+	}
+	return otherMethod
+}
@@ -0,0 +1,193 @@
+package tracing
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/httpx"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Record the spans in memory until the test ends.
+func record(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	previousProvider, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+	return exporter
+}
+
+// DBTX answering every query with "err"
+type fakeDB struct {
+	err error
+}
+
+func (f fakeDB) ExecContext(context.Context, string, ...interface{}) (sql.Result, error) {
+	return nil, f.err
+}
+
+func (f fakeDB) PrepareContext(context.Context, string) (*sql.Stmt, error) {
+	return nil, f.err
+}
+
+func (f fakeDB) QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error) {
+	return nil, f.err
+}
+
+func (f fakeDB) QueryRowContext(context.Context, string, ...interface{}) *sql.Row {
+	return nil
+}
+
+const deleteChirp = `-- name: DeleteChirp :one
+DELETE FROM chirps WHERE id = $1 RETURNING *`
+
+func newTestServer() http.Handler {
+	mux := http.NewServeMux()
+	db := WrapDB(fakeDB{})
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}", func(w http.ResponseWriter, r *http.Request) {
+		db.ExecContext(r.Context(), deleteChirp)
+		w.WriteHeader(204)
+	})
+	mux.HandleFunc("POST /api/chirps", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(500)
+	})
+	return httpx.Middleware(mux, Middleware(mux))
+}
+
+func attr(span tracetest.SpanStub, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestMiddleware(t *testing.T) {
+	exporter := record(t)
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	r := httptest.NewRequest("DELETE", "/api/chirps/1", nil)
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	newTestServer().ServeHTTP(httptest.NewRecorder(), r)
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("expected the query and the request spans, got %d", len(spans))
+	}
+	query, request := spans[0], spans[1]
+	if request.Name != "DELETE /api/chirps/{chirpID}" || request.SpanKind != trace.SpanKindServer {
+		t.Errorf("unexpected request span %s %s", request.Name, request.SpanKind)
+	}
+	if request.SpanContext.TraceID() != traceID || request.Parent.SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("expected the request span to continue the traceparent, got trace %s parent %s",
+			request.SpanContext.TraceID(), request.Parent.SpanID())
+	}
+	if got := attr(request, "http.route").AsString(); got != "/api/chirps/{chirpID}" {
+		t.Errorf("expected the route attribute, got %q", got)
+	}
+	if got := attr(request, "http.response.status_code").AsInt64(); got != 204 {
+		t.Errorf("expected the status code attribute to be 204, got %d", got)
+	}
+	if query.Name != "DeleteChirp" || query.Parent.SpanID() != request.SpanContext.SpanID() {
+		t.Errorf("expected a DeleteChirp span child of the request, got %s", query.Name)
+	}
+}
+
+func TestMiddlewareStatus(t *testing.T) {
+	tests := []struct {
+		method, path, name string
+		status             codes.Code
+	}{
+		{"POST", "/api/chirps", "POST /api/chirps", codes.Error},
+		{"GET", "/nope", "GET", codes.Unset},
+		{"BREW", "/nope", "HTTP", codes.Unset},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter := record(t)
+
+			newTestServer().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(tt.method, tt.path, nil))
+
+			span := exporter.GetSpans()[0]
+			if span.Name != tt.name || span.Status.Code != tt.status {
+				t.Errorf("expected span %q with status %s, got %q with %s", tt.name, tt.status, span.Name, span.Status.Code)
+			}
+		})
+	}
+}
+
+func TestDB(t *testing.T) {
+	exporter := record(t)
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "parent")
+	db := WrapDB(fakeDB{err: errors.New("boom")})
+
+	db.QueryContext(ctx, deleteChirp)
+	parent.End()
+
+	query := exporter.GetSpans()[0]
+	if query.Name != "DeleteChirp" || query.SpanKind != trace.SpanKindClient {
+		t.Errorf("unexpected query span %s %s", query.Name, query.SpanKind)
+	}
+	if query.Status.Code != codes.Error || len(query.Events) != 1 {
+		t.Errorf("expected the error to be recorded, got status %s", query.Status.Code)
+	}
+	if got := attr(query, "db.system.name").AsString(); got != "postgresql" {
+		t.Errorf("expected the db system attribute, got %q", got)
+	}
+}
+
+func TestDBWithoutTrace(t *testing.T) {
+	exporter := record(t)
+
+	WrapDB(fakeDB{}).ExecContext(context.Background(), deleteChirp)
+
+	if spans := exporter.GetSpans(); len(spans) != 0 {
+		t.Errorf("expected queries outside of a trace not to be traced, got %d spans", len(spans))
+	}
+}
+
+func TestQueryName(t *testing.T) {
+	tests := []struct {
+		query, want string
+	}{
+		{deleteChirp, "DeleteChirp"},
+		{"-- name: GetAllChirps :many\nSELECT 1", "GetAllChirps"},
+		{"SELECT 1", unnamedQuery},
+	}
+	for _, tt := range tests {
+		if got := queryName(tt.query); got != tt.want {
+			t.Errorf("queryName(%q) = %q, expected %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestSetup(t *testing.T) {
+	record(t)
+	if _, err := Setup(context.Background(), "zipkin"); err == nil {
+		t.Errorf("expected an unknown exporter to fail")
+	}
+	shutdown, err := Setup(context.Background(), "none")
+	if err != nil {
+		t.Fatalf("failed to set up the none exporter: %s", err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Errorf("failed to shut down: %s", err)
+	}
+}
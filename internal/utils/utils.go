@@ -2,10 +2,9 @@ package utils
 
 import (
 	"encoding/json"
+	"log/slog"
 	"net/http"
-	"time"
 
-	"github.com/google/uuid"
 	"github.com/luigiMinardi/bootdotdev-chirpy/internal/logging"
 )
 
@@ -14,18 +13,26 @@ type ReturnError struct {
 	Error string `json:"error"`
 }
 
-// struct that defines a return value for a user, omiting its password
-// based on database.User
-type UserWithNoPassword struct {
-	ID          uuid.UUID `json:"id"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
-	Email       string    `json:"email"`
-	IsChirpyRed bool      `json:"is_chirpy_red"`
+// struct that defines the return error for a request that broke one or more
+// validation rules, listing every one of them
+type ReturnValidationError struct {
+	Error      string `json:"error"`
+	Violations any    `json:"violations"`
 }
 
-func ResponseWithError(w http.ResponseWriter, code int, errorMsg, logErrMsg string, err any) {
-	logging.LogError(logErrMsg, err)
+// Answer "r" with "errorMsg" and log "logErrMsg" with "err", as an error when
+// it's the server's fault and as a warning when it's the client's. The log
+// has the request and user of "r" and the source of the caller.
+func ResponseWithError(w http.ResponseWriter, r *http.Request, code int, errorMsg, logErrMsg string, err any) {
+	args := []any{"status", code, "err", err}
+	if userID := logging.UserID(r.Context()); userID != "" {
+		args = append(args, "user_id", userID)
+	}
+	level := slog.LevelWarn
+	if code >= 500 {
+		level = slog.LevelError
+	}
+	logging.LogCallerContext(r.Context(), level, logErrMsg, args...)
 	respBody := ReturnError{
 		Error: errorMsg,
 	}
@@ -36,7 +43,7 @@ func ResponseWithError(w http.ResponseWriter, code int, errorMsg, logErrMsg stri
 func ResponseWithJson(w http.ResponseWriter, code int, data any) {
 	dataAsJson, err := json.Marshal(data)
 	if err != nil {
-		logging.LogError("failed to marshal JSON: %s", err)
+		logging.LogError("failed to marshal JSON", "err", err)
 		w.WriteHeader(500)
 		return
 	}
@@ -0,0 +1,136 @@
+package webhook
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MemoryStore keeps the queue in memory, it's meant for tests.
+type MemoryStore struct {
+	mu         sync.Mutex
+	endpoints  []Endpoint
+	deliveries map[uuid.UUID]*memoryDelivery
+	// used for the due time and the locks
+	Now func() time.Time
+}
+
+type memoryDelivery struct {
+	Delivery
+	lockedUntil time.Time
+	attempts    []Attempt
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{deliveries: map[uuid.UUID]*memoryDelivery{}}
+}
+
+func (s *MemoryStore) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
+
+// Register an endpoint, endpoints are registered through the database
+// otherwise.
+func (s *MemoryStore) AddEndpoint(endpoint Endpoint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.endpoints = append(s.endpoints, endpoint)
+}
+
+func (s *MemoryStore) Enqueue(ctx context.Context, event Event, payload []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	queued := 0
+	for _, endpoint := range s.endpoints {
+		if !endpoint.Wants(event) || s.queued(endpoint.ID, event.ID) {
+			continue
+		}
+		delivery := Delivery{
+			ID:          uuid.New(),
+			EndpointID:  endpoint.ID,
+			URL:         endpoint.URL,
+			Secret:      endpoint.Secret,
+			EventID:     event.ID,
+			EventType:   event.Type,
+			Payload:     payload,
+			Status:      StatusPending,
+			NextAttempt: s.now(),
+		}
+		s.deliveries[delivery.ID] = &memoryDelivery{Delivery: delivery}
+		queued++
+	}
+	return queued, nil
+}
+
+func (s *MemoryStore) queued(endpointID, eventID uuid.UUID) bool {
+	for _, delivery := range s.deliveries {
+		if delivery.EndpointID == endpointID && delivery.EventID == eventID {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *MemoryStore) ClaimDue(ctx context.Context, limit int, lockedUntil time.Time) ([]Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	var due []*memoryDelivery
+	for _, delivery := range s.deliveries {
+		if delivery.Status == StatusPending && !delivery.NextAttempt.After(now) && !delivery.lockedUntil.After(now) {
+			due = append(due, delivery)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].NextAttempt.Before(due[j].NextAttempt) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	claimed := make([]Delivery, len(due))
+	for i, delivery := range due {
+		delivery.lockedUntil = lockedUntil
+		claimed[i] = delivery.Delivery
+	}
+	return claimed, nil
+}
+
+func (s *MemoryStore) RecordAttempt(ctx context.Context, delivery Delivery, attempt Attempt) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.deliveries[delivery.ID]
+	if !ok {
+		return nil
+	}
+	stored.Status = delivery.Status
+	stored.Attempts = delivery.Attempts
+	stored.NextAttempt = delivery.NextAttempt
+	stored.lockedUntil = time.Time{}
+	stored.attempts = append(stored.attempts, attempt)
+	return nil
+}
+
+// Deliveries queued, in no particular order.
+func (s *MemoryStore) Deliveries() []Delivery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	deliveries := make([]Delivery, 0, len(s.deliveries))
+	for _, delivery := range s.deliveries {
+		deliveries = append(deliveries, delivery.Delivery)
+	}
+	return deliveries
+}
+
+// Attempts logged for the delivery with "deliveryID".
+func (s *MemoryStore) Attempts(deliveryID uuid.UUID) []Attempt {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if delivery, ok := s.deliveries[deliveryID]; ok {
+		return append([]Attempt(nil), delivery.attempts...)
+	}
+	return nil
+}
@@ -0,0 +1,308 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/logging"
+)
+
+// Events sent to the registered endpoints.
+const (
+	EventChirpCreated   = "chirp.created"
+	EventChirpDeleted   = "chirp.deleted"
+	EventUserUpgraded   = "user.upgraded"
+	EventUserDowngraded = "user.downgraded"
+)
+
+// Events is every event an endpoint can subscribe to.
+var Events = []string{EventChirpCreated, EventChirpDeleted, EventUserUpgraded, EventUserDowngraded}
+
+// IDHeader has the id of the event, the same on every retry so the receiver
+// can dedupe them.
+const IDHeader = "Webhook-Id"
+
+// Delivery statuses, a delivery is dead after failing MaxAttempts times.
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusDead      = "dead"
+)
+
+// Event is what the endpoints receive as the JSON body.
+type Event struct {
+	ID        uuid.UUID `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	// user the event is about, only endpoints of that user or for all
+	// users get it
+	UserID uuid.UUID `json:"user_id"`
+	Data   any       `json:"data"`
+}
+
+// Endpoint is a URL registered to receive events.
+type Endpoint struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+	URL    string
+	Secret []byte
+	// events it's subscribed to, every event when empty
+	Events []string
+	// registered by an admin to get the events of every user, the
+	// [PostgresStore] stops queueing them if the owner stops being one
+	AllUsers bool
+}
+
+// Does the endpoint want "event".
+func (e Endpoint) Wants(event Event) bool {
+	if !e.AllUsers && e.UserID != event.UserID {
+		return false
+	}
+	return len(e.Events) == 0 || slices.Contains(e.Events, event.Type)
+}
+
+// Delivery is an event queued to be sent to an endpoint.
+type Delivery struct {
+	ID          uuid.UUID
+	EndpointID  uuid.UUID
+	URL         string
+	Secret      []byte
+	EventID     uuid.UUID
+	EventType   string
+	Payload     []byte
+	Status      string
+	Attempts    int
+	NextAttempt time.Time
+}
+
+// Attempt is the log of sending a delivery once.
+type Attempt struct {
+	At time.Time
+	// 0 when no response was received
+	StatusCode int
+	Error      string
+	Duration   time.Duration
+}
+
+// Store is the durable delivery queue.
+type Store interface {
+	// Queue a delivery of "event" to every endpoint that wants it and
+	// doesn't have it queued already, returning how many were queued.
+	Enqueue(ctx context.Context, event Event, payload []byte) (int, error)
+	// Get up to "limit" pending deliveries that are due, they aren't
+	// returned again until "lockedUntil" so a slow delivery isn't sent twice.
+	ClaimDue(ctx context.Context, limit int, lockedUntil time.Time) ([]Delivery, error)
+	// Log "attempt" and save the new status, attempts and next attempt of
+	// "delivery".
+	RecordAttempt(ctx context.Context, delivery Delivery, attempt Attempt) error
+}
+
+// Make the secret endpoints verify the signatures with, it's shown once
+// when the endpoint is registered.
+func NewSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(secret), nil
+}
+
+// Backoff is how long to wait after the "attempt"th failed attempt: 30
+// seconds doubling every attempt, up to 6 hours.
+func Backoff(attempt int) time.Duration {
+	wait := time.Second * 30
+	for i := 1; i < attempt && wait < time.Hour*6; i++ {
+		wait *= 2
+	}
+	return min(wait, time.Hour*6)
+}
+
+// Dispatcher queues events and sends the due deliveries.
+type Dispatcher struct {
+	Store  Store
+	Client *http.Client
+	// deliveries failing this many times are dead and not retried
+	MaxAttempts int
+	// deliveries sent on each run
+	BatchSize int
+	// wait after the nth failed attempt, [Backoff] by default
+	Backoff func(attempt int) time.Duration
+	// current time, [time.Now] when nil
+	Now func() time.Time
+}
+
+func NewDispatcher(store Store) *Dispatcher {
+	return &Dispatcher{
+		Store:       store,
+		Client:      NewClient(false),
+		MaxAttempts: 10,
+		BatchSize:   20,
+		Backoff:     Backoff,
+	}
+}
+
+// Returned when a delivery would connect to an address that isn't public.
+var ErrPrivateAddress = errors.New("webhook: endpoint address isn't public")
+
+// Client sending the deliveries. It refuses to connect to addresses that
+// aren't public, unless "allowPrivate", so endpoints can't be used to reach
+// the internal network. It's checked on the resolved address when
+// connecting, a hostname resolving to one is refused as well.
+func NewClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: time.Second * 5,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			if allowPrivate {
+				return nil
+			}
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			addr, err := netip.ParseAddr(host)
+			if err != nil || !PublicAddr(addr) {
+				return ErrPrivateAddress
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// through a proxy the dialer would only see the proxy address
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   time.Second * 10,
+		Transport: transport,
+		// a redirect is a failed delivery, the endpoint URL must be fixed
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// Whether "addr" is a public address endpoints can be on, loopback, private,
+// link-local, multicast and unspecified addresses aren't.
+func PublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsValid() && !addr.IsLoopback() && !addr.IsPrivate() &&
+		!addr.IsLinkLocalUnicast() && !addr.IsLinkLocalMulticast() &&
+		!addr.IsInterfaceLocalMulticast() && !addr.IsMulticast() && !addr.IsUnspecified()
+}
+
+func (d *Dispatcher) now() time.Time {
+	if d.Now != nil {
+		return d.Now()
+	}
+	return time.Now()
+}
+
+// Queue an event of "eventType" about "userID" to the endpoints that want it.
+func (d *Dispatcher) Publish(ctx context.Context, eventType string, userID uuid.UUID, data any) error {
+	return d.PublishEvent(ctx, Event{
+		ID:        uuid.New(),
+		Type:      eventType,
+		CreatedAt: d.now().UTC(),
+		UserID:    userID,
+		Data:      data,
+	})
+}
+
+// Queue "event" to the endpoints that want it, an event already queued isn't
+// queued again so it can be published more than once.
+func (d *Dispatcher) PublishEvent(ctx context.Context, event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook event: %w", err)
+	}
+	_, err = d.Store.Enqueue(ctx, event, payload)
+	return err
+}
+
+// Send the deliveries that are due, returning how many were sent
+// successfully.
+func (d *Dispatcher) DeliverDue(ctx context.Context) (int, error) {
+	// they are sent one after the other, so the last one can wait for every
+	// other to time out before its own does
+	lockedUntil := d.now().Add(time.Duration(d.BatchSize)*d.Client.Timeout + time.Minute)
+	deliveries, err := d.Store.ClaimDue(ctx, d.BatchSize, lockedUntil)
+	if err != nil {
+		return 0, err
+	}
+	delivered := 0
+	for _, delivery := range deliveries {
+		attempt := d.send(ctx, delivery)
+		delivery.Attempts++
+		switch {
+		case attempt.Error == "":
+			delivery.Status = StatusDelivered
+			delivered++
+		case delivery.Attempts >= d.MaxAttempts:
+			delivery.Status = StatusDead
+		default:
+			delivery.Status = StatusPending
+			delivery.NextAttempt = attempt.At.Add(d.Backoff(delivery.Attempts))
+		}
+		if err := d.Store.RecordAttempt(ctx, delivery, attempt); err != nil {
+			return delivered, err
+		}
+	}
+	return delivered, nil
+}
+
+// POST the delivery payload signed with the endpoint secret.
+func (d *Dispatcher) send(ctx context.Context, delivery Delivery) Attempt {
+	attempt := Attempt{At: d.now()}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "Chirpy-Webhooks/1.0")
+	request.Header.Set(IDHeader, delivery.EventID.String())
+	SetHeaders(request.Header, delivery.Secret, attempt.At, delivery.Payload)
+
+	start := time.Now()
+	response, err := d.Client.Do(request)
+	attempt.Duration = time.Since(start)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(response.Body, 1<<16))
+	attempt.StatusCode = response.StatusCode
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		attempt.Error = fmt.Sprintf("endpoint answered %d", response.StatusCode)
+	}
+	return attempt
+}
+
+// Send the due deliveries every "interval" until "ctx" is done.
+func (d *Dispatcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := d.DeliverDue(ctx); err != nil {
+			logging.LogError("failed to send webhook deliveries", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,375 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// receiver is an endpoint checking the signatures at the time of "c", it
+// answers with the status codes queued on "statuses" and then 204.
+type receiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	events   []Event
+	ids      []string
+}
+
+func newReceiver(t *testing.T, c *clock, secret []byte, statuses ...int) *receiver {
+	t.Helper()
+	rc := &receiver{statuses: statuses}
+	verifier := NewVerifier([][]byte{secret}, time.Minute*5)
+	verifier.Now = c.Now
+	rc.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := verifier.Verify(r.Header, body); err != nil {
+			t.Errorf("receiver got an invalid signature: %s", err)
+			w.WriteHeader(401)
+			return
+		}
+		rc.mu.Lock()
+		defer rc.mu.Unlock()
+		var event Event
+		if err := json.Unmarshal(body, &event); err != nil {
+			t.Errorf("receiver got an invalid body: %s", err)
+		}
+		rc.events = append(rc.events, event)
+		rc.ids = append(rc.ids, r.Header.Get(IDHeader))
+		status := 204
+		if len(rc.statuses) > 0 {
+			status, rc.statuses = rc.statuses[0], rc.statuses[1:]
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(rc.Close)
+	return rc
+}
+
+func (rc *receiver) received() []Event {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return append([]Event(nil), rc.events...)
+}
+
+// clock is a fake time shared by the dispatcher and the store.
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func newTestDispatcher(store *MemoryStore, c *clock) *Dispatcher {
+	store.Now = c.Now
+	d := NewDispatcher(store)
+	// the receivers are on 127.0.0.1
+	d.Client = NewClient(true)
+	d.Now = c.Now
+	d.MaxAttempts = 3
+	return d
+}
+
+func TestDeliver(t *testing.T) {
+	ctx := context.Background()
+	secret := []byte("whsec_test")
+	c := &clock{now: time.Now()}
+	rc := newReceiver(t, c, secret)
+	store := NewMemoryStore()
+	d := newTestDispatcher(store, c)
+
+	userID := uuid.New()
+	store.AddEndpoint(Endpoint{ID: uuid.New(), UserID: userID, URL: rc.URL, Secret: secret})
+
+	if err := d.Publish(ctx, EventChirpCreated, userID, map[string]string{"body": "hello"}); err != nil {
+		t.Fatalf("failed to publish: %s", err)
+	}
+	delivered, err := d.DeliverDue(ctx)
+	if err != nil {
+		t.Fatalf("failed to deliver: %s", err)
+	}
+	if delivered != 1 {
+		t.Fatalf("expected 1 delivery, got %d", delivered)
+	}
+
+	events := rc.received()
+	if len(events) != 1 || events[0].Type != EventChirpCreated || events[0].UserID != userID {
+		t.Fatalf("unexpected events received: %+v", events)
+	}
+	if rc.ids[0] != events[0].ID.String() {
+		t.Errorf("expected the %s header to be the event id", IDHeader)
+	}
+	deliveries := store.Deliveries()
+	if deliveries[0].Status != StatusDelivered || deliveries[0].Attempts != 1 {
+		t.Errorf("expected a delivered delivery after 1 attempt, got %+v", deliveries[0])
+	}
+	if attempts := store.Attempts(deliveries[0].ID); len(attempts) != 1 || attempts[0].StatusCode != 204 {
+		t.Errorf("expected 1 attempt logged with 204, got %+v", attempts)
+	}
+
+	// nothing is due anymore
+	if delivered, _ := d.DeliverDue(ctx); delivered != 0 {
+		t.Errorf("expected nothing to be delivered again, got %d", delivered)
+	}
+}
+
+func TestDeliverFilters(t *testing.T) {
+	ctx := context.Background()
+	secret := []byte("whsec_test")
+	c := &clock{now: time.Now()}
+	store := NewMemoryStore()
+	d := newTestDispatcher(store, c)
+
+	owner := uuid.New()
+	other := uuid.New()
+	chirps := newReceiver(t, c, secret)
+	everything := newReceiver(t, c, secret)
+	admin := newReceiver(t, c, secret)
+	store.AddEndpoint(Endpoint{ID: uuid.New(), UserID: owner, URL: chirps.URL, Secret: secret, Events: []string{EventChirpCreated}})
+	store.AddEndpoint(Endpoint{ID: uuid.New(), UserID: owner, URL: everything.URL, Secret: secret})
+	store.AddEndpoint(Endpoint{ID: uuid.New(), UserID: uuid.New(), URL: admin.URL, Secret: secret, AllUsers: true})
+
+	d.Publish(ctx, EventChirpCreated, owner, nil)
+	d.Publish(ctx, EventUserUpgraded, owner, nil)
+	d.Publish(ctx, EventChirpCreated, other, nil)
+	if _, err := d.DeliverDue(ctx); err != nil {
+		t.Fatalf("failed to deliver: %s", err)
+	}
+
+	if got := len(chirps.received()); got != 1 {
+		t.Errorf("expected the chirps only endpoint to get 1 event, got %d", got)
+	}
+	if got := len(everything.received()); got != 2 {
+		t.Errorf("expected the endpoint without filters to get the 2 events of its user, got %d", got)
+	}
+	if got := len(admin.received()); got != 3 {
+		t.Errorf("expected the endpoint for all users to get 3 events, got %d", got)
+	}
+}
+
+func TestPublishEventOnce(t *testing.T) {
+	ctx := context.Background()
+	secret := []byte("whsec_test")
+	c := &clock{now: time.Now()}
+	rc := newReceiver(t, c, secret)
+	store := NewMemoryStore()
+	d := newTestDispatcher(store, c)
+
+	userID := uuid.New()
+	store.AddEndpoint(Endpoint{ID: uuid.New(), UserID: userID, URL: rc.URL, Secret: secret})
+	event := Event{ID: uuid.New(), Type: EventChirpCreated, CreatedAt: c.now, UserID: userID}
+	for range 2 {
+		if err := d.PublishEvent(ctx, event); err != nil {
+			t.Fatalf("failed to publish: %s", err)
+		}
+	}
+	d.DeliverDue(ctx)
+
+	if got := len(rc.received()); got != 1 {
+		t.Errorf("expected an event published twice to be delivered once, got %d", got)
+	}
+}
+
+func TestDeliverRetriesWithBackoff(t *testing.T) {
+	ctx := context.Background()
+	secret := []byte("whsec_test")
+	c := &clock{now: time.Now()}
+	rc := newReceiver(t, c, secret, 500, 503)
+	store := NewMemoryStore()
+	d := newTestDispatcher(store, c)
+
+	userID := uuid.New()
+	store.AddEndpoint(Endpoint{ID: uuid.New(), UserID: userID, URL: rc.URL, Secret: secret})
+	d.Publish(ctx, EventChirpDeleted, userID, nil)
+
+	if delivered, _ := d.DeliverDue(ctx); delivered != 0 {
+		t.Fatalf("expected the first attempt to fail, got %d delivered", delivered)
+	}
+	delivery := store.Deliveries()[0]
+	if want := c.now.Add(Backoff(1)); !delivery.NextAttempt.Equal(want) {
+		t.Errorf("expected the next attempt at %s, got %s", want, delivery.NextAttempt)
+	}
+
+	// not due yet
+	if _, err := d.DeliverDue(ctx); err != nil || len(rc.received()) != 1 {
+		t.Fatalf("expected no retry before the backoff, got %d attempts", len(rc.received()))
+	}
+
+	c.now = c.now.Add(Backoff(1))
+	d.DeliverDue(ctx)
+	delivery = store.Deliveries()[0]
+	if want := c.now.Add(Backoff(2)); !delivery.NextAttempt.Equal(want) {
+		t.Errorf("expected the backoff to grow to %s, got %s", Backoff(2), delivery.NextAttempt.Sub(c.now))
+	}
+
+	c.now = c.now.Add(Backoff(2))
+	if delivered, _ := d.DeliverDue(ctx); delivered != 1 {
+		t.Fatalf("expected the third attempt to be delivered, got %d", delivered)
+	}
+	events := rc.received()
+	if len(events) != 3 || events[0].ID != events[2].ID {
+		t.Errorf("expected 3 attempts of the same event, got %+v", events)
+	}
+	attempts := store.Attempts(delivery.ID)
+	if len(attempts) != 3 || attempts[0].StatusCode != 500 || attempts[0].Error == "" || attempts[2].Error != "" {
+		t.Errorf("unexpected attempts logged: %+v", attempts)
+	}
+}
+
+func TestDeliverDeadLetter(t *testing.T) {
+	ctx := context.Background()
+	secret := []byte("whsec_test")
+	c := &clock{now: time.Now()}
+	rc := newReceiver(t, c, secret, 500, 500, 500, 500)
+	store := NewMemoryStore()
+	d := newTestDispatcher(store, c)
+
+	userID := uuid.New()
+	store.AddEndpoint(Endpoint{ID: uuid.New(), UserID: userID, URL: rc.URL, Secret: secret})
+	d.Publish(ctx, EventChirpCreated, userID, nil)
+
+	for attempt := 1; attempt <= 5; attempt++ {
+		d.DeliverDue(ctx)
+		c.now = c.now.Add(time.Hour * 24)
+	}
+
+	delivery := store.Deliveries()[0]
+	if delivery.Status != StatusDead {
+		t.Errorf("expected the delivery to be dead, got %s", delivery.Status)
+	}
+	if got := len(rc.received()); got != d.MaxAttempts {
+		t.Errorf("expected %d attempts before giving up, got %d", d.MaxAttempts, got)
+	}
+}
+
+// Deliveries must stay claimed while the ones before them in the batch are
+// being sent, or another instance could send them too.
+func TestDeliverDueKeepsTheBatchClaimed(t *testing.T) {
+	ctx := context.Background()
+	c := &clock{now: time.Now()}
+	store := NewMemoryStore()
+	d := newTestDispatcher(store, c)
+	reclaimed := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// every endpoint takes as long as it's allowed to
+		c.now = c.now.Add(d.Client.Timeout)
+		claimed, _ := store.ClaimDue(ctx, d.BatchSize, c.now)
+		reclaimed += len(claimed)
+		w.WriteHeader(204)
+	}))
+	t.Cleanup(server.Close)
+
+	userID := uuid.New()
+	for range 5 {
+		store.AddEndpoint(Endpoint{ID: uuid.New(), UserID: userID, URL: server.URL, Secret: []byte("whsec_test")})
+	}
+	d.Publish(ctx, EventChirpCreated, userID, nil)
+	d.DeliverDue(ctx)
+
+	if reclaimed != 0 {
+		t.Errorf("expected the batch to stay claimed while it's sent, %d were claimed again", reclaimed)
+	}
+}
+
+func TestDeliverRedirectFails(t *testing.T) {
+	ctx := context.Background()
+	secret := []byte("whsec_test")
+	c := &clock{now: time.Now()}
+	target := newReceiver(t, c, secret)
+	redirect := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusFound))
+	defer redirect.Close()
+	store := NewMemoryStore()
+	d := newTestDispatcher(store, c)
+
+	userID := uuid.New()
+	store.AddEndpoint(Endpoint{ID: uuid.New(), UserID: userID, URL: redirect.URL, Secret: secret})
+	d.Publish(ctx, EventChirpCreated, userID, nil)
+
+	if delivered, _ := d.DeliverDue(ctx); delivered != 0 {
+		t.Errorf("expected a redirect to be a failed delivery")
+	}
+	if got := len(target.received()); got != 0 {
+		t.Errorf("expected the redirect not to be followed, got %d events", got)
+	}
+}
+
+func TestDeliverPrivateAddressFails(t *testing.T) {
+	ctx := context.Background()
+	secret := []byte("whsec_test")
+	c := &clock{now: time.Now()}
+	rc := newReceiver(t, c, secret)
+	store := NewMemoryStore()
+	d := newTestDispatcher(store, c)
+	d.Client = NewClient(false)
+
+	userID := uuid.New()
+	store.AddEndpoint(Endpoint{ID: uuid.New(), UserID: userID, URL: rc.URL, Secret: secret})
+	d.Publish(ctx, EventChirpCreated, userID, nil)
+
+	if delivered, _ := d.DeliverDue(ctx); delivered != 0 {
+		t.Errorf("expected a delivery to 127.0.0.1 to fail")
+	}
+	if got := len(rc.received()); got != 0 {
+		t.Errorf("expected no connection to a private address, got %d events", got)
+	}
+	attempts := store.Attempts(store.Deliveries()[0].ID)
+	if len(attempts) != 1 || !strings.Contains(attempts[0].Error, ErrPrivateAddress.Error()) {
+		t.Errorf("expected the attempt to fail with ErrPrivateAddress, got %+v", attempts)
+	}
+}
+
+func TestPublicAddr(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"fd00::1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"::ffff:127.0.0.1", false},
+		{"224.0.0.1", false},
+	}
+	for _, tt := range tests {
+		if got := PublicAddr(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("PublicAddr(%s): expected %v, got %v", tt.addr, tt.want, got)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, time.Second * 30},
+		{2, time.Minute},
+		{3, time.Minute * 2},
+		{10, time.Hour*4 + time.Minute*16},
+		{11, time.Hour * 6},
+		{100, time.Hour * 6},
+	}
+	for _, tt := range tests {
+		if got := Backoff(tt.attempt); got != tt.want {
+			t.Errorf("Backoff(%d): expected %s, got %s", tt.attempt, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package webhook
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/auth"
+	"github.com/luigiMinardi/bootdotdev-chirpy/internal/database"
+)
+
+// PostgresStore keeps the queue on the webhook_deliveries table so queued
+// deliveries survive restarts and every instance can send them.
+type PostgresStore struct {
+	db *database.Queries
+	// opens the endpoint secrets, they're sealed at rest
+	box *auth.SecretBox
+}
+
+func NewPostgresStore(db *database.Queries, box *auth.SecretBox) *PostgresStore {
+	return &PostgresStore{db: db, box: box}
+}
+
+func (s *PostgresStore) Enqueue(ctx context.Context, event Event, payload []byte) (int, error) {
+	queued, err := s.db.EnqueueWebhookDeliveries(ctx, database.EnqueueWebhookDeliveriesParams{
+		EventID:   event.ID,
+		EventType: event.Type,
+		Payload:   payload,
+		UserID:    event.UserID,
+	})
+	return int(queued), err
+}
+
+func (s *PostgresStore) ClaimDue(ctx context.Context, limit int, lockedUntil time.Time) ([]Delivery, error) {
+	rows, err := s.db.ClaimWebhookDeliveries(ctx, database.ClaimWebhookDeliveriesParams{
+		LockedUntil: lockedUntil,
+		BatchSize:   int32(limit),
+	})
+	if err != nil {
+		return nil, err
+	}
+	deliveries := make([]Delivery, 0, len(rows))
+	for _, row := range rows {
+		secret, err := s.box.Open(row.Secret)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open the secret of webhook endpoint %s: %w", row.EndpointID, err)
+		}
+		deliveries = append(deliveries, Delivery{
+			ID:          row.ID,
+			EndpointID:  row.EndpointID,
+			URL:         row.Url,
+			Secret:      secret,
+			EventID:     row.EventID,
+			EventType:   row.EventType,
+			Payload:     row.Payload,
+			Status:      row.Status,
+			Attempts:    int(row.Attempts),
+			NextAttempt: row.NextAttemptAt,
+		})
+	}
+	return deliveries, nil
+}
+
+func (s *PostgresStore) RecordAttempt(ctx context.Context, delivery Delivery, attempt Attempt) error {
+	return s.db.RecordWebhookDeliveryAttempt(ctx, database.RecordWebhookDeliveryAttemptParams{
+		ID:            delivery.ID,
+		Status:        delivery.Status,
+		Attempts:      int32(delivery.Attempts),
+		NextAttemptAt: delivery.NextAttempt,
+		StatusCode:    sql.NullInt32{Int32: int32(attempt.StatusCode), Valid: attempt.StatusCode != 0},
+		Error:         sql.NullString{String: attempt.Error, Valid: attempt.Error != ""},
+		AttemptedAt:   attempt.At,
+		DurationMs:    int32(attempt.Duration.Milliseconds()),
+	})
+}
@@ -0,0 +1,109 @@
+// Package webhook signs and verifies webhook deliveries with HMAC-SHA256, and
+// sends the events of Chirpy to the endpoints registered for them, see
+// [Dispatcher].
+//
+// The sender puts the unix time of the delivery on the Webhook-Timestamp
+// header and "v1=<hex HMAC of timestamp + "." + body>" on the
+// Webhook-Signature header. The signature header may have more than one
+// space separated signature, one for each secret the sender is signing with
+// while rotating them.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	TimestampHeader = "Webhook-Timestamp"
+	SignatureHeader = "Webhook-Signature"
+	// only version of the signature scheme
+	signatureVersion = "v1"
+)
+
+var (
+	ErrMissingSignature = errors.New("webhook signature or timestamp header missing")
+	ErrInvalidTimestamp = errors.New("webhook timestamp outside of the tolerance window")
+	ErrInvalidSignature = errors.New("webhook signature doesn't match")
+)
+
+// Sign the delivery of "body" at "timestamp" with "secret", returning the
+// value of the Webhook-Signature header.
+func Sign(secret []byte, timestamp time.Time, body []byte) string {
+	return signatureVersion + "=" + hex.EncodeToString(mac(secret, strconv.FormatInt(timestamp.Unix(), 10), body))
+}
+
+// Set the timestamp and signature headers of a delivery of "body" signed
+// with "secret".
+func SetHeaders(header http.Header, secret []byte, timestamp time.Time, body []byte) {
+	header.Set(TimestampHeader, strconv.FormatInt(timestamp.Unix(), 10))
+	header.Set(SignatureHeader, Sign(secret, timestamp, body))
+}
+
+func mac(secret []byte, timestamp string, body []byte) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(timestamp))
+	h.Write([]byte("."))
+	h.Write(body)
+	return h.Sum(nil)
+}
+
+// Verifier checks deliveries signed with any of its secrets.
+type Verifier struct {
+	// every secret accepted, more than one while rotating them
+	Secrets [][]byte
+	// how far the timestamp can be from now, so a captured delivery can't
+	// be replayed later
+	Tolerance time.Duration
+	// current time, [time.Now] when nil
+	Now func() time.Time
+}
+
+func NewVerifier(secrets [][]byte, tolerance time.Duration) *Verifier {
+	return &Verifier{Secrets: secrets, Tolerance: tolerance}
+}
+
+// Verify the signature headers of a delivery of "body".
+func (v *Verifier) Verify(header http.Header, body []byte) error {
+	timestamp := header.Get(TimestampHeader)
+	signatures := header.Get(SignatureHeader)
+	if timestamp == "" || signatures == "" {
+		return ErrMissingSignature
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidTimestamp
+	}
+	now := time.Now()
+	if v.Now != nil {
+		now = v.Now()
+	}
+	age := now.Sub(time.Unix(unix, 0))
+	if age > v.Tolerance || age < -v.Tolerance {
+		return ErrInvalidTimestamp
+	}
+
+	for _, signature := range strings.Fields(signatures) {
+		version, value, ok := strings.Cut(signature, "=")
+		if !ok || version != signatureVersion {
+			continue
+		}
+		sent, err := hex.DecodeString(value)
+		if err != nil {
+			continue
+		}
+		for _, secret := range v.Secrets {
+			if hmac.Equal(sent, mac(secret, timestamp, body)) {
+				return nil
+			}
+		}
+	}
+	return ErrInvalidSignature
+}
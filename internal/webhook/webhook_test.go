@@ -0,0 +1,94 @@
+package webhook
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+var (
+	oldSecret = []byte("old-secret")
+	newSecret = []byte("new-secret")
+	body      = []byte(`{"event":"user.upgraded","data":{"user_id":"3311741c-680c-4546-99f3-fc9efac2036c"}}`)
+)
+
+func newTestVerifier(now time.Time, secrets ...[]byte) *Verifier {
+	v := NewVerifier(secrets, time.Minute*5)
+	v.Now = func() time.Time { return now }
+	return v
+}
+
+func signedHeader(secret []byte, timestamp time.Time, body []byte) http.Header {
+	header := http.Header{}
+	SetHeaders(header, secret, timestamp, body)
+	return header
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	v := newTestVerifier(now, newSecret, oldSecret)
+
+	tests := []struct {
+		name   string
+		header http.Header
+		body   []byte
+		want   error
+	}{
+		{"signed with the new secret", signedHeader(newSecret, now, body), body, nil},
+		{"signed with the old secret", signedHeader(oldSecret, now, body), body, nil},
+		{"inside the tolerance", signedHeader(newSecret, now.Add(-time.Minute*4), body), body, nil},
+		{"clock a bit ahead", signedHeader(newSecret, now.Add(time.Minute*4), body), body, nil},
+		{"unknown secret", signedHeader([]byte("other"), now, body), body, ErrInvalidSignature},
+		{"body changed", signedHeader(newSecret, now, body), []byte(`{"event":"user.upgraded"}`), ErrInvalidSignature},
+		{"replayed later", signedHeader(newSecret, now.Add(-time.Minute*6), body), body, ErrInvalidTimestamp},
+		{"too far in the future", signedHeader(newSecret, now.Add(time.Minute*6), body), body, ErrInvalidTimestamp},
+		{"no headers", http.Header{}, body, ErrMissingSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := v.Verify(tt.header, tt.body); !errors.Is(err, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestVerifyTimestampIsSigned(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	v := newTestVerifier(now, newSecret)
+
+	// an old delivery with a fresh timestamp header
+	header := signedHeader(newSecret, now.Add(-time.Hour), body)
+	header.Set(TimestampHeader, strconv.FormatInt(now.Unix(), 10))
+	if err := v.Verify(header, body); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("expected ErrInvalidSignature, got %v", err)
+	}
+}
+
+func TestVerifyMultipleSignatures(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	v := newTestVerifier(now, newSecret)
+
+	header := http.Header{}
+	header.Set(TimestampHeader, strconv.FormatInt(now.Unix(), 10))
+	header.Set(SignatureHeader, "v1=zz v0=abc "+Sign(oldSecret, now, body)+" "+Sign(newSecret, now, body))
+	if err := v.Verify(header, body); err != nil {
+		t.Errorf("expected the signature with the new secret to be accepted, got %v", err)
+	}
+
+	header.Set(SignatureHeader, "v1=zz v0=abc "+Sign(oldSecret, now, body))
+	if err := v.Verify(header, body); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("expected ErrInvalidSignature, got %v", err)
+	}
+}
+
+func TestSign(t *testing.T) {
+	// same as: printf '1700000000.{}' | openssl dgst -sha256 -hmac secret
+	got := Sign([]byte("secret"), time.Unix(1_700_000_000, 0), []byte("{}"))
+	want := "v1=b8569b78799ff9e3cbff0fc2d63a33a2b57f3282abd07c37ae5e8e7d79a5f163"
+	if got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,44 @@
+-- name: CreateAccessToken :one
+INSERT INTO access_tokens(
+    jti,
+    created_at,
+    user_id,
+    refresh_token,
+    expires_at
+) VALUES (
+    $1,
+    NOW(),
+    $2,
+    $3,
+    $4
+)
+RETURNING *;
+
+-- name: DenyAccessTokensFromRefreshToken :many
+INSERT INTO access_token_denylist(jti, created_at, expires_at)
+SELECT jti, NOW(), expires_at FROM access_tokens
+WHERE refresh_token = $1 AND expires_at > NOW()
+ON CONFLICT (jti) DO NOTHING
+RETURNING jti, expires_at;
+
+-- name: DenyAccessTokensFromUser :many
+INSERT INTO access_token_denylist(jti, created_at, expires_at)
+SELECT jti, NOW(), expires_at FROM access_tokens
+WHERE user_id = $1 AND jti <> @keep_jti::text AND expires_at > NOW()
+ON CONFLICT (jti) DO NOTHING
+RETURNING jti, expires_at;
+
+-- name: IsAccessTokenDenied :one
+SELECT EXISTS(
+    SELECT 1 FROM access_token_denylist
+    WHERE jti = $1
+);
+
+-- name: DeleteExpiredAccessTokens :execrows
+DELETE FROM access_tokens
+WHERE expires_at < NOW();
+
+-- name: DeleteExpiredDeniedAccessTokens :execrows
+-- An expired token is rejected on its own, it doesn't need the denylist.
+DELETE FROM access_token_denylist
+WHERE expires_at < NOW();
@@ -0,0 +1,43 @@
+-- name: CreateAPIToken :one
+INSERT INTO api_tokens(
+    id,
+    created_at,
+    user_id,
+    name,
+    token_hash,
+    scopes,
+    expires_at
+) VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5
+)
+RETURNING *;
+
+-- name: GetAPITokensFromUser :many
+SELECT * FROM api_tokens
+WHERE user_id = $1 AND revoked_at IS NULL
+ORDER BY created_at DESC;
+
+-- name: RevokeAPIToken :execrows
+UPDATE api_tokens
+    SET revoked_at = NOW()
+    WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL;
+
+-- name: UseAPIToken :one
+-- Only live tokens of users that can still log in, it also marks the token as
+-- used.
+UPDATE api_tokens
+    SET last_used_at = NOW()
+    FROM users
+    WHERE api_tokens.token_hash = $1
+    AND api_tokens.revoked_at IS NULL
+    AND api_tokens.expires_at > NOW()
+    AND users.id = api_tokens.user_id
+    AND users.suspended_at IS NULL
+    AND users.deleted_at IS NULL
+RETURNING api_tokens.*;
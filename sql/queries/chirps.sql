@@ -24,18 +24,22 @@ WHERE user_id = $1 AND id = $2
 RETURNING *;
 
 -- name: GetAllChirps :many
-SELECT * FROM chirps
+SELECT * FROM chirps_with_authors
 ORDER BY 
 CASE WHEN UPPER(@sort_order::text) = 'ASC' THEN created_at END ASC,
 CASE WHEN UPPER(@sort_order::text) = 'DESC' THEN created_at END DESC;
 
 -- name: GetAllChirpsFromUser :many
-SELECT * FROM chirps
+SELECT * FROM chirps_with_authors
 WHERE user_id = $1
 ORDER BY 
 CASE WHEN UPPER(@sort_order::text) = 'ASC' THEN created_at END ASC,
 CASE WHEN UPPER(@sort_order::text) = 'DESC' THEN created_at END DESC;
 
 -- name: GetChirp :one
-SELECT * FROM chirps
+SELECT * FROM chirps_with_authors
 WHERE id = $1 LIMIT 1;
+
+-- name: CountChirpsFromUserSince :one
+SELECT COUNT(*) FROM chirps
+WHERE user_id = $1 AND created_at > $2;
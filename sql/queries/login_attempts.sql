@@ -0,0 +1,36 @@
+-- name: DeleteLoginAttempts :exec
+DELETE FROM login_attempts
+WHERE key = $1;
+
+-- name: GetLoginAttempts :one
+SELECT * FROM login_attempts
+WHERE key = $1 LIMIT 1;
+
+-- name: LockLoginAttempts :exec
+UPDATE login_attempts
+    SET locked_until = $2
+    WHERE key = $1;
+
+-- name: RecordLoginFailure :one
+INSERT INTO login_attempts(
+    key,
+    failures,
+    last_failure_at
+) VALUES (
+    @key,
+    1,
+    @now::timestamp
+)
+ON CONFLICT (key) DO UPDATE
+    SET failures = CASE
+        WHEN login_attempts.last_failure_at < @window_start::timestamp THEN 1
+        ELSE login_attempts.failures + 1
+    END,
+    last_failure_at = @now::timestamp
+RETURNING *;
+
+-- name: DeleteStaleLoginAttempts :execrows
+-- Attempts whose failures are all out of the window and that aren't locked.
+DELETE FROM login_attempts
+WHERE last_failure_at < @window_start::timestamp
+    AND (locked_until IS NULL OR locked_until < @window_start::timestamp);
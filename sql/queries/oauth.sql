@@ -0,0 +1,121 @@
+-- name: CreateOAuthClient :one
+INSERT INTO oauth_clients(
+    id,
+    created_at,
+    user_id,
+    name,
+    secret_hash,
+    redirect_uris,
+    scopes
+) VALUES (
+    $1,
+    NOW(),
+    $2,
+    $3,
+    $4,
+    $5,
+    $6
+)
+RETURNING *;
+
+-- name: GetOAuthClient :one
+SELECT * FROM oauth_clients
+WHERE id = $1 LIMIT 1;
+
+-- name: GetOAuthClientsFromUser :many
+SELECT * FROM oauth_clients
+WHERE user_id = $1
+ORDER BY created_at DESC;
+
+-- name: DeleteOAuthClient :execrows
+DELETE FROM oauth_clients
+WHERE id = $1 AND user_id = $2;
+
+-- name: CreateOAuthCode :exec
+INSERT INTO oauth_codes(
+    code_hash,
+    created_at,
+    client_id,
+    user_id,
+    redirect_uri,
+    scopes,
+    code_challenge,
+    expires_at
+) VALUES (
+    $1,
+    NOW(),
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7
+);
+
+-- name: UseOAuthCode :one
+UPDATE oauth_codes
+    SET used_at = NOW()
+    WHERE code_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+RETURNING *;
+
+-- name: CreateOAuthRefreshToken :one
+INSERT INTO refresh_tokens(
+    token,
+    created_at,
+    updated_at,
+    user_id,
+    expires_at,
+    client_id,
+    scopes
+) VALUES (
+    $1,
+    NOW(),
+    NOW(),
+    $2,
+    $3,
+    $4,
+    $5
+)
+RETURNING *;
+
+-- name: DenyAccessToken :exec
+INSERT INTO access_token_denylist(jti, created_at, expires_at)
+VALUES ($1, NOW(), $2)
+ON CONFLICT (jti) DO NOTHING;
+
+-- name: DeleteExpiredOAuthCodes :execrows
+DELETE FROM oauth_codes
+WHERE expires_at < NOW();
+
+-- name: RevokeOAuthRefreshToken :execrows
+-- Only if it isn't revoked yet, so a refresh token is rotated at most once.
+UPDATE refresh_tokens
+    SET revoked_at = NOW(),
+    updated_at = NOW()
+    WHERE token = $1 AND revoked_at IS NULL;
+
+-- name: RevokeOAuthRefreshTokensFromClient :exec
+UPDATE refresh_tokens
+    SET revoked_at = NOW(),
+    updated_at = NOW()
+    WHERE client_id = $1 AND user_id = $2 AND revoked_at IS NULL;
+
+-- name: DenyAllAccessTokensFromClient :many
+-- Every live access token of the client, for every user, if "user_id" owns it.
+INSERT INTO access_token_denylist(jti, created_at, expires_at)
+SELECT access_tokens.jti, NOW(), access_tokens.expires_at FROM access_tokens
+JOIN refresh_tokens ON refresh_tokens.token = access_tokens.refresh_token
+JOIN oauth_clients ON oauth_clients.id = refresh_tokens.client_id
+WHERE oauth_clients.id = $1 AND oauth_clients.user_id = $2
+    AND access_tokens.expires_at > NOW()
+ON CONFLICT (jti) DO NOTHING
+RETURNING jti, expires_at;
+
+-- name: DenyAccessTokensFromClient :many
+INSERT INTO access_token_denylist(jti, created_at, expires_at)
+SELECT access_tokens.jti, NOW(), access_tokens.expires_at FROM access_tokens
+JOIN refresh_tokens ON refresh_tokens.token = access_tokens.refresh_token
+WHERE refresh_tokens.client_id = $1 AND refresh_tokens.user_id = $2
+    AND access_tokens.expires_at > NOW()
+ON CONFLICT (jti) DO NOTHING
+RETURNING jti, expires_at;
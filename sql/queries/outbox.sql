@@ -0,0 +1,53 @@
+-- name: CreateOutboxEvent :exec
+-- Meant to be run in the transaction of the change the event is about.
+INSERT INTO outbox(
+    id,
+    created_at,
+    event_type,
+    user_id,
+    payload,
+    next_attempt_at
+) VALUES (
+    $1,
+    NOW(),
+    $2,
+    $3,
+    $4,
+    NOW()
+);
+
+-- name: ClaimOutboxEvents :many
+-- Lock the unpublished events that are due until "locked_until", oldest
+-- first, SKIP LOCKED lets every instance claim a different batch.
+UPDATE outbox
+    SET locked_until = @locked_until::timestamp
+    WHERE outbox.id IN (
+        SELECT due.id FROM outbox AS due
+        WHERE due.published_at IS NULL
+            AND due.next_attempt_at <= NOW()
+            AND (due.locked_until IS NULL OR due.locked_until <= NOW())
+        ORDER BY due.created_at
+        LIMIT @batch_size
+        FOR UPDATE SKIP LOCKED
+    )
+RETURNING *;
+
+-- name: MarkOutboxEventPublished :exec
+UPDATE outbox
+    SET published_at = NOW(),
+    attempts = attempts + 1,
+    locked_until = NULL,
+    last_error = NULL
+    WHERE id = $1;
+
+-- name: RecordOutboxEventFailure :exec
+UPDATE outbox
+    SET attempts = attempts + 1,
+    next_attempt_at = $2,
+    locked_until = NULL,
+    last_error = $3
+    WHERE id = $1;
+
+-- name: DeletePublishedOutboxEvents :execrows
+DELETE FROM outbox
+WHERE published_at < @published_before::timestamp;
@@ -0,0 +1,69 @@
+-- name: CreatePasskey :one
+INSERT INTO passkeys(
+    id,
+    created_at,
+    user_id,
+    name,
+    public_key,
+    attestation_type,
+    aaguid,
+    sign_count,
+    transports,
+    backup_eligible,
+    backup_state
+) VALUES (
+    $1,
+    NOW(),
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    $8,
+    $9,
+    $10
+)
+RETURNING *;
+
+-- name: GetPasskeysFromUser :many
+SELECT * FROM passkeys
+WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: UsePasskey :exec
+UPDATE passkeys
+    SET sign_count = $2,
+    backup_state = $3,
+    last_used_at = NOW()
+    WHERE id = $1;
+
+-- name: DeletePasskey :execrows
+DELETE FROM passkeys
+WHERE id = $1 AND user_id = $2;
+
+-- name: CreateWebAuthnSession :one
+INSERT INTO webauthn_sessions(
+    id,
+    created_at,
+    user_id,
+    data,
+    expires_at
+) VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3
+)
+RETURNING id;
+
+-- name: UseWebAuthnSession :one
+-- A session can only be used once, it's deleted even when it's expired.
+DELETE FROM webauthn_sessions
+WHERE id = $1
+RETURNING *;
+
+-- name: DeleteExpiredWebAuthnSessions :exec
+DELETE FROM webauthn_sessions
+WHERE expires_at < NOW();
@@ -26,3 +26,24 @@ UPDATE refresh_tokens
     SET revoked_at = NOW(),
     updated_at = NOW()
     WHERE token = $1;
+
+-- name: RevokeAllRefreshTokensFromUser :exec
+UPDATE refresh_tokens
+    SET revoked_at = NOW(),
+    updated_at = NOW()
+    WHERE user_id = $1 AND revoked_at IS NULL;
+
+-- name: RevokeOtherRefreshTokensFromUser :exec
+UPDATE refresh_tokens
+    SET revoked_at = NOW(),
+    updated_at = NOW()
+    WHERE refresh_tokens.user_id = $1 AND revoked_at IS NULL
+    AND token IS DISTINCT FROM (
+        SELECT refresh_token FROM access_tokens
+        WHERE jti = @keep_jti::text
+    );
+
+-- name: GetRefreshTokensFromUser :many
+SELECT * FROM refresh_tokens
+WHERE user_id = $1
+ORDER BY created_at DESC;
@@ -0,0 +1,92 @@
+-- name: StartSubscription :one
+-- Fails with no rows when the user doesn't exist.
+WITH upgraded AS (
+    UPDATE users
+        SET is_chirpy_red = TRUE,
+        updated_at = NOW()
+        WHERE users.id = @user_id
+    RETURNING users.id
+)
+INSERT INTO subscriptions(
+    id,
+    created_at,
+    updated_at,
+    user_id,
+    plan,
+    status,
+    started_at,
+    current_period_end
+)
+SELECT
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    upgraded.id,
+    @plan,
+    'active',
+    NOW(),
+    @current_period_end
+FROM upgraded
+RETURNING *;
+
+-- name: GetLiveSubscription :one
+SELECT * FROM subscriptions
+WHERE user_id = $1 AND status IN ('active', 'past_due');
+
+-- name: GetSubscriptionsFromUser :many
+SELECT * FROM subscriptions
+WHERE user_id = $1
+ORDER BY started_at;
+
+-- name: RenewSubscription :one
+UPDATE subscriptions
+    SET status = 'active',
+    plan = $2,
+    current_period_end = $3,
+    grace_until = NULL,
+    updated_at = NOW()
+    WHERE id = $1
+RETURNING *;
+
+-- name: MarkSubscriptionPastDue :one
+-- Failing again while past due doesn't extend the grace period.
+UPDATE subscriptions
+    SET status = 'past_due',
+    grace_until = COALESCE(grace_until, $2),
+    updated_at = NOW()
+    WHERE id = $1
+RETURNING *;
+
+-- name: CancelSubscription :one
+WITH canceled AS (
+    UPDATE subscriptions
+        SET status = 'canceled',
+        ended_at = NOW(),
+        updated_at = NOW()
+        WHERE subscriptions.id = @id
+    RETURNING subscriptions.user_id
+)
+UPDATE users
+    SET is_chirpy_red = FALSE,
+    updated_at = NOW()
+    WHERE users.id IN (SELECT user_id FROM canceled)
+RETURNING users.id;
+
+-- name: ExpireLapsedSubscriptions :many
+-- Active subscriptions whose period ended before "lapsed_before" (now minus
+-- the grace period) without a renewal, and past due ones whose grace period
+-- is over.
+WITH expired AS (
+    UPDATE subscriptions
+        SET status = 'expired',
+        ended_at = NOW(),
+        updated_at = NOW()
+        WHERE (subscriptions.status = 'active' AND subscriptions.current_period_end < @lapsed_before)
+        OR (subscriptions.status = 'past_due' AND subscriptions.grace_until < NOW())
+    RETURNING subscriptions.user_id
+)
+UPDATE users
+    SET is_chirpy_red = FALSE,
+    updated_at = NOW()
+    WHERE users.id IN (SELECT user_id FROM expired)
+RETURNING users.id;
@@ -0,0 +1,18 @@
+-- name: CreateUserIdentity :exec
+INSERT INTO user_identities(
+    issuer,
+    subject,
+    created_at,
+    user_id,
+    email
+) VALUES (
+    $1,
+    $2,
+    NOW(),
+    $3,
+    $4
+);
+
+-- name: GetUserIDByIdentity :one
+SELECT user_id FROM user_identities
+WHERE issuer = $1 AND subject = $2;
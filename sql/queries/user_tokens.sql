@@ -0,0 +1,24 @@
+-- name: CreateUserToken :exec
+INSERT INTO user_tokens(
+    token_hash,
+    created_at,
+    user_id,
+    purpose,
+    expires_at
+) VALUES (
+    $1,
+    NOW(),
+    $2,
+    $3,
+    $4
+);
+
+-- name: DeleteUserTokensFromUser :exec
+DELETE FROM user_tokens
+WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL;
+
+-- name: UseUserToken :one
+UPDATE user_tokens
+    SET used_at = NOW()
+    WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW()
+RETURNING user_id;
@@ -23,15 +23,119 @@ WHERE email = $1 LIMIT 1;
 
 -- name: UpdateUser :one
 UPDATE users
-    SET email = $2,
-    hashed_password = $3,
+    SET email = COALESCE(sqlc.narg('email')::text, email),
+    hashed_password = COALESCE(sqlc.narg('hashed_password')::text, hashed_password),
+    email_verified_at = CASE
+        WHEN sqlc.narg('email')::text IS NULL OR sqlc.narg('email')::text = email THEN email_verified_at
+        ELSE NULL
+    END,
+    username = COALESCE(sqlc.narg('username')::text, username),
+    display_name = COALESCE(sqlc.narg('display_name')::text, display_name),
+    bio = COALESCE(sqlc.narg('bio')::text, bio),
+    avatar = COALESCE(sqlc.narg('avatar')::text, avatar),
     updated_at = NOW()
-    WHERE id = $1 
-RETURNING id, created_at, updated_at, email, is_chirpy_red;
+    WHERE id = @id
+RETURNING *;
 
--- name: UpgradeUserToChirpyRedByID :one
+-- name: SuspendUserByID :one
 UPDATE users
-    SET is_chirpy_red = TRUE,
+    SET suspended_at = NOW(),
     updated_at = NOW()
     WHERE id = $1
 RETURNING id, created_at, updated_at, email, is_chirpy_red;
+
+-- name: UpdateUserPassword :exec
+UPDATE users
+    SET hashed_password = $2,
+    updated_at = NOW()
+    WHERE id = $1;
+
+-- name: GetUserByID :one
+SELECT * FROM users
+WHERE id = $1 LIMIT 1;
+
+-- name: SetUserTOTPSecret :exec
+UPDATE users
+    SET totp_secret = $2,
+    totp_enabled_at = NULL,
+    totp_last_step = NULL,
+    updated_at = NOW()
+    WHERE id = $1;
+
+-- name: EnableUserTOTP :exec
+UPDATE users
+    SET totp_enabled_at = NOW(),
+    totp_last_step = $2,
+    updated_at = NOW()
+    WHERE id = $1;
+
+-- name: DisableUserTOTP :exec
+UPDATE users
+    SET totp_secret = NULL,
+    totp_enabled_at = NULL,
+    totp_last_step = NULL,
+    updated_at = NOW()
+    WHERE id = $1;
+
+-- name: UseUserTOTPStep :execrows
+UPDATE users
+    SET totp_last_step = $2
+    WHERE id = $1 AND (totp_last_step IS NULL OR totp_last_step < $2);
+
+-- name: VerifyUserEmail :exec
+UPDATE users
+    SET email_verified_at = NOW(),
+    updated_at = NOW()
+    WHERE id = $1;
+
+-- name: SoftDeleteUser :exec
+UPDATE users
+    SET deleted_at = NOW(),
+    purge_after = $2,
+    updated_at = NOW()
+    WHERE id = $1;
+
+-- name: RestoreUser :exec
+UPDATE users
+    SET deleted_at = NULL,
+    purge_after = NULL,
+    updated_at = NOW()
+    WHERE id = $1;
+
+-- name: PurgeDeletedUsers :execrows
+DELETE FROM users
+WHERE deleted_at IS NOT NULL AND purge_after < NOW();
+
+-- name: GetUserProfileByUsername :one
+SELECT
+    id,
+    created_at,
+    username,
+    display_name,
+    bio,
+    avatar,
+    is_chirpy_red,
+    (SELECT COUNT(*) FROM chirps WHERE chirps.user_id = users.id) AS chirp_count,
+    (SELECT COUNT(*) FROM follows WHERE follows.followee_id = users.id) AS follower_count,
+    (SELECT COUNT(*) FROM follows WHERE follows.follower_id = users.id) AS following_count
+FROM users
+WHERE LOWER(username) = LOWER(@username::text) AND deleted_at IS NULL
+LIMIT 1;
+
+-- name: SetUserRole :one
+UPDATE users
+    SET role = $2,
+    updated_at = NOW()
+    WHERE id = $1
+RETURNING *;
+
+-- name: SetUserRoleByEmail :one
+UPDATE users
+    SET role = $2,
+    updated_at = NOW()
+    WHERE email = $1
+RETURNING *;
+
+-- name: CountUsersWithRole :one
+SELECT COUNT(*) FROM users
+WHERE role = $1;
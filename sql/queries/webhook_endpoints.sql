@@ -0,0 +1,163 @@
+-- name: CreateWebhookEndpoint :one
+INSERT INTO webhook_endpoints(
+    id,
+    created_at,
+    user_id,
+    url,
+    secret,
+    events,
+    all_users
+) VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5
+)
+RETURNING *;
+
+-- name: GetWebhookEndpoint :one
+SELECT * FROM webhook_endpoints
+WHERE id = $1 AND user_id = $2;
+
+-- name: GetWebhookEndpointsFromUser :many
+SELECT * FROM webhook_endpoints
+WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: DeleteWebhookEndpoint :execrows
+DELETE FROM webhook_endpoints
+WHERE id = $1 AND user_id = $2;
+
+-- name: EnqueueWebhookDeliveries :execrows
+-- Queue a delivery of the event to every endpoint of the user or for every
+-- user that wants its type, an event already queued isn't queued again.
+-- Endpoints for every user only get it while their owner is still an admin
+-- that isn't suspended or deleted.
+INSERT INTO webhook_deliveries(
+    id,
+    created_at,
+    endpoint_id,
+    event_id,
+    event_type,
+    payload,
+    next_attempt_at
+)
+SELECT
+    gen_random_uuid(),
+    NOW(),
+    webhook_endpoints.id,
+    @event_id::uuid,
+    @event_type::text,
+    @payload::jsonb,
+    NOW()
+FROM webhook_endpoints
+JOIN users ON users.id = webhook_endpoints.user_id
+WHERE (
+        webhook_endpoints.user_id = @user_id::uuid
+        OR (
+            webhook_endpoints.all_users
+            AND users.role = 'admin'
+            AND users.suspended_at IS NULL
+            AND users.deleted_at IS NULL
+        )
+    )
+    AND (cardinality(webhook_endpoints.events) = 0 OR @event_type::text = ANY(webhook_endpoints.events))
+ON CONFLICT (endpoint_id, event_id) DO NOTHING;
+
+-- name: ClaimWebhookDeliveries :many
+-- Lock the due deliveries until "locked_until", SKIP LOCKED lets every
+-- instance claim a different batch.
+WITH claimed AS (
+    UPDATE webhook_deliveries
+        SET locked_until = @locked_until::timestamp
+        WHERE webhook_deliveries.id IN (
+            SELECT due.id FROM webhook_deliveries AS due
+            WHERE due.status = 'pending'
+                AND due.next_attempt_at <= NOW()
+                AND (due.locked_until IS NULL OR due.locked_until <= NOW())
+            ORDER BY due.next_attempt_at
+            LIMIT @batch_size
+            FOR UPDATE SKIP LOCKED
+        )
+    RETURNING
+        webhook_deliveries.id,
+        webhook_deliveries.endpoint_id,
+        webhook_deliveries.event_id,
+        webhook_deliveries.event_type,
+        webhook_deliveries.payload,
+        webhook_deliveries.status,
+        webhook_deliveries.attempts,
+        webhook_deliveries.next_attempt_at
+)
+SELECT
+    claimed.id,
+    claimed.endpoint_id,
+    claimed.event_id,
+    claimed.event_type,
+    claimed.payload,
+    claimed.status,
+    claimed.attempts,
+    claimed.next_attempt_at,
+    webhook_endpoints.url,
+    webhook_endpoints.secret
+FROM claimed
+JOIN webhook_endpoints ON webhook_endpoints.id = claimed.endpoint_id
+ORDER BY claimed.next_attempt_at;
+
+-- name: RecordWebhookDeliveryAttempt :exec
+-- Log the attempt and save the outcome on the delivery.
+WITH attempt AS (
+    INSERT INTO webhook_delivery_attempts(
+        id,
+        delivery_id,
+        attempted_at,
+        status_code,
+        error,
+        duration_ms
+    ) VALUES (
+        gen_random_uuid(),
+        @id,
+        @attempted_at::timestamp,
+        @status_code,
+        @error,
+        @duration_ms
+    )
+)
+UPDATE webhook_deliveries
+    SET status = @status::text,
+    attempts = @attempts,
+    next_attempt_at = @next_attempt_at,
+    locked_until = NULL,
+    last_status_code = @status_code,
+    last_error = @error,
+    delivered_at = CASE WHEN @status::text = 'delivered' THEN @attempted_at::timestamp ELSE NULL END
+    WHERE webhook_deliveries.id = @id;
+
+-- name: GetWebhookDelivery :one
+SELECT * FROM webhook_deliveries
+WHERE id = $1 AND endpoint_id = $2;
+
+-- name: GetWebhookDeliveries :many
+SELECT * FROM webhook_deliveries
+WHERE endpoint_id = $1
+    AND (sqlc.narg('status')::text IS NULL OR status = sqlc.narg('status')::text)
+ORDER BY created_at DESC
+LIMIT $2;
+
+-- name: GetWebhookDeliveryAttempts :many
+SELECT * FROM webhook_delivery_attempts
+WHERE delivery_id = $1
+ORDER BY attempted_at;
+
+-- name: RetryWebhookDelivery :one
+-- Send a dead delivery again, its attempts start over.
+UPDATE webhook_deliveries
+    SET status = 'pending',
+    attempts = 0,
+    next_attempt_at = NOW(),
+    locked_until = NULL
+    WHERE id = $1 AND endpoint_id = $2 AND status = 'dead'
+RETURNING *;
@@ -0,0 +1,57 @@
+-- name: RecordWebhookEvent :one
+-- A retry of an event already recorded only counts the attempt, the caller
+-- checks the status to know if it was already processed.
+INSERT INTO webhook_events(
+    id,
+    source,
+    event_id,
+    event_type,
+    payload,
+    received_at
+) VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    $3,
+    $4,
+    NOW()
+)
+ON CONFLICT (source, event_id) DO UPDATE
+    SET attempts = webhook_events.attempts + 1
+RETURNING *;
+
+-- name: ClaimWebhookEvent :one
+-- Meant to be run in the transaction processing the event, the row stays
+-- locked until it ends so a concurrent delivery or replay waits and then
+-- claims nothing, unless the processing was rolled back.
+UPDATE webhook_events
+    SET status = 'processing'
+    WHERE id = $1 AND status IN ('received', 'failed')
+RETURNING *;
+
+-- name: FinishWebhookEvent :one
+UPDATE webhook_events
+    SET status = $2,
+    error = $3,
+    processed_at = NOW()
+    WHERE id = $1
+RETURNING *;
+
+-- name: FailWebhookEvent :one
+-- Unless a concurrent delivery or replay processed it in the meantime.
+UPDATE webhook_events
+    SET status = 'failed',
+    error = $2,
+    processed_at = NOW()
+    WHERE id = $1 AND status IN ('received', 'failed')
+RETURNING *;
+
+-- name: GetWebhookEvent :one
+SELECT * FROM webhook_events
+WHERE id = $1;
+
+-- name: GetWebhookEvents :many
+SELECT * FROM webhook_events
+WHERE sqlc.narg('status')::text IS NULL OR status = sqlc.narg('status')::text
+ORDER BY received_at DESC
+LIMIT $1;
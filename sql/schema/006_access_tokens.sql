@@ -0,0 +1,17 @@
+-- +goose Up
+CREATE TABLE access_tokens(
+    jti TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    refresh_token TEXT REFERENCES refresh_tokens(token) ON DELETE CASCADE,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE access_token_denylist(
+    jti TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+-- +goose Down
+DROP TABLE access_token_denylist;
+DROP TABLE access_tokens;
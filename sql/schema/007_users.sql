@@ -0,0 +1,6 @@
+-- +goose Up
+ALTER TABLE users
+    ADD COLUMN suspended_at TIMESTAMP DEFAULT NULL;
+-- +goose Down
+ALTER TABLE users
+    DROP COLUMN suspended_at;
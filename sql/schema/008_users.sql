@@ -0,0 +1,10 @@
+-- +goose Up
+ALTER TABLE users
+    ADD COLUMN totp_secret BYTEA DEFAULT NULL,
+    ADD COLUMN totp_enabled_at TIMESTAMP DEFAULT NULL,
+    ADD COLUMN totp_last_step BIGINT DEFAULT NULL;
+-- +goose Down
+ALTER TABLE users
+    DROP COLUMN totp_last_step,
+    DROP COLUMN totp_enabled_at,
+    DROP COLUMN totp_secret;
@@ -0,0 +1,11 @@
+-- +goose Up
+CREATE TABLE recovery_codes(
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash TEXT NOT NULL,
+    used_at TIMESTAMP DEFAULT NULL,
+    UNIQUE(user_id, code_hash)
+);
+-- +goose Down
+DROP TABLE recovery_codes;
@@ -0,0 +1,6 @@
+-- +goose Up
+ALTER TABLE users
+    ADD COLUMN email_verified_at TIMESTAMP DEFAULT NULL;
+-- +goose Down
+ALTER TABLE users
+    DROP COLUMN email_verified_at;
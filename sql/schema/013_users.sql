@@ -0,0 +1,8 @@
+-- +goose Up
+ALTER TABLE users
+    ADD COLUMN deleted_at TIMESTAMP DEFAULT NULL,
+    ADD COLUMN purge_after TIMESTAMP DEFAULT NULL;
+-- +goose Down
+ALTER TABLE users
+    DROP COLUMN purge_after,
+    DROP COLUMN deleted_at;
@@ -0,0 +1,14 @@
+-- +goose Up
+ALTER TABLE users
+    ADD COLUMN username TEXT DEFAULT NULL,
+    ADD COLUMN display_name TEXT NOT NULL DEFAULT '',
+    ADD COLUMN bio TEXT NOT NULL DEFAULT '',
+    ADD COLUMN avatar TEXT NOT NULL DEFAULT '';
+CREATE UNIQUE INDEX users_username_lower_idx ON users (LOWER(username));
+-- +goose Down
+DROP INDEX users_username_lower_idx;
+ALTER TABLE users
+    DROP COLUMN avatar,
+    DROP COLUMN bio,
+    DROP COLUMN display_name,
+    DROP COLUMN username;
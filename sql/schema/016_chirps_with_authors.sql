@@ -0,0 +1,18 @@
+-- +goose Up
+-- chirps with the public fields of their author, chirps from deleted
+-- accounts are left out
+CREATE VIEW chirps_with_authors AS
+SELECT
+    chirps.id,
+    chirps.created_at,
+    chirps.updated_at,
+    chirps.body,
+    chirps.user_id,
+    users.username AS author_username,
+    users.display_name AS author_display_name,
+    users.avatar AS author_avatar
+FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE users.deleted_at IS NULL;
+-- +goose Down
+DROP VIEW chirps_with_authors;
@@ -0,0 +1,32 @@
+-- +goose Up
+CREATE TABLE oauth_clients(
+    id TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    secret_hash TEXT DEFAULT NULL,
+    redirect_uris TEXT[] NOT NULL,
+    scopes TEXT[] NOT NULL
+);
+
+CREATE TABLE oauth_codes(
+    code_hash TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    client_id TEXT NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    redirect_uri TEXT NOT NULL,
+    scopes TEXT[] NOT NULL,
+    code_challenge TEXT NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP DEFAULT NULL
+);
+
+ALTER TABLE refresh_tokens
+    ADD COLUMN client_id TEXT DEFAULT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    ADD COLUMN scopes TEXT[] DEFAULT NULL;
+-- +goose Down
+ALTER TABLE refresh_tokens
+    DROP COLUMN scopes,
+    DROP COLUMN client_id;
+DROP TABLE oauth_codes;
+DROP TABLE oauth_clients;
@@ -0,0 +1,27 @@
+-- +goose Up
+CREATE TABLE passkeys(
+    id BYTEA PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    public_key BYTEA NOT NULL,
+    attestation_type TEXT NOT NULL,
+    aaguid BYTEA NOT NULL,
+    sign_count BIGINT NOT NULL,
+    transports TEXT[] NOT NULL,
+    backup_eligible BOOLEAN NOT NULL,
+    backup_state BOOLEAN NOT NULL,
+    last_used_at TIMESTAMP
+);
+
+CREATE TABLE webauthn_sessions(
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    -- NULL for logins, the user is only known once the passkey answers
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    data BYTEA NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+-- +goose Down
+DROP TABLE webauthn_sessions;
+DROP TABLE passkeys;
@@ -0,0 +1,20 @@
+-- +goose Up
+CREATE TABLE webhook_events(
+    id UUID PRIMARY KEY,
+    -- who sent it, e.g. "polka"
+    source TEXT NOT NULL,
+    -- id given by the sender, the same on every retry
+    event_id TEXT NOT NULL,
+    event_type TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    received_at TIMESTAMP NOT NULL,
+    processed_at TIMESTAMP,
+    status TEXT NOT NULL DEFAULT 'received' CHECK (status IN ('received', 'processed', 'ignored', 'failed')),
+    error TEXT,
+    attempts INTEGER NOT NULL DEFAULT 1,
+    UNIQUE(source, event_id)
+);
+
+CREATE INDEX webhook_events_status_idx ON webhook_events(status, received_at);
+-- +goose Down
+DROP TABLE webhook_events;
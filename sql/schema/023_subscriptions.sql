@@ -0,0 +1,27 @@
+-- +goose Up
+CREATE TABLE subscriptions(
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    plan TEXT NOT NULL,
+    -- past_due keeps the perks until grace_until, canceled and expired are
+    -- kept as history
+    status TEXT NOT NULL CHECK (status IN ('active', 'past_due', 'canceled', 'expired')),
+    started_at TIMESTAMP NOT NULL,
+    current_period_end TIMESTAMP NOT NULL,
+    grace_until TIMESTAMP,
+    ended_at TIMESTAMP
+);
+
+-- a user has a single live subscription
+CREATE UNIQUE INDEX subscriptions_live_user_idx ON subscriptions(user_id)
+WHERE status IN ('active', 'past_due');
+
+-- members from before subscriptions get a period to be renewed by Polka
+INSERT INTO subscriptions(id, created_at, updated_at, user_id, plan, status, started_at, current_period_end)
+SELECT gen_random_uuid(), NOW(), NOW(), id, 'red', 'active', updated_at, NOW() + INTERVAL '30 days'
+FROM users
+WHERE is_chirpy_red;
+-- +goose Down
+DROP TABLE subscriptions;
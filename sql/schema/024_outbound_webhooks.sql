@@ -0,0 +1,54 @@
+-- +goose Up
+CREATE TABLE webhook_endpoints(
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    -- sealed with the MFA encryption key, the receiver needs it in clear to
+    -- verify the signatures so it can't be hashed
+    secret BYTEA NOT NULL,
+    -- events the endpoint wants, every event when empty
+    events TEXT[] NOT NULL,
+    -- only admins can register endpoints for the events of every user
+    all_users BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE INDEX webhook_endpoints_user_id_idx ON webhook_endpoints(user_id);
+
+CREATE TABLE webhook_deliveries(
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    endpoint_id UUID NOT NULL REFERENCES webhook_endpoints(id) ON DELETE CASCADE,
+    -- the same on every delivery of an event, sent on the Webhook-Id header
+    event_id UUID NOT NULL,
+    event_type TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    -- dead after failing too many times, it's only retried by hand
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'delivered', 'dead')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL,
+    -- claimed by a worker until then, so it isn't sent twice
+    locked_until TIMESTAMP,
+    last_status_code INTEGER,
+    last_error TEXT,
+    delivered_at TIMESTAMP
+);
+
+CREATE INDEX webhook_deliveries_due_idx ON webhook_deliveries(status, next_attempt_at);
+CREATE INDEX webhook_deliveries_endpoint_id_idx ON webhook_deliveries(endpoint_id, created_at);
+
+CREATE TABLE webhook_delivery_attempts(
+    id UUID PRIMARY KEY,
+    delivery_id UUID NOT NULL REFERENCES webhook_deliveries(id) ON DELETE CASCADE,
+    attempted_at TIMESTAMP NOT NULL,
+    -- NULL when no response was received
+    status_code INTEGER,
+    error TEXT,
+    duration_ms INTEGER NOT NULL
+);
+
+CREATE INDEX webhook_delivery_attempts_delivery_id_idx ON webhook_delivery_attempts(delivery_id, attempted_at);
+-- +goose Down
+DROP TABLE webhook_delivery_attempts;
+DROP TABLE webhook_deliveries;
+DROP TABLE webhook_endpoints;
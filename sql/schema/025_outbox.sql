@@ -0,0 +1,26 @@
+-- +goose Up
+CREATE TABLE outbox(
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    event_type TEXT NOT NULL,
+    -- user the event is about, no foreign key so deleting the user doesn't
+    -- drop its events before they're published
+    user_id UUID NOT NULL,
+    payload JSONB NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL,
+    -- claimed by a relay until then, so it isn't published twice at once
+    locked_until TIMESTAMP,
+    last_error TEXT,
+    published_at TIMESTAMP
+);
+
+CREATE INDEX outbox_unpublished_idx ON outbox(next_attempt_at) WHERE published_at IS NULL;
+CREATE INDEX outbox_published_at_idx ON outbox(published_at) WHERE published_at IS NOT NULL;
+
+-- the relay publishes at least once, a republished event mustn't be
+-- delivered to the same endpoint twice
+ALTER TABLE webhook_deliveries ADD CONSTRAINT webhook_deliveries_endpoint_event_key UNIQUE(endpoint_id, event_id);
+-- +goose Down
+ALTER TABLE webhook_deliveries DROP CONSTRAINT webhook_deliveries_endpoint_event_key;
+DROP TABLE outbox;
@@ -0,0 +1,7 @@
+-- +goose Up
+-- expired rows are pruned in the background
+CREATE INDEX access_tokens_expires_at_idx ON access_tokens(expires_at);
+CREATE INDEX access_token_denylist_expires_at_idx ON access_token_denylist(expires_at);
+-- +goose Down
+DROP INDEX access_token_denylist_expires_at_idx;
+DROP INDEX access_tokens_expires_at_idx;
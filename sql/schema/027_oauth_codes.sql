@@ -0,0 +1,5 @@
+-- +goose Up
+-- expired codes are pruned in the background
+CREATE INDEX oauth_codes_expires_at_idx ON oauth_codes(expires_at);
+-- +goose Down
+DROP INDEX oauth_codes_expires_at_idx;
@@ -0,0 +1,10 @@
+-- +goose Up
+-- "processing" is only set by the transaction processing the event
+ALTER TABLE webhook_events
+    DROP CONSTRAINT webhook_events_status_check,
+    ADD CONSTRAINT webhook_events_status_check CHECK (status IN ('received', 'processing', 'processed', 'ignored', 'failed'));
+-- +goose Down
+UPDATE webhook_events SET status = 'failed' WHERE status = 'processing';
+ALTER TABLE webhook_events
+    DROP CONSTRAINT webhook_events_status_check,
+    ADD CONSTRAINT webhook_events_status_check CHECK (status IN ('received', 'processed', 'ignored', 'failed'));
@@ -0,0 +1,5 @@
+-- +goose Up
+-- stale attempts are pruned in the background
+CREATE INDEX login_attempts_last_failure_at_idx ON login_attempts(last_failure_at);
+-- +goose Down
+DROP INDEX login_attempts_last_failure_at_idx;